@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/services"
+)
+
+type AccountHandler struct {
+	accounts *services.AccountService
+}
+
+func NewAccountHandler(accounts *services.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accounts: accounts,
+	}
+}
+
+// ForgotPassword handles POST /api/password/forgot
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		BadRequest(w, "email must be valid")
+		return
+	}
+
+	if err := h.accounts.RequestPasswordReset(email, preferredLanguage(r.Header.Get("Accept-Language"))); err != nil {
+		InternalServerError(w, "Failed to request password reset")
+		return
+	}
+
+	// Same answer whether or not the account exists
+	JSON(w, http.StatusAccepted, &models.MessageResponse{
+		Message: "If an account exists for that email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword handles POST /api/password/reset
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		BadRequest(w, "token is required")
+		return
+	}
+	password := strings.TrimSpace(req.Password)
+	if len(password) < 8 {
+		BadRequest(w, "password must be at least 8 characters")
+		return
+	}
+
+	user, err := h.accounts.ResetPassword(token, password, auditActor(r))
+	if err != nil {
+		if err == services.ErrInvalidToken {
+			Error(w, http.StatusBadRequest, "INVALID_TOKEN", "The reset link is invalid, expired or already used")
+			return
+		}
+		InternalServerError(w, "Failed to reset password")
+		return
+	}
+
+	JSON(w, http.StatusOK, userToResponse(user))
+}
+
+// VerifyEmail handles POST /api/email/verify
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		BadRequest(w, "token is required")
+		return
+	}
+
+	user, err := h.accounts.VerifyEmail(token)
+	if err != nil {
+		if err == services.ErrInvalidToken {
+			Error(w, http.StatusBadRequest, "INVALID_TOKEN", "The verification link is invalid, expired or already used")
+			return
+		}
+		InternalServerError(w, "Failed to verify email")
+		return
+	}
+
+	JSON(w, http.StatusOK, userToResponse(user))
+}
+
+// ResendVerification handles POST /api/email/resend
+func (h *AccountHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req models.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		BadRequest(w, "email must be valid")
+		return
+	}
+
+	if err := h.accounts.ResendVerification(email, preferredLanguage(r.Header.Get("Accept-Language"))); err != nil {
+		InternalServerError(w, "Failed to resend verification email")
+		return
+	}
+
+	JSON(w, http.StatusAccepted, &models.MessageResponse{
+		Message: "If that email belongs to an unverified account, a new verification link has been sent",
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+type AuditHandler struct {
+	audit *services.AuditService
+}
+
+func NewAuditHandler(audit *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		audit: audit,
+	}
+}
+
+// ListAuditLog handles GET /api/admin/audit. Filters: actorId, action,
+// entityType, entityId, from and to (RFC3339), before (entry ID) and limit.
+func (h *AuditHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &repositories.AuditFilter{
+		Action:     strings.ToUpper(strings.TrimSpace(query.Get("action"))),
+		EntityType: strings.ToLower(strings.TrimSpace(query.Get("entityType"))),
+		EntityID:   strings.TrimSpace(query.Get("entityId")),
+	}
+
+	var err error
+	if value := query.Get("actorId"); value != "" {
+		if filter.ActorUserID, err = strconv.Atoi(value); err != nil || filter.ActorUserID <= 0 {
+			BadRequest(w, "actorId must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("before"); value != "" {
+		if filter.Before, err = strconv.ParseInt(value, 10, 64); err != nil || filter.Before <= 0 {
+			BadRequest(w, "before must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 {
+			BadRequest(w, "limit must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "from must be an RFC3339 timestamp")
+			return
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "to must be an RFC3339 timestamp")
+			return
+		}
+		filter.To = &to
+	}
+
+	entries, err := h.audit.List(filter)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch audit log")
+		return
+	}
+
+	response := &models.AuditLogResponse{
+		Entries: make([]*models.AuditEntryResponse, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		response.Entries = append(response.Entries, auditEntryToResponse(entry))
+	}
+	if len(entries) == filter.Limit {
+		next := entries[len(entries)-1].ID
+		response.NextBefore = &next
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+func auditEntryToResponse(entry *models.AuditEntry) *models.AuditEntryResponse {
+	resp := &models.AuditEntryResponse{
+		ID:          entry.ID,
+		ActorUserID: entry.ActorUserID,
+		Action:      entry.Action,
+		EntityType:  entry.EntityType,
+		EntityID:    entry.EntityID,
+		RequestID:   entry.RequestID,
+		IPAddress:   entry.IPAddress,
+		CreatedAt:   entry.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	if entry.Before != "" {
+		resp.Before = json.RawMessage(entry.Before)
+	}
+	if entry.After != "" {
+		resp.After = json.RawMessage(entry.After)
+	}
+
+	return resp
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"strconv"
+	"strings"
 	"ticketbooth-backend/models"
 	"ticketbooth-backend/repositories"
 	"ticketbooth-backend/services"
@@ -16,12 +17,18 @@ import (
 type BookingHandler struct {
 	bookingService *services.BookingService
 	bookingRepo    *repositories.BookingRepository
+	roleRepo       *repositories.RoleRepository
+	credentials    *services.CredentialService
+	documents      *services.DocumentService
 }
 
-func NewBookingHandler(bookingService *services.BookingService, bookingRepo *repositories.BookingRepository) *BookingHandler {
+func NewBookingHandler(bookingService *services.BookingService, bookingRepo *repositories.BookingRepository, roleRepo *repositories.RoleRepository, credentials *services.CredentialService, documents *services.DocumentService) *BookingHandler {
 	return &BookingHandler{
 		bookingService: bookingService,
 		bookingRepo:    bookingRepo,
+		roleRepo:       roleRepo,
+		credentials:    credentials,
+		documents:      documents,
 	}
 }
 
@@ -38,10 +45,22 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		BadRequest(w, "eventDateId is required")
 		return
 	}
+	req.CustomerName = strings.TrimSpace(req.CustomerName)
 	if req.CustomerName == "" {
 		BadRequest(w, "customerName is required")
 		return
 	}
+	if req.CustomerEmail != "" {
+		req.CustomerEmail = normalizeEmail(req.CustomerEmail)
+		if req.CustomerEmail == "" {
+			BadRequest(w, "customerEmail must be valid")
+			return
+		}
+	}
+	req.Locale = strings.TrimSpace(req.Locale)
+	if req.Locale == "" {
+		req.Locale = preferredLanguage(r.Header.Get("Accept-Language"))
+	}
 	if req.PaymentSource == "" {
 		BadRequest(w, "paymentSource is required")
 		return
@@ -50,6 +69,10 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		BadRequest(w, "userId is required")
 		return
 	}
+	if errMsg := normalizeAttendees(&req); errMsg != "" {
+		BadRequest(w, errMsg)
+		return
+	}
 
 	// Determine if GA or seated based on request
 	var response *models.BookingResponse
@@ -57,10 +80,10 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 
 	if len(req.Tiers) > 0 {
 		// GA booking
-		response, err = h.bookingService.BookGATickets(&req)
+		response, err = h.bookingService.BookGATickets(&req, auditActor(r))
 	} else if len(req.Seats) > 0 {
 		// Seated booking
-		response, err = h.bookingService.BookSeatedTickets(&req)
+		response, err = h.bookingService.BookSeatedTickets(&req, auditActor(r))
 	} else {
 		BadRequest(w, "Either tiers or seats must be provided")
 		return
@@ -80,6 +103,18 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 			NotFound(w, "Event date not found")
 			return
 		}
+		if err == services.ErrNotOnSale {
+			Conflict(w, "NOT_ON_SALE", "This event date is not on sale.")
+			return
+		}
+		if err == services.ErrSalesNotOpen {
+			Conflict(w, "SALES_NOT_OPEN", "Sales for this event date have not opened yet.")
+			return
+		}
+		if err == services.ErrSalesClosed {
+			Conflict(w, "SALES_CLOSED", "Sales for this event date have closed.")
+			return
+		}
 		InternalServerError(w, "Failed to create booking")
 		return
 	}
@@ -87,7 +122,7 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	JSON(w, http.StatusCreated, response)
 }
 
-// GetOrder handles GET /api/orders/:id
+// GetOrder handles GET /api/orders/:id for the order's owner or staff
 func (h *BookingHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
@@ -107,60 +142,62 @@ func (h *BookingHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert to response format
-	response := &models.OrderResponse{
-		ID:           order.ID,
-		CustomerName: "", // Will be set from first ticket's to_name
-		TotalAmount:  0,
-		Tickets:      []*models.OrderTicketResponse{},
+	// Another user's order looks the same as a missing one
+	allowed, err := ownerOrStaff(h.roleRepo, r, order.UserID)
+	if err != nil {
+		InternalServerError(w, "Failed to check permissions")
+		return
 	}
-
-	// Parse total amount
-	if order.Amount != "" {
-		if amount, err := strconv.ParseFloat(order.Amount, 64); err == nil {
-			response.TotalAmount = amount
-		}
+	if !allowed {
+		NotFound(w, "Order not found")
+		return
 	}
 
-	// Format created at
-	if order.CreatedAt != nil {
-		response.CreatedAt = order.CreatedAt.Format(time.RFC3339)
+	response := orderToResponse(order)
+	if err := h.attachCredentials(order, response); err != nil {
+		InternalServerError(w, "Failed to issue ticket credentials")
+		return
 	}
 
-	// Convert tickets
-	for _, ticket := range order.Tickets {
-		ticketResp := &models.OrderTicketResponse{
-			ID:         ticket.ID,
-			TicketType: "",
-		}
-
-		if ticket.TicketType != nil {
-			ticketResp.TicketType = ticket.TicketType.Name
-		}
-
-		if ticket.Seat != nil {
-			seatLabel := ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
-			ticketResp.SeatLabel = &seatLabel
-		}
+	JSON(w, http.StatusOK, response)
+}
 
-		// Get event info from ticket
-		if ticket.Event != nil {
-			ticketResp.EventTitle = ticket.Event.Title
-		}
+// GetOrderPDF handles GET /api/orders/:id/pdf (receipt plus printable tickets)
+// for the order's owner or staff
+func (h *BookingHandler) GetOrderPDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid order ID")
+		return
+	}
 
-		if ticket.EventDate != nil && ticket.EventDate.Date != nil {
-			ticketResp.EventDate = ticket.EventDate.Date.Format(time.RFC3339)
+	order, err := h.bookingRepo.GetOrderByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Order not found")
+			return
 		}
+		InternalServerError(w, "Failed to fetch order")
+		return
+	}
 
-		response.Tickets = append(response.Tickets, ticketResp)
+	allowed, err := ownerOrStaff(h.roleRepo, r, order.UserID)
+	if err != nil {
+		InternalServerError(w, "Failed to check permissions")
+		return
+	}
+	if !allowed {
+		NotFound(w, "Order not found")
+		return
+	}
 
-		// Set customer name from first ticket
-		if response.CustomerName == "" {
-			response.CustomerName = ticket.ToName
-		}
+	document, err := h.documents.RenderOrderPDF(order)
+	if err != nil {
+		InternalServerError(w, "Failed to render order PDF")
+		return
 	}
 
-	JSON(w, http.StatusOK, response)
+	PDF(w, fmt.Sprintf("order-%d.pdf", order.ID), document)
 }
 
 // get all user orders
@@ -181,105 +218,187 @@ func GetAllUserOrdersHandler(bookingRepo repositories.BookingRepository) http.Ha
 
 		var response []*models.OrderResponse
 		for _, order := range orders {
-			orderResp := &models.OrderResponse{
-				ID:           order.ID,
-				CustomerName: "",
-			}
-			if order.CreatedAt != nil {
-				orderResp.CreatedAt = order.CreatedAt.Format(time.RFC3339)
-			}
-
-			var tickets []*models.OrderTicketResponse
-			for _, ticket := range order.Tickets {
-				ticketResp := &models.OrderTicketResponse{
-					ID:         ticket.ID,
-					TicketType: "",
-				}
-				if ticket.TicketType != nil {
-					ticketResp.TicketType = ticket.TicketType.Name
-				}
-				if ticket.Seat != nil {
-					seatLabel := ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
-					ticketResp.SeatLabel = &seatLabel
-				}
-				if ticket.Event != nil {
-					ticketResp.EventTitle = ticket.Event.Title
-				}
-				if ticket.EventDate != nil && ticket.EventDate.Date != nil {
-					ticketResp.EventDate = ticket.EventDate.Date.Format(time.RFC3339)
-				}
-				tickets = append(tickets, ticketResp)
-				// Set customer name from first ticket
-				if orderResp.CustomerName == "" {
-					orderResp.CustomerName = ticket.ToName
-				}
-			}
-			orderResp.Tickets = tickets
-
-			response = append(response, orderResp)
+			response = append(response, orderToResponse(order))
 		}
 
 		JSON(w, http.StatusOK, response)
 	}
 }
 
-// GetOrders handles GET /api/orders?userId={id}
+// GetOrders handles GET /api/orders: the signed-in user's orders, newest
+// first, a page at a time (cursor and limit). userId is accepted for old
+// clients but must be the caller's own ID.
 func (h *BookingHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("userId")
-	if userID == "" {
-		BadRequest(w, "userId query parameter is required")
+	userID := authClaims(r).UserID
+	if value := r.URL.Query().Get("userId"); value != "" && value != strconv.Itoa(userID) {
+		Forbidden(w, "FORBIDDEN", "You can only list your own orders")
+		return
+	}
+
+	filter := &repositories.OrderFilter{UserID: userID, Sort: repositories.OrderSortCreatedAt}
+	if errMsg := parseOrderPage(r, filter); errMsg != "" {
+		BadRequest(w, errMsg)
 		return
 	}
 
-	orders, err := h.bookingRepo.GetAllOrdersByUserID(userID)
+	orders, err := h.bookingRepo.ListOrders(filter)
 	if err != nil {
 		InternalServerError(w, "Failed to fetch orders")
 		return
 	}
 
-	var response []*models.OrderResponse
+	response := &models.OrderListResponse{
+		Orders: make([]*models.OrderResponse, 0, len(orders)),
+	}
 	for _, order := range orders {
-		resp := &models.OrderResponse{
-			ID:           order.ID,
-			CustomerName: "",
+		resp := orderToResponse(order)
+		if err := h.attachCredentials(order, resp); err != nil {
+			InternalServerError(w, "Failed to issue ticket credentials")
+			return
 		}
-		if order.CreatedAt != nil {
-			resp.CreatedAt = order.CreatedAt.Format(time.RFC3339)
+		response.Orders = append(response.Orders, resp)
+	}
+	response.NextCursor = nextOrderCursor(filter, orders)
+
+	JSON(w, http.StatusOK, response)
+}
+
+// attachCredentials signs the QR credential for every ticket in an order response,
+// loading each event's active key only once
+func (h *BookingHandler) attachCredentials(order *models.Order, resp *models.OrderResponse) error {
+	keys := make(map[int]*models.SigningKey)
+
+	for i, ticket := range order.Tickets {
+		if ticket.CredentialNonce == "" || ticket.Event == nil || ticket.RefundedAt != nil {
+			continue
 		}
-		if order.Amount != "" {
-			if amount, err := strconv.ParseFloat(order.Amount, 64); err == nil {
-				resp.TotalAmount = amount
+
+		key, found := keys[ticket.Event.ID]
+		if !found {
+			var err error
+			key, err = h.credentials.ActiveKey(ticket.Event.ID)
+			if err != nil {
+				return err
 			}
+			keys[ticket.Event.ID] = key
 		}
 
-		var tickets []*models.OrderTicketResponse
-		for _, ticket := range order.Tickets {
-			ticketResp := &models.OrderTicketResponse{
-				ID:         ticket.ID,
-				TicketType: "",
-			}
-			if ticket.TicketType != nil {
-				ticketResp.TicketType = ticket.TicketType.Name
-			}
-			if ticket.Seat != nil {
-				seatLabel := ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
-				ticketResp.SeatLabel = &seatLabel
-			}
-			if ticket.Event != nil {
-				ticketResp.EventTitle = ticket.Event.Title
-			}
-			if ticket.EventDate != nil && ticket.EventDate.Date != nil {
-				ticketResp.EventDate = ticket.EventDate.Date.Format(time.RFC3339)
-			}
-			if resp.CustomerName == "" {
-				resp.CustomerName = ticket.ToName
+		credential, err := h.credentials.Issue(key, services.CredentialForTicket(ticket))
+		if err != nil {
+			return err
+		}
+		resp.Tickets[i].Credential = credential
+	}
+
+	return nil
+}
+
+// normalizeAttendees trims and validates the optional per-ticket attendee details
+func normalizeAttendees(req *models.BookingRequest) string {
+	for _, tier := range req.Tiers {
+		if len(tier.Attendees) > tier.Quantity {
+			return fmt.Sprintf("attendees cannot exceed quantity for ticket type %d", tier.TicketTypeID)
+		}
+		for _, attendee := range tier.Attendees {
+			if errMsg := normalizeAttendee(attendee); errMsg != "" {
+				return errMsg
 			}
-			tickets = append(tickets, ticketResp)
 		}
+	}
 
-		resp.Tickets = tickets
-		response = append(response, resp)
+	for _, seat := range req.Seats {
+		if errMsg := normalizeAttendee(seat.Attendee); errMsg != "" {
+			return errMsg
+		}
 	}
 
-	JSON(w, http.StatusOK, response)
+	return ""
+}
+
+func normalizeAttendee(attendee *models.AttendeeRequest) string {
+	if attendee == nil {
+		return ""
+	}
+
+	attendee.Name = strings.TrimSpace(attendee.Name)
+	if attendee.Name == "" {
+		return "attendee name is required"
+	}
+
+	if attendee.Email != "" {
+		attendee.Email = normalizeEmail(attendee.Email)
+		if attendee.Email == "" {
+			return "attendee email must be valid"
+		}
+	}
+
+	return ""
+}
+
+// preferredLanguage returns the first language tag of an Accept-Language header
+func preferredLanguage(header string) string {
+	first := strings.Split(header, ",")[0]
+	return strings.TrimSpace(strings.Split(first, ";")[0])
+}
+
+func orderToResponse(order *models.Order) *models.OrderResponse {
+	resp := &models.OrderResponse{
+		ID:            order.ID,
+		CustomerName:  order.CustomerName,
+		CustomerEmail: order.CustomerEmail,
+		Tickets:       []*models.OrderTicketResponse{},
+	}
+
+	if order.Amount != "" {
+		if amount, err := strconv.ParseFloat(order.Amount, 64); err == nil {
+			resp.TotalAmount = amount
+		}
+	}
+
+	if order.CreatedAt != nil {
+		resp.CreatedAt = order.CreatedAt.Format(time.RFC3339)
+	}
+	resp.RefundedAmount = order.RefundedAmount
+	resp.Status = repositories.OrderStatus(order)
+	resp.PaymentSource = order.PaymentSource
+
+	for _, ticket := range order.Tickets {
+		resp.Tickets = append(resp.Tickets, orderTicketToResponse(ticket))
+	}
+
+	return resp
+}
+
+func orderTicketToResponse(ticket *models.Ticket) *models.OrderTicketResponse {
+	resp := &models.OrderTicketResponse{
+		ID:      ticket.ID,
+		Price:   ticket.Price,
+		ToName:  ticket.ToName,
+		ToEmail: ticket.ToEmail,
+	}
+
+	if ticket.TicketType != nil {
+		resp.TicketType = ticket.TicketType.Name
+	}
+
+	if ticket.Seat != nil {
+		seatLabel := ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
+		resp.SeatLabel = &seatLabel
+	}
+
+	if ticket.Event != nil {
+		resp.EventTitle = ticket.Event.Title
+	}
+
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		resp.EventDate = ticket.EventDate.Date.Format(time.RFC3339)
+		resp.EventTimeZone = ticket.EventDate.TimeZone
+	}
+
+	if ticket.RefundedAt != nil {
+		refundedAt := ticket.RefundedAt.Format(time.RFC3339)
+		resp.RefundedAt = &refundedAt
+	}
+
+	return resp
 }
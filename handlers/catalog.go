@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+const (
+	maxSlugLength          = 45
+	maxCategoryNameLength  = 100
+	maxPerformerNameLength = 200
+	maxDescriptionLength   = 500
+	maxURLLength           = 500
+	maxAltTextLength       = 255
+	maxTagLength           = 45
+	maxEventTags           = 20
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type CatalogHandler struct {
+	catalog *services.CatalogService
+}
+
+func NewCatalogHandler(catalog *services.CatalogService) *CatalogHandler {
+	return &CatalogHandler{
+		catalog: catalog,
+	}
+}
+
+// ListCategories handles GET /api/categories and GET /api/admin/categories
+func (h *CatalogHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.catalog.ListCategories()
+	if err != nil {
+		InternalServerError(w, "Failed to fetch categories")
+		return
+	}
+
+	JSON(w, http.StatusOK, categories)
+}
+
+// CreateCategory handles POST /api/admin/categories
+func (h *CatalogHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCategoryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	category, err := h.catalog.CreateCategory(req, auditActor(r))
+	if err != nil {
+		if err == services.ErrSlugTaken {
+			Conflict(w, "SLUG_TAKEN", "Another category already has this slug")
+			return
+		}
+		InternalServerError(w, "Failed to create category")
+		return
+	}
+
+	JSON(w, http.StatusCreated, category)
+}
+
+// UpdateCategory handles PUT /api/admin/categories/{id}
+func (h *CatalogHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid category ID")
+		return
+	}
+
+	req, ok := decodeCategoryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	category, err := h.catalog.UpdateCategory(id, req, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Category not found")
+		case services.ErrSlugTaken:
+			Conflict(w, "SLUG_TAKEN", "Another category already has this slug")
+		default:
+			InternalServerError(w, "Failed to update category")
+		}
+		return
+	}
+
+	JSON(w, http.StatusOK, category)
+}
+
+// DeleteCategory handles DELETE /api/admin/categories/{id}
+func (h *CatalogHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid category ID")
+		return
+	}
+
+	if err := h.catalog.DeleteCategory(id, auditActor(r)); err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Category not found")
+			return
+		}
+		InternalServerError(w, "Failed to delete category")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPerformers handles GET /api/admin/performers. q filters by name.
+func (h *CatalogHandler) ListPerformers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			BadRequest(w, "limit must be a positive integer")
+			return
+		}
+	}
+
+	performers, err := h.catalog.ListPerformers(strings.TrimSpace(query.Get("q")), limit)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch performers")
+		return
+	}
+
+	JSON(w, http.StatusOK, performers)
+}
+
+// GetPerformer handles GET /api/admin/performers/{id}
+func (h *CatalogHandler) GetPerformer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid performer ID")
+		return
+	}
+
+	performer, err := h.catalog.GetPerformer(id)
+	if err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Performer not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch performer")
+		return
+	}
+
+	JSON(w, http.StatusOK, performer)
+}
+
+// CreatePerformer handles POST /api/admin/performers
+func (h *CatalogHandler) CreatePerformer(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodePerformerRequest(w, r)
+	if !ok {
+		return
+	}
+
+	performer, err := h.catalog.CreatePerformer(req, auditActor(r))
+	if err != nil {
+		if err == services.ErrSlugTaken {
+			Conflict(w, "SLUG_TAKEN", "Another performer already has this slug")
+			return
+		}
+		InternalServerError(w, "Failed to create performer")
+		return
+	}
+
+	JSON(w, http.StatusCreated, performer)
+}
+
+// UpdatePerformer handles PUT /api/admin/performers/{id}
+func (h *CatalogHandler) UpdatePerformer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid performer ID")
+		return
+	}
+
+	req, ok := decodePerformerRequest(w, r)
+	if !ok {
+		return
+	}
+
+	performer, err := h.catalog.UpdatePerformer(id, req, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Performer not found")
+		case services.ErrSlugTaken:
+			Conflict(w, "SLUG_TAKEN", "Another performer already has this slug")
+		default:
+			InternalServerError(w, "Failed to update performer")
+		}
+		return
+	}
+
+	JSON(w, http.StatusOK, performer)
+}
+
+// DeletePerformer handles DELETE /api/admin/performers/{id}
+func (h *CatalogHandler) DeletePerformer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid performer ID")
+		return
+	}
+
+	if err := h.catalog.DeletePerformer(id, auditActor(r)); err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Performer not found")
+			return
+		}
+		InternalServerError(w, "Failed to delete performer")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEventClassification handles GET /api/admin/events/{id}/classification
+func (h *CatalogHandler) GetEventClassification(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+
+	classification, err := h.catalog.GetEventClassification(eventID)
+	if err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Event not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch event classification")
+		return
+	}
+
+	JSON(w, http.StatusOK, classification)
+}
+
+// ClassifyEvent handles PUT /api/admin/events/{id}/classification. Each of
+// categoryIds, tags and performerIds replaces the current list when present.
+func (h *CatalogHandler) ClassifyEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+
+	var req models.EventClassificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	if req.CategoryIDs != nil && !validIDs(*req.CategoryIDs) {
+		BadRequest(w, "categoryIds must be distinct positive integers")
+		return
+	}
+	if req.PerformerIDs != nil && !validIDs(*req.PerformerIDs) {
+		BadRequest(w, "performerIds must be distinct positive integers")
+		return
+	}
+	if req.Tags != nil {
+		tags, errMsg := normalizeTags(*req.Tags)
+		if errMsg != "" {
+			BadRequest(w, errMsg)
+			return
+		}
+		req.Tags = &tags
+	}
+
+	classification, err := h.catalog.ClassifyEvent(eventID, &req, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Event not found")
+		case services.ErrUnknownCategory:
+			Error(w, http.StatusUnprocessableEntity, "UNKNOWN_CATEGORY", "One or more categories do not exist")
+		case services.ErrUnknownPerformer:
+			Error(w, http.StatusUnprocessableEntity, "UNKNOWN_PERFORMER", "One or more performers do not exist")
+		default:
+			InternalServerError(w, "Failed to classify event")
+		}
+		return
+	}
+
+	JSON(w, http.StatusOK, classification)
+}
+
+// AddEventMedia handles POST /api/admin/events/{id}/media
+func (h *CatalogHandler) AddEventMedia(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+
+	var req models.EventMediaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	req.Kind = strings.ToUpper(strings.TrimSpace(req.Kind))
+	if req.Kind != repositories.MediaImage && req.Kind != repositories.MediaVideo {
+		BadRequest(w, "kind must be IMAGE or VIDEO")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if !validURL(req.URL) {
+		BadRequest(w, "url must be an absolute http or https URL of at most 500 characters")
+		return
+	}
+	req.AltText = strings.TrimSpace(req.AltText)
+	if utf8.RuneCountInString(req.AltText) > maxAltTextLength {
+		BadRequest(w, "altText must be at most 255 characters")
+		return
+	}
+	if req.Position < 0 {
+		BadRequest(w, "position must not be negative")
+		return
+	}
+
+	media, err := h.catalog.AddEventMedia(eventID, &req, auditActor(r))
+	if err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Event not found")
+			return
+		}
+		InternalServerError(w, "Failed to add media")
+		return
+	}
+
+	JSON(w, http.StatusCreated, media)
+}
+
+// DeleteEventMedia handles DELETE /api/admin/events/{id}/media/{mediaId}
+func (h *CatalogHandler) DeleteEventMedia(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+	mediaID, err := strconv.Atoi(chi.URLParam(r, "mediaId"))
+	if err != nil {
+		BadRequest(w, "Invalid media ID")
+		return
+	}
+
+	if err := h.catalog.DeleteEventMedia(eventID, mediaID, auditActor(r)); err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Media not found")
+			return
+		}
+		InternalServerError(w, "Failed to delete media")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateVenueTimeZone handles PUT /api/admin/venues/{id}/time-zone
+func (h *CatalogHandler) UpdateVenueTimeZone(w http.ResponseWriter, r *http.Request) {
+	venueID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid venue ID")
+		return
+	}
+
+	var req models.VenueTimeZone
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	updated, err := h.catalog.UpdateVenueTimeZone(venueID, strings.TrimSpace(req.TimeZone), auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrUnknownTimeZone:
+			BadRequest(w, "timeZone must be an IANA time zone such as America/Mexico_City")
+		case services.ErrNotFound:
+			NotFound(w, "Venue not found")
+		default:
+			InternalServerError(w, "Failed to update venue time zone")
+		}
+		return
+	}
+
+	JSON(w, http.StatusOK, updated)
+}
+
+func decodeCategoryRequest(w http.ResponseWriter, r *http.Request) (*models.CategoryRequest, bool) {
+	var req models.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return nil, false
+	}
+
+	req.Slug = strings.TrimSpace(req.Slug)
+	if !validSlug(req.Slug) {
+		BadRequest(w, "slug must be lower-case letters, digits and single hyphens, at most 45 characters")
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxCategoryNameLength {
+		BadRequest(w, "name is required and must be at most 100 characters")
+		return nil, false
+	}
+
+	return &req, true
+}
+
+func decodePerformerRequest(w http.ResponseWriter, r *http.Request) (*models.PerformerRequest, bool) {
+	var req models.PerformerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return nil, false
+	}
+
+	req.Slug = strings.TrimSpace(req.Slug)
+	if !validSlug(req.Slug) {
+		BadRequest(w, "slug must be lower-case letters, digits and single hyphens, at most 45 characters")
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxPerformerNameLength {
+		BadRequest(w, "name is required and must be at most 200 characters")
+		return nil, false
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		BadRequest(w, "description must be at most 500 characters")
+		return nil, false
+	}
+	req.ImageURL = strings.TrimSpace(req.ImageURL)
+	if req.ImageURL != "" && !validURL(req.ImageURL) {
+		BadRequest(w, "imageUrl must be an absolute http or https URL of at most 500 characters")
+		return nil, false
+	}
+
+	return &req, true
+}
+
+func validSlug(slug string) bool {
+	return len(slug) <= maxSlugLength && slugPattern.MatchString(slug)
+}
+
+func validURL(value string) bool {
+	if value == "" || len(value) > maxURLLength {
+		return false
+	}
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func validIDs(ids []int) bool {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// normalizeTags trims and lower-cases tags and drops duplicates. It returns
+// an error message for a bad request.
+func normalizeTags(tags []string) ([]string, string) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, "tags must be non-empty and at most 45 characters"
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxEventTags {
+		return nil, "an event can have at most 20 tags"
+	}
+	return normalized, ""
+}
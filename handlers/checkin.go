@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/services"
+)
+
+const (
+	// maxSyncBatch limits how many buffered scans a device may upload per request
+	maxSyncBatch = 500
+	// maxDeviceIDLength leaves room in ticket_scan.device_id for the user prefix
+	maxDeviceIDLength = 64
+)
+
+type CheckInHandler struct {
+	checkInService *services.CheckInService
+}
+
+func NewCheckInHandler(checkInService *services.CheckInService) *CheckInHandler {
+	return &CheckInHandler{
+		checkInService: checkInService,
+	}
+}
+
+// CheckIn handles POST /api/checkin
+func (h *CheckInHandler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	var req models.CheckInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	req.Credential = strings.TrimSpace(req.Credential)
+	req.Gate = strings.TrimSpace(req.Gate)
+	deviceID, ok := scannerDeviceID(w, r, req.DeviceID)
+	if !ok {
+		return
+	}
+	req.DeviceID = deviceID
+	if req.Credential == "" {
+		BadRequest(w, "credential is required")
+		return
+	}
+	if req.EventDateID == 0 {
+		BadRequest(w, "eventDateId is required")
+		return
+	}
+	if req.Gate == "" {
+		BadRequest(w, "gate is required")
+		return
+	}
+
+	result, err := h.checkInService.CheckIn(&req, auditActor(r))
+	if err != nil {
+		InternalServerError(w, "Failed to check in ticket")
+		return
+	}
+
+	switch result.Status {
+	case services.CheckInAdmitted:
+		JSON(w, http.StatusOK, checkInToResponse(result))
+	case services.CheckInAlreadyAdmitted:
+		JSON(w, http.StatusConflict, &models.AlreadyAdmittedResponse{
+			Error:     services.CheckInAlreadyAdmitted,
+			Message:   "Ticket was already admitted",
+			TicketID:  result.Ticket.ID,
+			Admission: admissionToInfo(result.Admission),
+		})
+	case services.CheckInTicketRefunded:
+		Conflict(w, services.CheckInTicketRefunded, "Ticket has been refunded and is no longer valid")
+	case services.CheckInWrongEventDate:
+		Conflict(w, services.CheckInWrongEventDate, fmt.Sprintf("Ticket is not valid for this event date (ticket is for event date %d)", result.Ticket.EventDateID))
+	default:
+		Error(w, http.StatusUnprocessableEntity, services.CheckInInvalidCredential, "Ticket credential is not valid")
+	}
+}
+
+// SyncScans handles POST /api/checkin/sync for scans buffered while a device was offline
+func (h *CheckInHandler) SyncScans(w http.ResponseWriter, r *http.Request) {
+	var req models.CheckInSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	deviceID, ok := scannerDeviceID(w, r, req.DeviceID)
+	if !ok {
+		return
+	}
+	if len(req.Scans) == 0 {
+		BadRequest(w, "scans must not be empty")
+		return
+	}
+	if len(req.Scans) > maxSyncBatch {
+		BadRequest(w, fmt.Sprintf("at most %d scans can be synced per request", maxSyncBatch))
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Scans))
+	scans := make([]*services.OfflineScan, 0, len(req.Scans))
+	for i, scanReq := range req.Scans {
+		if scanReq == nil {
+			BadRequest(w, fmt.Sprintf("scans[%d] is required", i))
+			return
+		}
+
+		clientScanID := strings.TrimSpace(scanReq.ClientScanID)
+		if clientScanID == "" {
+			BadRequest(w, fmt.Sprintf("scans[%d].clientScanId is required", i))
+			return
+		}
+		if seen[clientScanID] {
+			BadRequest(w, fmt.Sprintf("scans[%d].clientScanId is duplicated", i))
+			return
+		}
+		seen[clientScanID] = true
+
+		if scanReq.EventDateID == 0 || strings.TrimSpace(scanReq.Credential) == "" || strings.TrimSpace(scanReq.Gate) == "" {
+			BadRequest(w, fmt.Sprintf("scans[%d] requires credential, eventDateId and gate", i))
+			return
+		}
+
+		scannedAt, err := time.Parse(time.RFC3339, scanReq.ScannedAt)
+		if err != nil {
+			BadRequest(w, fmt.Sprintf("scans[%d].scannedAt must be an RFC3339 timestamp", i))
+			return
+		}
+
+		scans = append(scans, &services.OfflineScan{
+			ClientScanID: clientScanID,
+			Credential:   strings.TrimSpace(scanReq.Credential),
+			EventDateID:  scanReq.EventDateID,
+			Gate:         strings.TrimSpace(scanReq.Gate),
+			ScannedAt:    scannedAt,
+		})
+	}
+
+	results, err := h.checkInService.SyncOfflineScans(deviceID, scans, auditActor(r))
+	if err != nil {
+		InternalServerError(w, "Failed to sync scans")
+		return
+	}
+
+	response := &models.CheckInSyncResponse{
+		Results: make([]*models.OfflineScanResult, 0, len(results)),
+	}
+	for i, result := range results {
+		scanResult := &models.OfflineScanResult{
+			ClientScanID: scans[i].ClientScanID,
+			Status:       result.Status,
+			Conflict:     result.Conflict,
+			Admission:    admissionToInfo(result.Admission),
+			Superseded:   admissionToInfo(result.Superseded),
+		}
+		if result.Ticket != nil {
+			scanResult.TicketID = result.Ticket.ID
+		}
+
+		switch {
+		case result.Superseded != nil:
+			scanResult.Message = "Earlier offline scan replaced a later admission; ticket was used twice"
+		case result.Status == services.CheckInAlreadyAdmitted && result.Conflict:
+			scanResult.Message = "Ticket was admitted earlier; holder was let in twice"
+		}
+
+		response.Results = append(response.Results, scanResult)
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// scannerDeviceID scopes the device ID the client registered to the signed-in
+// scanner, so one user cannot record scans as another's device. It does not
+// depend on the session, keeping offline re-uploads idempotent after a token
+// refresh or a new login.
+func scannerDeviceID(w http.ResponseWriter, r *http.Request, deviceID string) (string, bool) {
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		BadRequest(w, "deviceId is required")
+		return "", false
+	}
+	if len(deviceID) > maxDeviceIDLength {
+		BadRequest(w, fmt.Sprintf("deviceId must be at most %d characters", maxDeviceIDLength))
+		return "", false
+	}
+
+	return fmt.Sprintf("user-%d/%s", authClaims(r).UserID, deviceID), true
+}
+
+func checkInToResponse(result *services.CheckInResult) *models.CheckInResponse {
+	ticket := result.Ticket
+	resp := &models.CheckInResponse{
+		Status:      result.Status,
+		TicketID:    ticket.ID,
+		EventDateID: ticket.EventDateID,
+		ToName:      ticket.ToName,
+		Admission:   admissionToInfo(result.Admission),
+	}
+
+	if ticket.TicketType != nil {
+		resp.TicketType = ticket.TicketType.Name
+	}
+
+	if ticket.Seat != nil {
+		seatLabel := ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
+		resp.SeatLabel = &seatLabel
+	}
+
+	return resp
+}
+
+func admissionToInfo(admission *models.Admission) *models.AdmissionInfo {
+	if admission == nil {
+		return nil
+	}
+
+	return &models.AdmissionInfo{
+		AdmittedAt: admission.AdmittedAt.UTC().Format(time.RFC3339),
+		Gate:       admission.Gate,
+		DeviceID:   admission.DeviceID,
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Page cursors are opaque to clients: a few fields, typically the sort they
+// were issued for, the last item's sort key and its ID
+
+func encodeCursor(fields ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(fields, "|")))
+}
+
+// decodeCursor returns the cursor's fields, or false unless it holds count of
+// them. The last field may itself contain the separator.
+func decodeCursor(cursor string, count int) ([]string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	fields := strings.SplitN(string(raw), "|", count)
+	if len(fields) != count {
+		return nil, false
+	}
+	return fields, true
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+const (
+	maxStatusReasonLength = 500
+	maxRefundWindowDays   = 365
+)
+
+var eventDateStatuses = map[string]bool{
+	repositories.EventDateDraft:     true,
+	repositories.EventDateOnSale:    true,
+	repositories.EventDatePaused:    true,
+	repositories.EventDateSoldOut:   true,
+	repositories.EventDateCancelled: true,
+	repositories.EventDatePostponed: true,
+	repositories.EventDateCompleted: true,
+}
+
+type EventDateHandler struct {
+	eventDates *services.EventDateService
+	eventRepo  *repositories.EventRepository
+}
+
+func NewEventDateHandler(eventDates *services.EventDateService, eventRepo *repositories.EventRepository) *EventDateHandler {
+	return &EventDateHandler{
+		eventDates: eventDates,
+		eventRepo:  eventRepo,
+	}
+}
+
+// UpdateSchedule handles PUT /api/admin/event-dates/{id}/schedule
+func (h *EventDateHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event date ID")
+		return
+	}
+
+	var req models.EventDateScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	var schedule services.EventDateSchedule
+	fields := []struct {
+		name   string
+		value  *string
+		update *services.TimeUpdate
+	}{
+		{"date", req.Date, &schedule.Date},
+		{"doorsOpen", req.DoorsOpen, &schedule.DoorsOpenAt},
+		{"endsAt", req.EndsAt, &schedule.EndsAt},
+		{"salesOpenAt", req.SalesOpenAt, &schedule.SalesOpenAt},
+		{"salesCloseAt", req.SalesCloseAt, &schedule.SalesCloseAt},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		field.update.Set = true
+		if *field.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *field.value)
+		if err != nil {
+			BadRequest(w, field.name+" must be an RFC3339 timestamp with an offset, such as 2025-07-15T20:00:00-06:00")
+			return
+		}
+		t = t.UTC()
+		field.update.Value = &t
+	}
+
+	if err := h.eventDates.Schedule(id, &schedule, auditActor(r)); err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Event date not found")
+		case services.ErrEventDateClosed:
+			Conflict(w, "EVENT_DATE_CLOSED", "Cancelled and completed event dates cannot be rescheduled")
+		case services.ErrInvalidSchedule:
+			Error(w, http.StatusUnprocessableEntity, "INVALID_SCHEDULE", "The date needs a start; doors must open by the start, the end must follow it, and sales must open before they close")
+		default:
+			InternalServerError(w, "Failed to update event date schedule")
+		}
+		return
+	}
+
+	eventDate, err := h.eventRepo.GetEventDateByID(id)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch event date")
+		return
+	}
+
+	JSON(w, http.StatusOK, eventDateResponse(eventDate))
+}
+
+// UpdateStatus handles POST /api/admin/event-dates/{id}/status
+func (h *EventDateHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event date ID")
+		return
+	}
+
+	var req models.EventDateStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	req.Status = strings.ToUpper(strings.TrimSpace(req.Status))
+	if !eventDateStatuses[req.Status] {
+		BadRequest(w, "status must be DRAFT, ON_SALE, PAUSED, SOLD_OUT, CANCELLED, POSTPONED or COMPLETED")
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" && (req.Status == repositories.EventDateCancelled || req.Status == repositories.EventDatePostponed) {
+		BadRequest(w, "reason is required to cancel or postpone")
+		return
+	}
+	if utf8.RuneCountInString(req.Reason) > maxStatusReasonLength {
+		BadRequest(w, "reason must be at most 500 characters")
+		return
+	}
+
+	change := &services.StatusChange{Status: req.Status, Reason: req.Reason}
+	if req.NewDate != nil || req.RefundWindowDays != nil {
+		if req.Status != repositories.EventDatePostponed {
+			BadRequest(w, "newDate and refundWindowDays only apply when postponing")
+			return
+		}
+	}
+	if req.NewDate != nil {
+		newDate, err := time.Parse(time.RFC3339, *req.NewDate)
+		if err != nil {
+			BadRequest(w, "newDate must be an RFC3339 timestamp with an offset, such as 2025-07-15T20:00:00-06:00")
+			return
+		}
+		newDate = newDate.UTC()
+		change.NewDate = &newDate
+	}
+	if req.RefundWindowDays != nil {
+		if *req.RefundWindowDays < 1 || *req.RefundWindowDays > maxRefundWindowDays {
+			BadRequest(w, "refundWindowDays must be between 1 and 365")
+			return
+		}
+		change.RefundWindow = time.Duration(*req.RefundWindowDays) * 24 * time.Hour
+	}
+
+	response, err := h.eventDates.ChangeStatus(id, change, authClaims(r).UserID, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Event date not found")
+		case services.ErrInvalidStatusTransition:
+			Conflict(w, "INVALID_STATUS_TRANSITION", "The event date cannot move to "+req.Status+" from its current status")
+		case services.ErrInvalidSchedule:
+			Error(w, http.StatusUnprocessableEntity, "INVALID_SCHEDULE", "newDate must be in the future, and the date's doors and end must still fit around it")
+		default:
+			InternalServerError(w, "Failed to change event date status")
+		}
+		return
+	}
+
+	// Refunds and notifications run in the background; the change reports
+	// their progress
+	status := http.StatusOK
+	if response.Change != nil {
+		status = http.StatusAccepted
+	}
+	JSON(w, status, response)
+}
+
+// ListChanges handles GET /api/admin/event-dates/{id}/changes
+func (h *EventDateHandler) ListChanges(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event date ID")
+		return
+	}
+
+	changes, err := h.eventDates.ListChanges(id)
+	if err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Event date not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch event date changes")
+		return
+	}
+
+	JSON(w, http.StatusOK, changes)
+}
+
+// GetChange handles GET /api/admin/event-date-changes/{id}, the progress
+// report of a cancellation or postponement
+func (h *EventDateHandler) GetChange(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid change ID")
+		return
+	}
+
+	change, err := h.eventDates.GetChange(id)
+	if err != nil {
+		if err == services.ErrNotFound {
+			NotFound(w, "Change not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch event date change")
+		return
+	}
+
+	JSON(w, http.StatusOK, change)
+}
+
+// RetryChange handles POST /api/admin/event-date-changes/{id}/retry
+func (h *EventDateHandler) RetryChange(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid change ID")
+		return
+	}
+
+	change, err := h.eventDates.RetryChange(id, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Change not found")
+		case services.ErrNothingToRetry:
+			Conflict(w, "NOTHING_TO_RETRY", "The change has no failed orders")
+		default:
+			InternalServerError(w, "Failed to retry event date change")
+		}
+		return
+	}
+
+	JSON(w, http.StatusAccepted, change)
+}
+
+// RefundPostponed handles POST /api/orders/{id}/postponement-refund: the
+// holder of tickets for a postponed date asks for their money back while the
+// refund window is open
+func (h *EventDateHandler) RefundPostponed(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid order ID")
+		return
+	}
+
+	refund, err := h.eventDates.RefundPostponed(orderID, authClaims(r).UserID, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Order not found")
+		case services.ErrNoRefundWindow:
+			Conflict(w, "NO_REFUND_WINDOW", "The order holds no tickets for a postponed date that can still be refunded")
+		case services.ErrNothingToRefund, services.ErrTicketAlreadyRefunded:
+			Conflict(w, "NOTHING_TO_REFUND", "The tickets have already been refunded")
+		default:
+			InternalServerError(w, "Failed to issue refund")
+		}
+		return
+	}
+
+	JSON(w, http.StatusCreated, refundToResponse(refund))
+}
+
+// eventDateResponse converts an event date loaded with its event and venue.
+// Times carry the venue's offset.
+func eventDateResponse(eventDate *models.EventDate) *models.EventDateResponse {
+	response := &models.EventDateResponse{
+		ID:           eventDate.ID,
+		SeatingMode:  eventDate.SeatingMode,
+		TimeZone:     eventDate.TimeZone,
+		Status:       eventDate.Status,
+		StatusReason: eventDate.StatusReason,
+		OnSale:       services.CheckOnSale(eventDate, time.Now()) == nil,
+	}
+
+	if eventDate.Event != nil {
+		response.Event = &models.EventInfo{
+			ID:          eventDate.Event.ID,
+			Slug:        eventDate.Event.Slug,
+			Title:       eventDate.Event.Title,
+			Description: eventDate.Event.Description,
+		}
+	}
+
+	if eventDate.Date != nil {
+		response.Date = eventDate.Date.Format(time.RFC3339)
+	}
+	if eventDate.DoorsOpenAt != nil {
+		response.DoorsOpen = eventDate.DoorsOpenAt.Format(time.RFC3339)
+	}
+	if eventDate.EndsAt != nil {
+		response.EndsAt = eventDate.EndsAt.Format(time.RFC3339)
+	}
+	if eventDate.SalesOpenAt != nil {
+		response.SalesOpenAt = eventDate.SalesOpenAt.Format(time.RFC3339)
+	}
+	if eventDate.SalesCloseAt != nil {
+		response.SalesCloseAt = eventDate.SalesCloseAt.Format(time.RFC3339)
+	}
+
+	if eventDate.Venue != nil {
+		response.Venue = &models.VenueInfo{
+			ID:       eventDate.Venue.ID,
+			Slug:     eventDate.Venue.Slug,
+			Name:     eventDate.Venue.Name,
+			Capacity: eventDate.Venue.Capacity,
+			TimeZone: eventDate.Venue.TimeZone,
+		}
+	}
+
+	return response
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	eventsDefaultLimit = 20
+	eventsMaxLimit     = 100
+)
+
+// parseEventFilter reads the catalog query parameters: q (words matched
+// against title, description and performer names), category and performer
+// (slugs), tag (repeatable; all must match), from and to (RFC3339, on the
+// event date),
+// venue (ID or slug), seatingMode (GA or SEATED), available (true or false),
+// sort (date or title, prefixed with - for descending; default date), cursor
+// and limit. It returns an error message for a bad request.
+func parseEventFilter(r *http.Request) (*repositories.EventFilter, string) {
+	query := r.URL.Query()
+	filter := &repositories.EventFilter{
+		Query:       strings.TrimSpace(query.Get("q")),
+		SeatingMode: strings.ToUpper(strings.TrimSpace(query.Get("seatingMode"))),
+		Limit:       eventsDefaultLimit,
+	}
+
+	filter.Category = strings.TrimSpace(query.Get("category"))
+	filter.Performer = strings.TrimSpace(query.Get("performer"))
+	for _, tag := range query["tag"] {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+
+	switch filter.SeatingMode {
+	case "", "GA", "SEATED":
+	default:
+		return nil, "seatingMode must be GA or SEATED"
+	}
+
+	if value := strings.TrimSpace(query.Get("venue")); value != "" {
+		if id, err := strconv.Atoi(value); err == nil {
+			filter.VenueID = id
+		} else {
+			filter.VenueSlug = value
+		}
+	}
+	if value := query.Get("available"); value != "" {
+		available, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, "available must be true or false"
+		}
+		filter.Available = &available
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, "from must be an RFC3339 timestamp"
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, "to must be an RFC3339 timestamp"
+		}
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, "from must be before to"
+	}
+
+	sort := strings.TrimSpace(query.Get("sort"))
+	if sort == "" {
+		sort = repositories.EventSortDate
+	}
+	filter.Descending = strings.HasPrefix(sort, "-")
+	filter.Sort = strings.TrimPrefix(sort, "-")
+	if filter.Sort != repositories.EventSortDate && filter.Sort != repositories.EventSortTitle {
+		return nil, "sort must be date or title, optionally prefixed with -"
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, "limit must be a positive integer"
+		}
+		filter.Limit = limit
+	}
+	if filter.Limit > eventsMaxLimit {
+		filter.Limit = eventsMaxLimit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		parts, ok := decodeCursor(value, 3)
+		if !ok || parts[0] != sort {
+			return nil, "cursor is invalid or was issued for a different sort"
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, "cursor is invalid or was issued for a different sort"
+		}
+		filter.After = &repositories.EventCursor{Value: parts[2], ID: id}
+	}
+
+	return filter, ""
+}
+
+// encodeEventCursor records the sort, the event's ID and its sort key. The
+// key goes last as a title may contain the separator.
+func encodeEventCursor(filter *repositories.EventFilter, event *models.EventListItem) string {
+	sort := filter.Sort
+	if filter.Descending {
+		sort = "-" + sort
+	}
+	return encodeCursor(sort, strconv.Itoa(event.ID), event.SortKey)
+}
@@ -5,7 +5,6 @@ import (
 	//"encoding/json"
 	"net/http"
 	"strconv"
-	"time"
 	"ticketbooth-backend/models"
 	"ticketbooth-backend/repositories"
 	"github.com/go-chi/chi/v5"
@@ -23,15 +22,46 @@ func NewEventHandler(eventRepo *repositories.EventRepository, availabilityRepo *
 	}
 }
 
-// GetEvents handles GET /api/events
+// GetEvents handles GET /api/events. See parseEventFilter for the search,
+// filter, sort and paging parameters.
 func (h *EventHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
-	events, err := h.eventRepo.GetAllEvents()
+	filter, errMsg := parseEventFilter(r)
+	if errMsg != "" {
+		BadRequest(w, errMsg)
+		return
+	}
+
+	events, total, err := h.eventRepo.SearchEvents(filter)
 	if err != nil {
 		InternalServerError(w, "Failed to fetch events")
 		return
 	}
 
-	JSON(w, http.StatusOK, events)
+	response := &models.EventListResponse{
+		Events: events,
+		Total:  total,
+	}
+	if len(events) == filter.Limit {
+		cursor := encodeEventCursor(filter, events[len(events)-1])
+		response.NextCursor = &cursor
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// GetEvent handles GET /api/events/{slugOrId}
+func (h *EventHandler) GetEvent(w http.ResponseWriter, r *http.Request) {
+	event, err := h.eventRepo.GetEventBySlugOrID(chi.URLParam(r, "slugOrId"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Event not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch event")
+		return
+	}
+
+	JSON(w, http.StatusOK, event)
 }
 
 // GetEventDate handles GET /api/event-dates/:id
@@ -53,33 +83,13 @@ func (h *EventHandler) GetEventDate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert to response format
-	response := &models.EventDateResponse{
-		ID:          eventDate.ID,
-		SeatingMode: eventDate.SeatingMode,
-	}
-
-	if eventDate.Event != nil {
-		response.Event = &models.EventInfo{
-			ID:          eventDate.Event.ID,
-			Title:       eventDate.Event.Title,
-			Description: eventDate.Event.Description,
-		}
-	}
-
-	if eventDate.Date != nil {
-		response.Date = eventDate.Date.Format(time.RFC3339)
-	}
-
-	if eventDate.Venue != nil {
-		response.Venue = &models.VenueInfo{
-			ID:       eventDate.Venue.ID,
-			Name:     eventDate.Venue.Name,
-			Capacity: eventDate.Venue.Capacity,
-		}
+	// Drafts are not public yet
+	if eventDate.Status == repositories.EventDateDraft {
+		NotFound(w, "Event date not found")
+		return
 	}
 
-	JSON(w, http.StatusOK, response)
+	JSON(w, http.StatusOK, eventDateResponse(eventDate))
 }
 
 // GetAvailability handles GET /api/event-dates/:id/availability
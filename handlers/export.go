@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+type ExportHandler struct {
+	exports *services.DataExportService
+}
+
+func NewExportHandler(exports *services.DataExportService) *ExportHandler {
+	return &ExportHandler{
+		exports: exports,
+	}
+}
+
+// RequestExport handles GET /api/me/export?format=json|zip. It starts an export
+// of the caller's personal data, or returns the one already in progress.
+func (h *ExportHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	var format string
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "", "json":
+		format = repositories.ExportFormatJSON
+	case "zip":
+		format = repositories.ExportFormatZIP
+	default:
+		BadRequest(w, "format must be json or zip")
+		return
+	}
+
+	export, _, err := h.exports.Request(authClaims(r).UserID, format)
+	if err != nil {
+		InternalServerError(w, "Failed to start export")
+		return
+	}
+
+	resp := dataExportToResponse(export)
+	if export.Status == repositories.ExportReady {
+		JSON(w, http.StatusOK, resp)
+		return
+	}
+
+	w.Header().Set("Location", resp.StatusURL)
+	JSON(w, http.StatusAccepted, resp)
+}
+
+// GetExport handles GET /api/me/export/{id}
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid export ID")
+		return
+	}
+
+	export, err := h.exports.Get(authClaims(r).UserID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Export not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch export")
+		return
+	}
+
+	JSON(w, http.StatusOK, dataExportToResponse(export))
+}
+
+// DownloadExport handles GET /api/me/export/{id}/download
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid export ID")
+		return
+	}
+
+	export, data, err := h.exports.Download(authClaims(r).UserID, id)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			NotFound(w, "Export not found")
+		case services.ErrExportNotReady:
+			Conflict(w, "EXPORT_NOT_READY", "The export is still being prepared")
+		case services.ErrExportExpired:
+			Error(w, http.StatusGone, "EXPORT_EXPIRED", "The export has expired; request a new one")
+		default:
+			InternalServerError(w, "Failed to download export")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func dataExportToResponse(export *models.DataExport) *models.DataExportResponse {
+	resp := &models.DataExportResponse{
+		ID:          export.ID,
+		Format:      strings.ToLower(export.Format),
+		Status:      export.Status,
+		RequestedAt: export.RequestedAt.Format(time.RFC3339),
+		SizeBytes:   export.SizeBytes,
+		StatusURL:   fmt.Sprintf("/api/me/export/%d", export.ID),
+	}
+
+	if export.CompletedAt != nil {
+		completed := export.CompletedAt.Format(time.RFC3339)
+		resp.CompletedAt = &completed
+	}
+	if export.ExpiresAt != nil {
+		expires := export.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &expires
+	}
+	if export.Status == repositories.ExportReady {
+		resp.DownloadURL = resp.StatusURL + "/download"
+	}
+
+	return resp
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/services"
+)
+
+type LedgerHandler struct {
+	ledger *services.LedgerService
+}
+
+func NewLedgerHandler(ledger *services.LedgerService) *LedgerHandler {
+	return &LedgerHandler{
+		ledger: ledger,
+	}
+}
+
+// GetTrialBalance handles GET /api/admin/ledger/trial-balance?asOf=RFC3339
+func (h *LedgerHandler) GetTrialBalance(w http.ResponseWriter, r *http.Request) {
+	var asOf *time.Time
+	if value := r.URL.Query().Get("asOf"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "asOf must be an RFC3339 timestamp")
+			return
+		}
+		asOf = &parsed
+	}
+
+	tb, unbalanced, err := h.ledger.TrialBalance(asOf)
+	if err != nil {
+		InternalServerError(w, "Failed to compute trial balance")
+		return
+	}
+
+	resp := &models.TrialBalanceResponse{
+		Accounts:               make([]*models.TrialBalanceAccount, 0, len(tb.Balances)),
+		TotalDebit:             tb.TotalDebit.Float(),
+		TotalCredit:            tb.TotalCredit.Float(),
+		Balanced:               tb.Balanced() && unbalanced == 0,
+		UnbalancedTransactions: unbalanced,
+	}
+	if asOf != nil {
+		formatted := asOf.UTC().Format(time.RFC3339)
+		resp.AsOf = &formatted
+	}
+
+	for _, balance := range tb.Balances {
+		side := "CREDIT"
+		if balance.Account.NormalDebit() {
+			side = "DEBIT"
+		}
+		resp.Accounts = append(resp.Accounts, &models.TrialBalanceAccount{
+			Account:    string(balance.Account),
+			NormalSide: side,
+			Debit:      balance.Debit.Float(),
+			Credit:     balance.Credit.Float(),
+			Balance:    balance.Net().Float(),
+		})
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
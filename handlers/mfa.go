@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+type MFAHandler struct {
+	mfa      *services.MFAService
+	userRepo *repositories.UserRepository
+	throttle *services.LoginThrottle
+}
+
+func NewMFAHandler(mfa *services.MFAService, userRepo *repositories.UserRepository, throttle *services.LoginThrottle) *MFAHandler {
+	return &MFAHandler{
+		mfa:      mfa,
+		userRepo: userRepo,
+		throttle: throttle,
+	}
+}
+
+// LoginMFA handles POST /api/login/mfa, the second login step
+func (h *MFAHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	token := strings.TrimSpace(req.MFAToken)
+	code := strings.TrimSpace(req.Code)
+	recoveryCode := strings.TrimSpace(req.RecoveryCode)
+	if token == "" {
+		BadRequest(w, "mfaToken is required")
+		return
+	}
+	if (code == "") == (recoveryCode == "") {
+		BadRequest(w, "Exactly one of code or recoveryCode is required")
+		return
+	}
+
+	user, ok := h.challengeUser(w, repositories.TokenMFAChallenge, token)
+	if !ok || !h.checkThrottle(w, r, user) {
+		return
+	}
+
+	pair, err := h.mfa.CompleteLogin(token, code, recoveryCode, r.UserAgent(), clientIP(r))
+	if err != nil {
+		h.codeError(w, r, user, err, "Failed to complete login")
+		return
+	}
+
+	h.throttle.RecordSuccess(user)
+	JSON(w, http.StatusOK, tokenPairToResponse(pair, userToResponse(user)))
+}
+
+// LoginEnroll handles POST /api/login/mfa/enroll. Admins and organizers without
+// MFA get an enrollment token from login and set up TOTP here before their
+// first session is issued.
+func (h *MFAHandler) LoginEnroll(w http.ResponseWriter, r *http.Request) {
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	token := strings.TrimSpace(req.MFAToken)
+	if token == "" {
+		BadRequest(w, "mfaToken is required")
+		return
+	}
+
+	user, ok := h.challengeUser(w, repositories.TokenMFAEnroll, token)
+	if !ok {
+		return
+	}
+
+	h.beginEnrollment(w, user)
+}
+
+// LoginEnrollConfirm handles POST /api/login/mfa/enroll/confirm
+func (h *MFAHandler) LoginEnrollConfirm(w http.ResponseWriter, r *http.Request) {
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	token := strings.TrimSpace(req.MFAToken)
+	code := strings.TrimSpace(req.Code)
+	if token == "" || code == "" {
+		BadRequest(w, "mfaToken and code are required")
+		return
+	}
+
+	user, ok := h.challengeUser(w, repositories.TokenMFAEnroll, token)
+	if !ok || !h.checkThrottle(w, r, user) {
+		return
+	}
+
+	pair, codes, err := h.mfa.CompleteEnrollment(token, code, r.UserAgent(), clientIP(r))
+	if err != nil {
+		h.codeError(w, r, user, err, "Failed to complete enrollment")
+		return
+	}
+
+	h.throttle.RecordSuccess(user)
+	response := tokenPairToResponse(pair, userToResponse(user))
+	response.RecoveryCodes = codes
+	JSON(w, http.StatusOK, response)
+}
+
+// Status handles GET /api/me/mfa
+func (h *MFAHandler) Status(w http.ResponseWriter, r *http.Request) {
+	status, err := h.mfa.Status(authClaims(r).UserID)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch MFA status")
+		return
+	}
+
+	JSON(w, http.StatusOK, status)
+}
+
+// Enroll handles POST /api/me/mfa/totp
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.beginEnrollment(w, user)
+}
+
+// ConfirmEnroll handles POST /api/me/mfa/totp/confirm
+func (h *MFAHandler) ConfirmEnroll(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, func(user *models.User, code string) error {
+		codes, err := h.mfa.ConfirmEnrollment(user.ID, code)
+		if err != nil {
+			return err
+		}
+		JSON(w, http.StatusOK, &models.RecoveryCodesResponse{RecoveryCodes: codes})
+		return nil
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /api/me/mfa/recovery-codes
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, func(user *models.User, code string) error {
+		codes, err := h.mfa.RegenerateRecoveryCodes(user.ID, code)
+		if err != nil {
+			return err
+		}
+		JSON(w, http.StatusOK, &models.RecoveryCodesResponse{RecoveryCodes: codes})
+		return nil
+	})
+}
+
+// Disable handles DELETE /api/me/mfa
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, func(user *models.User, code string) error {
+		if err := h.mfa.Disable(user.ID, code); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (h *MFAHandler) beginEnrollment(w http.ResponseWriter, user *models.User) {
+	enrollment, err := h.mfa.BeginEnrollment(user)
+	if err != nil {
+		if err == services.ErrMFAAlreadyEnabled {
+			Conflict(w, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+			return
+		}
+		InternalServerError(w, "Failed to start enrollment")
+		return
+	}
+
+	JSON(w, http.StatusOK, &models.MFAEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+}
+
+// withCode decodes a TOTP code for the signed-in user and runs fn, counting
+// wrong codes against the login throttle like failed passwords
+func (h *MFAHandler) withCode(w http.ResponseWriter, r *http.Request, fn func(user *models.User, code string) error) {
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		BadRequest(w, "code is required")
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok || !h.checkThrottle(w, r, user) {
+		return
+	}
+
+	if err := fn(user, code); err != nil {
+		h.codeError(w, r, user, err, "Failed to update two-factor authentication")
+		return
+	}
+	h.throttle.RecordSuccess(user)
+}
+
+func (h *MFAHandler) challengeUser(w http.ResponseWriter, purpose string, token string) (*models.User, bool) {
+	user, err := h.mfa.ChallengeUser(purpose, token)
+	if err != nil {
+		if err == services.ErrInvalidMFAToken || err == sql.ErrNoRows {
+			Error(w, http.StatusUnauthorized, "INVALID_MFA_TOKEN", "MFA token is invalid or expired; log in again")
+			return nil, false
+		}
+		InternalServerError(w, "Failed to verify MFA token")
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *MFAHandler) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := h.userRepo.GetUserByID(authClaims(r).UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			Unauthorized(w, "User no longer exists")
+			return nil, false
+		}
+		InternalServerError(w, "Failed to fetch user")
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *MFAHandler) checkThrottle(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	result := h.throttle.Check(user.Email, user, clientIP(r))
+	if result.Allowed {
+		return true
+	}
+
+	if result.Locked {
+		TooManyRequests(w, "LOGIN_LOCKED", "Too many failed attempts; try again later", result.RetryAfter)
+	} else {
+		TooManyRequests(w, "LOGIN_THROTTLED", "Too many failed attempts; wait before retrying", result.RetryAfter)
+	}
+	return false
+}
+
+func (h *MFAHandler) codeError(w http.ResponseWriter, r *http.Request, user *models.User, err error, fallback string) {
+	switch err {
+	case services.ErrInvalidMFACode:
+		h.throttle.RecordFailure(user.Email, user, clientIP(r))
+		Error(w, http.StatusUnauthorized, "INVALID_MFA_CODE", "Invalid authentication code")
+	case services.ErrInvalidMFAToken:
+		Error(w, http.StatusUnauthorized, "INVALID_MFA_TOKEN", "MFA token is invalid or expired; log in again")
+	case services.ErrMFANotEnabled:
+		Conflict(w, "MFA_NOT_ENABLED", "Two-factor authentication is not enabled")
+	case services.ErrMFANotStarted:
+		Conflict(w, "MFA_ENROLLMENT_NOT_STARTED", "Start enrollment before confirming a code")
+	case services.ErrMFAAlreadyEnabled:
+		Conflict(w, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+	case services.ErrMFARequired:
+		Forbidden(w, "MFA_REQUIRED", "Two-factor authentication is required for admin and organizer accounts")
+	default:
+		InternalServerError(w, fallback)
+	}
+}
+
+func mfaChallengeResponse(challenge *services.MFAChallenge) *models.MFAChallengeResponse {
+	return &models.MFAChallengeResponse{
+		MFARequired:           true,
+		MFAEnrollmentRequired: challenge.EnrollmentRequired,
+		MFAToken:              challenge.Token,
+		ExpiresIn:             challenge.ExpiresIn,
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/services"
+)
+
+type OIDCHandler struct {
+	social *services.SocialLoginService
+}
+
+func NewOIDCHandler(social *services.SocialLoginService) *OIDCHandler {
+	return &OIDCHandler{
+		social: social,
+	}
+}
+
+// ListProviders handles GET /api/auth/oidc/providers
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	JSON(w, http.StatusOK, h.social.Providers())
+}
+
+// Authorize handles GET /api/auth/oidc/{provider}/authorize
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.social.Authorize(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		if err == services.ErrOIDCProviderNotFound {
+			NotFound(w, "Unknown login provider")
+			return
+		}
+		log.Printf("oidc authorize failed: %v", err)
+		Error(w, http.StatusBadGateway, "OIDC_PROVIDER_UNAVAILABLE", "Login provider is unavailable")
+		return
+	}
+
+	JSON(w, http.StatusOK, &models.OIDCAuthorizeResponse{
+		AuthorizationURL: authURL,
+		State:            state,
+	})
+}
+
+// Callback handles POST /api/auth/oidc/{provider}/callback. The web app posts
+// the code and state it received on its redirect URL.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var req models.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	state := strings.TrimSpace(req.State)
+	if code == "" || state == "" {
+		BadRequest(w, "code and state are required")
+		return
+	}
+
+	result, user, err := h.social.Callback(r.Context(), chi.URLParam(r, "provider"), code, state, r.UserAgent(), clientIP(r))
+	if err != nil {
+		switch {
+		case err == services.ErrOIDCProviderNotFound:
+			NotFound(w, "Unknown login provider")
+		case err == services.ErrInvalidOIDCState:
+			Error(w, http.StatusBadRequest, "INVALID_OIDC_STATE", "Login request is invalid or expired; start again")
+		case err == services.ErrOIDCEmailNotVerified:
+			Forbidden(w, "OIDC_EMAIL_NOT_VERIFIED", "The provider did not confirm a verified email address")
+		case errors.Is(err, services.ErrOIDCExchangeFailed), errors.Is(err, services.ErrInvalidIDToken):
+			log.Printf("oidc callback rejected: %v", err)
+			Unauthorized(w, "Login with the provider failed")
+		default:
+			log.Printf("oidc callback failed: %v", err)
+			InternalServerError(w, "Failed to log in")
+		}
+		return
+	}
+
+	if result.Challenge != nil {
+		JSON(w, http.StatusOK, mfaChallengeResponse(result.Challenge))
+		return
+	}
+
+	JSON(w, http.StatusOK, tokenPairToResponse(result.Session, userToResponse(user)))
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	ordersDefaultLimit = 20
+	ordersMaxLimit     = 100
+)
+
+// SearchOrders handles GET /api/admin/orders for support staff. Filters:
+// email, orderId, eventDateId, status, paymentSource, from and to (RFC3339, on
+// created_at). sort is createdAt, amount or id, prefixed with - for
+// descending (default -createdAt). Pages with cursor and limit.
+func (h *BookingHandler) SearchOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &repositories.OrderFilter{
+		Email:         strings.ToLower(strings.TrimSpace(query.Get("email"))),
+		PaymentSource: strings.TrimSpace(query.Get("paymentSource")),
+		Status:        strings.ToUpper(strings.TrimSpace(query.Get("status"))),
+	}
+
+	switch filter.Status {
+	case "", repositories.OrderStatusPaid, repositories.OrderStatusPartiallyRefunded, repositories.OrderStatusRefunded:
+	default:
+		BadRequest(w, "status must be PAID, PARTIALLY_REFUNDED or REFUNDED")
+		return
+	}
+
+	var err error
+	if value := query.Get("orderId"); value != "" {
+		if filter.OrderID, err = strconv.Atoi(value); err != nil || filter.OrderID <= 0 {
+			BadRequest(w, "orderId must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("eventDateId"); value != "" {
+		if filter.EventDateID, err = strconv.Atoi(value); err != nil || filter.EventDateID <= 0 {
+			BadRequest(w, "eventDateId must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "from must be an RFC3339 timestamp")
+			return
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "to must be an RFC3339 timestamp")
+			return
+		}
+		filter.To = &to
+	}
+
+	sort := strings.TrimSpace(query.Get("sort"))
+	if sort == "" {
+		sort = "-" + repositories.OrderSortCreatedAt
+	}
+	filter.Ascending = !strings.HasPrefix(sort, "-")
+	filter.Sort = strings.TrimPrefix(sort, "-")
+	switch filter.Sort {
+	case repositories.OrderSortCreatedAt, repositories.OrderSortAmount, repositories.OrderSortID:
+	default:
+		BadRequest(w, "sort must be createdAt, amount or id, optionally prefixed with -")
+		return
+	}
+
+	if errMsg := parseOrderPage(r, filter); errMsg != "" {
+		BadRequest(w, errMsg)
+		return
+	}
+
+	orders, err := h.bookingRepo.ListOrders(filter)
+	if err != nil {
+		InternalServerError(w, "Failed to search orders")
+		return
+	}
+
+	response := &models.OrderListResponse{
+		Orders: make([]*models.OrderResponse, 0, len(orders)),
+	}
+	for _, order := range orders {
+		resp := orderToResponse(order)
+		resp.UserID = order.UserID
+		response.Orders = append(response.Orders, resp)
+	}
+	response.NextCursor = nextOrderCursor(filter, orders)
+
+	JSON(w, http.StatusOK, response)
+}
+
+// parseOrderPage reads limit and cursor into filter, whose sort must already
+// be set. It returns an error message for a bad request.
+func parseOrderPage(r *http.Request, filter *repositories.OrderFilter) string {
+	query := r.URL.Query()
+
+	filter.Limit = ordersDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return "limit must be a positive integer"
+		}
+		filter.Limit = limit
+	}
+	if filter.Limit > ordersMaxLimit {
+		filter.Limit = ordersMaxLimit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, ok := decodeOrderCursor(value, filter)
+		if !ok {
+			return "cursor is invalid or was issued for a different sort"
+		}
+		filter.After = cursor
+	}
+
+	return ""
+}
+
+// encodeOrderCursor records the sort, the order's sort key and its ID
+func encodeOrderCursor(filter *repositories.OrderFilter, order *models.Order) string {
+	var value string
+	switch filter.Sort {
+	case repositories.OrderSortAmount:
+		amount, _ := strconv.ParseFloat(order.Amount, 64)
+		value = strconv.FormatFloat(amount, 'f', 2, 64)
+	case repositories.OrderSortID:
+		value = strconv.Itoa(order.ID)
+	default:
+		if order.CreatedAt != nil {
+			value = order.CreatedAt.UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	return encodeCursor(sortKey(filter), value, strconv.Itoa(order.ID))
+}
+
+func decodeOrderCursor(cursor string, filter *repositories.OrderFilter) (*repositories.OrderCursor, bool) {
+	parts, ok := decodeCursor(cursor, 3)
+	if !ok || parts[0] != sortKey(filter) {
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, false
+	}
+	switch filter.Sort {
+	case repositories.OrderSortAmount:
+		if _, err := strconv.ParseFloat(parts[1], 64); err != nil {
+			return nil, false
+		}
+	case repositories.OrderSortID:
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			return nil, false
+		}
+	default:
+		if _, err := time.Parse(time.RFC3339Nano, parts[1]); err != nil {
+			return nil, false
+		}
+	}
+
+	return &repositories.OrderCursor{Value: parts[1], ID: id}, true
+}
+
+// nextOrderCursor returns the cursor after a full page, or nil on the last one
+func nextOrderCursor(filter *repositories.OrderFilter, orders []*models.Order) *string {
+	if filter.Limit == 0 || len(orders) < filter.Limit {
+		return nil
+	}
+	cursor := encodeOrderCursor(filter, orders[len(orders)-1])
+	return &cursor
+}
+
+func sortKey(filter *repositories.OrderFilter) string {
+	if filter.Ascending {
+		return filter.Sort
+	}
+	return "-" + filter.Sort
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+const maxRefundReasonLength = 500
+
+type RefundHandler struct {
+	refunds     *services.RefundService
+	bookingRepo *repositories.BookingRepository
+}
+
+func NewRefundHandler(refunds *services.RefundService, bookingRepo *repositories.BookingRepository) *RefundHandler {
+	return &RefundHandler{
+		refunds:     refunds,
+		bookingRepo: bookingRepo,
+	}
+}
+
+// CreateRefund handles POST /api/orders/{id}/refunds. The type may be left out
+// when ticketIds or amount makes it clear.
+func (h *RefundHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid order ID")
+		return
+	}
+
+	var req models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
+	if req.Type == "" {
+		switch {
+		case len(req.TicketIDs) > 0:
+			req.Type = repositories.RefundTickets
+		case req.Amount != nil:
+			req.Type = repositories.RefundAmount
+		}
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		BadRequest(w, "reason is required")
+		return
+	}
+	if utf8.RuneCountInString(req.Reason) > maxRefundReasonLength {
+		BadRequest(w, "reason must be at most 500 characters")
+		return
+	}
+
+	switch req.Type {
+	case repositories.RefundFull:
+		if len(req.TicketIDs) > 0 || req.Amount != nil {
+			BadRequest(w, "A FULL refund takes neither ticketIds nor amount")
+			return
+		}
+	case repositories.RefundTickets:
+		if len(req.TicketIDs) == 0 || req.Amount != nil {
+			BadRequest(w, "A TICKETS refund needs ticketIds and no amount")
+			return
+		}
+		for _, id := range req.TicketIDs {
+			if id <= 0 {
+				BadRequest(w, "ticketIds must be positive integers")
+				return
+			}
+		}
+	case repositories.RefundAmount:
+		if req.Amount == nil || len(req.TicketIDs) > 0 {
+			BadRequest(w, "An AMOUNT refund needs amount and no ticketIds")
+			return
+		}
+		cents := *req.Amount * 100
+		if *req.Amount <= 0 || math.Abs(cents-math.Round(cents)) > 1e-6 {
+			BadRequest(w, "amount must be positive with at most two decimal places")
+			return
+		}
+		if req.Restock {
+			BadRequest(w, "restock applies only to refunds that cover tickets")
+			return
+		}
+	default:
+		BadRequest(w, "type must be FULL, TICKETS or AMOUNT")
+		return
+	}
+
+	refund, err := h.refunds.Refund(orderID, &req, authClaims(r).UserID, auditActor(r))
+	if err != nil {
+		switch err {
+		case services.ErrNotFound:
+			NotFound(w, "Order not found")
+		case services.ErrRefundExceedsBalance:
+			Conflict(w, "REFUND_EXCEEDS_BALANCE", "The refund is larger than the order's refundable balance")
+		case services.ErrNothingToRefund:
+			Conflict(w, "NOTHING_TO_REFUND", "The order has already been fully refunded")
+		case services.ErrTicketAlreadyRefunded:
+			Conflict(w, "TICKET_ALREADY_REFUNDED", "One or more tickets have already been refunded")
+		case services.ErrTicketNotInOrder:
+			Error(w, http.StatusUnprocessableEntity, "TICKET_NOT_IN_ORDER", "One or more tickets do not belong to this order")
+		default:
+			InternalServerError(w, "Failed to issue refund")
+		}
+		return
+	}
+
+	JSON(w, http.StatusCreated, refundToResponse(refund))
+}
+
+// ListRefunds handles GET /api/orders/{id}/refunds
+func (h *RefundHandler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid order ID")
+		return
+	}
+
+	order, err := h.bookingRepo.GetOrderByID(orderID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Order not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch order")
+		return
+	}
+
+	refunds, err := h.refunds.List(orderID)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch refunds")
+		return
+	}
+
+	total, _ := strconv.ParseFloat(order.Amount, 64)
+	resp := &models.OrderRefundsResponse{
+		OrderID:           order.ID,
+		TotalAmount:       total,
+		RefundedAmount:    order.RefundedAmount,
+		RefundableBalance: math.Round((total-order.RefundedAmount)*100) / 100,
+		Refunds:           make([]*models.RefundResponse, 0, len(refunds)),
+	}
+	for _, refund := range refunds {
+		resp.Refunds = append(resp.Refunds, refundToResponse(refund))
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+func refundToResponse(refund *models.OrderRefund) *models.RefundResponse {
+	resp := &models.RefundResponse{
+		ID:             refund.ID,
+		OrderID:        refund.OrderID,
+		Type:           refund.Type,
+		Amount:         refund.Amount,
+		Reason:         refund.Reason,
+		OperatorUserID: refund.OperatorUserID,
+		Restocked:      refund.Restocked,
+		TicketIDs:      refund.TicketIDs,
+		CreatedAt:      refund.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if resp.TicketIDs == nil {
+		resp.TicketIDs = []int{}
+	}
+	return resp
+}
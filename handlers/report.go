@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+const (
+	defaultTopSections = 10
+	maxTopSections     = 100
+)
+
+type ReportHandler struct {
+	reports *services.ReportService
+}
+
+func NewReportHandler(reports *services.ReportService) *ReportHandler {
+	return &ReportHandler{
+		reports: reports,
+	}
+}
+
+// GetEventSales handles GET /api/admin/reports/events/{id}/sales
+func (h *ReportHandler) GetEventSales(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+
+	h.salesReport(w, r, &repositories.SalesScope{EventID: eventID}, fmt.Sprintf("event-%d-sales", eventID))
+}
+
+// GetEventDateSales handles GET /api/admin/reports/event-dates/{id}/sales
+func (h *ReportHandler) GetEventDateSales(w http.ResponseWriter, r *http.Request) {
+	eventDateID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event date ID")
+		return
+	}
+
+	h.salesReport(w, r, &repositories.SalesScope{EventDateID: eventDateID}, fmt.Sprintf("event-date-%d-sales", eventDateID))
+}
+
+// salesReport reads the shared query parameters: from and to (RFC3339, on the
+// order's creation time), interval (hour or day), sections (how many top
+// sections to list), and format=csv with table=tiers|dates|velocity|sections
+func (h *ReportHandler) salesReport(w http.ResponseWriter, r *http.Request, scope *repositories.SalesScope, filename string) {
+	query := r.URL.Query()
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "from must be an RFC3339 timestamp")
+			return
+		}
+		scope.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "to must be an RFC3339 timestamp")
+			return
+		}
+		scope.To = &to
+	}
+	if scope.From != nil && scope.To != nil && !scope.From.Before(*scope.To) {
+		BadRequest(w, "from must be before to")
+		return
+	}
+
+	interval := strings.ToLower(strings.TrimSpace(query.Get("interval")))
+	if interval == "" {
+		interval = repositories.IntervalDay
+	}
+	if interval != repositories.IntervalHour && interval != repositories.IntervalDay {
+		BadRequest(w, "interval must be hour or day")
+		return
+	}
+
+	topSections := defaultTopSections
+	if value := query.Get("sections"); value != "" {
+		var err error
+		if topSections, err = strconv.Atoi(value); err != nil || topSections <= 0 || topSections > maxTopSections {
+			BadRequest(w, "sections must be between 1 and 100")
+			return
+		}
+	}
+
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+	if format != "" && format != "json" && format != "csv" {
+		BadRequest(w, "format must be json or csv")
+		return
+	}
+	table := strings.ToLower(strings.TrimSpace(query.Get("table")))
+	if table == "" {
+		table = services.ReportTableTiers
+	}
+	switch table {
+	case services.ReportTableTiers, services.ReportTableDates, services.ReportTableVelocity, services.ReportTableSections:
+	default:
+		BadRequest(w, "table must be tiers, dates, velocity or sections")
+		return
+	}
+
+	report, err := h.reports.SalesReport(scope, interval, topSections)
+	if err != nil {
+		if err == services.ErrNotFound {
+			if scope.EventDateID != 0 {
+				NotFound(w, "Event date not found")
+			} else {
+				NotFound(w, "Event not found")
+			}
+			return
+		}
+		InternalServerError(w, "Failed to build sales report")
+		return
+	}
+
+	if format != "csv" {
+		JSON(w, http.StatusOK, report)
+		return
+	}
+
+	data, err := h.reports.SalesReportCSV(report, table)
+	if err != nil {
+		InternalServerError(w, "Failed to render sales report")
+		return
+	}
+	Attachment(w, "text/csv; charset=utf-8", filename+"-"+table+".csv", data)
+}
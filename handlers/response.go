@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"ticketbooth-backend/models"
+	"time"
 )
 
 // JSON writes a JSON response
@@ -13,6 +16,24 @@ func JSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// PDF writes a PDF document for inline display, with a filename for saving
+func PDF(w http.ResponseWriter, filename string, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// Attachment writes a file for download
+func Attachment(w http.ResponseWriter, contentType string, filename string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
 // Error writes an error response
 func Error(w http.ResponseWriter, status int, errorCode string, message string) {
 	JSON(w, status, models.ErrorResponse{
@@ -41,6 +62,21 @@ func Unauthorized(w http.ResponseWriter, message string) {
 	Error(w, http.StatusUnauthorized, "UNAUTHORIZED", message)
 }
 
+// Forbidden writes a 403 response
+func Forbidden(w http.ResponseWriter, errorCode string, message string) {
+	Error(w, http.StatusForbidden, errorCode, message)
+}
+
+// TooManyRequests writes a 429 response with a Retry-After header in whole seconds
+func TooManyRequests(w http.ResponseWriter, errorCode string, message string, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	Error(w, http.StatusTooManyRequests, errorCode, message)
+}
+
 // InternalServerError writes a 500 response
 func InternalServerError(w http.ResponseWriter, message string) {
 	Error(w, http.StatusInternalServerError, "INTERNAL_ERROR", message)
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+type contextKey string
+
+const authClaimsKey contextKey = "authClaims"
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer <accessToken>"
+// and makes the token's claims available through authClaims
+func RequireAuth(auth *services.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || strings.TrimSpace(token) == "" {
+				Unauthorized(w, "Missing access token")
+				return
+			}
+
+			claims, err := auth.Authenticate(strings.TrimSpace(token))
+			if err != nil {
+				if err == services.ErrUnauthenticated {
+					Unauthorized(w, "Invalid or expired access token")
+					return
+				}
+				InternalServerError(w, "Failed to authenticate")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authClaimsKey, claims)))
+		})
+	}
+}
+
+// RequireRole rejects authenticated users holding none of the roles. It must
+// run after RequireAuth.
+func RequireRole(roleRepo *repositories.RoleRepository, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := roleRepo.HasAnyRole(authClaims(r).UserID, roles...)
+			if err != nil {
+				InternalServerError(w, "Failed to check permissions")
+				return
+			}
+			if !allowed {
+				Forbidden(w, "FORBIDDEN", "You do not have permission to do this")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authClaims returns the claims set by RequireAuth
+func authClaims(r *http.Request) *services.AccessClaims {
+	claims, _ := r.Context().Value(authClaimsKey).(*services.AccessClaims)
+	return claims
+}
+
+// ownerOrStaff reports whether the authenticated caller is ownerID or holds a
+// role that may look after any customer's orders and tickets
+func ownerOrStaff(roleRepo *repositories.RoleRepository, r *http.Request, ownerID int) (bool, error) {
+	claims := authClaims(r)
+	if claims == nil {
+		return false, nil
+	}
+	if ownerID != 0 && claims.UserID == ownerID {
+		return true, nil
+	}
+	return roleRepo.HasAnyRole(claims.UserID, repositories.RoleAdmin, repositories.RoleBoxOffice)
+}
+
+// auditActor describes who is making the request, for the audit log
+func auditActor(r *http.Request) *models.AuditActor {
+	actor := &models.AuditActor{
+		RequestID: middleware.GetReqID(r.Context()),
+		IPAddress: clientIP(r),
+	}
+	if claims := authClaims(r); claims != nil {
+		userID := claims.UserID
+		actor.UserID = &userID
+	}
+	return actor
+}
+
+// clientIP returns the address of the connecting client without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type SessionHandler struct {
+	auth *services.AuthService
+}
+
+func NewSessionHandler(auth *services.AuthService) *SessionHandler {
+	return &SessionHandler{
+		auth: auth,
+	}
+}
+
+// Refresh handles POST /api/token/refresh
+func (h *SessionHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	refreshToken := strings.TrimSpace(req.RefreshToken)
+	if refreshToken == "" {
+		BadRequest(w, "refreshToken is required")
+		return
+	}
+
+	pair, err := h.auth.Refresh(refreshToken)
+	if err != nil {
+		switch err {
+		case services.ErrRefreshTokenReused:
+			Error(w, http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token was already used; the session has been revoked")
+		case services.ErrInvalidRefreshToken:
+			Error(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Refresh token is invalid or the session has ended")
+		default:
+			InternalServerError(w, "Failed to refresh session")
+		}
+		return
+	}
+
+	JSON(w, http.StatusOK, tokenPairToResponse(pair, nil))
+}
+
+// Logout handles POST /api/logout
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.auth.Logout(authClaims(r)); err != nil {
+		InternalServerError(w, "Failed to log out")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions handles GET /api/sessions
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims := authClaims(r)
+
+	sessions, err := h.auth.ListSessions(claims.UserID)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch sessions")
+		return
+	}
+
+	response := make([]*models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, &models.SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt.UTC().Format(time.RFC3339),
+			LastUsedAt: session.LastUsedAt.UTC().Format(time.RFC3339),
+			ExpiresAt:  session.ExpiresAt.UTC().Format(time.RFC3339),
+			Current:    session.ID == claims.SessionID,
+		})
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// RevokeSession handles DELETE /api/sessions/{id}
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid session ID")
+		return
+	}
+
+	if err := h.auth.RevokeSession(authClaims(r).UserID, sessionID); err != nil {
+		if err == services.ErrSessionNotFound {
+			NotFound(w, "Session not found")
+			return
+		}
+		InternalServerError(w, "Failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAll handles POST /api/sessions/revoke-all
+func (h *SessionHandler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	revoked, err := h.auth.RevokeAll(authClaims(r).UserID, repositories.SessionRevokedAll)
+	if err != nil {
+		InternalServerError(w, "Failed to revoke sessions")
+		return
+	}
+
+	JSON(w, http.StatusOK, &models.RevokeSessionsResponse{Revoked: revoked})
+}
+
+func tokenPairToResponse(pair *services.TokenPair, user *models.UserResponse) *models.LoginResponse {
+	return &models.LoginResponse{
+		Token:        pair.AccessToken,
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    pair.ExpiresIn,
+		User:         user,
+	}
+}
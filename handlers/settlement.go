@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+type SettlementHandler struct {
+	settlements *services.SettlementService
+}
+
+func NewSettlementHandler(settlements *services.SettlementService) *SettlementHandler {
+	return &SettlementHandler{
+		settlements: settlements,
+	}
+}
+
+// RunSettlements handles POST /api/admin/settlements. It settles the period
+// for the given organizer, or for every organizer when organizerId is left
+// out.
+func (h *SettlementHandler) RunSettlements(w http.ResponseWriter, r *http.Request) {
+	var req models.SettlementRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, req.PeriodStart)
+	if err != nil {
+		BadRequest(w, "periodStart must be an RFC3339 timestamp")
+		return
+	}
+	end, err := time.Parse(time.RFC3339, req.PeriodEnd)
+	if err != nil {
+		BadRequest(w, "periodEnd must be an RFC3339 timestamp")
+		return
+	}
+	if !start.Before(end) {
+		BadRequest(w, "periodStart must be before periodEnd")
+		return
+	}
+
+	organizerID := 0
+	if req.OrganizerID != nil {
+		if *req.OrganizerID <= 0 {
+			BadRequest(w, "organizerId must be a positive integer")
+			return
+		}
+		organizerID = *req.OrganizerID
+	}
+
+	settlements, unassigned, err := h.settlements.Run(start, end, organizerID, authClaims(r).UserID, auditActor(r))
+	if err != nil {
+		if err == services.ErrSettlementPeriodOpen {
+			Conflict(w, "SETTLEMENT_PERIOD_OPEN", "periodEnd is in the future; only closed periods can be settled")
+			return
+		}
+		InternalServerError(w, "Failed to run settlement")
+		return
+	}
+
+	resp := &models.SettlementRunResponse{
+		Settlements:      make([]*models.SettlementResponse, 0, len(settlements)),
+		UnassignedOrders: unassigned,
+	}
+	for _, settlement := range settlements {
+		resp.Settlements = append(resp.Settlements, settlementToResponse(settlement))
+	}
+
+	JSON(w, http.StatusCreated, resp)
+}
+
+// ListSettlements handles GET /api/admin/settlements. Filters: organizerId,
+// from and to (RFC3339, against the period end), before (settlement ID) and
+// limit.
+func (h *SettlementHandler) ListSettlements(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &repositories.SettlementFilter{}
+
+	var err error
+	if value := query.Get("organizerId"); value != "" {
+		if filter.OrganizerID, err = strconv.Atoi(value); err != nil || filter.OrganizerID <= 0 {
+			BadRequest(w, "organizerId must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("before"); value != "" {
+		if filter.Before, err = strconv.Atoi(value); err != nil || filter.Before <= 0 {
+			BadRequest(w, "before must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 {
+			BadRequest(w, "limit must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "from must be an RFC3339 timestamp")
+			return
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			BadRequest(w, "to must be an RFC3339 timestamp")
+			return
+		}
+		filter.To = &to
+	}
+
+	settlements, err := h.settlements.List(filter)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch settlements")
+		return
+	}
+
+	resp := &models.SettlementListResponse{
+		Settlements: make([]*models.SettlementResponse, 0, len(settlements)),
+	}
+	for _, settlement := range settlements {
+		resp.Settlements = append(resp.Settlements, settlementToResponse(settlement))
+	}
+	if len(settlements) == filter.Limit {
+		next := settlements[len(settlements)-1].ID
+		resp.NextBefore = &next
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// GetSettlement handles GET /api/admin/settlements/{id}
+func (h *SettlementHandler) GetSettlement(w http.ResponseWriter, r *http.Request) {
+	settlement, ok := h.loadSettlement(w, r)
+	if !ok {
+		return
+	}
+
+	JSON(w, http.StatusOK, settlementToResponse(settlement))
+}
+
+// DownloadStatement handles GET /api/admin/settlements/{id}/statement. The
+// format query parameter is csv (the default) or json.
+func (h *SettlementHandler) DownloadStatement(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		BadRequest(w, "format must be csv or json")
+		return
+	}
+
+	settlement, ok := h.loadSettlement(w, r)
+	if !ok {
+		return
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(settlementToResponse(settlement), "", "  ")
+		if err != nil {
+			InternalServerError(w, "Failed to render statement")
+			return
+		}
+		Attachment(w, "application/json", settlement.Reference+".json", data)
+		return
+	}
+
+	data, err := h.settlements.StatementCSV(settlement)
+	if err != nil {
+		InternalServerError(w, "Failed to render statement")
+		return
+	}
+	Attachment(w, "text/csv; charset=utf-8", settlement.Reference+".csv", data)
+}
+
+func (h *SettlementHandler) loadSettlement(w http.ResponseWriter, r *http.Request) (*models.Settlement, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid settlement ID")
+		return nil, false
+	}
+
+	settlement, err := h.settlements.Get(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Settlement not found")
+			return nil, false
+		}
+		InternalServerError(w, "Failed to fetch settlement")
+		return nil, false
+	}
+
+	return settlement, true
+}
+
+func settlementToResponse(settlement *models.Settlement) *models.SettlementResponse {
+	resp := &models.SettlementResponse{
+		ID:            settlement.ID,
+		Reference:     settlement.Reference,
+		OrganizerID:   settlement.OrganizerID,
+		OrganizerName: settlement.OrganizerName,
+		PeriodStart:   settlement.PeriodStart.UTC().Format(time.RFC3339),
+		PeriodEnd:     settlement.PeriodEnd.UTC().Format(time.RFC3339),
+		OrderCount:    settlement.OrderCount,
+		RefundCount:   settlement.RefundCount,
+		GrossSales:    settlement.GrossSales,
+		Refunds:       settlement.Refunds,
+		PlatformFees:  settlement.PlatformFees,
+		Tax:           settlement.Tax,
+		NetPayout:     settlement.NetPayout,
+		CreatedBy:     settlement.CreatedBy,
+		CreatedAt:     settlement.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	for _, line := range settlement.Lines {
+		resp.Lines = append(resp.Lines, &models.SettlementLineResponse{
+			EventID:      line.EventID,
+			EventTitle:   line.EventTitle,
+			OrderCount:   line.OrderCount,
+			RefundCount:  line.RefundCount,
+			GrossSales:   line.GrossSales,
+			Refunds:      line.Refunds,
+			PlatformFees: line.PlatformFees,
+			Tax:          line.Tax,
+			NetPayout:    line.NetPayout,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/skip2/go-qrcode"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+type TicketHandler struct {
+	ticketRepo  *repositories.TicketRepository
+	roleRepo    *repositories.RoleRepository
+	credentials *services.CredentialService
+	documents   *services.DocumentService
+	wallet      *services.WalletService
+}
+
+func NewTicketHandler(ticketRepo *repositories.TicketRepository, roleRepo *repositories.RoleRepository, credentials *services.CredentialService, documents *services.DocumentService, wallet *services.WalletService) *TicketHandler {
+	return &TicketHandler{
+		ticketRepo:  ticketRepo,
+		roleRepo:    roleRepo,
+		credentials: credentials,
+		documents:   documents,
+		wallet:      wallet,
+	}
+}
+
+// GetTicketQR handles GET /api/tickets/{id}/qr?format=png|svg&size=256
+func (h *TicketHandler) GetTicketQR(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid ticket ID")
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		BadRequest(w, "format must be png or svg")
+		return
+	}
+
+	size := defaultQRSize
+	if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			BadRequest(w, fmt.Sprintf("size must be between %d and %d", minQRSize, maxQRSize))
+			return
+		}
+	}
+
+	ticket, ok := h.loadTicket(w, r, id)
+	if !ok {
+		return
+	}
+
+	credential, err := h.credentials.IssueForTicket(ticket)
+	if err != nil {
+		InternalServerError(w, "Failed to issue ticket credential")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if format == "svg" {
+		svg, err := renderQRCodeSVG(credential, size)
+		if err != nil {
+			InternalServerError(w, "Failed to render QR code")
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(svg)
+		return
+	}
+
+	png, err := qrcode.Encode(credential, qrcode.Medium, size)
+	if err != nil {
+		InternalServerError(w, "Failed to render QR code")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(png)
+}
+
+// GetTicketPDF handles GET /api/tickets/{id}/pdf
+func (h *TicketHandler) GetTicketPDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid ticket ID")
+		return
+	}
+
+	ticket, ok := h.loadTicket(w, r, id)
+	if !ok {
+		return
+	}
+
+	document, err := h.documents.RenderTicketPDF(ticket)
+	if err != nil {
+		InternalServerError(w, "Failed to render ticket PDF")
+		return
+	}
+
+	PDF(w, fmt.Sprintf("ticket-%d.pdf", ticket.ID), document)
+}
+
+// GetTicketWallet handles GET /api/tickets/{id}/wallet?type=pkpass|google
+func (h *TicketHandler) GetTicketWallet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid ticket ID")
+		return
+	}
+
+	passType := strings.ToLower(r.URL.Query().Get("type"))
+	if passType != "pkpass" && passType != "google" {
+		BadRequest(w, "type must be pkpass or google")
+		return
+	}
+
+	ticket, ok := h.loadTicket(w, r, id)
+	if !ok {
+		return
+	}
+
+	if passType == "google" {
+		pass, err := h.wallet.GooglePass(ticket)
+		if err != nil {
+			walletError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		JSON(w, http.StatusOK, pass)
+		return
+	}
+
+	pass, err := h.wallet.ApplePass(ticket)
+	if err != nil {
+		walletError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", pass.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", pass.Filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pass.Data)
+}
+
+// loadTicket fetches a ticket for its holder or staff. Anyone else gets the
+// same 404 as for a missing ticket, so ticket IDs cannot be probed.
+func (h *TicketHandler) loadTicket(w http.ResponseWriter, r *http.Request, id int) (*models.Ticket, bool) {
+	ticket, err := h.ticketRepo.GetTicketByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Ticket not found")
+			return nil, false
+		}
+		InternalServerError(w, "Failed to fetch ticket")
+		return nil, false
+	}
+
+	ownerID, _ := strconv.Atoi(ticket.UserID)
+	allowed, err := ownerOrStaff(h.roleRepo, r, ownerID)
+	if err != nil {
+		InternalServerError(w, "Failed to check permissions")
+		return nil, false
+	}
+	if !allowed {
+		NotFound(w, "Ticket not found")
+		return nil, false
+	}
+
+	if ticket.RefundedAt != nil {
+		ticketRefunded(w)
+		return nil, false
+	}
+	return ticket, true
+}
+
+// ticketRefunded answers requests for a refunded ticket's QR code, PDF or
+// wallet pass, none of which would admit anyone
+func ticketRefunded(w http.ResponseWriter) {
+	Error(w, http.StatusGone, services.CheckInTicketRefunded, "Ticket has been refunded and is no longer valid")
+}
+
+func walletError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrWalletNotConfigured) {
+		Error(w, http.StatusNotImplemented, services.ErrWalletNotConfigured.Error(), "This wallet pass type is not configured")
+		return
+	}
+	InternalServerError(w, "Failed to build wallet pass")
+}
+
+// GetSigningKeys handles GET /api/events/{id}/signing-keys
+// Scanners cache these public keys to verify credentials while offline.
+func (h *TicketHandler) GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+
+	keys, err := h.credentials.ListKeys(eventID)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch signing keys")
+		return
+	}
+
+	response := make([]*models.SigningKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, signingKeyToResponse(key))
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// RotateSigningKey handles POST /api/events/{id}/signing-keys/rotate
+func (h *TicketHandler) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, "Invalid event ID")
+		return
+	}
+
+	var req models.RotateSigningKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			BadRequest(w, "Invalid request body")
+			return
+		}
+	}
+
+	key, err := h.credentials.RotateKey(eventID, req.RevokePrevious, auditActor(r))
+	if err != nil {
+		if isDuplicateEntryError(err) {
+			Conflict(w, "ROTATION_IN_PROGRESS", "The signing key was rotated concurrently, try again")
+			return
+		}
+		InternalServerError(w, "Failed to rotate signing key")
+		return
+	}
+
+	JSON(w, http.StatusCreated, signingKeyToResponse(key))
+}
+
+func signingKeyToResponse(key *models.SigningKey) *models.SigningKeyResponse {
+	resp := &models.SigningKeyResponse{
+		KeyID:     key.KeyID,
+		Algorithm: "Ed25519",
+		PublicKey: key.PublicKey,
+		Status:    key.Status,
+	}
+
+	if key.CreatedAt != nil {
+		created := key.CreatedAt.Format(time.RFC3339)
+		resp.CreatedAt = &created
+	}
+
+	if key.RetiredAt != nil {
+		retired := key.RetiredAt.Format(time.RFC3339)
+		resp.RetiredAt = &retired
+	}
+
+	return resp
+}
+
+// renderQRCodeSVG draws the QR code as one SVG path of unit squares scaled to size
+func renderQRCodeSVG(content string, size int) ([]byte, error) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := code.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	svg := fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+			`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`,
+		size, size, modules, modules, path.String(),
+	)
+	return []byte(svg), nil
+}
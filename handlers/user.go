@@ -1,13 +1,12 @@
 package handlers
 
 import (
-	"crypto/sha256"
 	"database/sql"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/mail"
 	"strconv"
 	"strings"
 	"time"
@@ -15,17 +14,29 @@ import (
 	"github.com/go-chi/chi/v5"
 	"ticketbooth-backend/models"
 	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/services"
 )
 
 type UserHandler struct {
 	userRepo   *repositories.UserRepository
+	roleRepo   *repositories.RoleRepository
 	authSecret string
+	accounts   *services.AccountService
+	mfa        *services.MFAService
+	throttle   *services.LoginThrottle
+	// requireEmailVerification blocks login until the user verifies their email
+	requireEmailVerification bool
 }
 
-func NewUserHandler(userRepo *repositories.UserRepository, authSecret string) *UserHandler {
+func NewUserHandler(userRepo *repositories.UserRepository, roleRepo *repositories.RoleRepository, authSecret string, accounts *services.AccountService, mfa *services.MFAService, throttle *services.LoginThrottle, requireEmailVerification bool) *UserHandler {
 	return &UserHandler{
-		userRepo:   userRepo,
-		authSecret: authSecret,
+		userRepo:                 userRepo,
+		roleRepo:                 roleRepo,
+		authSecret:               authSecret,
+		accounts:                 accounts,
+		mfa:                      mfa,
+		throttle:                 throttle,
+		requireEmailVerification: requireEmailVerification,
 	}
 }
 
@@ -37,7 +48,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, ok := h.processUserCreation(&req, w)
+	resp, ok := h.processUserCreation(&req, w, r)
 	if !ok {
 		return
 	}
@@ -53,7 +64,7 @@ func (h *UserHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, ok := h.processUserCreation(&req, w)
+	resp, ok := h.processUserCreation(&req, w, r)
 	if !ok {
 		return
 	}
@@ -61,7 +72,8 @@ func (h *UserHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	JSON(w, http.StatusCreated, resp)
 }
 
-// UpdateUser handles PUT /api/users/{id}
+// UpdateUser handles PUT /api/users/{id}. Users may only edit themselves;
+// admins may edit anyone.
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
@@ -70,6 +82,18 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if claims := authClaims(r); claims.UserID != id {
+		isAdmin, err := h.roleRepo.HasAnyRole(claims.UserID, repositories.RoleAdmin)
+		if err != nil {
+			InternalServerError(w, "Failed to check permissions")
+			return
+		}
+		if !isAdmin {
+			Forbidden(w, "FORBIDDEN", "You can only update your own account")
+			return
+		}
+	}
+
 	var req models.UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		BadRequest(w, "Invalid request body")
@@ -119,7 +143,8 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userRepo.UpdateUser(id, updates); err != nil {
+	previousUser, updatedUser, err := h.accounts.UpdateProfile(id, updates, auditActor(r))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			NotFound(w, "User not found")
 			return
@@ -132,26 +157,139 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updatedUser, err := h.userRepo.GetUserByID(id)
+	// A new address has to be verified again
+	if previousUser.Email != updatedUser.Email {
+		if err := h.accounts.SendVerification(updatedUser, preferredLanguage(r.Header.Get("Accept-Language"))); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", updatedUser.ID, err)
+		}
+	}
+
+	JSON(w, http.StatusOK, userToResponse(updatedUser))
+}
+
+// Me handles GET /api/me
+func (h *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userRepo.GetUserByID(authClaims(r).UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			NotFound(w, "User not found")
+			Unauthorized(w, "User no longer exists")
 			return
 		}
-		InternalServerError(w, "Failed to load updated user")
+		InternalServerError(w, "Failed to fetch user")
 		return
 	}
 
-	JSON(w, http.StatusOK, userToResponse(updatedUser))
+	roles, err := h.roleRepo.GetUserRoles(user.ID)
+	if err != nil {
+		InternalServerError(w, "Failed to fetch roles")
+		return
+	}
+
+	resp := userToResponse(user)
+	resp.Roles = roles
+	JSON(w, http.StatusOK, resp)
+}
+
+// ChangePassword handles PUT /api/me/password. Other sessions are signed out.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	if req.CurrentPassword == "" {
+		BadRequest(w, "currentPassword is required")
+		return
+	}
+	newPassword := strings.TrimSpace(req.NewPassword)
+	if len(newPassword) < 8 {
+		BadRequest(w, "newPassword must be at least 8 characters")
+		return
+	}
+
+	claims := authClaims(r)
+	user, ok := h.checkPasswordThrottle(w, r, claims.UserID)
+	if !ok {
+		return
+	}
+
+	if err := h.accounts.ChangePassword(user.ID, claims.SessionID, req.CurrentPassword, newPassword, auditActor(r)); err != nil {
+		h.passwordError(w, r, user, err, "Failed to change password")
+		return
+	}
+
+	h.throttle.RecordSuccess(user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteMe handles DELETE /api/me. Personal data is anonymized; orders and
+// tickets are kept for accounting.
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		BadRequest(w, "Invalid request body")
+		return
+	}
+
+	claims := authClaims(r)
+	user, ok := h.checkPasswordThrottle(w, r, claims.UserID)
+	if !ok {
+		return
+	}
+
+	if err := h.accounts.DeleteAccount(user.ID, claims.SessionID, req.Password, auditActor(r)); err != nil {
+		h.passwordError(w, r, user, err, "Failed to delete account")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkPasswordThrottle loads the signed-in user and applies the login
+// throttle, so password confirmations cannot be used to guess passwords
+func (h *UserHandler) checkPasswordThrottle(w http.ResponseWriter, r *http.Request, userID int) (*models.User, bool) {
+	user, err := h.userRepo.GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			Unauthorized(w, "User no longer exists")
+			return nil, false
+		}
+		InternalServerError(w, "Failed to fetch user")
+		return nil, false
+	}
+
+	if result := h.throttle.Check(user.Email, user, clientIP(r)); !result.Allowed {
+		if result.Locked {
+			TooManyRequests(w, "LOGIN_LOCKED", "Too many failed attempts; try again later", result.RetryAfter)
+		} else {
+			TooManyRequests(w, "LOGIN_THROTTLED", "Too many failed attempts; wait before retrying", result.RetryAfter)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *UserHandler) passwordError(w http.ResponseWriter, r *http.Request, user *models.User, err error, fallback string) {
+	switch err {
+	case services.ErrInvalidPassword:
+		h.throttle.RecordFailure(user.Email, user, clientIP(r))
+		Error(w, http.StatusUnauthorized, "INVALID_PASSWORD", "Password is incorrect")
+	case services.ErrReauthenticationRequired:
+		Forbidden(w, "REAUTHENTICATION_REQUIRED", "Log in again before deleting your account")
+	default:
+		InternalServerError(w, fallback)
+	}
 }
 
 func userToResponse(user *models.User) *models.UserResponse {
 	resp := &models.UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Email:     user.Email,
+		ID:            user.ID,
+		Username:      user.Username,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
 	}
 
 	if user.CreatedAt != nil {
@@ -175,14 +313,14 @@ func isDuplicateEntryError(err error) bool {
 	return strings.Contains(errStr, "Duplicate entry")
 }
 
-func (h *UserHandler) processUserCreation(req *models.CreateUserRequest, w http.ResponseWriter) (*models.UserResponse, bool) {
+func (h *UserHandler) processUserCreation(req *models.CreateUserRequest, w http.ResponseWriter, r *http.Request) (*models.UserResponse, bool) {
 	firstName, lastName, email, username, password, errMsg := normalizeCreateUserPayload(req)
 	if errMsg != "" {
 		BadRequest(w, errMsg)
 		return nil, false
 	}
 
-	resp, err := h.createUserRecord(firstName, lastName, email, username, password)
+	user, err := h.createUserRecord(firstName, lastName, email, username, password)
 	if err != nil {
 		if isDuplicateEntryError(err) {
 			Conflict(w, "USER_EXISTS", "A user with that email already exists")
@@ -192,10 +330,15 @@ func (h *UserHandler) processUserCreation(req *models.CreateUserRequest, w http.
 		return nil, false
 	}
 
-	return resp, true
+	// The account exists either way; the user can ask for another link via /api/email/resend
+	if err := h.accounts.SendVerification(user, preferredLanguage(r.Header.Get("Accept-Language"))); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	return userToResponse(user), true
 }
 
-func (h *UserHandler) createUserRecord(firstName, lastName, email, username, password string) (*models.UserResponse, error) {
+func (h *UserHandler) createUserRecord(firstName, lastName, email, username, password string) (*models.User, error) {
 	user := &models.User{
 		Username:       username,
 		FirstName:      firstName,
@@ -209,12 +352,7 @@ func (h *UserHandler) createUserRecord(firstName, lastName, email, username, pas
 		return nil, err
 	}
 
-	createdUser, err := h.userRepo.GetUserByID(int(userID))
-	if err != nil {
-		return nil, err
-	}
-
-	return userToResponse(createdUser), nil
+	return h.userRepo.GetUserByID(int(userID))
 }
 
 func normalizeCreateUserPayload(req *models.CreateUserRequest) (string, string, string, string, string, string) {
@@ -246,11 +384,25 @@ func normalizeCreateUserPayload(req *models.CreateUserRequest) (string, string,
 	return firstName, lastName, email, username, password, ""
 }
 
+// normalizeEmail lowercases a bare address and returns "" unless it is a
+// well-formed addr-spec with a dotted domain
 func normalizeEmail(email string) string {
 	email = strings.TrimSpace(strings.ToLower(email))
-	if email == "" || !strings.Contains(email, "@") {
+	if email == "" || len(email) > 255 {
+		return ""
+	}
+
+	parsed, err := mail.ParseAddress(email)
+	if err != nil || parsed.Address != email || parsed.Name != "" {
 		return ""
 	}
+
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return ""
+	}
+
 	return email
 }
 
@@ -263,15 +415,7 @@ func normalizeUsername(username string) string {
 }
 
 func (h *UserHandler) hashPassword(password string) string {
-	sum := sha256.Sum256([]byte(h.authSecret + ":" + password))
-	return hex.EncodeToString(sum[:])
-}
-
-func (h *UserHandler) generateToken(user *models.User) string {
-	payload := fmt.Sprintf("%d:%s:%d", user.ID, user.Email, time.Now().Unix())
-	sig := sha256.Sum256([]byte(h.authSecret + ":" + payload))
-	token := payload + ":" + hex.EncodeToString(sig[:])
-	return base64.StdEncoding.EncodeToString([]byte(token))
+	return services.HashPassword(h.authSecret, password)
 }
 
 // Login handles POST /api/login
@@ -288,45 +432,69 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user *models.User
+	var identifier string
 	var err error
 
 	if req.Email != nil && strings.TrimSpace(*req.Email) != "" {
-		email := normalizeEmail(*req.Email)
-		if email == "" {
+		identifier = normalizeEmail(*req.Email)
+		if identifier == "" {
 			BadRequest(w, "email must be valid")
 			return
 		}
-		user, err = h.userRepo.GetUserByEmail(email)
+		user, err = h.userRepo.GetUserByEmail(identifier)
 	} else if req.Username != nil && strings.TrimSpace(*req.Username) != "" {
-		username := normalizeUsername(*req.Username)
-		if username == "" {
+		identifier = normalizeUsername(*req.Username)
+		if identifier == "" {
 			BadRequest(w, "username must be valid")
 			return
 		}
-		user, err = h.userRepo.GetUserByUsername(username)
+		user, err = h.userRepo.GetUserByUsername(identifier)
 	} else {
 		BadRequest(w, "email or username is required")
 		return
 	}
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			Unauthorized(w, "Invalid credentials")
+		if err != sql.ErrNoRows {
+			InternalServerError(w, "Failed to fetch user")
 			return
 		}
-		InternalServerError(w, "Failed to fetch user")
+		user = nil
+	}
+
+	ip := clientIP(r)
+	if result := h.throttle.Check(identifier, user, ip); !result.Allowed {
+		if result.Locked {
+			TooManyRequests(w, "LOGIN_LOCKED", "Too many failed login attempts; try again later", result.RetryAfter)
+			return
+		}
+		TooManyRequests(w, "LOGIN_THROTTLED", "Too many failed login attempts; wait before retrying", result.RetryAfter)
 		return
 	}
 
-	if h.hashPassword(req.Password) != user.HashedPassword {
+	if user == nil || h.hashPassword(req.Password) != user.HashedPassword {
+		h.throttle.RecordFailure(identifier, user, ip)
 		Unauthorized(w, "Invalid credentials")
 		return
 	}
 
-	token := h.generateToken(user)
-	response := &models.LoginResponse{
-		Token: token,
-		User:  userToResponse(user),
+	if h.requireEmailVerification && user.EmailVerifiedAt == nil {
+		Forbidden(w, "EMAIL_NOT_VERIFIED", "Verify your email address before logging in")
+		return
+	}
+
+	result, err := h.mfa.StartLogin(user, r.UserAgent(), ip)
+	if err != nil {
+		InternalServerError(w, "Failed to start session")
+		return
+	}
+
+	// With a second factor pending, failures stay counted until it is verified
+	if result.Challenge != nil {
+		JSON(w, http.StatusOK, mfaChallengeResponse(result.Challenge))
+		return
 	}
-	JSON(w, http.StatusOK, response)
+
+	h.throttle.RecordSuccess(user)
+	JSON(w, http.StatusOK, tokenPairToResponse(result.Session, userToResponse(user)))
 }
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"ticketbooth-backend/repositories"
+)
+
+type VenueHandler struct {
+	venueRepo *repositories.VenueRepository
+}
+
+func NewVenueHandler(venueRepo *repositories.VenueRepository) *VenueHandler {
+	return &VenueHandler{
+		venueRepo: venueRepo,
+	}
+}
+
+// GetVenue handles GET /api/venues/{slug}
+func (h *VenueHandler) GetVenue(w http.ResponseWriter, r *http.Request) {
+	venue, err := h.venueRepo.GetVenueBySlug(chi.URLParam(r, "slug"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			NotFound(w, "Venue not found")
+			return
+		}
+		InternalServerError(w, "Failed to fetch venue")
+		return
+	}
+
+	JSON(w, http.StatusOK, venue)
+}
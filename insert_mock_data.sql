@@ -66,20 +66,20 @@ VALUES
   (2, 4, 50.00, 15);
 
 -- Users
-INSERT INTO user (id, username, name, last_name, email, hashed_password, date_created, date_updated)
+INSERT INTO user (id, username, name, last_name, email, hashed_password, email_verified_at, date_created, date_updated)
 VALUES
-  (1, 'aliceex', 'Alice', 'Example', 'alice123@gmail.com', '52fd0e88bc0677bf4e30963621cb33181947b00eb237cff1b156d333c9a1db6d', NOW(), NOW()),
-  (2, 'bobbyo', 'Bob', 'Organizer', 'organizer@example.com', '1c3cfcc72db6b55b814afbfd8a53163b961e76e743ed81d35cf573f88f738c93', NOW(), NOW());
+  (1, 'aliceex', 'Alice', 'Example', 'alice123@gmail.com', '52fd0e88bc0677bf4e30963621cb33181947b00eb237cff1b156d333c9a1db6d', NOW(), NOW(), NOW()),
+  (2, 'bobbyo', 'Bob', 'Organizer', 'organizer@example.com', '1c3cfcc72db6b55b814afbfd8a53163b961e76e743ed81d35cf573f88f738c93', NOW(), NOW(), NOW());
 
 -- Order
-INSERT INTO `order` (id, User_id, total_tickets, amount, payment_source)
-VALUES (1, 1, 2, '200.00', 'test-card-4242');
+INSERT INTO `order` (id, User_id, total_tickets, amount, payment_source, customer_name, customer_email)
+VALUES (1, 1, 2, '200.00', 'test-card-4242', 'Alice Example', 'alice123@gmail.com');
 
 -- Tickets
-INSERT INTO ticket (id, event_id, user_id, ticket_type_id, to_name, event_date_id, seat_id)
+INSERT INTO ticket (id, event_id, user_id, ticket_type_id, to_name, to_email, event_date_id, seat_id, price, credential_nonce)
 VALUES
-  (1, '1', '1', 14, 'Alice Example', 2, 1),
-  (2, '1', '1', 14, 'Alice Example', 2, 2);
+  (1, '1', '1', 14, 'Alice Example', 'alice123@gmail.com', 2, 1, 100.00, '5f1c0a9e3b7d42c8a6e1f093'),
+  (2, '1', '1', 14, 'Jamie Example', NULL, 2, 2, 100.00, 'c27d94b1e05a4f3d8b6c1e72');
 
 -- Order Tickets Junction
 INSERT INTO order_hast_tickets (Order_id, ticket_id)
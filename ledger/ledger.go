@@ -0,0 +1,288 @@
+// Package ledger models money movements as balanced double-entry
+// transactions. Amounts are whole cents so splits and sums are exact; storage
+// lives in repositories.LedgerRepository.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Account is a ledger account
+type Account string
+
+const (
+	// CustomerReceivable is what customers paid for orders
+	CustomerReceivable Account = "CUSTOMER_RECEIVABLE"
+	// OrganizerPayable is owed to event organizers, net of fees and tax
+	OrganizerPayable Account = "ORGANIZER_PAYABLE"
+	// PlatformFees is the platform's commission
+	PlatformFees Account = "PLATFORM_FEES"
+	// TaxPayable is sales tax collected on behalf of the tax authority
+	TaxPayable Account = "TAX_PAYABLE"
+	// Refunds is what has been returned to customers
+	Refunds Account = "REFUNDS"
+)
+
+// Accounts lists every account in trial balance order
+var Accounts = []Account{CustomerReceivable, OrganizerPayable, PlatformFees, TaxPayable, Refunds}
+
+// NormalDebit reports whether the account normally carries a debit balance
+func (a Account) NormalDebit() bool {
+	return a == CustomerReceivable
+}
+
+func (a Account) valid() bool {
+	for _, account := range Accounts {
+		if a == account {
+			return true
+		}
+	}
+	return false
+}
+
+// Transaction kinds
+const (
+	KindSale   = "SALE"
+	KindRefund = "REFUND"
+)
+
+var (
+	ErrUnbalanced   = errors.New("LEDGER_UNBALANCED")
+	ErrInvalidEntry = errors.New("LEDGER_INVALID_ENTRY")
+)
+
+// Amount is a sum of money in cents
+type Amount int64
+
+// ParseAmount reads a decimal amount such as "12.50"; empty is zero
+func ParseAmount(value string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return FromFloat(f), nil
+}
+
+// FromFloat rounds a decimal amount to cents
+func FromFloat(value float64) Amount {
+	return Amount(math.Round(value * 100))
+}
+
+// Float returns the amount in currency units, for JSON responses
+func (a Amount) Float() float64 {
+	return float64(a) / 100
+}
+
+// String formats the amount with two decimals, as stored in DECIMAL columns
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+// Rates are the platform fee and sales tax in basis points (1/100 of a
+// percent). Ticket prices include tax; the fee is charged on the price net of
+// tax.
+type Rates struct {
+	PlatformFee int64
+	Tax         int64
+}
+
+// ParsePercent reads a percentage such as "5" or "2.75" as basis points
+func ParsePercent(value string) (int64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f < 0 || f >= 100 {
+		return 0, fmt.Errorf("invalid percentage %q", value)
+	}
+	return int64(math.Round(f * 100)), nil
+}
+
+// Split divides a sale between the organizer, the platform and the tax authority
+type Split struct {
+	Organizer Amount
+	Fees      Amount
+	Tax       Amount
+}
+
+// Total is the whole sale the split came from
+func (s Split) Total() Amount {
+	return s.Organizer + s.Fees + s.Tax
+}
+
+// Split divides a gross, tax-inclusive sale; the organizer gets the rounding
+func (r Rates) Split(gross Amount) Split {
+	tax := mulDiv(gross, r.Tax, 10000+r.Tax)
+	fees := mulDiv(gross-tax, r.PlatformFee, 10000)
+	return Split{Organizer: gross - tax - fees, Fees: fees, Tax: tax}
+}
+
+// Share is the part of the split that corresponds to part of its total.
+// Shares are computed cumulatively by callers (Share(refunded after) minus
+// Share(refunded before)) so a full refund reverses the sale exactly.
+func (s Split) Share(part Amount) Split {
+	total := s.Total()
+	if total == 0 || part == total {
+		return s
+	}
+	tax := mulDiv(s.Tax, int64(part), int64(total))
+	fees := mulDiv(s.Fees, int64(part), int64(total))
+	return Split{Organizer: part - tax - fees, Fees: fees, Tax: tax}
+}
+
+// Minus subtracts another split account by account
+func (s Split) Minus(other Split) Split {
+	return Split{Organizer: s.Organizer - other.Organizer, Fees: s.Fees - other.Fees, Tax: s.Tax - other.Tax}
+}
+
+// mulDiv returns amount*num/den rounded half away from zero, without overflow
+func mulDiv(amount Amount, num int64, den int64) Amount {
+	product := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(num))
+	quotient, remainder := new(big.Int).QuoRem(product, big.NewInt(den), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(big.NewInt(den)) >= 0 {
+		if product.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return Amount(quotient.Int64())
+}
+
+// Entry is one side of a transaction; exactly one of Debit and Credit is set
+type Entry struct {
+	Account Account
+	Debit   Amount
+	Credit  Amount
+}
+
+// Transaction is a set of entries that moves money between accounts
+type Transaction struct {
+	ID        int64
+	Kind      string
+	OrderID   int
+	RefundID  *int
+	EventID   int
+	Memo      string
+	CreatedAt time.Time
+	Entries   []Entry
+}
+
+// Validate checks the double-entry invariant: every entry is a positive debit
+// or credit on a known account, and debits equal credits
+func (t *Transaction) Validate() error {
+	if len(t.Entries) < 2 {
+		return fmt.Errorf("%w: a transaction needs at least two entries", ErrInvalidEntry)
+	}
+
+	var debits, credits Amount
+	for _, entry := range t.Entries {
+		if !entry.Account.valid() {
+			return fmt.Errorf("%w: unknown account %q", ErrInvalidEntry, entry.Account)
+		}
+		if entry.Debit < 0 || entry.Credit < 0 || (entry.Debit == 0) == (entry.Credit == 0) {
+			return fmt.Errorf("%w: %s needs either a positive debit or a positive credit", ErrInvalidEntry, entry.Account)
+		}
+		debits += entry.Debit
+		credits += entry.Credit
+	}
+
+	if debits != credits {
+		return fmt.Errorf("%w: debits %s, credits %s", ErrUnbalanced, debits, credits)
+	}
+	return nil
+}
+
+// Sale records an order: the customer's payment is split between the
+// organizer, platform fees and tax
+func Sale(orderID int, eventID int, split Split, at time.Time) *Transaction {
+	t := &Transaction{Kind: KindSale, OrderID: orderID, EventID: eventID, CreatedAt: at}
+	t.debit(CustomerReceivable, split.Total())
+	t.credit(OrganizerPayable, split.Organizer)
+	t.credit(PlatformFees, split.Fees)
+	t.credit(TaxPayable, split.Tax)
+	return t
+}
+
+// Refund records money returned to a customer, taken back from the organizer,
+// fees and tax in the given proportions
+func Refund(orderID int, refundID int, eventID int, split Split, at time.Time) *Transaction {
+	t := &Transaction{Kind: KindRefund, OrderID: orderID, RefundID: &refundID, EventID: eventID, CreatedAt: at}
+	t.debit(OrganizerPayable, split.Organizer)
+	t.debit(PlatformFees, split.Fees)
+	t.debit(TaxPayable, split.Tax)
+	t.credit(Refunds, split.Total())
+	return t
+}
+
+// debit and credit skip zero amounts and post negative ones to the other side
+func (t *Transaction) debit(account Account, amount Amount) {
+	switch {
+	case amount > 0:
+		t.Entries = append(t.Entries, Entry{Account: account, Debit: amount})
+	case amount < 0:
+		t.Entries = append(t.Entries, Entry{Account: account, Credit: -amount})
+	}
+}
+
+func (t *Transaction) credit(account Account, amount Amount) {
+	t.debit(account, -amount)
+}
+
+// Balance is an account's total debits and credits
+type Balance struct {
+	Account Account
+	Debit   Amount
+	Credit  Amount
+}
+
+// Net is the balance on the account's normal side
+func (b Balance) Net() Amount {
+	if b.Account.NormalDebit() {
+		return b.Debit - b.Credit
+	}
+	return b.Credit - b.Debit
+}
+
+// TrialBalance lists every account's totals. The ledger is consistent when
+// total debits equal total credits.
+type TrialBalance struct {
+	Balances    []Balance
+	TotalDebit  Amount
+	TotalCredit Amount
+}
+
+// NewTrialBalance fills in accounts with no entries and adds up the totals
+func NewTrialBalance(balances []Balance) *TrialBalance {
+	byAccount := make(map[Account]Balance, len(balances))
+	for _, balance := range balances {
+		byAccount[balance.Account] = balance
+	}
+
+	tb := &TrialBalance{}
+	for _, account := range Accounts {
+		balance := byAccount[account]
+		balance.Account = account
+		tb.Balances = append(tb.Balances, balance)
+		tb.TotalDebit += balance.Debit
+		tb.TotalCredit += balance.Credit
+	}
+	return tb
+}
+
+// Balanced reports whether total debits equal total credits
+func (tb *TrialBalance) Balanced() bool {
+	return tb.TotalDebit == tb.TotalCredit
+}
@@ -0,0 +1,132 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateRejectsBrokenTransactions(t *testing.T) {
+	for name, test := range map[string]struct {
+		entries []Entry
+		want    error
+	}{
+		"unbalanced": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: 1000}, {Account: OrganizerPayable, Credit: 999}},
+			want:    ErrUnbalanced,
+		},
+		"one entry": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: 1000}},
+			want:    ErrInvalidEntry,
+		},
+		"unknown account": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: 1000}, {Account: "CASH", Credit: 1000}},
+			want:    ErrInvalidEntry,
+		},
+		"negative amount": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: -1000}, {Account: OrganizerPayable, Debit: 1000}},
+			want:    ErrInvalidEntry,
+		},
+		"debit and credit": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: 1000, Credit: 1000}, {Account: OrganizerPayable, Credit: 0}},
+			want:    ErrInvalidEntry,
+		},
+		"zero entry": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: 1000}, {Account: OrganizerPayable, Credit: 1000}, {Account: TaxPayable}},
+			want:    ErrInvalidEntry,
+		},
+		"balanced": {
+			entries: []Entry{{Account: CustomerReceivable, Debit: 1000}, {Account: OrganizerPayable, Credit: 900}, {Account: PlatformFees, Credit: 100}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			transaction := &Transaction{Kind: KindSale, Entries: test.entries}
+			if err := transaction.Validate(); !errors.Is(err, test.want) {
+				t.Errorf("Validate: %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSaleAndRefundBalance(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, rates := range []Rates{{}, {PlatformFee: 500, Tax: 1600}, {PlatformFee: 275, Tax: 800}, {PlatformFee: 9999, Tax: 9999}} {
+		for _, gross := range []Amount{1, 3, 99, 1000, 3333, 123457} {
+			split := rates.Split(gross)
+			if split.Total() != gross || split.Organizer < 0 || split.Fees < 0 || split.Tax < 0 {
+				t.Errorf("%+v split %s into %+v", rates, gross, split)
+			}
+			if err := Sale(5, 3, split, at).Validate(); err != nil {
+				t.Errorf("%+v sale of %s: %v", rates, gross, err)
+			}
+
+			// Refund it in uneven parts; each refund balances and together
+			// they reverse the sale exactly
+			var refunded Amount
+			var reversed Split
+			for _, part := range []Amount{gross / 3, gross / 7, gross} {
+				if refunded+part > gross {
+					part = gross - refunded
+				}
+				if part == 0 {
+					continue
+				}
+				share := split.Share(refunded + part).Minus(split.Share(refunded))
+				if share.Total() != part {
+					t.Errorf("%+v refund of %s of %s reverses %s", rates, part, gross, share.Total())
+				}
+				if err := Refund(5, 11, 3, share, at).Validate(); err != nil {
+					t.Errorf("%+v refund of %s of %s: %v", rates, part, gross, err)
+				}
+				refunded += part
+				reversed = Split{Organizer: reversed.Organizer + share.Organizer, Fees: reversed.Fees + share.Fees, Tax: reversed.Tax + share.Tax}
+			}
+			if reversed != split {
+				t.Errorf("%+v refunds of %s reversed %+v, want %+v", rates, gross, reversed, split)
+			}
+		}
+	}
+}
+
+func TestSplitRoundsTaxInclusivePrice(t *testing.T) {
+	split := Rates{PlatformFee: 500, Tax: 1600}.Split(10000)
+	// 16% tax included in 100.00 is 13.79; 5% of the 86.21 net is 4.31
+	if split.Tax != 1379 || split.Fees != 431 || split.Organizer != 8190 {
+		t.Errorf("split %+v", split)
+	}
+}
+
+func TestAmountParseAndFormat(t *testing.T) {
+	for value, want := range map[string]Amount{"": 0, "12.5": 1250, "0.01": 1, " 99.99 ": 9999, "-3.10": -310, "0.005": 1} {
+		got, err := ParseAmount(value)
+		if err != nil || got != want {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	if _, err := ParseAmount("12,50"); err == nil {
+		t.Errorf("ParseAmount accepted a comma")
+	}
+
+	for amount, want := range map[Amount]string{0: "0.00", 5: "0.05", 1250: "12.50", -310: "-3.10"} {
+		if got := amount.String(); got != want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(amount), got, want)
+		}
+	}
+}
+
+func TestTrialBalance(t *testing.T) {
+	tb := NewTrialBalance([]Balance{
+		{Account: CustomerReceivable, Debit: 10000},
+		{Account: OrganizerPayable, Debit: 4094, Credit: 8190},
+		{Account: Refunds, Credit: 5000},
+	})
+	if len(tb.Balances) != len(Accounts) || tb.Balances[2].Account != PlatformFees {
+		t.Fatalf("balances %+v, want every account in order", tb.Balances)
+	}
+	if tb.Balances[1].Net() != 4096 || tb.Balances[0].Net() != 10000 {
+		t.Errorf("net balances %s and %s", tb.Balances[0].Net(), tb.Balances[1].Net())
+	}
+	if tb.Balanced() {
+		t.Errorf("debits %s and credits %s reported as balanced", tb.TotalDebit, tb.TotalCredit)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"ticketbooth-backend/db"
 	"ticketbooth-backend/handlers"
+	"ticketbooth-backend/ledger"
 	"ticketbooth-backend/repositories"
 	"ticketbooth-backend/services"
 
@@ -28,6 +32,70 @@ func main() {
 		log.Fatal("AUTH_SECRET not set")
 	}
 
+	// Base URL of the web app, used for links in emails
+	appBaseURL := os.Getenv("APP_BASE_URL")
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:3000"
+	}
+	requireEmailVerification := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	// Only trust X-Forwarded-For / X-Real-IP when running behind a proxy that sets them,
+	// otherwise clients could pick the IP that login throttling counts against
+	trustProxyHeaders := os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+	// Name shown next to the account in authenticator apps
+	mfaIssuer := os.Getenv("MFA_ISSUER")
+	if mfaIssuer == "" {
+		mfaIssuer = "Ticketbooth"
+	}
+
+	accountThrottle := services.DefaultAccountThrottle
+	ipThrottle := services.DefaultIPThrottle
+	if v := os.Getenv("LOGIN_MAX_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatal("LOGIN_MAX_FAILURES must be a positive integer")
+		}
+		accountThrottle.LockAfter = n
+	}
+	if v := os.Getenv("LOGIN_IP_MAX_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatal("LOGIN_IP_MAX_FAILURES must be a positive integer")
+		}
+		ipThrottle.LockAfter = n
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatal("LOGIN_LOCKOUT_DURATION must be a positive duration such as 15m")
+		}
+		accountThrottle.LockFor = d
+		ipThrottle.LockFor = d
+	}
+
+	// Platform commission and sales tax used to split each sale in the ledger.
+	// Ticket prices include tax; the fee is taken from the price net of tax.
+	var ledgerRates ledger.Rates
+	if v := os.Getenv("PLATFORM_FEE_PERCENT"); v != "" {
+		rate, err := ledger.ParsePercent(v)
+		if err != nil {
+			log.Fatal("PLATFORM_FEE_PERCENT must be a percentage such as 5 or 2.75")
+		}
+		ledgerRates.PlatformFee = rate
+	}
+	if v := os.Getenv("SALES_TAX_PERCENT"); v != "" {
+		rate, err := ledger.ParsePercent(v)
+		if err != nil {
+			log.Fatal("SALES_TAX_PERCENT must be a percentage such as 16")
+		}
+		ledgerRates.Tax = rate
+	}
+
+	ticketSigningSecret := os.Getenv("TICKET_SIGNING_SECRET")
+	if ticketSigningSecret == "" {
+		log.Fatal("TICKET_SIGNING_SECRET not set")
+	}
+
 	sqlxDB, err := sqlx.Open("mysql", dsn)
 	if err != nil {
 		log.Fatal(err)
@@ -42,25 +110,163 @@ func main() {
 
 	database := db.New(sqlxDB)
 
+	// Wallet passes are optional; each platform is enabled once its keys are configured
+	walletOrganization := os.Getenv("WALLET_ORGANIZATION_NAME")
+	if walletOrganization == "" {
+		walletOrganization = "Ticketbooth"
+	}
+
+	var appleWallet *services.AppleWalletConfig
+	if passTypeID := os.Getenv("APPLE_WALLET_PASS_TYPE_ID"); passTypeID != "" {
+		appleWallet, err = services.LoadAppleWalletConfig(
+			passTypeID,
+			os.Getenv("APPLE_WALLET_TEAM_ID"),
+			walletOrganization,
+			os.Getenv("APPLE_WALLET_CERT_FILE"),
+			os.Getenv("APPLE_WALLET_KEY_FILE"),
+			os.Getenv("APPLE_WALLET_WWDR_FILE"),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Social login providers, e.g. OIDC_PROVIDERS=google,apple with
+	// OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET, ...
+	var oidcProviders []*services.OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := services.OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = strings.TrimRight(appBaseURL, "/") + "/auth/oidc/" + name + "/callback"
+		}
+		oidcProviders = append(oidcProviders, services.NewOIDCProvider(config))
+	}
+
+	var googleWallet *services.GoogleWalletConfig
+	if issuerID := os.Getenv("GOOGLE_WALLET_ISSUER_ID"); issuerID != "" {
+		googleWallet, err = services.LoadGoogleWalletConfig(issuerID, walletOrganization, os.Getenv("GOOGLE_WALLET_SERVICE_ACCOUNT_FILE"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Initialize repositories
 	eventRepo := repositories.NewEventRepository(database)
+	venueRepo := repositories.NewVenueRepository(database)
+	catalogRepo := repositories.NewCatalogRepository(database)
 	availabilityRepo := repositories.NewAvailabilityRepository(database)
 	bookingRepo := repositories.NewBookingRepository(database)
 	inventoryRepo := repositories.NewInventoryRepository(database)
 	ticketTypeRepo := repositories.NewTicketTypeRepository(database)
 	seatRepo := repositories.NewSeatRepository(database)
 	userRepo := repositories.NewUserRepository(database)
+	ticketRepo := repositories.NewTicketRepository(database)
+	signingKeyRepo := repositories.NewSigningKeyRepository(database)
+	checkInRepo := repositories.NewCheckInRepository(database)
+	outboxRepo := repositories.NewOutboxRepository(database)
+	userTokenRepo := repositories.NewUserTokenRepository(database)
+	sessionRepo := repositories.NewSessionRepository(database)
+	loginAuditRepo := repositories.NewLoginAuditRepository(database)
+	roleRepo := repositories.NewRoleRepository(database)
+	mfaRepo := repositories.NewMFARepository(database)
+	identityRepo := repositories.NewIdentityRepository(database)
+	dataExportRepo := repositories.NewDataExportRepository(database)
+	auditRepo := repositories.NewAuditRepository(database)
+	refundRepo := repositories.NewRefundRepository(database)
+	ledgerRepo := repositories.NewLedgerRepository(database)
+	settlementRepo := repositories.NewSettlementRepository(database)
+	reportRepo := repositories.NewReportRepository(database)
+	eventDateChangeRepo := repositories.NewEventDateChangeRepository(database)
+
+	emailTemplates, err := services.LoadEmailTemplates()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Initialize services
-	bookingService := services.NewBookingService(database, bookingRepo, inventoryRepo, eventRepo, ticketTypeRepo, seatRepo)
+	auditService := services.NewAuditService(auditRepo)
+	credentialService := services.NewCredentialService(database, ticketSigningSecret, signingKeyRepo, auditService)
+	notificationService := services.NewNotificationService(outboxRepo, userRepo, emailTemplates)
+	ledgerService := services.NewLedgerService(ledgerRepo, ledgerRates)
+	accountService := services.NewAccountService(database, userRepo, userTokenRepo, sessionRepo, ticketRepo, bookingRepo, outboxRepo, dataExportRepo, mfaRepo, identityRepo, roleRepo, notificationService, auditService, authSecret, appBaseURL)
+	authService := services.NewAuthService(database, sessionRepo, authSecret)
+	mfaService := services.NewMFAService(database, userRepo, roleRepo, mfaRepo, userTokenRepo, authService, authSecret, mfaIssuer)
+	socialLoginService := services.NewSocialLoginService(database, oidcProviders, userRepo, identityRepo, sessionRepo, mfaService)
+	loginThrottle := services.NewLoginThrottle(services.NewMemoryAttemptStore(), loginAuditRepo, accountThrottle, ipThrottle)
+	dataExportService := services.NewDataExportService(dataExportRepo, userRepo, roleRepo, mfaRepo, identityRepo, bookingRepo, sessionRepo, checkInRepo, outboxRepo, loginAuditRepo)
+	bookingService := services.NewBookingService(database, bookingRepo, inventoryRepo, eventRepo, ticketTypeRepo, seatRepo, credentialService, notificationService, auditService, ledgerService)
+	checkInService := services.NewCheckInService(database, ticketRepo, checkInRepo, credentialService, auditService)
+	refundService := services.NewRefundService(database, refundRepo, inventoryRepo, ledgerService, notificationService, auditService)
+	settlementService := services.NewSettlementService(database, settlementRepo, auditService)
+	reportService := services.NewReportService(reportRepo)
+	catalogService := services.NewCatalogService(database, catalogRepo, venueRepo, auditService)
+	eventDateService := services.NewEventDateService(database, eventRepo, eventDateChangeRepo, refundService, notificationService, auditService)
+	documentService := services.NewDocumentService(credentialService)
+	walletService := services.NewWalletService(credentialService, appleWallet, googleWallet)
+
+	// Deliver queued emails in the background; without SMTP they stay in the outbox
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		sender, err := services.NewSMTPSender(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("EMAIL_FROM"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		emailWorker := services.NewEmailWorker(outboxRepo, bookingRepo, emailTemplates, documentService, sender)
+		go emailWorker.Run(context.Background())
+	} else {
+		log.Println("SMTP_HOST not set, emails will be queued but not delivered")
+	}
+
+	// Build personal data exports in the background
+	go dataExportService.Run(context.Background())
+
+	// Refund or notify the orders of cancelled and postponed event dates
+	go eventDateService.Run(context.Background())
 
 	// Initialize handlers
 	eventHandler := handlers.NewEventHandler(eventRepo, availabilityRepo)
-	bookingHandler := handlers.NewBookingHandler(bookingService, bookingRepo)
-	userHandler := handlers.NewUserHandler(userRepo, authSecret)
+	venueHandler := handlers.NewVenueHandler(venueRepo)
+	catalogHandler := handlers.NewCatalogHandler(catalogService)
+	eventDateHandler := handlers.NewEventDateHandler(eventDateService, eventRepo)
+	bookingHandler := handlers.NewBookingHandler(bookingService, bookingRepo, roleRepo, credentialService, documentService)
+	ticketHandler := handlers.NewTicketHandler(ticketRepo, roleRepo, credentialService, documentService, walletService)
+	checkInHandler := handlers.NewCheckInHandler(checkInService)
+	userHandler := handlers.NewUserHandler(userRepo, roleRepo, authSecret, accountService, mfaService, loginThrottle, requireEmailVerification)
+	mfaHandler := handlers.NewMFAHandler(mfaService, userRepo, loginThrottle)
+	oidcHandler := handlers.NewOIDCHandler(socialLoginService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	sessionHandler := handlers.NewSessionHandler(authService)
+	exportHandler := handlers.NewExportHandler(dataExportService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	refundHandler := handlers.NewRefundHandler(refundService, bookingRepo)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService)
+	settlementHandler := handlers.NewSettlementHandler(settlementService)
+	reportHandler := handlers.NewReportHandler(reportService)
 
 	// Setup router
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	if trustProxyHeaders {
+		r.Use(middleware.RealIP)
+	}
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
@@ -74,19 +280,124 @@ func main() {
 	r.Route("/api", func(r chi.Router) {
 		// Events
 		r.Get("/events", eventHandler.GetEvents)
+		r.Get("/events/{slugOrId}", eventHandler.GetEvent)
 		r.Get("/event-dates/{id}", eventHandler.GetEventDate)
 		r.Get("/event-dates/{id}/availability", eventHandler.GetAvailability)
+		r.Get("/events/{id}/signing-keys", ticketHandler.GetSigningKeys)
+		r.Get("/venues/{slug}", venueHandler.GetVenue)
+		r.Get("/categories", catalogHandler.ListCategories)
 
 		// Bookings
 		r.Post("/bookings", bookingHandler.CreateBooking)
-		r.Get("/orders/{id}", bookingHandler.GetOrder)
-		r.Get("/orders", bookingHandler.GetOrders)
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Get("/orders", bookingHandler.GetOrders)
+			r.Get("/orders/{id}", bookingHandler.GetOrder)
+			r.Get("/orders/{id}/pdf", bookingHandler.GetOrderPDF)
+			r.Post("/orders/{id}/postponement-refund", eventDateHandler.RefundPostponed)
+		})
+
+		// Tickets
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Get("/tickets/{id}/qr", ticketHandler.GetTicketQR)
+			r.Get("/tickets/{id}/pdf", ticketHandler.GetTicketPDF)
+			r.Get("/tickets/{id}/wallet", ticketHandler.GetTicketWallet)
+		})
+
+		// Door check-in
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Use(handlers.RequireRole(roleRepo, repositories.RoleScanner, repositories.RoleBoxOffice, repositories.RoleAdmin))
+			r.Post("/checkin", checkInHandler.CheckIn)
+			r.Post("/checkin/sync", checkInHandler.SyncScans)
+		})
 
 		// Users
 		r.Post("/signup", userHandler.SignUp)
 		r.Post("/login", userHandler.Login)
 		r.Post("/users", userHandler.CreateUser)
-		r.Put("/users/{id}", userHandler.UpdateUser)
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Put("/users/{id}", userHandler.UpdateUser)
+			r.Get("/me", userHandler.Me)
+			r.Delete("/me", userHandler.DeleteMe)
+			r.Put("/me/password", userHandler.ChangePassword)
+			r.Get("/me/export", exportHandler.RequestExport)
+			r.Get("/me/export/{id}", exportHandler.GetExport)
+			r.Get("/me/export/{id}/download", exportHandler.DownloadExport)
+		})
+
+		// Account recovery and email verification
+		r.Post("/password/forgot", accountHandler.ForgotPassword)
+		r.Post("/password/reset", accountHandler.ResetPassword)
+		r.Post("/email/verify", accountHandler.VerifyEmail)
+		r.Post("/email/resend", accountHandler.ResendVerification)
+
+		// Sessions
+		r.Post("/token/refresh", sessionHandler.Refresh)
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Post("/logout", sessionHandler.Logout)
+			r.Get("/sessions", sessionHandler.ListSessions)
+			r.Delete("/sessions/{id}", sessionHandler.RevokeSession)
+			r.Post("/sessions/revoke-all", sessionHandler.RevokeAll)
+		})
+
+		// Social login
+		r.Get("/auth/oidc/providers", oidcHandler.ListProviders)
+		r.Get("/auth/oidc/{provider}/authorize", oidcHandler.Authorize)
+		r.Post("/auth/oidc/{provider}/callback", oidcHandler.Callback)
+
+		// Two-factor authentication
+		r.Post("/login/mfa", mfaHandler.LoginMFA)
+		r.Post("/login/mfa/enroll", mfaHandler.LoginEnroll)
+		r.Post("/login/mfa/enroll/confirm", mfaHandler.LoginEnrollConfirm)
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Get("/me/mfa", mfaHandler.Status)
+			r.Delete("/me/mfa", mfaHandler.Disable)
+			r.Post("/me/mfa/totp", mfaHandler.Enroll)
+			r.Post("/me/mfa/totp/confirm", mfaHandler.ConfirmEnroll)
+			r.Post("/me/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		})
+
+		// Admin
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireAuth(authService))
+			r.Use(handlers.RequireRole(roleRepo, repositories.RoleAdmin))
+			r.Get("/admin/audit", auditHandler.ListAuditLog)
+			r.Post("/events/{id}/signing-keys/rotate", ticketHandler.RotateSigningKey)
+			r.Get("/admin/orders", bookingHandler.SearchOrders)
+			r.Post("/orders/{id}/refunds", refundHandler.CreateRefund)
+			r.Get("/orders/{id}/refunds", refundHandler.ListRefunds)
+			r.Get("/admin/ledger/trial-balance", ledgerHandler.GetTrialBalance)
+			r.Post("/admin/settlements", settlementHandler.RunSettlements)
+			r.Get("/admin/settlements", settlementHandler.ListSettlements)
+			r.Get("/admin/settlements/{id}", settlementHandler.GetSettlement)
+			r.Get("/admin/settlements/{id}/statement", settlementHandler.DownloadStatement)
+			r.Get("/admin/reports/events/{id}/sales", reportHandler.GetEventSales)
+			r.Get("/admin/reports/event-dates/{id}/sales", reportHandler.GetEventDateSales)
+			r.Get("/admin/categories", catalogHandler.ListCategories)
+			r.Post("/admin/categories", catalogHandler.CreateCategory)
+			r.Put("/admin/categories/{id}", catalogHandler.UpdateCategory)
+			r.Delete("/admin/categories/{id}", catalogHandler.DeleteCategory)
+			r.Get("/admin/performers", catalogHandler.ListPerformers)
+			r.Post("/admin/performers", catalogHandler.CreatePerformer)
+			r.Get("/admin/performers/{id}", catalogHandler.GetPerformer)
+			r.Put("/admin/performers/{id}", catalogHandler.UpdatePerformer)
+			r.Delete("/admin/performers/{id}", catalogHandler.DeletePerformer)
+			r.Get("/admin/events/{id}/classification", catalogHandler.GetEventClassification)
+			r.Put("/admin/events/{id}/classification", catalogHandler.ClassifyEvent)
+			r.Post("/admin/events/{id}/media", catalogHandler.AddEventMedia)
+			r.Delete("/admin/events/{id}/media/{mediaId}", catalogHandler.DeleteEventMedia)
+			r.Put("/admin/venues/{id}/time-zone", catalogHandler.UpdateVenueTimeZone)
+			r.Put("/admin/event-dates/{id}/schedule", eventDateHandler.UpdateSchedule)
+			r.Post("/admin/event-dates/{id}/status", eventDateHandler.UpdateStatus)
+			r.Get("/admin/event-dates/{id}/changes", eventDateHandler.ListChanges)
+			r.Get("/admin/event-date-changes/{id}", eventDateHandler.GetChange)
+			r.Post("/admin/event-date-changes/{id}/retry", eventDateHandler.RetryChange)
+		})
 	})
 
 	srv := &http.Server{
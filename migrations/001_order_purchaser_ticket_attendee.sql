@@ -0,0 +1,21 @@
+-- Store the purchaser on the order and per-ticket attendee details on the ticket.
+USE `ticketbooth`;
+
+ALTER TABLE `order`
+  ADD COLUMN `customer_name` VARCHAR(255) NULL AFTER `payment_source`,
+  ADD COLUMN `customer_email` VARCHAR(255) NULL AFTER `customer_name`;
+
+ALTER TABLE `ticket`
+  ADD COLUMN `to_email` VARCHAR(255) NULL AFTER `to_name`;
+
+-- Existing orders only have the purchaser copied onto their tickets; backfill
+-- from the first ticket of each order.
+UPDATE `order` o
+INNER JOIN (
+  SELECT oht.order_id, MIN(oht.ticket_id) AS ticket_id
+  FROM order_hast_tickets oht
+  GROUP BY oht.order_id
+) first_ticket ON first_ticket.order_id = o.id
+INNER JOIN ticket t ON t.id = first_ticket.ticket_id
+SET o.customer_name = t.to_name
+WHERE o.customer_name IS NULL;
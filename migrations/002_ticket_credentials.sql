@@ -0,0 +1,29 @@
+-- Signed ticket credentials: a per-ticket nonce and per-event Ed25519 public keys.
+USE `ticketbooth`;
+
+ALTER TABLE `ticket`
+  ADD COLUMN `credential_nonce` VARCHAR(32) NULL AFTER `seat_id`;
+
+-- Give existing tickets a nonce so they can be issued a credential
+UPDATE `ticket`
+SET credential_nonce = LOWER(HEX(RANDOM_BYTES(12)))
+WHERE credential_nonce IS NULL;
+
+CREATE TABLE IF NOT EXISTS `event_signing_key` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `event_id` INT NOT NULL,
+  `version` INT NOT NULL,
+  `key_id` VARCHAR(45) NOT NULL,
+  `public_key` VARCHAR(64) NOT NULL,
+  `status` ENUM('ACTIVE', 'RETIRED', 'REVOKED') NOT NULL DEFAULT 'ACTIVE',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `retired_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `key_id_UNIQUE` (`key_id` ASC) VISIBLE,
+  UNIQUE INDEX `uniq_signing_key_event_version` (`event_id` ASC, `version` ASC) VISIBLE,
+  CONSTRAINT `fk_event_signing_key_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
@@ -0,0 +1,30 @@
+-- Door check-in: admission state on the ticket plus an append-only scan log.
+USE `ticketbooth`;
+
+ALTER TABLE `ticket`
+  ADD COLUMN `admitted_at` DATETIME NULL AFTER `credential_nonce`,
+  ADD COLUMN `admitted_gate` VARCHAR(45) NULL AFTER `admitted_at`,
+  ADD COLUMN `admitted_device` VARCHAR(100) NULL AFTER `admitted_gate`;
+
+CREATE TABLE IF NOT EXISTS `ticket_scan` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `ticket_id` INT NULL,
+  `event_date_id` INT NOT NULL,
+  `gate` VARCHAR(45) NOT NULL,
+  `device_id` VARCHAR(100) NOT NULL,
+  `client_scan_id` VARCHAR(100) NULL,
+  `source` ENUM('ONLINE', 'OFFLINE') NOT NULL,
+  `result` VARCHAR(32) NOT NULL,
+  `conflict` TINYINT NOT NULL DEFAULT 0,
+  `scanned_at` DATETIME NOT NULL,
+  `received_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_ticket_scan_ticket1_idx` (`ticket_id` ASC) VISIBLE,
+  INDEX `idx_ticket_scan_event_date` (`event_date_id` ASC, `scanned_at` ASC) VISIBLE,
+  UNIQUE INDEX `uniq_ticket_scan_device_client` (`device_id` ASC, `client_scan_id` ASC) VISIBLE,
+  CONSTRAINT `fk_ticket_scan_ticket1`
+    FOREIGN KEY (`ticket_id`)
+    REFERENCES `ticket` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
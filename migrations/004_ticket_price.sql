@@ -0,0 +1,16 @@
+-- Record the price charged for each ticket so receipts can be itemized.
+USE `ticketbooth`;
+
+ALTER TABLE `ticket`
+  ADD COLUMN `price` DECIMAL(19,2) NOT NULL DEFAULT 0 AFTER `seat_id`;
+
+-- Backfill from current inventory prices; historical prices were not recorded.
+UPDATE `ticket` t
+INNER JOIN event_date_has_seat edhs ON edhs.event_date_id = t.event_date_id AND edhs.seat_id = t.seat_id
+SET t.price = edhs.price
+WHERE t.seat_id IS NOT NULL;
+
+UPDATE `ticket` t
+INNER JOIN event_date_has_ticket_type edtt ON edtt.event_date_id = t.event_date_id AND edtt.ticket_type_id = t.ticket_type_id
+SET t.price = edtt.price
+WHERE t.seat_id IS NULL;
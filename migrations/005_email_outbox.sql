@@ -0,0 +1,29 @@
+-- Transactional email outbox and the language each order's emails are sent in.
+USE `ticketbooth`;
+
+ALTER TABLE `order`
+  ADD COLUMN `locale` VARCHAR(10) NOT NULL DEFAULT 'en' AFTER `customer_email`;
+
+CREATE TABLE IF NOT EXISTS `email_outbox` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `template` VARCHAR(64) NOT NULL,
+  `locale` VARCHAR(10) NOT NULL,
+  `to_email` VARCHAR(255) NOT NULL,
+  `to_name` VARCHAR(255) NULL,
+  `order_id` INT NULL,
+  `payload` JSON NOT NULL,
+  `status` ENUM('PENDING', 'SENT', 'FAILED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt_at` DATETIME NOT NULL,
+  `last_error` TEXT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `sent_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_email_outbox_due` (`status` ASC, `next_attempt_at` ASC) VISIBLE,
+  INDEX `fk_email_outbox_order1_idx` (`order_id` ASC) VISIBLE,
+  CONSTRAINT `fk_email_outbox_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
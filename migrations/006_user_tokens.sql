@@ -0,0 +1,27 @@
+-- Email verification state and single-use account tokens.
+USE `ticketbooth`;
+
+ALTER TABLE `user`
+  ADD COLUMN `email_verified_at` DATETIME NULL AFTER `hashed_password`;
+
+-- Accounts created before verification existed are treated as verified, so
+-- turning on REQUIRE_EMAIL_VERIFICATION does not lock them out
+UPDATE `user` SET email_verified_at = date_created WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS `user_token` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `purpose` ENUM('PASSWORD_RESET', 'EMAIL_VERIFY') NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  `used_at` DATETIME NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_user_token_hash` (`token_hash` ASC) VISIBLE,
+  INDEX `idx_user_token_user_purpose` (`user_id` ASC, `purpose` ASC) VISIBLE,
+  CONSTRAINT `fk_user_token_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
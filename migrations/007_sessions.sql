@@ -0,0 +1,37 @@
+-- Login sessions with rotating refresh tokens.
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `user_session` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `user_agent` VARCHAR(255) NULL,
+  `ip_address` VARCHAR(45) NULL,
+  `created_at` DATETIME NOT NULL,
+  `last_used_at` DATETIME NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  `revoked_at` DATETIME NULL,
+  `revoke_reason` VARCHAR(32) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_user_session_user_active` (`user_id` ASC, `revoked_at` ASC, `expires_at` ASC) VISIBLE,
+  CONSTRAINT `fk_user_session_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `session_refresh_token` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `session_id` INT NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `created_at` DATETIME NOT NULL,
+  `rotated_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_session_refresh_token_hash` (`token_hash` ASC) VISIBLE,
+  INDEX `fk_session_refresh_token_session1_idx` (`session_id` ASC) VISIBLE,
+  CONSTRAINT `fk_session_refresh_token_session1`
+    FOREIGN KEY (`session_id`)
+    REFERENCES `user_session` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
@@ -0,0 +1,21 @@
+-- Audit trail of temporary login lockouts (brute-force protection).
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `login_lockout` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `scope` ENUM('ACCOUNT', 'IP') NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `user_id` INT NULL,
+  `ip_address` VARCHAR(45) NULL,
+  `failures` INT NOT NULL,
+  `locked_until` DATETIME NOT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_login_lockout_created` (`created_at` ASC) VISIBLE,
+  INDEX `fk_login_lockout_user1_idx` (`user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_login_lockout_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
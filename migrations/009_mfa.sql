@@ -0,0 +1,34 @@
+-- TOTP two-factor authentication with recovery codes.
+USE `ticketbooth`;
+
+ALTER TABLE `user_token`
+  MODIFY COLUMN `purpose` ENUM('PASSWORD_RESET', 'EMAIL_VERIFY', 'MFA_CHALLENGE', 'MFA_ENROLL') NOT NULL;
+
+CREATE TABLE IF NOT EXISTS `user_mfa` (
+  `user_id` INT NOT NULL,
+  `totp_secret` VARCHAR(255) NOT NULL,
+  `confirmed_at` DATETIME NULL,
+  `last_used_step` BIGINT NOT NULL DEFAULT 0,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `fk_user_mfa_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `user_recovery_code` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `code_hash` CHAR(64) NOT NULL,
+  `used_at` DATETIME NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_user_recovery_code` (`user_id` ASC, `code_hash` ASC) VISIBLE,
+  CONSTRAINT `fk_user_recovery_code_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
@@ -0,0 +1,33 @@
+-- OpenID Connect social login: linked identities and logins in progress.
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `user_identity` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `provider` VARCHAR(45) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `email` VARCHAR(255) NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_login_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_user_identity_provider_subject` (`provider` ASC, `subject` ASC) VISIBLE,
+  INDEX `fk_user_identity_user1_idx` (`user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_user_identity_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `oidc_auth_request` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `state_hash` CHAR(64) NOT NULL,
+  `provider` VARCHAR(45) NOT NULL,
+  `code_verifier` VARCHAR(128) NOT NULL,
+  `nonce` VARCHAR(128) NOT NULL,
+  `redirect_uri` VARCHAR(512) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_oidc_auth_request_state` (`state_hash` ASC) VISIBLE,
+  INDEX `idx_oidc_auth_request_expires` (`expires_at` ASC) VISIBLE)
+ENGINE = InnoDB;
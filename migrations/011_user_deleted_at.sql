@@ -0,0 +1,6 @@
+-- Account deletion: anonymized users keep their row (orders reference it) and
+-- record when they were deleted.
+USE `ticketbooth`;
+
+ALTER TABLE `user`
+  ADD COLUMN `deleted_at` DATETIME NULL AFTER `email_verified_at`;
@@ -0,0 +1,27 @@
+-- Personal data exports (GET /api/me/export), generated by a background worker.
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `data_export` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `format` ENUM('JSON', 'ZIP') NOT NULL,
+  `status` ENUM('PENDING', 'RUNNING', 'READY', 'FAILED', 'EXPIRED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `lease_until` DATETIME NULL,
+  `last_error` TEXT NULL,
+  `file_name` VARCHAR(255) NULL,
+  `content_type` VARCHAR(100) NULL,
+  `size_bytes` INT NULL,
+  `data` LONGBLOB NULL,
+  `requested_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completed_at` DATETIME NULL,
+  `expires_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_data_export_status` (`status` ASC, `requested_at` ASC) VISIBLE,
+  INDEX `fk_data_export_user1_idx` (`user_id` ASC, `requested_at` ASC) VISIBLE,
+  CONSTRAINT `fk_data_export_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
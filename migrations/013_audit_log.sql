@@ -0,0 +1,36 @@
+-- Append-only audit log, written in the same transaction as each change.
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `audit_log` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `actor_user_id` INT NULL,
+  `action` VARCHAR(64) NOT NULL,
+  `entity_type` VARCHAR(45) NOT NULL,
+  `entity_id` VARCHAR(64) NOT NULL,
+  `before_data` JSON NULL,
+  `after_data` JSON NULL,
+  `request_id` VARCHAR(100) NULL,
+  `ip_address` VARCHAR(45) NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_audit_log_entity` (`entity_type` ASC, `entity_id` ASC, `id` ASC) VISIBLE,
+  INDEX `idx_audit_log_actor` (`actor_user_id` ASC, `id` ASC) VISIBLE,
+  INDEX `idx_audit_log_action` (`action` ASC, `id` ASC) VISIBLE,
+  INDEX `idx_audit_log_created` (`created_at` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+DROP TRIGGER IF EXISTS `audit_log_no_update`;
+DROP TRIGGER IF EXISTS `audit_log_no_delete`;
+DELIMITER $$
+CREATE TRIGGER `audit_log_no_update` BEFORE UPDATE ON `audit_log`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+END$$
+
+CREATE TRIGGER `audit_log_no_delete` BEFORE DELETE ON `audit_log`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+END$$
+DELIMITER ;
@@ -0,0 +1,62 @@
+-- Refunds (POST /api/orders/{id}/refunds): one row per refund, the running
+-- refunded total on the order, and refunded/released markers on tickets.
+USE `ticketbooth`;
+
+ALTER TABLE `order`
+  ADD COLUMN `refunded_amount` DECIMAL(19,2) NOT NULL DEFAULT 0 AFTER `locale`;
+
+ALTER TABLE `ticket`
+  ADD COLUMN `refunded_at` DATETIME NULL AFTER `admitted_device`,
+  ADD COLUMN `inventory_released_at` DATETIME NULL AFTER `refunded_at`,
+  ADD COLUMN `held_seat_id` INT AS (IF(`inventory_released_at` IS NULL, `seat_id`, NULL)) STORED AFTER `inventory_released_at`;
+
+-- A seat released by a refund can be sold again, so uniqueness now applies
+-- only to tickets still holding their seat. The plain index keeps the
+-- composite foreign key to event_date_has_seat covered.
+ALTER TABLE `ticket`
+  ADD INDEX `fk_ticket_event_date_has_seat1_idx` (`event_date_id`, `seat_id`);
+
+ALTER TABLE `ticket`
+  DROP INDEX `uniq_ticket_eventdate_seat`,
+  ADD UNIQUE INDEX `uniq_ticket_eventdate_seat` (`event_date_id`, `held_seat_id`);
+
+CREATE TABLE IF NOT EXISTS `order_refund` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `order_id` INT NOT NULL,
+  `type` ENUM('FULL', 'TICKETS', 'AMOUNT') NOT NULL,
+  `amount` DECIMAL(19,2) NOT NULL,
+  `reason` VARCHAR(500) NOT NULL,
+  `operator_user_id` INT NOT NULL,
+  `restocked` TINYINT(1) NOT NULL DEFAULT 0,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_order_refund_order1_idx` (`order_id` ASC) VISIBLE,
+  INDEX `fk_order_refund_user1_idx` (`operator_user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_order_refund_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_order_refund_user1`
+    FOREIGN KEY (`operator_user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `order_refund_ticket` (
+  `refund_id` INT NOT NULL,
+  `ticket_id` INT NOT NULL,
+  PRIMARY KEY (`refund_id`, `ticket_id`),
+  UNIQUE INDEX `uniq_order_refund_ticket` (`ticket_id` ASC) VISIBLE,
+  CONSTRAINT `fk_order_refund_ticket_refund1`
+    FOREIGN KEY (`refund_id`)
+    REFERENCES `order_refund` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_order_refund_ticket_ticket1`
+    FOREIGN KEY (`ticket_id`)
+    REFERENCES `ticket` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
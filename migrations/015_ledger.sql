@@ -0,0 +1,75 @@
+-- Double-entry ledger for sales and refunds (see the ledger package).
+-- Orders placed before this migration get their sale recorded on their first refund.
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `ledger_transaction` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `kind` ENUM('SALE', 'REFUND') NOT NULL,
+  `order_id` INT NOT NULL,
+  `refund_id` INT NULL,
+  `event_id` INT NOT NULL,
+  `memo` VARCHAR(255) NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_ledger_transaction_order1_idx` (`order_id` ASC) VISIBLE,
+  INDEX `fk_ledger_transaction_refund1_idx` (`refund_id` ASC) VISIBLE,
+  INDEX `idx_ledger_transaction_event` (`event_id` ASC, `created_at` ASC) VISIBLE,
+  INDEX `idx_ledger_transaction_created` (`created_at` ASC) VISIBLE,
+  CONSTRAINT `fk_ledger_transaction_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_ledger_transaction_refund1`
+    FOREIGN KEY (`refund_id`)
+    REFERENCES `order_refund` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `ledger_entry` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `transaction_id` BIGINT NOT NULL,
+  `account` ENUM('CUSTOMER_RECEIVABLE', 'ORGANIZER_PAYABLE', 'PLATFORM_FEES', 'TAX_PAYABLE', 'REFUNDS') NOT NULL,
+  `debit` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `credit` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  INDEX `fk_ledger_entry_transaction1_idx` (`transaction_id` ASC) VISIBLE,
+  INDEX `idx_ledger_entry_account` (`account` ASC) VISIBLE,
+  CONSTRAINT `chk_ledger_entry_one_side` CHECK (`debit` >= 0 AND `credit` >= 0 AND (`debit` = 0) <> (`credit` = 0)),
+  CONSTRAINT `fk_ledger_entry_transaction1`
+    FOREIGN KEY (`transaction_id`)
+    REFERENCES `ledger_transaction` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+DROP TRIGGER IF EXISTS `ledger_transaction_no_update`;
+DROP TRIGGER IF EXISTS `ledger_transaction_no_delete`;
+DROP TRIGGER IF EXISTS `ledger_entry_no_update`;
+DROP TRIGGER IF EXISTS `ledger_entry_no_delete`;
+DELIMITER $$
+CREATE TRIGGER `ledger_transaction_no_update` BEFORE UPDATE ON `ledger_transaction`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+
+CREATE TRIGGER `ledger_transaction_no_delete` BEFORE DELETE ON `ledger_transaction`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+
+CREATE TRIGGER `ledger_entry_no_update` BEFORE UPDATE ON `ledger_entry`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+
+CREATE TRIGGER `ledger_entry_no_delete` BEFORE DELETE ON `ledger_entry`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+DELIMITER ;
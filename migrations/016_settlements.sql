@@ -0,0 +1,85 @@
+-- Organizer settlements: who organizes each event, payout statements per
+-- organizer and period, and the settled marker that locks orders and refunds.
+USE `ticketbooth`;
+
+ALTER TABLE `event`
+  ADD COLUMN `organizer_id` INT NULL AFTER `description`,
+  ADD INDEX `fk_event_organizer1_idx` (`organizer_id` ASC),
+  ADD CONSTRAINT `fk_event_organizer1`
+    FOREIGN KEY (`organizer_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION;
+
+CREATE TABLE IF NOT EXISTS `settlement` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `reference` VARCHAR(45) NULL,
+  `organizer_id` INT NOT NULL,
+  `period_start` DATETIME NOT NULL,
+  `period_end` DATETIME NOT NULL,
+  `order_count` INT NOT NULL DEFAULT 0,
+  `refund_count` INT NOT NULL DEFAULT 0,
+  `gross_sales` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `refunds` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `platform_fees` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `tax` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `net_payout` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `created_by` INT NOT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `reference_UNIQUE` (`reference` ASC) VISIBLE,
+  INDEX `idx_settlement_organizer` (`organizer_id` ASC, `period_end` ASC) VISIBLE,
+  INDEX `fk_settlement_user1_idx` (`created_by` ASC) VISIBLE,
+  CONSTRAINT `fk_settlement_organizer1`
+    FOREIGN KEY (`organizer_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_settlement_user1`
+    FOREIGN KEY (`created_by`)
+    REFERENCES `user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `settlement_line` (
+  `settlement_id` INT NOT NULL,
+  `event_id` INT NOT NULL,
+  `order_count` INT NOT NULL DEFAULT 0,
+  `refund_count` INT NOT NULL DEFAULT 0,
+  `gross_sales` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `refunds` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `platform_fees` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `tax` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `net_payout` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`settlement_id`, `event_id`),
+  INDEX `fk_settlement_line_event1_idx` (`event_id` ASC) VISIBLE,
+  CONSTRAINT `fk_settlement_line_settlement1`
+    FOREIGN KEY (`settlement_id`)
+    REFERENCES `settlement` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_settlement_line_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+ALTER TABLE `order`
+  ADD COLUMN `settlement_id` INT NULL AFTER `refunded_amount`,
+  ADD INDEX `idx_order_unsettled` (`settlement_id` ASC, `created_at` ASC),
+  ADD CONSTRAINT `fk_order_settlement1`
+    FOREIGN KEY (`settlement_id`)
+    REFERENCES `settlement` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION;
+
+ALTER TABLE `order_refund`
+  ADD COLUMN `settlement_id` INT NULL AFTER `restocked`,
+  ADD INDEX `fk_order_refund_settlement1_idx` (`settlement_id` ASC),
+  ADD CONSTRAINT `fk_order_refund_settlement1`
+    FOREIGN KEY (`settlement_id`)
+    REFERENCES `settlement` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION;
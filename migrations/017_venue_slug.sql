@@ -0,0 +1,6 @@
+-- Venues are looked up by slug (GET /api/venues/{slug}), so a slug must
+-- identify one venue. Fix any duplicate slugs before applying.
+USE `ticketbooth`;
+
+ALTER TABLE `venue`
+  ADD UNIQUE INDEX `slug_UNIQUE` (`slug` ASC);
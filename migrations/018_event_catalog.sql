@@ -0,0 +1,101 @@
+-- Event classification: categories, free-form tags, performers and media.
+-- This replaces event_has_venue_has_venue_types, which tied events to venue
+-- types and was never read or written by the application. venue_types and
+-- venue_has_venue_types still describe venues and are kept.
+USE `ticketbooth`;
+
+DROP TABLE IF EXISTS `event_has_venue_has_venue_types`;
+
+CREATE TABLE IF NOT EXISTS `category` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `slug` VARCHAR(45) NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC))
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `event_has_category` (
+  `event_id` INT NOT NULL,
+  `category_id` INT NOT NULL,
+  PRIMARY KEY (`event_id`, `category_id`),
+  INDEX `fk_event_has_category_category1_idx` (`category_id` ASC),
+  CONSTRAINT `fk_event_has_category_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_has_category_category1`
+    FOREIGN KEY (`category_id`)
+    REFERENCES `category` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `tag` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(45) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `name_UNIQUE` (`name` ASC))
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `event_has_tag` (
+  `event_id` INT NOT NULL,
+  `tag_id` INT NOT NULL,
+  PRIMARY KEY (`event_id`, `tag_id`),
+  INDEX `fk_event_has_tag_tag1_idx` (`tag_id` ASC),
+  CONSTRAINT `fk_event_has_tag_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_has_tag_tag1`
+    FOREIGN KEY (`tag_id`)
+    REFERENCES `tag` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `performer` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `slug` VARCHAR(45) NOT NULL,
+  `name` VARCHAR(200) NOT NULL,
+  `description` VARCHAR(500) NULL,
+  `image_url` VARCHAR(500) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC))
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `event_has_performer` (
+  `event_id` INT NOT NULL,
+  `performer_id` INT NOT NULL,
+  `billing_order` INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`event_id`, `performer_id`),
+  INDEX `fk_event_has_performer_performer1_idx` (`performer_id` ASC),
+  CONSTRAINT `fk_event_has_performer_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_has_performer_performer1`
+    FOREIGN KEY (`performer_id`)
+    REFERENCES `performer` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `event_media` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `event_id` INT NOT NULL,
+  `kind` ENUM('IMAGE', 'VIDEO') NOT NULL,
+  `url` VARCHAR(500) NOT NULL,
+  `alt_text` VARCHAR(255) NULL,
+  `position` INT NOT NULL DEFAULT 0,
+  `created_at` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `fk_event_media_event1_idx` (`event_id` ASC, `position` ASC),
+  CONSTRAINT `fk_event_media_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
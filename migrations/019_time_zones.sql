@@ -0,0 +1,22 @@
+-- Venue time zones and doors/end times. event_date times are UTC instants and
+-- the API shows them in the venue's IANA zone.
+USE `ticketbooth`;
+
+ALTER TABLE `venue`
+  ADD COLUMN `time_zone` VARCHAR(64) NOT NULL DEFAULT 'UTC' AFTER `accessible_weelchair`;
+
+ALTER TABLE `event_date`
+  ADD COLUMN `doors_open_at` DATETIME NULL AFTER `date`,
+  ADD COLUMN `ends_at` DATETIME NULL AFTER `doors_open_at`;
+
+-- Existing dates were rendered as UTC, so every venue starts in UTC and no
+-- showtime moves. Dates that were entered as the venue's local wall time need
+-- converting once the venue's zone is set, for example:
+--
+--   UPDATE `venue` SET `time_zone` = 'America/Mexico_City' WHERE `id` = 5;
+--   UPDATE `event_date`
+--     SET `date` = CONVERT_TZ(`date`, 'America/Mexico_City', '+00:00')
+--     WHERE CAST(`id_venue` AS UNSIGNED) = 5;
+--
+-- CONVERT_TZ with zone names needs the MySQL time zone tables loaded
+-- (mysql_tzinfo_to_sql).
@@ -0,0 +1,17 @@
+-- Event date lifecycle (POST /api/admin/event-dates/{id}/status) and sales
+-- windows. Bookings are accepted only while a date is ON_SALE and inside its
+-- window; a NULL sales_open_at opens sales immediately and a NULL
+-- sales_close_at closes them when the date starts.
+USE `ticketbooth`;
+
+ALTER TABLE `event_date`
+  ADD COLUMN `status` ENUM('DRAFT', 'ON_SALE', 'PAUSED', 'SOLD_OUT', 'CANCELLED', 'POSTPONED', 'COMPLETED') NOT NULL DEFAULT 'ON_SALE' AFTER `ends_at`,
+  ADD COLUMN `status_reason` VARCHAR(500) NULL AFTER `status`,
+  ADD COLUMN `status_changed_at` DATETIME NULL AFTER `status_reason`,
+  ADD COLUMN `sales_open_at` DATETIME NULL AFTER `status_changed_at`,
+  ADD COLUMN `sales_close_at` DATETIME NULL AFTER `sales_open_at`;
+
+-- Dates that have already happened could still be booked; close them out
+UPDATE `event_date`
+  SET `status` = 'COMPLETED', `status_changed_at` = UTC_TIMESTAMP()
+  WHERE `date` < UTC_TIMESTAMP();
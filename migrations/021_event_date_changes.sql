@@ -0,0 +1,69 @@
+-- Cancellation and postponement runs (POST /api/admin/event-dates/{id}/status).
+-- The status change records a run and a row per affected order in one
+-- transaction; a background worker then refunds or notifies the orders. Each
+-- order is marked done in the same transaction as its refund or email, so a
+-- run that stops half way picks up where it left off without paying or
+-- emailing anyone twice.
+USE `ticketbooth`;
+
+CREATE TABLE IF NOT EXISTS `event_date_change` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `event_date_id` INT NOT NULL,
+  `kind` ENUM('CANCEL', 'POSTPONE') NOT NULL,
+  `reason` VARCHAR(500) NOT NULL,
+  `previous_date` DATETIME NULL,
+  `new_date` DATETIME NULL,
+  -- Until when holders of a postponed date may ask for a refund
+  `refund_deadline` DATETIME NULL,
+  `operator_user_id` INT NOT NULL,
+  `status` ENUM('PENDING', 'RUNNING', 'COMPLETED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  -- Until when a worker holds a RUNNING change, or when a PENDING one that
+  -- still has orders to retry is next due
+  `lease_until` DATETIME NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completed_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_event_date_change_status` (`status` ASC, `created_at` ASC) VISIBLE,
+  INDEX `fk_event_date_change_event_date1_idx` (`event_date_id` ASC, `kind` ASC) VISIBLE,
+  INDEX `fk_event_date_change_user1_idx` (`operator_user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_date_change_event_date1`
+    FOREIGN KEY (`event_date_id`)
+    REFERENCES `event_date` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_date_change_user1`
+    FOREIGN KEY (`operator_user_id`)
+    REFERENCES `user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS `event_date_change_order` (
+  `change_id` INT NOT NULL,
+  `order_id` INT NOT NULL,
+  `status` ENUM('PENDING', 'DONE', 'SKIPPED', 'FAILED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `last_error` TEXT NULL,
+  `refund_id` INT NULL,
+  `refund_amount` DECIMAL(19,2) NULL,
+  `processed_at` DATETIME NULL,
+  PRIMARY KEY (`change_id`, `order_id`),
+  INDEX `idx_event_date_change_order_status` (`change_id` ASC, `status` ASC, `order_id` ASC) VISIBLE,
+  INDEX `fk_event_date_change_order_order1_idx` (`order_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_date_change_order_change1`
+    FOREIGN KEY (`change_id`)
+    REFERENCES `event_date_change` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_date_change_order_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_date_change_order_refund1`
+    FOREIGN KEY (`refund_id`)
+    REFERENCES `order_refund` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
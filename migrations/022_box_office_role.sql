@@ -0,0 +1,8 @@
+-- Box office staff: may look up any order and reissue its ticket credentials.
+-- The fixed id leaves the seed data's role ids (1-3) free on an empty table.
+USE `ticketbooth`;
+
+INSERT INTO `role` (`id`, `name`, `description`)
+SELECT 4, 'BOX_OFFICE', 'Can look up any order and reissue its tickets'
+FROM DUAL
+WHERE NOT EXISTS (SELECT 1 FROM `role` WHERE `name` = 'BOX_OFFICE');
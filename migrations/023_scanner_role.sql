@@ -0,0 +1,8 @@
+-- Door scanner accounts: may check tickets in and sync offline scans.
+-- The fixed id leaves the seed data's role ids (1-3) free on an empty table.
+USE `ticketbooth`;
+
+INSERT INTO `role` (`id`, `name`, `description`)
+SELECT 5, 'SCANNER', 'Can check tickets in at the door'
+FROM DUAL
+WHERE NOT EXISTS (SELECT 1 FROM `role` WHERE `name` = 'SCANNER');
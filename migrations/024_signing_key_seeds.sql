@@ -0,0 +1,9 @@
+-- Ticket signing keys get a random seed, stored AES-GCM encrypted with a key
+-- derived from TICKET_SIGNING_SECRET. Existing keys were derived from the secret
+-- itself and have no stored seed; the server retires each event's one on its
+-- next use, so it keeps verifying issued credentials but signs nothing new.
+-- Revoke them with POST /api/events/:id/signing-keys/rotate if the secret leaked.
+USE `ticketbooth`;
+
+ALTER TABLE `event_signing_key`
+  ADD COLUMN `private_key` VARCHAR(255) NULL AFTER `public_key`;
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Database Models
 
@@ -19,6 +22,8 @@ type Venue struct {
 	Capacity             int    `db:"capacity" json:"capacity"`
 	VenueType            string `db:"venue_type" json:"venueType"`
 	AccessibleWheelchair bool   `db:"accessible_weelchair" json:"accessibleWheelchair"`
+	// TimeZone is the venue's IANA zone, such as America/Mexico_City
+	TimeZone string `db:"time_zone" json:"timeZone"`
 }
 
 type EventDate struct {
@@ -28,6 +33,18 @@ type EventDate struct {
 	EventID      int        `db:"event_id" json:"-"`
 	SeatingMode  string     `db:"seating_mode" json:"seatingMode"`
 	Date         *time.Time `db:"date" json:"date"`
+	DoorsOpenAt  *time.Time `db:"doors_open_at" json:"doorsOpenAt,omitempty"`
+	EndsAt       *time.Time `db:"ends_at" json:"endsAt,omitempty"`
+	// Status is the lifecycle state; bookings need ON_SALE and the current
+	// time inside the sales window
+	Status          string     `db:"status" json:"status"`
+	StatusReason    string     `db:"status_reason" json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `db:"status_changed_at" json:"statusChangedAt,omitempty"`
+	SalesOpenAt     *time.Time `db:"sales_open_at" json:"salesOpenAt,omitempty"`
+	SalesCloseAt    *time.Time `db:"sales_close_at" json:"salesCloseAt,omitempty"`
+	// TimeZone is the venue's zone; Date, DoorsOpenAt, EndsAt and the sales
+	// window are loaded on its wall clock
+	TimeZone string `json:"timeZone"`
 	// Joined fields
 	Event *Event `json:"event,omitempty"`
 	Venue *Venue `json:"venue,omitempty"`
@@ -77,7 +94,12 @@ type Order struct {
 	TotalTickets  int        `db:"total_tickets" json:"totalTickets"`
 	Amount        string     `db:"amount" json:"amount"`
 	PaymentSource string     `db:"payment_source" json:"paymentSource"`
+	CustomerName  string     `db:"customer_name" json:"customerName"`
+	CustomerEmail string     `db:"customer_email" json:"customerEmail,omitempty"`
+	Locale        string     `db:"locale" json:"locale,omitempty"`
 	CreatedAt     *time.Time `db:"created_at" json:"createdAt,omitempty"`
+	// Sum of all refunds issued against the order
+	RefundedAmount float64 `db:"refunded_amount" json:"refundedAmount"`
 	// Joined fields
 	Tickets []*Ticket `json:"tickets,omitempty"`
 }
@@ -88,9 +110,21 @@ type Ticket struct {
 	UserID       string `db:"user_id" json:"-"`
 	TicketTypeID int    `db:"ticket_type_id" json:"-"`
 	ToName       string `db:"to_name" json:"toName"`
+	ToEmail      string `db:"to_email" json:"toEmail,omitempty"`
 	EventDateID  int    `db:"event_date_id" json:"-"`
 	SeatID       int    `db:"seat_id" json:"-"`
+	// Price charged for this ticket at booking time
+	Price float64 `db:"price" json:"price"`
+	// Random per-ticket value bound into the signed credential; replacing it invalidates old QR codes
+	CredentialNonce string `db:"credential_nonce" json:"-"`
+	// Set when the ticket is scanned in at the door
+	AdmittedAt     *time.Time `db:"admitted_at" json:"admittedAt,omitempty"`
+	AdmittedGate   string     `db:"admitted_gate" json:"admittedGate,omitempty"`
+	AdmittedDevice string     `db:"admitted_device" json:"admittedDevice,omitempty"`
+	// Set when the ticket is refunded; a refunded ticket no longer admits anyone
+	RefundedAt *time.Time `db:"refunded_at" json:"refundedAt,omitempty"`
 	// Joined fields
+	OrderID    int         `json:"orderId,omitempty"`
 	TicketType *TicketType `json:"ticketType,omitempty"`
 	Seat       *Seat       `json:"seat,omitempty"`
 	Event      *Event      `json:"event,omitempty"`
@@ -98,15 +132,202 @@ type Ticket struct {
 }
 
 type User struct {
-	ID             int        `db:"id" json:"id"`
-	Username       string     `db:"username" json:"username"`
-	FirstName      string     `db:"name" json:"firstName"`
-	LastName       string     `db:"last_name" json:"lastName"`
-	Email          string     `db:"email" json:"email"`
-	Password       string     `db:"-" json:"-"`
-	HashedPassword string     `db:"hashed_password" json:"-"`
-	CreatedAt      *time.Time `db:"date_created" json:"createdAt,omitempty"`
-	UpdatedAt      *time.Time `db:"date_updated" json:"updatedAt,omitempty"`
+	ID              int        `db:"id" json:"id"`
+	Username        string     `db:"username" json:"username"`
+	FirstName       string     `db:"name" json:"firstName"`
+	LastName        string     `db:"last_name" json:"lastName"`
+	Email           string     `db:"email" json:"email"`
+	Password        string     `db:"-" json:"-"`
+	HashedPassword  string     `db:"hashed_password" json:"-"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"emailVerifiedAt,omitempty"`
+	CreatedAt       *time.Time `db:"date_created" json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `db:"date_updated" json:"updatedAt,omitempty"`
+}
+
+// Session is a login on one device, kept alive by rotating refresh tokens
+type Session struct {
+	ID           int        `db:"id" json:"id"`
+	UserID       int        `db:"user_id" json:"userId"`
+	UserAgent    string     `db:"user_agent" json:"userAgent,omitempty"`
+	IPAddress    string     `db:"ip_address" json:"ipAddress,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	LastUsedAt   time.Time  `db:"last_used_at" json:"lastUsedAt"`
+	ExpiresAt    time.Time  `db:"expires_at" json:"expiresAt"`
+	RevokedAt    *time.Time `db:"revoked_at" json:"revokedAt,omitempty"`
+	RevokeReason string     `db:"revoke_reason" json:"revokeReason,omitempty"`
+}
+
+// RefreshToken is one link in a session's refresh token chain; only the hash is stored
+type RefreshToken struct {
+	ID        int        `db:"id" json:"id"`
+	SessionID int        `db:"session_id" json:"sessionId"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	RotatedAt *time.Time `db:"rotated_at" json:"rotatedAt,omitempty"`
+}
+
+// UserIdentity links an external OIDC account (provider + subject) to a user
+type UserIdentity struct {
+	ID          int        `db:"id" json:"id"`
+	UserID      int        `db:"user_id" json:"userId"`
+	Provider    string     `db:"provider" json:"provider"`
+	Subject     string     `db:"subject" json:"-"`
+	Email       string     `db:"email" json:"email,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"lastLoginAt,omitempty"`
+}
+
+// OIDCAuthRequest holds the server side of an authorization-code + PKCE login
+// between the redirect to the provider and the callback
+type OIDCAuthRequest struct {
+	ID           int       `db:"id"`
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	RedirectURI  string    `db:"redirect_uri"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// UserMFA is a user's TOTP enrollment; the secret is stored encrypted
+type UserMFA struct {
+	UserID       int        `db:"user_id" json:"userId"`
+	TOTPSecret   string     `db:"totp_secret" json:"-"`
+	ConfirmedAt  *time.Time `db:"confirmed_at" json:"confirmedAt,omitempty"`
+	LastUsedStep int64      `db:"last_used_step" json:"-"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// LoginLockout records a temporary lockout triggered by repeated failed logins
+type LoginLockout struct {
+	ID          int       `db:"id" json:"id"`
+	Scope       string    `db:"scope" json:"scope"`
+	Subject     string    `db:"subject" json:"subject"`
+	UserID      *int      `db:"user_id" json:"userId,omitempty"`
+	IPAddress   string    `db:"ip_address" json:"ipAddress,omitempty"`
+	Failures    int       `db:"failures" json:"failures"`
+	LockedUntil time.Time `db:"locked_until" json:"lockedUntil"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+}
+
+// DataExport is a background job that builds an archive of a user's personal
+// data. The archive itself is loaded separately, only for download.
+type DataExport struct {
+	ID          int        `db:"id" json:"id"`
+	UserID      int        `db:"user_id" json:"userId"`
+	Format      string     `db:"format" json:"format"`
+	Status      string     `db:"status" json:"status"`
+	Attempts    int        `db:"attempts" json:"attempts"`
+	LeaseUntil  *time.Time `db:"lease_until" json:"-"`
+	LastError   string     `db:"last_error" json:"lastError,omitempty"`
+	FileName    string     `db:"file_name" json:"fileName,omitempty"`
+	ContentType string     `db:"content_type" json:"contentType,omitempty"`
+	SizeBytes   int        `db:"size_bytes" json:"sizeBytes,omitempty"`
+	RequestedAt time.Time  `db:"requested_at" json:"requestedAt"`
+	CompletedAt *time.Time `db:"completed_at" json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expiresAt,omitempty"`
+}
+
+// AuditEntry is one row of the append-only audit log. Before and After hold
+// the JSON state of the entity around the change, when there is one.
+type AuditEntry struct {
+	ID          int64     `db:"id" json:"id"`
+	ActorUserID *int      `db:"actor_user_id" json:"actorUserId,omitempty"`
+	Action      string    `db:"action" json:"action"`
+	EntityType  string    `db:"entity_type" json:"entityType"`
+	EntityID    string    `db:"entity_id" json:"entityId"`
+	Before      string    `db:"before_data" json:"-"`
+	After       string    `db:"after_data" json:"-"`
+	RequestID   string    `db:"request_id" json:"requestId,omitempty"`
+	IPAddress   string    `db:"ip_address" json:"ipAddress,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+}
+
+// AuditActor identifies who made a change and the request it came from.
+// UserID is nil for unauthenticated requests.
+type AuditActor struct {
+	UserID    *int
+	RequestID string
+	IPAddress string
+}
+
+// UserToken is a single-use account token (password reset, email verification).
+// Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID        int        `db:"id" json:"id"`
+	UserID    int        `db:"user_id" json:"userId"`
+	Purpose   string     `db:"purpose" json:"purpose"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt,omitempty"`
+	CreatedAt *time.Time `db:"created_at" json:"createdAt,omitempty"`
+}
+
+// OutboxMessage is a transactional email queued in the same transaction as the
+// change that triggered it and delivered later by the email worker
+type OutboxMessage struct {
+	ID            int        `db:"id" json:"id"`
+	Template      string     `db:"template" json:"template"`
+	Locale        string     `db:"locale" json:"locale"`
+	ToEmail       string     `db:"to_email" json:"toEmail"`
+	ToName        string     `db:"to_name" json:"toName,omitempty"`
+	OrderID       *int       `db:"order_id" json:"orderId,omitempty"`
+	Payload       string     `db:"payload" json:"-"`
+	Status        string     `db:"status" json:"status"`
+	Attempts      int        `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time  `db:"next_attempt_at" json:"nextAttemptAt"`
+	LastError     string     `db:"last_error" json:"lastError,omitempty"`
+	CreatedAt     *time.Time `db:"created_at" json:"createdAt,omitempty"`
+	SentAt        *time.Time `db:"sent_at" json:"sentAt,omitempty"`
+}
+
+// SigningKey is a per-event Ed25519 key used to sign ticket credentials.
+// Only the public half is stored; the private key is derived from the server secret.
+type SigningKey struct {
+	ID        int    `db:"id" json:"-"`
+	EventID   int    `db:"event_id" json:"eventId"`
+	Version   int    `db:"version" json:"version"`
+	KeyID     string `db:"key_id" json:"keyId"`
+	PublicKey string `db:"public_key" json:"publicKey"`
+	// SealedPrivateKey is the encrypted Ed25519 seed; empty for keys created
+	// before seeds were stored
+	SealedPrivateKey string     `db:"private_key" json:"-"`
+	Status           string     `db:"status" json:"status"`
+	CreatedAt        *time.Time `db:"created_at" json:"createdAt,omitempty"`
+	RetiredAt        *time.Time `db:"retired_at" json:"retiredAt,omitempty"`
+}
+
+// TicketCredential is the payload signed into a ticket's QR code.
+// Field names are kept short so the encoded credential stays small.
+type TicketCredential struct {
+	TicketID    int    `json:"t"`
+	EventDateID int    `json:"d"`
+	EventDate   int64  `json:"ts,omitempty"`
+	Seat        string `json:"s,omitempty"`
+	Nonce       string `json:"n"`
+}
+
+// Admission is the canonical door entry recorded for a ticket
+type Admission struct {
+	TicketID   int       `db:"id" json:"ticketId"`
+	AdmittedAt time.Time `db:"admitted_at" json:"admittedAt"`
+	Gate       string    `db:"admitted_gate" json:"gate"`
+	DeviceID   string    `db:"admitted_device" json:"deviceId"`
+}
+
+// TicketScan is an append-only record of every scan attempt, online or synced from a device
+type TicketScan struct {
+	ID           int        `db:"id" json:"id"`
+	TicketID     *int       `db:"ticket_id" json:"ticketId,omitempty"`
+	EventDateID  int        `db:"event_date_id" json:"eventDateId"`
+	Gate         string     `db:"gate" json:"gate"`
+	DeviceID     string     `db:"device_id" json:"deviceId"`
+	ClientScanID string     `db:"client_scan_id" json:"clientScanId,omitempty"`
+	Source       string     `db:"source" json:"source"`
+	Result       string     `db:"result" json:"result"`
+	Conflict     bool       `db:"conflict" json:"conflict"`
+	ScannedAt    time.Time  `db:"scanned_at" json:"scannedAt"`
+	ReceivedAt   *time.Time `db:"received_at" json:"receivedAt,omitempty"`
 }
 
 // API Request/Response DTOs
@@ -115,20 +336,87 @@ type EventDateResponse struct {
 	ID          int        `json:"id"`
 	Event       *EventInfo `json:"event"`
 	Date        string     `json:"date"`
+	DoorsOpen   string     `json:"doorsOpen,omitempty"`
+	EndsAt      string     `json:"endsAt,omitempty"`
+	TimeZone    string     `json:"timeZone"`
 	Venue       *VenueInfo `json:"venue"`
 	SeatingMode string     `json:"seatingMode"`
+	Status      string     `json:"status"`
+	// StatusReason explains a cancellation or postponement
+	StatusReason string `json:"statusReason,omitempty"`
+	SalesOpenAt  string `json:"salesOpenAt,omitempty"`
+	SalesCloseAt string `json:"salesCloseAt,omitempty"`
+	// OnSale is true when the date can be booked right now
+	OnSale bool `json:"onSale"`
 }
 
 type EventInfo struct {
 	ID          int    `json:"id"`
+	Slug        string `json:"slug,omitempty"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
 }
 
 type VenueInfo struct {
 	ID       int    `json:"id"`
+	Slug     string `json:"slug,omitempty"`
 	Name     string `json:"name"`
 	Capacity int    `json:"capacity"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// EventDetailResponse is the full event behind GET /api/events/{slugOrId}
+type EventDetailResponse struct {
+	ID          int                `json:"id"`
+	Slug        string             `json:"slug"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Dates       []*EventDetailDate `json:"dates"`
+	Categories  []*Category        `json:"categories"`
+	Tags        []string           `json:"tags"`
+	Performers  []*Performer       `json:"performers"`
+	Media       []*EventMedia      `json:"media"`
+}
+
+// EventDetailDate is one date of an event. MinPrice is the cheapest seat or
+// tier still on sale; it is null once the date is sold out.
+type EventDetailDate struct {
+	ID          int        `json:"id"`
+	Date        string     `json:"date"`
+	DoorsOpen   string     `json:"doorsOpen,omitempty"`
+	EndsAt      string     `json:"endsAt,omitempty"`
+	TimeZone    string     `json:"timeZone"`
+	SeatingMode string     `json:"seatingMode"`
+	Status      string     `json:"status"`
+	Venue       *VenueInfo `json:"venue"`
+	MinPrice    *float64   `json:"minPrice"`
+	SoldOut     bool       `json:"soldOut"`
+}
+
+// VenueDetailResponse is a venue with its upcoming dates, earliest first
+type VenueDetailResponse struct {
+	ID                   int              `json:"id"`
+	Slug                 string           `json:"slug"`
+	Name                 string           `json:"name"`
+	Description          string           `json:"description"`
+	Capacity             int              `json:"capacity"`
+	VenueType            string           `json:"venueType"`
+	AccessibleWheelchair bool             `json:"accessibleWheelchair"`
+	TimeZone             string           `json:"timeZone"`
+	UpcomingDates        []*VenueDateItem `json:"upcomingDates"`
+}
+
+// VenueDateItem is an upcoming date at a venue, priced like EventDetailDate
+type VenueDateItem struct {
+	ID          int        `json:"id"`
+	Date        string     `json:"date"`
+	DoorsOpen   string     `json:"doorsOpen,omitempty"`
+	EndsAt      string     `json:"endsAt,omitempty"`
+	SeatingMode string     `json:"seatingMode"`
+	Status      string     `json:"status"`
+	Event       *EventInfo `json:"event"`
+	MinPrice    *float64   `json:"minPrice"`
+	SoldOut     bool       `json:"soldOut"`
 }
 
 type EventListItem struct {
@@ -137,13 +425,185 @@ type EventListItem struct {
 	Title       string           `json:"title"`
 	Description string           `json:"description"`
 	Dates       []*EventDateItem `json:"dates"`
+	Categories  []*Category      `json:"categories"`
+	Tags        []string         `json:"tags"`
+	Performers  []*Performer     `json:"performers"`
+	// ImageURL is the event's first image, for catalog cards
+	ImageURL string `json:"imageUrl,omitempty"`
+	// SortKey is the value the catalog page was sorted on, for its cursor
+	SortKey string `json:"-"`
 }
 
 type EventDateItem struct {
 	ID          int    `json:"id"`
 	Date        string `json:"date"`
+	DoorsOpen   string `json:"doorsOpen,omitempty"`
+	EndsAt      string `json:"endsAt,omitempty"`
+	TimeZone    string `json:"timeZone"`
 	VenueName   string `json:"venueName"`
 	SeatingMode string `json:"seatingMode"`
+	Status      string `json:"status"`
+	// Available is true while the date is on sale, inside its sales window
+	// and not sold out
+	Available bool `json:"available"`
+}
+
+// Category is a catalog category such as music, theatre or sports
+type Category struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// Performer is an artist, band, team or company appearing at events
+type Performer struct {
+	ID          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+}
+
+// EventMedia is an image or video shown with an event, referenced by URL
+type EventMedia struct {
+	ID       int    `json:"id"`
+	EventID  int    `json:"-"`
+	Kind     string `json:"kind"`
+	URL      string `json:"url"`
+	AltText  string `json:"altText,omitempty"`
+	Position int    `json:"position"`
+}
+
+// EventClassification is everything that classifies and illustrates an
+// event. Performers are in billing order, headliner first; media by position.
+type EventClassification struct {
+	EventID    int           `json:"eventId"`
+	Categories []*Category   `json:"categories"`
+	Tags       []string      `json:"tags"`
+	Performers []*Performer  `json:"performers"`
+	Media      []*EventMedia `json:"media"`
+}
+
+type CategoryRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// VenueTimeZone is a venue's IANA zone, as set by admins
+type VenueTimeZone struct {
+	VenueID  int    `json:"venueId"`
+	TimeZone string `json:"timeZone"`
+}
+
+type PerformerRequest struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ImageURL    string `json:"imageUrl"`
+}
+
+// EventClassificationRequest replaces an event's categories, tags or lineup.
+// A field left out is not changed; an empty list clears it. PerformerIDs are
+// in billing order.
+type EventClassificationRequest struct {
+	CategoryIDs  *[]int    `json:"categoryIds"`
+	Tags         *[]string `json:"tags"`
+	PerformerIDs *[]int    `json:"performerIds"`
+}
+
+type EventMediaRequest struct {
+	Kind     string `json:"kind"`
+	URL      string `json:"url"`
+	AltText  string `json:"altText"`
+	Position int    `json:"position"`
+}
+
+// EventDateScheduleRequest sets an event date's times, each RFC3339 with an
+// offset. A field left out is not changed; an empty string clears it, except
+// date, which cannot be cleared.
+type EventDateScheduleRequest struct {
+	Date         *string `json:"date"`
+	DoorsOpen    *string `json:"doorsOpen"`
+	EndsAt       *string `json:"endsAt"`
+	SalesOpenAt  *string `json:"salesOpenAt"`
+	SalesCloseAt *string `json:"salesCloseAt"`
+}
+
+// EventDateStatusRequest moves an event date to another lifecycle state.
+// Reason is required to cancel or postpone and is sent to ticket holders.
+// NewDate (RFC3339) and RefundWindowDays apply only to postponements.
+type EventDateStatusRequest struct {
+	Status           string  `json:"status"`
+	Reason           string  `json:"reason"`
+	NewDate          *string `json:"newDate"`
+	RefundWindowDays *int    `json:"refundWindowDays"`
+}
+
+// EventDateStatusResponse is the result of a status change. Cancelling and
+// postponing start a change run, reported in Change.
+type EventDateStatusResponse struct {
+	ID             int              `json:"id"`
+	Status         string           `json:"status"`
+	PreviousStatus string           `json:"previousStatus"`
+	Reason         string           `json:"reason,omitempty"`
+	ChangedAt      string           `json:"changedAt"`
+	Change         *EventDateChange `json:"change,omitempty"`
+}
+
+// EventDateChange is a cancellation or postponement run: the background
+// worker refunds (CANCEL) or notifies (POSTPONE) every order that held
+// tickets for the date when it was changed. Times are UTC.
+type EventDateChange struct {
+	ID             int        `json:"id"`
+	EventDateID    int        `json:"eventDateId"`
+	Kind           string     `json:"kind"`
+	Reason         string     `json:"reason"`
+	PreviousDate   *time.Time `json:"previousDate,omitempty"`
+	NewDate        *time.Time `json:"newDate,omitempty"`
+	RefundDeadline *time.Time `json:"refundDeadline,omitempty"`
+	OperatorUserID int        `json:"operatorUserId"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LeaseUntil     *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+	// Joined fields
+	Progress     *EventDateChangeProgress `json:"progress,omitempty"`
+	FailedOrders []*EventDateChangeOrder  `json:"failedOrders,omitempty"`
+}
+
+// EventDateChangeProgress counts a run's orders by state. RefundedAmount is
+// the total refunded so far.
+type EventDateChangeProgress struct {
+	Total          int     `json:"total"`
+	Pending        int     `json:"pending"`
+	Done           int     `json:"done"`
+	Skipped        int     `json:"skipped"`
+	Failed         int     `json:"failed"`
+	RefundedAmount float64 `json:"refundedAmount"`
+}
+
+// EventDateChangeOrder is one order's place in a change run. SKIPPED orders
+// had nothing left to refund when the worker reached them, or were left to a
+// later change to the same date.
+type EventDateChangeOrder struct {
+	OrderID      int        `json:"orderId"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"lastError,omitempty"`
+	RefundID     *int       `json:"refundId,omitempty"`
+	RefundAmount *float64   `json:"refundAmount,omitempty"`
+	ProcessedAt  *time.Time `json:"processedAt,omitempty"`
+	// Joined fields
+	Order *Order `json:"-"`
+}
+
+// EventListResponse is a page of the event catalog. Total counts every
+// matching event; NextCursor is omitted on the last page.
+type EventListResponse struct {
+	Events     []*EventListItem `json:"events"`
+	Total      int              `json:"total"`
+	NextCursor *string          `json:"nextCursor,omitempty"`
 }
 
 type GAAvailabilityResponse struct {
@@ -184,6 +644,8 @@ type SeatAvailability struct {
 type BookingRequest struct {
 	EventDateID   int                   `json:"eventDateId"`
 	CustomerName  string                `json:"customerName"`
+	CustomerEmail string                `json:"customerEmail,omitempty"`
+	Locale        string                `json:"locale,omitempty"` // Language for emails; defaults to Accept-Language
 	PaymentSource string                `json:"paymentSource"`
 	UserID        int                   `json:"userId"`
 	Tiers         []*TierBookingRequest `json:"tiers,omitempty"` // For GA
@@ -191,13 +653,20 @@ type BookingRequest struct {
 }
 
 type TierBookingRequest struct {
-	TicketTypeID int `json:"ticketTypeId"`
-	Quantity     int `json:"quantity"`
+	TicketTypeID int                `json:"ticketTypeId"`
+	Quantity     int                `json:"quantity"`
+	Attendees    []*AttendeeRequest `json:"attendees,omitempty"` // One per ticket; missing entries default to the purchaser
 }
 
 type SeatBookingRequest struct {
-	SeatID       int `json:"seatId"`
-	TicketTypeID int `json:"ticketTypeId"`
+	SeatID       int              `json:"seatId"`
+	TicketTypeID int              `json:"ticketTypeId"`
+	Attendee     *AttendeeRequest `json:"attendee,omitempty"` // Defaults to the purchaser
+}
+
+type AttendeeRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
 }
 
 type BookingResponse struct {
@@ -210,23 +679,121 @@ type TicketResponse struct {
 	ID         int     `json:"id"`
 	TicketType string  `json:"ticketType"`
 	SeatLabel  *string `json:"seatLabel"`
+	Price      float64 `json:"price"`
 	ToName     string  `json:"toName"`
+	ToEmail    string  `json:"toEmail,omitempty"`
+	Credential string  `json:"credential,omitempty"`
 }
 
 type OrderResponse struct {
-	ID           int                    `json:"id"`
-	CreatedAt    string                 `json:"createdAt"`
-	CustomerName string                 `json:"customerName"`
-	TotalAmount  float64                `json:"totalAmount"`
-	Tickets      []*OrderTicketResponse `json:"tickets"`
+	ID            int                    `json:"id"`
+	CreatedAt     string                 `json:"createdAt"`
+	CustomerName  string                 `json:"customerName"`
+	CustomerEmail string                 `json:"customerEmail,omitempty"`
+	TotalAmount   float64                `json:"totalAmount"`
+	Tickets       []*OrderTicketResponse `json:"tickets"`
+	// RefundedAmount is what has been refunded so far
+	RefundedAmount float64 `json:"refundedAmount"`
+	// Status is PAID, PARTIALLY_REFUNDED or REFUNDED
+	Status        string `json:"status"`
+	PaymentSource string `json:"paymentSource,omitempty"`
+	// UserID is only included in admin listings
+	UserID int `json:"userId,omitempty"`
+}
+
+// OrderListResponse is a page of orders. NextCursor is passed as cursor to
+// get the next page; it is omitted on the last page.
+type OrderListResponse struct {
+	Orders     []*OrderResponse `json:"orders"`
+	NextCursor *string          `json:"nextCursor,omitempty"`
 }
 
 type OrderTicketResponse struct {
-	ID         int     `json:"id"`
-	EventTitle string  `json:"eventTitle"`
-	EventDate  string  `json:"eventDate"`
-	TicketType string  `json:"ticketType"`
-	SeatLabel  *string `json:"seatLabel"`
+	ID         int    `json:"id"`
+	EventTitle string `json:"eventTitle"`
+	EventDate  string `json:"eventDate"`
+	// EventTimeZone is the venue's zone; EventDate carries its offset
+	EventTimeZone string  `json:"eventTimeZone,omitempty"`
+	TicketType    string  `json:"ticketType"`
+	SeatLabel     *string `json:"seatLabel"`
+	Price         float64 `json:"price"`
+	ToName        string  `json:"toName"`
+	ToEmail       string  `json:"toEmail,omitempty"`
+	Credential    string  `json:"credential,omitempty"`
+	RefundedAt    *string `json:"refundedAt,omitempty"`
+}
+
+type SigningKeyResponse struct {
+	KeyID     string  `json:"keyId"`
+	Algorithm string  `json:"algorithm"`
+	PublicKey string  `json:"publicKey"`
+	Status    string  `json:"status"`
+	CreatedAt *string `json:"createdAt,omitempty"`
+	RetiredAt *string `json:"retiredAt,omitempty"`
+}
+
+type RotateSigningKeyRequest struct {
+	RevokePrevious bool `json:"revokePrevious"`
+}
+
+type CheckInRequest struct {
+	Credential  string `json:"credential"`
+	EventDateID int    `json:"eventDateId"`
+	Gate        string `json:"gate"`
+	// DeviceID is the client's own device ID; the handler scopes it to the
+	// signed-in scanner
+	DeviceID string `json:"deviceId"`
+}
+
+type CheckInResponse struct {
+	Status      string         `json:"status"`
+	TicketID    int            `json:"ticketId"`
+	EventDateID int            `json:"eventDateId"`
+	TicketType  string         `json:"ticketType"`
+	SeatLabel   *string        `json:"seatLabel"`
+	ToName      string         `json:"toName"`
+	Admission   *AdmissionInfo `json:"admission"`
+}
+
+type AdmissionInfo struct {
+	AdmittedAt string `json:"admittedAt"`
+	Gate       string `json:"gate"`
+	DeviceID   string `json:"deviceId"`
+}
+
+// AlreadyAdmittedResponse is the 409 body for a second scan, carrying the original entry
+type AlreadyAdmittedResponse struct {
+	Error     string         `json:"error"`
+	Message   string         `json:"message"`
+	TicketID  int            `json:"ticketId"`
+	Admission *AdmissionInfo `json:"admission"`
+}
+
+type CheckInSyncRequest struct {
+	DeviceID string                `json:"deviceId"`
+	Scans    []*OfflineScanRequest `json:"scans"`
+}
+
+type OfflineScanRequest struct {
+	ClientScanID string `json:"clientScanId"`
+	Credential   string `json:"credential"`
+	EventDateID  int    `json:"eventDateId"`
+	Gate         string `json:"gate"`
+	ScannedAt    string `json:"scannedAt"`
+}
+
+type CheckInSyncResponse struct {
+	Results []*OfflineScanResult `json:"results"`
+}
+
+type OfflineScanResult struct {
+	ClientScanID string         `json:"clientScanId"`
+	Status       string         `json:"status"`
+	TicketID     int            `json:"ticketId,omitempty"`
+	Conflict     bool           `json:"conflict"`
+	Message      string         `json:"message,omitempty"`
+	Admission    *AdmissionInfo `json:"admission,omitempty"`
+	Superseded   *AdmissionInfo `json:"superseded,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -250,13 +817,72 @@ type UpdateUserRequest struct {
 }
 
 type UserResponse struct {
-	ID        int     `json:"id"`
-	Username  string  `json:"username"`
-	FirstName string  `json:"firstName"`
-	LastName  string  `json:"lastName"`
-	Email     string  `json:"email"`
-	CreatedAt *string `json:"createdAt,omitempty"`
-	UpdatedAt *string `json:"updatedAt,omitempty"`
+	ID            int     `json:"id"`
+	Username      string  `json:"username"`
+	FirstName     string  `json:"firstName"`
+	LastName      string  `json:"lastName"`
+	Email         string  `json:"email"`
+	EmailVerified bool    `json:"emailVerified"`
+	CreatedAt     *string `json:"createdAt,omitempty"`
+	UpdatedAt     *string `json:"updatedAt,omitempty"`
+	// Roles is only filled in for the signed-in user's own profile
+	Roles []string `json:"roles,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// DeleteAccountRequest confirms account deletion. Password is required unless
+// the account was created through social login and has never set one.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type DataExportResponse struct {
+	ID          int     `json:"id"`
+	Format      string  `json:"format"`
+	Status      string  `json:"status"`
+	RequestedAt string  `json:"requestedAt"`
+	CompletedAt *string `json:"completedAt,omitempty"`
+	ExpiresAt   *string `json:"expiresAt,omitempty"`
+	SizeBytes   int     `json:"sizeBytes,omitempty"`
+	StatusURL   string  `json:"statusUrl"`
+	DownloadURL string  `json:"downloadUrl,omitempty"`
+}
+
+type AuditEntryResponse struct {
+	ID          int64           `json:"id"`
+	ActorUserID *int            `json:"actorUserId,omitempty"`
+	Action      string          `json:"action"`
+	EntityType  string          `json:"entityType"`
+	EntityID    string          `json:"entityId"`
+	Before      json.RawMessage `json:"before,omitempty"`
+	After       json.RawMessage `json:"after,omitempty"`
+	RequestID   string          `json:"requestId,omitempty"`
+	IPAddress   string          `json:"ipAddress,omitempty"`
+	CreatedAt   string          `json:"createdAt"`
+}
+
+type AuditLogResponse struct {
+	Entries []*AuditEntryResponse `json:"entries"`
+	// NextBefore is passed as ?before= to fetch the next (older) page
+	NextBefore *int64 `json:"nextBefore,omitempty"`
+}
+
+// DataExportArchive is everything held about a user, as written to an export
+type DataExportArchive struct {
+	GeneratedAt   string           `json:"generatedAt"`
+	Profile       *User            `json:"profile"`
+	Roles         []string         `json:"roles"`
+	MFA           *UserMFA         `json:"mfa,omitempty"`
+	Identities    []*UserIdentity  `json:"linkedAccounts"`
+	Orders        []*Order         `json:"orders"`
+	Sessions      []*Session       `json:"sessions"`
+	CheckIns      []*TicketScan    `json:"checkIns"`
+	Emails        []*OutboxMessage `json:"emails"`
+	LoginLockouts []*LoginLockout  `json:"loginLockouts"`
 }
 
 type LoginRequest struct {
@@ -266,6 +892,319 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string        `json:"token"`
-	User  *UserResponse `json:"user"`
+	// Token is the access token, kept for clients written before refresh tokens
+	Token        string        `json:"token"`
+	AccessToken  string        `json:"accessToken"`
+	RefreshToken string        `json:"refreshToken"`
+	TokenType    string        `json:"tokenType"`
+	ExpiresIn    int           `json:"expiresIn"` // Access token lifetime in seconds
+	User         *UserResponse `json:"user,omitempty"`
+	// RecoveryCodes is only set when login finishes a mandatory MFA enrollment
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// MFAChallengeResponse is returned by login instead of a session when a second
+// factor is needed. MFAToken authorizes only the /api/login/mfa endpoints.
+type MFAChallengeResponse struct {
+	MFARequired           bool   `json:"mfaRequired"`
+	MFAEnrollmentRequired bool   `json:"mfaEnrollmentRequired"`
+	MFAToken              string `json:"mfaToken"`
+	ExpiresIn             int    `json:"expiresIn"`
+}
+
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// OIDCCallbackRequest carries the code and state the provider redirected back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+}
+
+// MFACodeRequest carries a TOTP code; MFAToken is only used during login enrollment
+type MFACodeRequest struct {
+	MFAToken string `json:"mfaToken,omitempty"`
+	Code     string `json:"code"`
+}
+
+type MFAEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MFAStatusResponse struct {
+	Enabled bool `json:"enabled"`
+	// Required is true for admin and organizer accounts, which cannot turn MFA off
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type SessionResponse struct {
+	ID         int    `json:"id"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	IPAddress  string `json:"ipAddress,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+	LastUsedAt string `json:"lastUsedAt"`
+	ExpiresAt  string `json:"expiresAt"`
+	Current    bool   `json:"current"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// OrderRefund is one refund issued against an order
+type OrderRefund struct {
+	ID             int       `db:"id" json:"id"`
+	OrderID        int       `db:"order_id" json:"orderId"`
+	Type           string    `db:"type" json:"type"`
+	Amount         float64   `db:"amount" json:"amount"`
+	Reason         string    `db:"reason" json:"reason"`
+	OperatorUserID int       `db:"operator_user_id" json:"operatorUserId"`
+	Restocked      bool      `db:"restocked" json:"restocked"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+	// Joined fields
+	TicketIDs []int `json:"ticketIds"`
+}
+
+// RefundRequest is the body of POST /api/orders/{id}/refunds. Type is FULL,
+// TICKETS (with ticketIds) or AMOUNT (with amount); restock returns refunded
+// tickets to sale.
+type RefundRequest struct {
+	Type      string   `json:"type"`
+	TicketIDs []int    `json:"ticketIds,omitempty"`
+	Amount    *float64 `json:"amount,omitempty"`
+	Reason    string   `json:"reason"`
+	Restock   bool     `json:"restock"`
+}
+
+type RefundResponse struct {
+	ID             int     `json:"id"`
+	OrderID        int     `json:"orderId"`
+	Type           string  `json:"type"`
+	Amount         float64 `json:"amount"`
+	Reason         string  `json:"reason"`
+	OperatorUserID int     `json:"operatorUserId"`
+	Restocked      bool    `json:"restocked"`
+	TicketIDs      []int   `json:"ticketIds"`
+	CreatedAt      string  `json:"createdAt"`
+}
+
+// OrderRefundsResponse lists an order's refunds with its remaining balance
+type OrderRefundsResponse struct {
+	OrderID           int               `json:"orderId"`
+	TotalAmount       float64           `json:"totalAmount"`
+	RefundedAmount    float64           `json:"refundedAmount"`
+	RefundableBalance float64           `json:"refundableBalance"`
+	Refunds           []*RefundResponse `json:"refunds"`
+}
+
+// TrialBalanceResponse is every ledger account's totals. Balanced is false if
+// total debits and credits differ, or any single transaction is unbalanced.
+type TrialBalanceResponse struct {
+	AsOf                   *string                `json:"asOf,omitempty"`
+	Accounts               []*TrialBalanceAccount `json:"accounts"`
+	TotalDebit             float64                `json:"totalDebit"`
+	TotalCredit            float64                `json:"totalCredit"`
+	Balanced               bool                   `json:"balanced"`
+	UnbalancedTransactions int                    `json:"unbalancedTransactions"`
+}
+
+// TrialBalanceAccount is one account's totals; Balance is on its normal side
+type TrialBalanceAccount struct {
+	Account    string  `json:"account"`
+	NormalSide string  `json:"normalSide"`
+	Debit      float64 `json:"debit"`
+	Credit     float64 `json:"credit"`
+	Balance    float64 `json:"balance"`
+}
+
+// Settlement is an organizer's payout statement for a period. Refunds are
+// subtracted from gross sales; NetPayout is what the organizer is owed after
+// refunds, platform fees and tax.
+type Settlement struct {
+	ID            int               `db:"id" json:"id"`
+	Reference     string            `db:"reference" json:"reference"`
+	OrganizerID   int               `db:"organizer_id" json:"organizerId"`
+	OrganizerName string            `json:"organizerName,omitempty"`
+	PeriodStart   time.Time         `db:"period_start" json:"periodStart"`
+	PeriodEnd     time.Time         `db:"period_end" json:"periodEnd"`
+	OrderCount    int               `db:"order_count" json:"orderCount"`
+	RefundCount   int               `db:"refund_count" json:"refundCount"`
+	GrossSales    float64           `db:"gross_sales" json:"grossSales"`
+	Refunds       float64           `db:"refunds" json:"refunds"`
+	PlatformFees  float64           `db:"platform_fees" json:"platformFees"`
+	Tax           float64           `db:"tax" json:"tax"`
+	NetPayout     float64           `db:"net_payout" json:"netPayout"`
+	CreatedBy     int               `db:"created_by" json:"createdBy"`
+	CreatedAt     time.Time         `db:"created_at" json:"createdAt"`
+	Lines         []*SettlementLine `json:"lines,omitempty"`
+}
+
+// SettlementLine is one event's share of a settlement
+type SettlementLine struct {
+	SettlementID int     `db:"settlement_id" json:"-"`
+	EventID      int     `db:"event_id" json:"eventId"`
+	EventTitle   string  `json:"eventTitle"`
+	OrderCount   int     `db:"order_count" json:"orderCount"`
+	RefundCount  int     `db:"refund_count" json:"refundCount"`
+	GrossSales   float64 `db:"gross_sales" json:"grossSales"`
+	Refunds      float64 `db:"refunds" json:"refunds"`
+	PlatformFees float64 `db:"platform_fees" json:"platformFees"`
+	Tax          float64 `db:"tax" json:"tax"`
+	NetPayout    float64 `db:"net_payout" json:"netPayout"`
+}
+
+// SettlementRunRequest settles everything unsettled in [periodStart, periodEnd),
+// for one organizer or all of them
+type SettlementRunRequest struct {
+	PeriodStart string `json:"periodStart"`
+	PeriodEnd   string `json:"periodEnd"`
+	OrganizerID *int   `json:"organizerId,omitempty"`
+}
+
+type SettlementResponse struct {
+	ID            int                       `json:"id"`
+	Reference     string                    `json:"reference"`
+	OrganizerID   int                       `json:"organizerId"`
+	OrganizerName string                    `json:"organizerName,omitempty"`
+	PeriodStart   string                    `json:"periodStart"`
+	PeriodEnd     string                    `json:"periodEnd"`
+	OrderCount    int                       `json:"orderCount"`
+	RefundCount   int                       `json:"refundCount"`
+	GrossSales    float64                   `json:"grossSales"`
+	Refunds       float64                   `json:"refunds"`
+	PlatformFees  float64                   `json:"platformFees"`
+	Tax           float64                   `json:"tax"`
+	NetPayout     float64                   `json:"netPayout"`
+	CreatedBy     int                       `json:"createdBy"`
+	CreatedAt     string                    `json:"createdAt"`
+	Lines         []*SettlementLineResponse `json:"lines,omitempty"`
+}
+
+type SettlementLineResponse struct {
+	EventID      int     `json:"eventId"`
+	EventTitle   string  `json:"eventTitle"`
+	OrderCount   int     `json:"orderCount"`
+	RefundCount  int     `json:"refundCount"`
+	GrossSales   float64 `json:"grossSales"`
+	Refunds      float64 `json:"refunds"`
+	PlatformFees float64 `json:"platformFees"`
+	Tax          float64 `json:"tax"`
+	NetPayout    float64 `json:"netPayout"`
+}
+
+// SettlementRunResponse lists the statements a run created; organizers with
+// nothing to settle get none. UnassignedOrders counts orders left unsettled
+// because their event has no organizer.
+type SettlementRunResponse struct {
+	Settlements      []*SettlementResponse `json:"settlements"`
+	UnassignedOrders int                   `json:"unassignedOrders"`
+}
+
+// SettlementListResponse is a page of statements, newest first. NextBefore is
+// the settlement ID to pass as before for the next page.
+type SettlementListResponse struct {
+	Settlements []*SettlementResponse `json:"settlements"`
+	NextBefore  *int                  `json:"nextBefore,omitempty"`
+}
+
+// SalesReport summarizes ticket sales for an event or a single event date.
+// Refunded tickets are excluded throughout; revenue is the face value of the
+// tickets still sold. Capacity and SellThroughPercent are nil when no
+// capacity is configured.
+type SalesReport struct {
+	EventID            int                   `json:"eventId"`
+	EventTitle         string                `json:"eventTitle"`
+	EventDateID        *int                  `json:"eventDateId,omitempty"`
+	From               *time.Time            `json:"from,omitempty"`
+	To                 *time.Time            `json:"to,omitempty"`
+	Interval           string                `json:"interval"`
+	TicketsSold        int                   `json:"ticketsSold"`
+	TicketsRefunded    int                   `json:"ticketsRefunded"`
+	GrossRevenue       float64               `json:"grossRevenue"`
+	Capacity           *int                  `json:"capacity"`
+	SellThroughPercent *float64              `json:"sellThroughPercent"`
+	Dates              []*DateSales          `json:"dates"`
+	Tiers              []*TierSales          `json:"tiers"`
+	Velocity           []*SalesVelocityPoint `json:"velocity"`
+	TopSections        []*SectionSales       `json:"topSections"`
+}
+
+// DateSales is one event date's sales. Capacity is tota_tickets, or the sum
+// of its tiers' capacities when that is not set.
+type DateSales struct {
+	EventDateID        int        `json:"eventDateId"`
+	Date               *time.Time `json:"date,omitempty"`
+	SeatingMode        string     `json:"seatingMode,omitempty"`
+	TicketsSold        int        `json:"ticketsSold"`
+	TicketsRefunded    int        `json:"ticketsRefunded"`
+	GrossRevenue       float64    `json:"grossRevenue"`
+	Capacity           *int       `json:"capacity"`
+	SellThroughPercent *float64   `json:"sellThroughPercent"`
+}
+
+// TierSales is one ticket type's sales. Capacity is max_quantity, or the
+// number of seats priced at the tier on seated dates without one.
+type TierSales struct {
+	TicketTypeID       int      `json:"ticketTypeId"`
+	Name               string   `json:"name"`
+	TicketsSold        int      `json:"ticketsSold"`
+	TicketsRefunded    int      `json:"ticketsRefunded"`
+	GrossRevenue       float64  `json:"grossRevenue"`
+	Capacity           *int     `json:"capacity"`
+	SellThroughPercent *float64 `json:"sellThroughPercent"`
+}
+
+// SalesVelocityPoint is the sales in one hour or day, starting at Period
+type SalesVelocityPoint struct {
+	Period       time.Time `json:"period"`
+	TicketsSold  int       `json:"ticketsSold"`
+	GrossRevenue float64   `json:"grossRevenue"`
+}
+
+// SectionSales is one seating section's sales on seated dates
+type SectionSales struct {
+	Section            string   `json:"section"`
+	TicketsSold        int      `json:"ticketsSold"`
+	GrossRevenue       float64  `json:"grossRevenue"`
+	Seats              int      `json:"seats"`
+	SellThroughPercent *float64 `json:"sellThroughPercent"`
 }
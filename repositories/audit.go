@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// AuditFilter narrows an audit log query; zero values match everything.
+// Before pages backwards: only entries with a smaller ID are returned.
+type AuditFilter struct {
+	ActorUserID int
+	Action      string
+	EntityType  string
+	EntityID    string
+	From        *time.Time
+	To          *time.Time
+	Before      int64
+	Limit       int
+}
+
+// AuditRepository appends to and reads the audit log. There is deliberately no
+// way to change or remove an entry; the database rejects it too.
+type AuditRepository struct {
+	db *db.DB
+}
+
+func NewAuditRepository(db *db.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// CreateEntry appends an entry inside the transaction making the change
+func (r *AuditRepository) CreateEntry(tx *sqlx.Tx, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_user_id, action, entity_type, entity_id, before_data, after_data, request_id, ip_address, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := tx.Exec(query,
+		entry.ActorUserID, entry.Action, entry.EntityType, entry.EntityID,
+		nullableString(entry.Before), nullableString(entry.After),
+		nullableString(entry.RequestID), nullableString(entry.IPAddress), entry.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// ListEntries returns matching entries, newest first
+func (r *AuditRepository) ListEntries(filter *AuditFilter) ([]*models.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.ActorUserID != 0 {
+		conditions = append(conditions, "actor_user_id = ?")
+		args = append(args, filter.ActorUserID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Before != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.Before)
+	}
+
+	query := `
+		SELECT id, actor_user_id, action, entity_type, entity_id, before_data, after_data, request_id, ip_address, created_at
+		FROM audit_log
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var actorUserID sql.NullInt64
+		var before, after, requestID, ipAddress sql.NullString
+
+		if err := rows.Scan(
+			&entry.ID, &actorUserID, &entry.Action, &entry.EntityType, &entry.EntityID,
+			&before, &after, &requestID, &ipAddress, &entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		entry.Before = before.String
+		entry.After = after.String
+		entry.RequestID = requestID.String
+		entry.IPAddress = ipAddress.String
+		if actorUserID.Valid {
+			id := int(actorUserID.Int64)
+			entry.ActorUserID = &id
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
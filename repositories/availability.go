@@ -56,7 +56,7 @@ func (r *AvailabilityRepository) GetSeatedAvailability(eventDateID int) ([]*mode
 		FROM event_date_has_seat edhs
 		INNER JOIN seat s ON edhs.seat_id = s.id
 		INNER JOIN ticket_type tt ON edhs.ticket_type_id = tt.id
-		LEFT JOIN ticket t ON t.event_date_id = edhs.event_date_id AND t.seat_id = edhs.seat_id
+		LEFT JOIN ticket t ON t.event_date_id = edhs.event_date_id AND t.seat_id = edhs.seat_id AND t.inventory_released_at IS NULL
 		WHERE edhs.event_date_id = ?
 		ORDER BY s.section, s.row, s.number
 	`
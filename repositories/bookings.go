@@ -2,6 +2,11 @@ package repositories
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 	"ticketbooth-backend/db"
 	"ticketbooth-backend/models"
@@ -15,11 +20,11 @@ func NewBookingRepository(db *db.DB) *BookingRepository {
 	return &BookingRepository{db: db}
 }
 
-// CreateOrder creates a new order
-func (r *BookingRepository) CreateOrder(tx *sqlx.Tx, userID int, totalTickets int, amount string, paymentSource string) (int64, error) {
-	query := "INSERT INTO `order` (User_id, total_tickets, amount, payment_source) VALUES (?, ?, ?, ?)"
+// CreateOrder creates a new order, recording the purchaser on the order itself
+func (r *BookingRepository) CreateOrder(tx *sqlx.Tx, userID int, totalTickets int, amount string, paymentSource string, customerName string, customerEmail string, locale string) (int64, error) {
+	query := "INSERT INTO `order` (User_id, total_tickets, amount, payment_source, customer_name, customer_email, locale) VALUES (?, ?, ?, ?, ?, ?, ?)"
 
-	result, err := tx.Exec(query, userID, totalTickets, amount, paymentSource)
+	result, err := tx.Exec(query, userID, totalTickets, amount, paymentSource, customerName, nullableString(customerEmail), locale)
 	if err != nil {
 		return 0, err
 	}
@@ -32,21 +37,31 @@ func (r *BookingRepository) CreateOrder(tx *sqlx.Tx, userID int, totalTickets in
 	return orderID, nil
 }
 
-// CreateTicket creates a new ticket
-func (r *BookingRepository) CreateTicket(tx *sqlx.Tx, orderID int, userID string, eventID string, eventDateID int, ticketTypeID int, seatID int, toName string) (int64, error) {
+// AnonymizeCustomer replaces the purchaser name and email on every order a user
+// placed. Orders are kept for accounting.
+func (r *BookingRepository) AnonymizeCustomer(tx *sqlx.Tx, userID int, name string) error {
+	_, err := tx.Exec("UPDATE `order` SET customer_name = ?, customer_email = NULL WHERE user_id = ?", name, userID)
+	return err
+}
+
+// CreateTicket creates a new ticket issued to the given attendee and links it to the order
+func (r *BookingRepository) CreateTicket(tx *sqlx.Tx, orderID int, ticket *models.Ticket) (int64, error) {
 	query := `
-		INSERT INTO ticket (event_id, user_id, ticket_type_id, to_name, event_date_id, seat_id)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO ticket (event_id, user_id, ticket_type_id, to_name, to_email, event_date_id, seat_id, price, credential_nonce)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var seatIDValue interface{}
-	if seatID == 0 {
+	if ticket.SeatID == 0 {
 		seatIDValue = nil
 	} else {
-		seatIDValue = seatID
+		seatIDValue = ticket.SeatID
 	}
 
-	result, err := tx.Exec(query, eventID, userID, ticketTypeID, toName, eventDateID, seatIDValue)
+	result, err := tx.Exec(query,
+		ticket.EventID, ticket.UserID, ticket.TicketTypeID, ticket.ToName, nullableString(ticket.ToEmail),
+		ticket.EventDateID, seatIDValue, ticket.Price, ticket.CredentialNonce,
+	)
 	if err != nil {
 		return 0, err
 	}
@@ -68,31 +83,42 @@ func (r *BookingRepository) CreateTicket(tx *sqlx.Tx, orderID int, userID string
 // GetOrderByID fetches an order with its tickets
 func (r *BookingRepository) GetOrderByID(id int) (*models.Order, error) {
 	// First get the order
-	orderQuery := "SELECT id, User_id, total_tickets, amount, payment_source FROM `order` WHERE id = ?"
+	orderQuery := "SELECT id, User_id, total_tickets, amount, payment_source, customer_name, customer_email, locale, refunded_amount, created_at FROM `order` WHERE id = ?"
 
 	var order models.Order
+	var customerName, customerEmail sql.NullString
+	var createdAt sql.NullTime
 	err := r.db.QueryRow(orderQuery, id).Scan(
-		&order.ID, &order.UserID, &order.TotalTickets, &order.Amount, &order.PaymentSource,
+		&order.ID, &order.UserID, &order.TotalTickets, &order.Amount, &order.PaymentSource, &customerName, &customerEmail, &order.Locale, &order.RefundedAmount, &createdAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	order.CustomerName = customerName.String
+	order.CustomerEmail = customerEmail.String
+	if createdAt.Valid {
+		order.CreatedAt = &createdAt.Time
+	}
+
 	// Get tickets for this order
 	ticketsQuery := `
 		SELECT 
-			t.id, t.event_id, t.user_id, t.ticket_type_id, t.to_name, t.event_date_id, t.seat_id,
+			t.id, t.event_id, t.user_id, t.ticket_type_id, t.to_name, t.to_email, t.event_date_id, t.seat_id, t.price, t.credential_nonce, t.refunded_at,
 			tt.id as ticket_type_id_full, tt.name as ticket_type_name,
 			s.section, s.row, s.number,
 			e.id as event_id_full, e.title as event_title,
-			ed.date as event_date
+			ed.date as event_date,
+			v.id as venue_id, v.name as venue_name, ` + venueTimeZone + ` as time_zone
 		FROM ticket t
 		INNER JOIN order_hast_tickets oht ON t.id = oht.ticket_id
 		INNER JOIN ticket_type tt ON t.ticket_type_id = tt.id
 		LEFT JOIN seat s ON t.seat_id = s.id
 		INNER JOIN event_date ed ON t.event_date_id = ed.id
 		INNER JOIN event e ON ed.event_id = e.id
+		LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
 		WHERE oht.Order_id = ?
+		ORDER BY t.id
 	`
 
 	rows, err := r.db.Query(ticketsQuery, id)
@@ -105,23 +131,34 @@ func (r *BookingRepository) GetOrderByID(id int) (*models.Order, error) {
 	for rows.Next() {
 		var ticket models.Ticket
 		var ticketType models.TicketType
+		var toEmail, credentialNonce sql.NullString
+		var refundedAt sql.NullTime
 		var seatSection, seatRow, seatNumber sql.NullString
 		var seatID sql.NullInt64
 		var eventID int
 		var eventTitle string
 		var eventDate sql.NullTime
+		var venueID sql.NullInt64
+		var venueName sql.NullString
+		var timeZone string
 
 		err := rows.Scan(
-			&ticket.ID, &ticket.EventID, &ticket.UserID, &ticket.TicketTypeID, &ticket.ToName, &ticket.EventDateID, &seatID,
+			&ticket.ID, &ticket.EventID, &ticket.UserID, &ticket.TicketTypeID, &ticket.ToName, &toEmail, &ticket.EventDateID, &seatID, &ticket.Price, &credentialNonce, &refundedAt,
 			&ticketType.ID, &ticketType.Name,
 			&seatSection, &seatRow, &seatNumber,
 			&eventID, &eventTitle,
 			&eventDate,
+			&venueID, &venueName, &timeZone,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		ticket.ToEmail = toEmail.String
+		ticket.CredentialNonce = credentialNonce.String
+		if refundedAt.Valid {
+			ticket.RefundedAt = &refundedAt.Time
+		}
 		if seatID.Valid {
 			ticket.SeatID = int(seatID.Int64)
 		} else {
@@ -147,8 +184,16 @@ func (r *BookingRepository) GetOrderByID(id int) (*models.Order, error) {
 
 		if eventDate.Valid {
 			eventDateModel := &models.EventDate{
-				ID:   ticket.EventDateID,
-				Date: &eventDate.Time,
+				ID:       ticket.EventDateID,
+				Date:     localTime(eventDate, timeZone),
+				TimeZone: timeZone,
+			}
+			if venueID.Valid {
+				eventDateModel.Venue = &models.Venue{
+					ID:       int(venueID.Int64),
+					Name:     venueName.String,
+					TimeZone: timeZone,
+				}
 			}
 			ticket.EventDate = eventDateModel
 		}
@@ -160,71 +205,284 @@ func (r *BookingRepository) GetOrderByID(id int) (*models.Order, error) {
 	return &order, nil
 }
 
-// get all orders by user
+// Order statuses, derived from how much of the order has been refunded
+const (
+	OrderStatusPaid              = "PAID"
+	OrderStatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+	OrderStatusRefunded          = "REFUNDED"
+)
+
+// Order list sort keys
+const (
+	OrderSortCreatedAt = "createdAt"
+	OrderSortAmount    = "amount"
+	OrderSortID        = "id"
+)
+
+// orderAmountExpr is the order total as a number; amount is stored as text
+const orderAmountExpr = "CAST(COALESCE(NULLIF(o.amount, ''), '0') AS DECIMAL(19,2))"
+
+// orderSortColumns maps sort keys to the expression they order by
+var orderSortColumns = map[string]string{
+	OrderSortCreatedAt: "o.created_at",
+	OrderSortAmount:    orderAmountExpr,
+	OrderSortID:        "o.id",
+}
+
+// OrderStatus derives an order's status from its refunded amount
+func OrderStatus(order *models.Order) string {
+	if order.RefundedAmount <= 0 {
+		return OrderStatusPaid
+	}
+	if amount, err := strconv.ParseFloat(order.Amount, 64); err == nil && order.RefundedAmount >= amount {
+		return OrderStatusRefunded
+	}
+	return OrderStatusPartiallyRefunded
+}
+
+// OrderCursor is the position after the last order of a page: its sort key
+// value (RFC3339 for createdAt, a decimal for amount, the ID for id) and ID
+type OrderCursor struct {
+	Value string
+	ID    int
+}
+
+// OrderFilter narrows an order listing; zero values match everything. Sort is
+// one of the OrderSort keys (createdAt by default); a zero Limit returns every
+// match.
+type OrderFilter struct {
+	UserID        int
+	Email         string
+	OrderID       int
+	EventDateID   int
+	Status        string
+	PaymentSource string
+	From          *time.Time
+	To            *time.Time
+	Sort          string
+	Ascending     bool
+	After         *OrderCursor
+	Limit         int
+}
+
+// GetAllOrdersByUserID returns every order of a user, newest first
 func (r *BookingRepository) GetAllOrdersByUserID(userID string) ([]*models.Order, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.ListOrders(&OrderFilter{UserID: id})
+}
+
+// ListOrders returns a page of matching orders with their tickets. Orders are
+// paged first and their tickets loaded separately, so a page costs two
+// queries however many tickets it holds.
+func (r *BookingRepository) ListOrders(filter *OrderFilter) ([]*models.Order, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != 0 {
+		conditions = append(conditions, "o.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Email != "" {
+		conditions = append(conditions, "o.customer_email = ?")
+		args = append(args, filter.Email)
+	}
+	if filter.OrderID != 0 {
+		conditions = append(conditions, "o.id = ?")
+		args = append(args, filter.OrderID)
+	}
+	if filter.EventDateID != 0 {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM order_hast_tickets oht
+			INNER JOIN ticket t ON t.id = oht.ticket_id
+			WHERE oht.order_id = o.id AND t.event_date_id = ?
+		)`)
+		args = append(args, filter.EventDateID)
+	}
+	switch filter.Status {
+	case OrderStatusPaid:
+		conditions = append(conditions, "o.refunded_amount = 0")
+	case OrderStatusPartiallyRefunded:
+		conditions = append(conditions, "o.refunded_amount > 0 AND o.refunded_amount < "+orderAmountExpr)
+	case OrderStatusRefunded:
+		conditions = append(conditions, "o.refunded_amount > 0 AND o.refunded_amount >= "+orderAmountExpr)
+	}
+	if filter.PaymentSource != "" {
+		conditions = append(conditions, "o.payment_source = ?")
+		args = append(args, filter.PaymentSource)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "o.created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "o.created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	column, found := orderSortColumns[filter.Sort]
+	if !found {
+		column = orderSortColumns[OrderSortCreatedAt]
+	}
+	direction, comparison := "DESC", "<"
+	if filter.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if filter.After != nil {
+		var value interface{} = filter.After.Value
+		if column == orderSortColumns[OrderSortCreatedAt] {
+			at, err := time.Parse(time.RFC3339Nano, filter.After.Value)
+			if err != nil {
+				return nil, err
+			}
+			value = at.UTC()
+		}
+		if column == orderSortColumns[OrderSortAmount] {
+			conditions = append(conditions, fmt.Sprintf("(%s %s CAST(? AS DECIMAL(19,2)) OR (%s = CAST(? AS DECIMAL(19,2)) AND o.id %s ?))", column, comparison, column, comparison))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND o.id %s ?))", column, comparison, column, comparison))
+		}
+		args = append(args, value, value, filter.After.ID)
+	}
+
 	query := `
+		SELECT o.id, o.user_id, o.total_tickets, o.amount, o.payment_source, o.customer_name, o.customer_email, o.refunded_amount, o.created_at
+		FROM ` + "`order`" + ` o
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, o.id %s", column, direction, direction)
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []*models.Order{}
+	byID := make(map[int]*models.Order)
+	for rows.Next() {
+		var (
+			order         models.Order
+			totalTickets  sql.NullInt64
+			amount        sql.NullString
+			paymentSource sql.NullString
+			customerName  sql.NullString
+			customerEmail sql.NullString
+			createdAt     sql.NullTime
+		)
+		if err := rows.Scan(
+			&order.ID, &order.UserID, &totalTickets, &amount, &paymentSource, &customerName, &customerEmail, &order.RefundedAmount, &createdAt,
+		); err != nil {
+			return nil, err
+		}
+
+		order.TotalTickets = int(totalTickets.Int64)
+		order.Amount = amount.String
+		order.PaymentSource = paymentSource.String
+		order.CustomerName = customerName.String
+		order.CustomerEmail = customerEmail.String
+		if createdAt.Valid {
+			order.CreatedAt = &createdAt.Time
+		}
+		order.Tickets = []*models.Ticket{}
+
+		orders = append(orders, &order)
+		byID[order.ID] = &order
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(orders) > 0 {
+		if err := r.attachOrderTickets(byID); err != nil {
+			return nil, err
+		}
+	}
+
+	return orders, nil
+}
+
+// attachOrderTickets loads the tickets of the given orders in one query
+func (r *BookingRepository) attachOrderTickets(orders map[int]*models.Order) error {
+	orderIDs := make([]int, 0, len(orders))
+	for id := range orders {
+		orderIDs = append(orderIDs, id)
+	}
+
+	query, args, err := sqlx.In(`
 		SELECT
-			o.id, o.user_id, o.total_tickets, o.amount, o.payment_source, o.created_at,
-			t.id, t.event_id, t.user_id, t.ticket_type_id, t.to_name, t.event_date_id, t.seat_id,
+			oht.order_id,
+			t.id, t.event_id, t.user_id, t.ticket_type_id, t.to_name, t.to_email, t.event_date_id, t.seat_id, t.price, t.credential_nonce, t.refunded_at,
 			tt.id, tt.name,
 			s.section, s.row, s.number,
 			e.id, e.title,
-			ed.date
-		FROM ` + "`order`" + ` o
-		INNER JOIN order_hast_tickets oht ON o.id = oht.order_id
+			ed.date, `+venueTimeZone+`
+		FROM order_hast_tickets oht
 		INNER JOIN ticket t ON oht.ticket_id = t.id
 		LEFT JOIN ticket_type tt ON t.ticket_type_id = tt.id
 		LEFT JOIN seat s ON t.seat_id = s.id
 		INNER JOIN event_date ed ON t.event_date_id = ed.id
 		INNER JOIN event e ON ed.event_id = e.id
-		WHERE o.user_id = ?
-		ORDER BY o.created_at DESC, o.id, t.id
-	`
+		LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
+		WHERE oht.order_id IN (?)
+		ORDER BY t.id
+	`, orderIDs)
+	if err != nil {
+		return err
+	}
 
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.Query(r.db.Rebind(query), args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	orderMap := make(map[int]*models.Order)
-	var orders []*models.Order
-
 	for rows.Next() {
 		var (
-			orderID         int
-			orderUserID     int
-			orderTotal      sql.NullInt64
-			orderAmount     sql.NullString
-			orderPaymentSrc sql.NullString
-			orderCreatedAt  sql.NullTime
-			ticket          models.Ticket
-			seatID          sql.NullInt64
-			ticketType      models.TicketType
-			seatSection     sql.NullString
-			seatRow         sql.NullString
-			seatNumber      sql.NullString
-			eventID         int
-			eventTitle      string
-			eventDate       sql.NullTime
+			orderID        int
+			ticket         models.Ticket
+			ticketToEmail  sql.NullString
+			ticketNonce    sql.NullString
+			ticketRefunded sql.NullTime
+			seatID         sql.NullInt64
+			ticketType     models.TicketType
+			seatSection    sql.NullString
+			seatRow        sql.NullString
+			seatNumber     sql.NullString
+			eventID        int
+			eventTitle     string
+			eventDate      sql.NullTime
+			timeZone       string
 		)
 
 		err := rows.Scan(
-			&orderID, &orderUserID, &orderTotal, &orderAmount, &orderPaymentSrc, &orderCreatedAt,
-			&ticket.ID, &ticket.EventID, &ticket.UserID, &ticket.TicketTypeID, &ticket.ToName, &ticket.EventDateID, &seatID,
+			&orderID,
+			&ticket.ID, &ticket.EventID, &ticket.UserID, &ticket.TicketTypeID, &ticket.ToName, &ticketToEmail, &ticket.EventDateID, &seatID, &ticket.Price, &ticketNonce, &ticketRefunded,
 			&ticketType.ID, &ticketType.Name,
 			&seatSection, &seatRow, &seatNumber,
 			&eventID, &eventTitle,
-			&eventDate,
+			&eventDate, &timeZone,
 		)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
+		ticket.ToEmail = ticketToEmail.String
+		ticket.CredentialNonce = ticketNonce.String
+		if ticketRefunded.Valid {
+			ticket.RefundedAt = &ticketRefunded.Time
+		}
 		if seatID.Valid {
 			ticket.SeatID = int(seatID.Int64)
-		} else {
-			ticket.SeatID = 0
 		}
 
 		ticket.TicketType = &ticketType
@@ -243,42 +501,24 @@ func (r *BookingRepository) GetAllOrdersByUserID(userID string) ([]*models.Order
 
 		if eventDate.Valid {
 			ticket.EventDate = &models.EventDate{
-				ID:   ticket.EventDateID,
-				Date: &eventDate.Time,
+				ID:       ticket.EventDateID,
+				Date:     localTime(eventDate, timeZone),
+				TimeZone: timeZone,
 			}
 		}
 
-		order, found := orderMap[orderID]
-		if !found {
-			totalTickets := 0
-			if orderTotal.Valid {
-				totalTickets = int(orderTotal.Int64)
-			}
-
-			order = &models.Order{
-				ID:            orderID,
-				UserID:        orderUserID,
-				TotalTickets:  totalTickets,
-				Amount:        "",
-				PaymentSource: "",
-				Tickets:       []*models.Ticket{},
-			}
-			if orderAmount.Valid {
-				order.Amount = orderAmount.String
-			}
-			if orderPaymentSrc.Valid {
-				order.PaymentSource = orderPaymentSrc.String
-			}
-			if orderCreatedAt.Valid {
-				createdAt := orderCreatedAt.Time
-				order.CreatedAt = &createdAt
-			}
-			orderMap[orderID] = order
-			orders = append(orders, order)
+		if order, found := orders[orderID]; found {
+			order.Tickets = append(order.Tickets, &ticket)
 		}
-
-		order.Tickets = append(order.Tickets, &ticket)
 	}
 
-	return orders, nil
+	return rows.Err()
+}
+
+// nullableString maps an empty string to SQL NULL for optional columns
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
 }
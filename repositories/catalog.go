@@ -0,0 +1,395 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Event media kinds
+const (
+	MediaImage = "IMAGE"
+	MediaVideo = "VIDEO"
+)
+
+// CatalogRepository manages what classifies events: categories, tags,
+// performers and media
+type CatalogRepository struct {
+	db *db.DB
+}
+
+func NewCatalogRepository(db *db.DB) *CatalogRepository {
+	return &CatalogRepository{db: db}
+}
+
+// ListCategories returns every category by name
+func (r *CatalogRepository) ListCategories() ([]*models.Category, error) {
+	rows, err := r.db.Query("SELECT id, slug, name FROM category ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*models.Category{}
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(&category.ID, &category.Slug, &category.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetCategory returns sql.ErrNoRows if the category does not exist
+func (r *CatalogRepository) GetCategory(id int) (*models.Category, error) {
+	var category models.Category
+	err := r.db.QueryRow("SELECT id, slug, name FROM category WHERE id = ?", id).
+		Scan(&category.ID, &category.Slug, &category.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *CatalogRepository) CreateCategory(tx *sqlx.Tx, category *models.Category) (int, error) {
+	result, err := tx.Exec("INSERT INTO category (slug, name) VALUES (?, ?)", category.Slug, category.Name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (r *CatalogRepository) UpdateCategory(tx *sqlx.Tx, category *models.Category) error {
+	_, err := tx.Exec("UPDATE category SET slug = ?, name = ? WHERE id = ?", category.Slug, category.Name, category.ID)
+	return err
+}
+
+// DeleteCategory removes the category from every event, then deletes it
+func (r *CatalogRepository) DeleteCategory(tx *sqlx.Tx, id int) error {
+	if _, err := tx.Exec("DELETE FROM event_has_category WHERE category_id = ?", id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM category WHERE id = ?", id)
+	return err
+}
+
+// ListPerformers returns performers by name, optionally only those whose name
+// contains query
+func (r *CatalogRepository) ListPerformers(query string, limit int) ([]*models.Performer, error) {
+	rows, err := r.db.Query(`
+		SELECT id, slug, name, description, image_url
+		FROM performer
+		WHERE ? = '' OR name LIKE ?
+		ORDER BY name, id
+		LIMIT ?
+	`, query, "%"+escapeLike(query)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performers := []*models.Performer{}
+	for rows.Next() {
+		performer, err := scanPerformer(rows)
+		if err != nil {
+			return nil, err
+		}
+		performers = append(performers, performer)
+	}
+
+	return performers, rows.Err()
+}
+
+// GetPerformer returns sql.ErrNoRows if the performer does not exist
+func (r *CatalogRepository) GetPerformer(id int) (*models.Performer, error) {
+	return scanPerformer(r.db.QueryRow("SELECT id, slug, name, description, image_url FROM performer WHERE id = ?", id))
+}
+
+func (r *CatalogRepository) CreatePerformer(tx *sqlx.Tx, performer *models.Performer) (int, error) {
+	result, err := tx.Exec(
+		"INSERT INTO performer (slug, name, description, image_url) VALUES (?, ?, ?, ?)",
+		performer.Slug, performer.Name, nullableString(performer.Description), nullableString(performer.ImageURL),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (r *CatalogRepository) UpdatePerformer(tx *sqlx.Tx, performer *models.Performer) error {
+	_, err := tx.Exec(
+		"UPDATE performer SET slug = ?, name = ?, description = ?, image_url = ? WHERE id = ?",
+		performer.Slug, performer.Name, nullableString(performer.Description), nullableString(performer.ImageURL), performer.ID,
+	)
+	return err
+}
+
+// DeletePerformer removes the performer from every lineup, then deletes it
+func (r *CatalogRepository) DeletePerformer(tx *sqlx.Tx, id int) error {
+	if _, err := tx.Exec("DELETE FROM event_has_performer WHERE performer_id = ?", id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM performer WHERE id = ?", id)
+	return err
+}
+
+func (r *CatalogRepository) EventExists(eventID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM event WHERE id = ?)", eventID).Scan(&exists)
+	return exists, err
+}
+
+// CountCategories counts how many of the IDs are existing categories
+func (r *CatalogRepository) CountCategories(ids []int) (int, error) {
+	return r.countIDs("category", ids)
+}
+
+// CountPerformers counts how many of the IDs are existing performers
+func (r *CatalogRepository) CountPerformers(ids []int) (int, error) {
+	return r.countIDs("performer", ids)
+}
+
+func (r *CatalogRepository) countIDs(table string, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In("SELECT COUNT(*) FROM "+table+" WHERE id IN (?)", ids)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = r.db.QueryRow(r.db.Rebind(query), args...).Scan(&count)
+	return count, err
+}
+
+// SetEventCategories replaces the event's categories
+func (r *CatalogRepository) SetEventCategories(tx *sqlx.Tx, eventID int, categoryIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM event_has_category WHERE event_id = ?", eventID); err != nil {
+		return err
+	}
+	for _, id := range categoryIDs {
+		if _, err := tx.Exec("INSERT INTO event_has_category (event_id, category_id) VALUES (?, ?)", eventID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetEventTags replaces the event's tags, creating tags not seen before.
+// Names must already be normalized.
+func (r *CatalogRepository) SetEventTags(tx *sqlx.Tx, eventID int, names []string) error {
+	if _, err := tx.Exec("DELETE FROM event_has_tag WHERE event_id = ?", eventID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		// LAST_INSERT_ID(id) makes an existing tag report its own ID
+		result, err := tx.Exec("INSERT INTO tag (name) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)", name)
+		if err != nil {
+			return err
+		}
+		tagID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO event_has_tag (event_id, tag_id) VALUES (?, ?)", eventID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetEventPerformers replaces the event's lineup, billed in the given order
+func (r *CatalogRepository) SetEventPerformers(tx *sqlx.Tx, eventID int, performerIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM event_has_performer WHERE event_id = ?", eventID); err != nil {
+		return err
+	}
+	for order, id := range performerIDs {
+		if _, err := tx.Exec(
+			"INSERT INTO event_has_performer (event_id, performer_id, billing_order) VALUES (?, ?, ?)",
+			eventID, id, order,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *CatalogRepository) CreateEventMedia(tx *sqlx.Tx, media *models.EventMedia, createdAt time.Time) (int, error) {
+	result, err := tx.Exec(
+		"INSERT INTO event_media (event_id, kind, url, alt_text, position, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		media.EventID, media.Kind, media.URL, nullableString(media.AltText), media.Position, createdAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetEventMedia returns sql.ErrNoRows unless the media belongs to the event
+func (r *CatalogRepository) GetEventMedia(eventID int, mediaID int) (*models.EventMedia, error) {
+	var media models.EventMedia
+	var altText sql.NullString
+	err := r.db.QueryRow(
+		"SELECT id, event_id, kind, url, alt_text, position FROM event_media WHERE id = ? AND event_id = ?",
+		mediaID, eventID,
+	).Scan(&media.ID, &media.EventID, &media.Kind, &media.URL, &altText, &media.Position)
+	if err != nil {
+		return nil, err
+	}
+	media.AltText = altText.String
+	return &media, nil
+}
+
+func (r *CatalogRepository) DeleteEventMedia(tx *sqlx.Tx, mediaID int) error {
+	_, err := tx.Exec("DELETE FROM event_media WHERE id = ?", mediaID)
+	return err
+}
+
+// GetEventClassification returns the event's categories, tags, lineup and media
+func (r *CatalogRepository) GetEventClassification(eventID int) (*models.EventClassification, error) {
+	classifications, err := loadEventClassifications(r.db, []int{eventID})
+	if err != nil {
+		return nil, err
+	}
+	return classifications[eventID], nil
+}
+
+// loadEventClassifications loads the classification of each event, with empty
+// lists for events that have none
+func loadEventClassifications(database *db.DB, eventIDs []int) (map[int]*models.EventClassification, error) {
+	classifications := make(map[int]*models.EventClassification, len(eventIDs))
+	for _, id := range eventIDs {
+		classifications[id] = &models.EventClassification{
+			EventID:    id,
+			Categories: []*models.Category{},
+			Tags:       []string{},
+			Performers: []*models.Performer{},
+			Media:      []*models.EventMedia{},
+		}
+	}
+	if len(eventIDs) == 0 {
+		return classifications, nil
+	}
+
+	err := queryByEvent(database, `
+		SELECT ehc.event_id, c.id, c.slug, c.name
+		FROM event_has_category ehc
+		INNER JOIN category c ON c.id = ehc.category_id
+		WHERE ehc.event_id IN (?)
+		ORDER BY c.name, c.id
+	`, eventIDs, func(row rowScanner) error {
+		var eventID int
+		var category models.Category
+		if err := row.Scan(&eventID, &category.ID, &category.Slug, &category.Name); err != nil {
+			return err
+		}
+		classifications[eventID].Categories = append(classifications[eventID].Categories, &category)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryByEvent(database, `
+		SELECT eht.event_id, t.name
+		FROM event_has_tag eht
+		INNER JOIN tag t ON t.id = eht.tag_id
+		WHERE eht.event_id IN (?)
+		ORDER BY t.name
+	`, eventIDs, func(row rowScanner) error {
+		var eventID int
+		var name string
+		if err := row.Scan(&eventID, &name); err != nil {
+			return err
+		}
+		classifications[eventID].Tags = append(classifications[eventID].Tags, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryByEvent(database, `
+		SELECT ehp.event_id, p.id, p.slug, p.name, p.description, p.image_url
+		FROM event_has_performer ehp
+		INNER JOIN performer p ON p.id = ehp.performer_id
+		WHERE ehp.event_id IN (?)
+		ORDER BY ehp.billing_order, p.name
+	`, eventIDs, func(row rowScanner) error {
+		var eventID int
+		var performer models.Performer
+		var description, imageURL sql.NullString
+		if err := row.Scan(&eventID, &performer.ID, &performer.Slug, &performer.Name, &description, &imageURL); err != nil {
+			return err
+		}
+		performer.Description = description.String
+		performer.ImageURL = imageURL.String
+		classifications[eventID].Performers = append(classifications[eventID].Performers, &performer)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryByEvent(database, `
+		SELECT event_id, id, kind, url, alt_text, position
+		FROM event_media
+		WHERE event_id IN (?)
+		ORDER BY position, id
+	`, eventIDs, func(row rowScanner) error {
+		var media models.EventMedia
+		var altText sql.NullString
+		if err := row.Scan(&media.EventID, &media.ID, &media.Kind, &media.URL, &altText, &media.Position); err != nil {
+			return err
+		}
+		media.AltText = altText.String
+		classifications[media.EventID].Media = append(classifications[media.EventID].Media, &media)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return classifications, nil
+}
+
+// queryByEvent runs a query whose only placeholder is "IN (?)" over eventIDs
+// and hands each row to scan
+func queryByEvent(database *db.DB, query string, eventIDs []int, scan func(rowScanner) error) error {
+	query, args, err := sqlx.In(query, eventIDs)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.Query(database.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func scanPerformer(row rowScanner) (*models.Performer, error) {
+	var performer models.Performer
+	var description, imageURL sql.NullString
+	if err := row.Scan(&performer.ID, &performer.Slug, &performer.Name, &description, &imageURL); err != nil {
+		return nil, err
+	}
+	performer.Description = description.String
+	performer.ImageURL = imageURL.String
+	return &performer, nil
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+const (
+	ScanSourceOnline  = "ONLINE"
+	ScanSourceOffline = "OFFLINE"
+)
+
+type CheckInRepository struct {
+	db *db.DB
+}
+
+func NewCheckInRepository(db *db.DB) *CheckInRepository {
+	return &CheckInRepository{db: db}
+}
+
+// AdmitTicket atomically marks a ticket as admitted
+// Returns false if the ticket was already admitted by an earlier scan
+func (r *CheckInRepository) AdmitTicket(tx *sqlx.Tx, ticketID int, admittedAt time.Time, gate string, deviceID string) (bool, error) {
+	query := `
+		UPDATE ticket
+		SET admitted_at = ?, admitted_gate = ?, admitted_device = ?
+		WHERE id = ? AND admitted_at IS NULL
+	`
+
+	result, err := tx.Exec(query, admittedAt, gate, deviceID, ticketID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// GetAdmissionForUpdate fetches and locks a ticket's current admission
+func (r *CheckInRepository) GetAdmissionForUpdate(tx *sqlx.Tx, ticketID int) (*models.Admission, error) {
+	query := `
+		SELECT id, admitted_at, admitted_gate, admitted_device
+		FROM ticket
+		WHERE id = ? AND admitted_at IS NOT NULL
+		FOR UPDATE
+	`
+
+	var admission models.Admission
+	if err := tx.Get(&admission, query, ticketID); err != nil {
+		return nil, err
+	}
+
+	return &admission, nil
+}
+
+// ReplaceAdmission overwrites a ticket's admission, used when a synced offline scan predates it
+func (r *CheckInRepository) ReplaceAdmission(tx *sqlx.Tx, admission *models.Admission) error {
+	query := `
+		UPDATE ticket
+		SET admitted_at = ?, admitted_gate = ?, admitted_device = ?
+		WHERE id = ?
+	`
+
+	_, err := tx.Exec(query, admission.AdmittedAt, admission.Gate, admission.DeviceID, admission.TicketID)
+	return err
+}
+
+// CreateScan appends a scan attempt to the scan log
+func (r *CheckInRepository) CreateScan(tx *sqlx.Tx, scan *models.TicketScan) error {
+	query := `
+		INSERT INTO ticket_scan (ticket_id, event_date_id, gate, device_id, client_scan_id, source, result, conflict, scanned_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := tx.Exec(query,
+		scan.TicketID, scan.EventDateID, scan.Gate, scan.DeviceID, nullableString(scan.ClientScanID),
+		scan.Source, scan.Result, scan.Conflict, scan.ScannedAt,
+	)
+	return err
+}
+
+// GetScanByClientID fetches a previously synced offline scan so re-uploads are idempotent
+func (r *CheckInRepository) GetScanByClientID(deviceID string, clientScanID string) (*models.TicketScan, error) {
+	query := `
+		SELECT id, ticket_id, event_date_id, gate, device_id, client_scan_id, source, result, conflict, scanned_at, received_at
+		FROM ticket_scan
+		WHERE device_id = ? AND client_scan_id = ?
+	`
+
+	var scan models.TicketScan
+	if err := r.db.Get(&scan, query, deviceID, clientScanID); err != nil {
+		return nil, err
+	}
+
+	return &scan, nil
+}
+
+// ListScansByUser returns the scan log for tickets on a user's orders
+func (r *CheckInRepository) ListScansByUser(userID int) ([]*models.TicketScan, error) {
+	query := `
+		SELECT ts.id, ts.ticket_id, ts.event_date_id, ts.gate, ts.device_id, COALESCE(ts.client_scan_id, '') AS client_scan_id, ts.source, ts.result, ts.conflict, ts.scanned_at, ts.received_at
+		FROM ticket_scan ts
+		INNER JOIN order_hast_tickets oht ON oht.ticket_id = ts.ticket_id
+		INNER JOIN ` + "`order`" + ` o ON o.id = oht.order_id
+		WHERE o.user_id = ?
+		ORDER BY ts.scanned_at, ts.id
+	`
+
+	var scans []*models.TicketScan
+	if err := r.db.Select(&scans, query, userID); err != nil {
+		return nil, err
+	}
+
+	return scans, nil
+}
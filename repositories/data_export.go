@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Data export statuses
+const (
+	ExportPending = "PENDING"
+	ExportRunning = "RUNNING"
+	ExportReady   = "READY"
+	ExportFailed  = "FAILED"
+	ExportExpired = "EXPIRED"
+)
+
+// Data export formats
+const (
+	ExportFormatJSON = "JSON"
+	ExportFormatZIP  = "ZIP"
+)
+
+const dataExportColumns = "id, user_id, format, status, attempts, lease_until, last_error, file_name, content_type, size_bytes, requested_at, completed_at, expires_at"
+
+type DataExportRepository struct {
+	db *db.DB
+}
+
+func NewDataExportRepository(db *db.DB) *DataExportRepository {
+	return &DataExportRepository{db: db}
+}
+
+// CreateExport queues a new export job
+func (r *DataExportRepository) CreateExport(userID int, format string, now time.Time) (int64, error) {
+	result, err := r.db.Exec(
+		"INSERT INTO data_export (user_id, format, status, requested_at) VALUES (?, ?, ?, ?)",
+		userID, format, ExportPending, now.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// GetExport fetches an export job without its archive
+func (r *DataExportRepository) GetExport(id int) (*models.DataExport, error) {
+	return scanDataExport(r.db.QueryRow("SELECT "+dataExportColumns+" FROM data_export WHERE id = ?", id))
+}
+
+// GetLatestExport returns the user's most recent export in the format that is
+// still queued, running or downloadable
+func (r *DataExportRepository) GetLatestExport(userID int, format string) (*models.DataExport, error) {
+	query := "SELECT " + dataExportColumns + `
+		FROM data_export
+		WHERE user_id = ? AND format = ? AND status IN (?, ?, ?)
+		ORDER BY requested_at DESC, id DESC
+		LIMIT 1
+	`
+	return scanDataExport(r.db.QueryRow(query, userID, format, ExportPending, ExportRunning, ExportReady))
+}
+
+// ClaimNext locks the oldest queued export, or a running one whose worker let
+// its lease lapse, and marks it running until the lease ends. Exports of
+// deleted users are never claimed.
+func (r *DataExportRepository) ClaimNext(lease time.Duration) (*models.DataExport, error) {
+	var export *models.DataExport
+
+	err := r.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		query := "SELECT " + dataExportColumns + `
+			FROM data_export
+			WHERE (status = ? OR (status = ? AND lease_until <= ?))
+				AND user_id IN (SELECT id FROM ` + "`user`" + ` WHERE deleted_at IS NULL)
+			ORDER BY requested_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		`
+
+		var err error
+		export, err = scanDataExport(tx.QueryRow(query, ExportPending, ExportRunning, now))
+		if err != nil {
+			return err
+		}
+
+		leaseUntil := now.Add(lease)
+		export.Status = ExportRunning
+		export.Attempts++
+		export.LeaseUntil = &leaseUntil
+
+		_, err = tx.Exec(
+			"UPDATE data_export SET status = ?, attempts = ?, lease_until = ? WHERE id = ?",
+			export.Status, export.Attempts, leaseUntil, export.ID,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// CompleteExport stores the finished archive
+func (r *DataExportRepository) CompleteExport(id int, fileName string, contentType string, data []byte, completedAt time.Time, expiresAt time.Time) error {
+	query := `
+		UPDATE data_export
+		SET status = ?, file_name = ?, content_type = ?, size_bytes = ?, data = ?, completed_at = ?, expires_at = ?,
+			lease_until = NULL, last_error = NULL
+		WHERE id = ?
+	`
+
+	_, err := r.db.Exec(query, ExportReady, fileName, contentType, len(data), data, completedAt.UTC(), expiresAt.UTC(), id)
+	return err
+}
+
+// RetryExport puts a failed attempt back in the queue
+func (r *DataExportRepository) RetryExport(id int, lastError string) error {
+	_, err := r.db.Exec(
+		"UPDATE data_export SET status = ?, lease_until = NULL, last_error = ? WHERE id = ?",
+		ExportPending, lastError, id,
+	)
+	return err
+}
+
+// FailExport gives up on an export after its final attempt
+func (r *DataExportRepository) FailExport(id int, lastError string) error {
+	_, err := r.db.Exec(
+		"UPDATE data_export SET status = ?, lease_until = NULL, last_error = ? WHERE id = ?",
+		ExportFailed, lastError, id,
+	)
+	return err
+}
+
+// GetExportData loads a ready export's archive
+func (r *DataExportRepository) GetExportData(id int) ([]byte, error) {
+	var data []byte
+	if err := r.db.Get(&data, "SELECT data FROM data_export WHERE id = ? AND status = ?", id, ExportReady); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DeleteUserExports deletes every export of a user, queued or finished, with
+// its archive
+func (r *DataExportRepository) DeleteUserExports(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec("DELETE FROM data_export WHERE user_id = ?", userID)
+	return err
+}
+
+// ExpireExports drops the archives of exports past their expiry
+func (r *DataExportRepository) ExpireExports(now time.Time) (int64, error) {
+	result, err := r.db.Exec(
+		"UPDATE data_export SET status = ?, data = NULL WHERE status = ? AND expires_at <= ?",
+		ExportExpired, ExportReady, now.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func scanDataExport(row rowScanner) (*models.DataExport, error) {
+	var export models.DataExport
+	var leaseUntil, completedAt, expiresAt sql.NullTime
+	var lastError, fileName, contentType sql.NullString
+	var sizeBytes sql.NullInt64
+
+	err := row.Scan(
+		&export.ID, &export.UserID, &export.Format, &export.Status, &export.Attempts, &leaseUntil, &lastError,
+		&fileName, &contentType, &sizeBytes, &export.RequestedAt, &completedAt, &expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	export.LastError = lastError.String
+	export.FileName = fileName.String
+	export.ContentType = contentType.String
+	export.SizeBytes = int(sizeBytes.Int64)
+	if leaseUntil.Valid {
+		export.LeaseUntil = &leaseUntil.Time
+	}
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+
+	return &export, nil
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/models"
+)
+
+// Event date lifecycle states
+const (
+	EventDateDraft     = "DRAFT"
+	EventDateOnSale    = "ON_SALE"
+	EventDatePaused    = "PAUSED"
+	EventDateSoldOut   = "SOLD_OUT"
+	EventDateCancelled = "CANCELLED"
+	EventDatePostponed = "POSTPONED"
+	EventDateCompleted = "COMPLETED"
+)
+
+// eventDateOnSale is true when the event_date aliased ed takes bookings right
+// now: ON_SALE and inside its sales window, which closes at the start time
+// when no close is set
+const eventDateOnSale = `(
+	ed.status = 'ON_SALE'
+	AND (ed.sales_open_at IS NULL OR ed.sales_open_at <= UTC_TIMESTAMP())
+	AND COALESCE(ed.sales_close_at, ed.date, '9999-12-31 23:59:59') > UTC_TIMESTAMP()
+)`
+
+// LockEventDateForSale reads an event date's status and sales window, in
+// UTC, holding a shared lock until the transaction ends so its status cannot
+// change under a booking
+func (r *EventRepository) LockEventDateForSale(tx *sqlx.Tx, id int) (*models.EventDate, error) {
+	return lockEventDate(tx, id, "FOR SHARE")
+}
+
+// LockEventDate reads an event date's status and times, in UTC, and locks it
+// for a status or schedule change. Bookings in flight finish first.
+func (r *EventRepository) LockEventDate(tx *sqlx.Tx, id int) (*models.EventDate, error) {
+	return lockEventDate(tx, id, "FOR UPDATE")
+}
+
+func lockEventDate(tx *sqlx.Tx, id int, lock string) (*models.EventDate, error) {
+	query := `
+		SELECT id, event_id, status, status_reason, status_changed_at, date, doors_open_at, ends_at, sales_open_at, sales_close_at
+		FROM event_date
+		WHERE id = ?
+	` + lock
+
+	var eventDate models.EventDate
+	var reason sql.NullString
+	var changedAt, date, doorsOpen, endsAt, salesOpen, salesClose sql.NullTime
+	err := tx.QueryRow(query, id).Scan(
+		&eventDate.ID, &eventDate.EventID, &eventDate.Status, &reason, &changedAt, &date, &doorsOpen, &endsAt, &salesOpen, &salesClose,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	eventDate.StatusReason = reason.String
+	eventDate.StatusChangedAt = localTime(changedAt, "")
+	eventDate.Date = localTime(date, "")
+	eventDate.DoorsOpenAt = localTime(doorsOpen, "")
+	eventDate.EndsAt = localTime(endsAt, "")
+	eventDate.SalesOpenAt = localTime(salesOpen, "")
+	eventDate.SalesCloseAt = localTime(salesClose, "")
+	return &eventDate, nil
+}
+
+// UpdateEventDateStatus moves an event date to status. An empty reason
+// clears the previous one.
+func (r *EventRepository) UpdateEventDateStatus(tx *sqlx.Tx, id int, status string, reason string, at time.Time) error {
+	_, err := tx.Exec(
+		"UPDATE event_date SET status = ?, status_reason = ?, status_changed_at = ? WHERE id = ?",
+		status, nullableString(reason), at.UTC(), id,
+	)
+	return err
+}
+
+// UpdateEventDateSchedule writes an event date's start, doors, end and sales
+// window
+func (r *EventRepository) UpdateEventDateSchedule(tx *sqlx.Tx, eventDate *models.EventDate) error {
+	query := `
+		UPDATE event_date
+		SET date = ?, doors_open_at = ?, ends_at = ?, sales_open_at = ?, sales_close_at = ?
+		WHERE id = ?
+	`
+
+	_, err := tx.Exec(query,
+		nullableTime(eventDate.Date), nullableTime(eventDate.DoorsOpenAt), nullableTime(eventDate.EndsAt),
+		nullableTime(eventDate.SalesOpenAt), nullableTime(eventDate.SalesCloseAt), eventDate.ID,
+	)
+	return err
+}
+
+// nullableTime maps nil to SQL NULL and stores everything else in UTC
+func nullableTime(value *time.Time) interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.UTC()
+}
@@ -0,0 +1,433 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Event date change kinds
+const (
+	ChangeCancel   = "CANCEL"
+	ChangePostpone = "POSTPONE"
+)
+
+// Event date change run statuses
+const (
+	ChangePending   = "PENDING"
+	ChangeRunning   = "RUNNING"
+	ChangeCompleted = "COMPLETED"
+)
+
+// Statuses of an order within a change run
+const (
+	ChangeOrderPending = "PENDING"
+	ChangeOrderDone    = "DONE"
+	ChangeOrderSkipped = "SKIPPED"
+	ChangeOrderFailed  = "FAILED"
+)
+
+const eventDateChangeColumns = "id, event_date_id, kind, reason, previous_date, new_date, refund_deadline, operator_user_id, status, attempts, lease_until, created_at, completed_at"
+
+// RefundWindow is an open postponement refund window covering an order
+type RefundWindow struct {
+	UserID      int
+	EventDateID int
+	Deadline    time.Time
+}
+
+// EventDateChangeRepository stores cancellation and postponement runs and
+// the orders each one works through
+type EventDateChangeRepository struct {
+	db *db.DB
+}
+
+func NewEventDateChangeRepository(db *db.DB) *EventDateChangeRepository {
+	return &EventDateChangeRepository{db: db}
+}
+
+// CreateChange records a run, with every order still holding an unrefunded
+// ticket for the date, and returns its ID and the number of orders. Call it in
+// the transaction that changes the date's status, so no booking can slip in
+// between.
+func (r *EventDateChangeRepository) CreateChange(tx *sqlx.Tx, change *models.EventDateChange) (int, int, error) {
+	query := `
+		INSERT INTO event_date_change (event_date_id, kind, reason, previous_date, new_date, refund_deadline, operator_user_id, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query,
+		change.EventDateID, change.Kind, change.Reason, nullableTime(change.PreviousDate), nullableTime(change.NewDate),
+		nullableTime(change.RefundDeadline), change.OperatorUserID, ChangePending, change.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.Exec(`
+		INSERT INTO event_date_change_order (change_id, order_id)
+		SELECT DISTINCT ?, oht.order_id
+		FROM order_hast_tickets oht
+		INNER JOIN ticket t ON t.id = oht.ticket_id
+		WHERE t.event_date_id = ? AND t.refunded_at IS NULL
+	`, id, change.EventDateID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	orders, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(id), int(orders), nil
+}
+
+// SupersedePostponements skips the orders earlier postponement runs for the
+// date have not reached yet, so holders only hear about the latest change
+func (r *EventDateChangeRepository) SupersedePostponements(tx *sqlx.Tx, eventDateID int) error {
+	query := `
+		UPDATE event_date_change_order co
+		INNER JOIN event_date_change c ON c.id = co.change_id
+		SET co.status = ?, co.last_error = 'Superseded by a later change'
+		WHERE c.event_date_id = ? AND c.kind = ? AND co.status IN (?, ?)
+	`
+
+	_, err := tx.Exec(query, ChangeOrderSkipped, eventDateID, ChangePostpone, ChangeOrderPending, ChangeOrderFailed)
+	return err
+}
+
+// GetChange fetches a run without its progress
+func (r *EventDateChangeRepository) GetChange(id int) (*models.EventDateChange, error) {
+	return scanEventDateChange(r.db.QueryRow("SELECT "+eventDateChangeColumns+" FROM event_date_change WHERE id = ?", id))
+}
+
+// LockChange fetches a run and locks it until the transaction ends
+func (r *EventDateChangeRepository) LockChange(tx *sqlx.Tx, id int) (*models.EventDateChange, error) {
+	return scanEventDateChange(tx.QueryRow("SELECT "+eventDateChangeColumns+" FROM event_date_change WHERE id = ? FOR UPDATE", id))
+}
+
+// ListChanges returns an event date's runs, newest first
+func (r *EventDateChangeRepository) ListChanges(eventDateID int) ([]*models.EventDateChange, error) {
+	rows, err := r.db.Query("SELECT "+eventDateChangeColumns+" FROM event_date_change WHERE event_date_id = ? ORDER BY id DESC", eventDateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*models.EventDateChange{}
+	for rows.Next() {
+		change, err := scanEventDateChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// ClaimNext locks the oldest pending run that is due, or a running one whose
+// worker let its lease lapse, and marks it running until the lease ends
+func (r *EventDateChangeRepository) ClaimNext(lease time.Duration) (*models.EventDateChange, error) {
+	var change *models.EventDateChange
+
+	err := r.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		query := "SELECT " + eventDateChangeColumns + `
+			FROM event_date_change
+			WHERE status IN (?, ?) AND (lease_until IS NULL OR lease_until <= ?)
+			ORDER BY created_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		`
+
+		var err error
+		change, err = scanEventDateChange(tx.QueryRow(query, ChangePending, ChangeRunning, now))
+		if err != nil {
+			return err
+		}
+
+		leaseUntil := now.Add(lease)
+		change.Status = ChangeRunning
+		change.Attempts++
+		change.LeaseUntil = &leaseUntil
+
+		_, err = tx.Exec(
+			"UPDATE event_date_change SET status = ?, attempts = ?, lease_until = ? WHERE id = ?",
+			change.Status, change.Attempts, leaseUntil, change.ID,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// ExtendLease keeps a running run claimed for another lease period
+func (r *EventDateChangeRepository) ExtendLease(id int, lease time.Duration) error {
+	_, err := r.db.Exec(
+		"UPDATE event_date_change SET lease_until = ? WHERE id = ? AND status = ?",
+		time.Now().UTC().Add(lease), id, ChangeRunning,
+	)
+	return err
+}
+
+// ReleaseChange hands a running run back to the queue, to be claimed again
+// from retryAt for the orders still pending
+func (r *EventDateChangeRepository) ReleaseChange(id int, retryAt time.Time) error {
+	_, err := r.db.Exec(
+		"UPDATE event_date_change SET status = ?, lease_until = ? WHERE id = ? AND status = ?",
+		ChangePending, retryAt.UTC(), id, ChangeRunning,
+	)
+	return err
+}
+
+// CompleteChange marks a running run finished unless orders are still
+// pending. Returns false, changing nothing, when some are. Orders that failed
+// stay FAILED until RetryFailedOrders queues them again.
+func (r *EventDateChangeRepository) CompleteChange(id int, at time.Time) (bool, error) {
+	query := `
+		UPDATE event_date_change
+		SET status = ?, lease_until = NULL, completed_at = ?
+		WHERE id = ? AND status = ? AND NOT EXISTS (
+			SELECT 1 FROM event_date_change_order WHERE change_id = ? AND status = ?
+		)
+	`
+
+	result, err := r.db.Exec(query, ChangeCompleted, at.UTC(), id, ChangeRunning, id, ChangeOrderPending)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// ListPendingOrders returns up to limit of a run's pending orders after
+// afterOrderID, with the order's purchaser details
+func (r *EventDateChangeRepository) ListPendingOrders(changeID int, afterOrderID int, limit int) ([]*models.EventDateChangeOrder, error) {
+	query := `
+		SELECT c.order_id, c.status, c.attempts,
+			o.id, o.user_id, COALESCE(o.amount, '0'), o.customer_name, o.customer_email, o.locale, o.refunded_amount
+		FROM event_date_change_order c
+		INNER JOIN ` + "`order`" + ` o ON o.id = c.order_id
+		WHERE c.change_id = ? AND c.status = ? AND c.order_id > ?
+		ORDER BY c.order_id
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, changeID, ChangeOrderPending, afterOrderID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.EventDateChangeOrder
+	for rows.Next() {
+		var item models.EventDateChangeOrder
+		var order models.Order
+		var customerName, customerEmail sql.NullString
+		if err := rows.Scan(
+			&item.OrderID, &item.Status, &item.Attempts,
+			&order.ID, &order.UserID, &order.Amount, &customerName, &customerEmail, &order.Locale, &order.RefundedAmount,
+		); err != nil {
+			return nil, err
+		}
+		order.CustomerName = customerName.String
+		order.CustomerEmail = customerEmail.String
+		item.Order = &order
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// FinishOrder moves a pending order of a run to DONE or SKIPPED, in the
+// transaction that refunded or notified it. Returns false, changing nothing,
+// when the order is no longer pending because another worker got there first.
+func (r *EventDateChangeRepository) FinishOrder(tx *sqlx.Tx, changeID int, orderID int, status string, refundID *int, refundAmount *float64, at time.Time) (bool, error) {
+	query := `
+		UPDATE event_date_change_order
+		SET status = ?, refund_id = ?, refund_amount = ?, processed_at = ?, last_error = NULL
+		WHERE change_id = ? AND order_id = ? AND status = ?
+	`
+
+	result, err := tx.Exec(query, status, refundID, refundAmount, at.UTC(), changeID, orderID, ChangeOrderPending)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// FailOrderAttempt records a failed attempt at an order, marking it FAILED
+// once it has used maxAttempts
+func (r *EventDateChangeRepository) FailOrderAttempt(changeID int, orderID int, lastError string, maxAttempts int) error {
+	// status is assigned before attempts, so it sees the old count
+	query := `
+		UPDATE event_date_change_order
+		SET status = IF(attempts + 1 >= ?, ?, status), attempts = attempts + 1, last_error = ?
+		WHERE change_id = ? AND order_id = ? AND status = ?
+	`
+
+	_, err := r.db.Exec(query, maxAttempts, ChangeOrderFailed, lastError, changeID, orderID, ChangeOrderPending)
+	return err
+}
+
+// RetryFailedOrders puts a run's failed orders back in the queue and the run
+// back to pending. Returns the number of orders queued.
+func (r *EventDateChangeRepository) RetryFailedOrders(tx *sqlx.Tx, changeID int) (int64, error) {
+	result, err := tx.Exec(
+		"UPDATE event_date_change_order SET status = ?, attempts = 0 WHERE change_id = ? AND status = ?",
+		ChangeOrderPending, changeID, ChangeOrderFailed,
+	)
+	if err != nil {
+		return 0, err
+	}
+	queued, err := result.RowsAffected()
+	if err != nil || queued == 0 {
+		return queued, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE event_date_change SET status = ?, completed_at = NULL WHERE id = ? AND status = ?",
+		ChangePending, changeID, ChangeCompleted,
+	)
+	return queued, err
+}
+
+// GetProgress counts a run's orders by status
+func (r *EventDateChangeRepository) GetProgress(changeID int) (*models.EventDateChangeProgress, error) {
+	rows, err := r.db.Query(`
+		SELECT status, COUNT(*), COALESCE(SUM(refund_amount), 0)
+		FROM event_date_change_order
+		WHERE change_id = ?
+		GROUP BY status
+	`, changeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var progress models.EventDateChangeProgress
+	for rows.Next() {
+		var status string
+		var count int
+		var refunded float64
+		if err := rows.Scan(&status, &count, &refunded); err != nil {
+			return nil, err
+		}
+
+		progress.Total += count
+		progress.RefundedAmount += refunded
+		switch status {
+		case ChangeOrderPending:
+			progress.Pending = count
+		case ChangeOrderDone:
+			progress.Done = count
+		case ChangeOrderSkipped:
+			progress.Skipped = count
+		case ChangeOrderFailed:
+			progress.Failed = count
+		}
+	}
+
+	return &progress, rows.Err()
+}
+
+// ListFailedOrders returns up to limit of a run's failed orders
+func (r *EventDateChangeRepository) ListFailedOrders(changeID int, limit int) ([]*models.EventDateChangeOrder, error) {
+	query := `
+		SELECT order_id, status, attempts, last_error
+		FROM event_date_change_order
+		WHERE change_id = ? AND status = ?
+		ORDER BY order_id
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, changeID, ChangeOrderFailed, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.EventDateChangeOrder
+	for rows.Next() {
+		var item models.EventDateChangeOrder
+		var lastError sql.NullString
+		if err := rows.Scan(&item.OrderID, &item.Status, &item.Attempts, &lastError); err != nil {
+			return nil, err
+		}
+		item.LastError = lastError.String
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// FindRefundWindow returns the latest postponement refund window still open
+// at now for a date the order holds unrefunded tickets for. Only orders the
+// postponement was sent to, those placed before it was announced, get its
+// window; buyers who booked the new date knowingly do not. Cancelled dates
+// are refunded by their own run and have no window.
+func (r *EventDateChangeRepository) FindRefundWindow(orderID int, now time.Time) (*RefundWindow, error) {
+	query := `
+		SELECT o.user_id, t.event_date_id, c.refund_deadline
+		FROM ` + "`order`" + ` o
+		INNER JOIN order_hast_tickets oht ON oht.order_id = o.id
+		INNER JOIN ticket t ON t.id = oht.ticket_id AND t.refunded_at IS NULL
+		INNER JOIN event_date ed ON ed.id = t.event_date_id AND ed.status <> 'CANCELLED'
+		INNER JOIN event_date_change c ON c.event_date_id = t.event_date_id AND c.kind = ? AND c.refund_deadline > ?
+		INNER JOIN event_date_change_order co ON co.change_id = c.id AND co.order_id = o.id
+		WHERE o.id = ?
+		ORDER BY c.refund_deadline DESC
+		LIMIT 1
+	`
+
+	var window RefundWindow
+	err := r.db.QueryRow(query, ChangePostpone, now.UTC(), orderID).Scan(&window.UserID, &window.EventDateID, &window.Deadline)
+	if err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+func scanEventDateChange(row rowScanner) (*models.EventDateChange, error) {
+	var change models.EventDateChange
+	var previousDate, newDate, refundDeadline, leaseUntil, completedAt sql.NullTime
+
+	err := row.Scan(
+		&change.ID, &change.EventDateID, &change.Kind, &change.Reason, &previousDate, &newDate, &refundDeadline,
+		&change.OperatorUserID, &change.Status, &change.Attempts, &leaseUntil, &change.CreatedAt, &completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	change.PreviousDate = localTime(previousDate, "")
+	change.NewDate = localTime(newDate, "")
+	change.RefundDeadline = localTime(refundDeadline, "")
+	change.LeaseUntil = localTime(leaseUntil, "")
+	change.CompletedAt = localTime(completedAt, "")
+	return &change, nil
+}
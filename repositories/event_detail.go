@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"database/sql"
+	"strconv"
+
+	"ticketbooth-backend/models"
+)
+
+// GetEventBySlugOrID fetches an event and all of its dates, earliest first.
+// A slug match wins over an ID match, so an all-digit slug still resolves to
+// its own event. Returns sql.ErrNoRows if neither matches.
+func (r *EventRepository) GetEventBySlugOrID(slugOrID string) (*models.EventDetailResponse, error) {
+	id, err := strconv.Atoi(slugOrID)
+	if err != nil {
+		id = 0
+	}
+
+	var event models.EventDetailResponse
+	var slug, title, description sql.NullString
+	err = r.db.QueryRow(`
+		SELECT id, slug, title, description
+		FROM event
+		WHERE slug = ? OR id = ?
+		ORDER BY slug = ? DESC
+		LIMIT 1
+	`, slugOrID, id, slugOrID).Scan(&event.ID, &slug, &title, &description)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Slug = slug.String
+	event.Title = title.String
+	event.Description = description.String
+
+	rows, err := r.db.Query(`
+		SELECT ed.id, ed.date, ed.doors_open_at, ed.ends_at, ed.seating_mode, ed.status, `+venueTimeZone+`,
+			v.id, v.slug, v.name, v.capacity,
+			`+eventDateMinPrice+`, `+eventDateAvailable+`
+		FROM event_date ed
+		LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
+		WHERE ed.event_id = ? AND ed.status <> 'DRAFT'
+		ORDER BY ed.date IS NULL, ed.date, ed.id
+	`, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	event.Dates = []*models.EventDetailDate{}
+	for rows.Next() {
+		var item models.EventDetailDate
+		var date, doorsOpen, endsAt sql.NullTime
+		var seatingMode, venueSlug, venueName sql.NullString
+		var venueID, venueCapacity sql.NullInt64
+		var minPrice sql.NullFloat64
+		var available bool
+		if err := rows.Scan(&item.ID, &date, &doorsOpen, &endsAt, &seatingMode, &item.Status, &item.TimeZone, &venueID, &venueSlug, &venueName, &venueCapacity, &minPrice, &available); err != nil {
+			return nil, err
+		}
+
+		item.SeatingMode = seatingMode.String
+		item.SoldOut = !available || item.Status == EventDateSoldOut
+		item.Date = formatLocal(date, item.TimeZone)
+		item.DoorsOpen = formatLocal(doorsOpen, item.TimeZone)
+		item.EndsAt = formatLocal(endsAt, item.TimeZone)
+		if venueID.Valid {
+			item.Venue = &models.VenueInfo{
+				ID:       int(venueID.Int64),
+				Slug:     venueSlug.String,
+				Name:     venueName.String,
+				Capacity: int(venueCapacity.Int64),
+				TimeZone: item.TimeZone,
+			}
+		}
+		if minPrice.Valid {
+			price := minPrice.Float64
+			item.MinPrice = &price
+		}
+		event.Dates = append(event.Dates, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	classifications, err := loadEventClassifications(r.db, []int{event.ID})
+	if err != nil {
+		return nil, err
+	}
+	classification := classifications[event.ID]
+	event.Categories = classification.Categories
+	event.Tags = classification.Tags
+	event.Performers = classification.Performers
+	event.Media = classification.Media
+
+	return &event, nil
+}
@@ -0,0 +1,342 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/models"
+)
+
+// Event catalog sort keys
+const (
+	EventSortDate  = "date"
+	EventSortTitle = "title"
+)
+
+// eventDateAvailable is true when the event_date aliased ed can still sell: a
+// free seat on seated dates, remaining tickets in any tier otherwise
+const eventDateAvailable = `(
+	(ed.seating_mode = 'SEATED' AND EXISTS (
+		SELECT 1 FROM event_date_has_seat eds
+		WHERE eds.event_date_id = ed.id AND NOT EXISTS (
+			SELECT 1 FROM ticket t WHERE t.event_date_id = eds.event_date_id AND t.held_seat_id = eds.seat_id
+		)
+	))
+	OR (COALESCE(ed.seating_mode, 'GA') <> 'SEATED' AND EXISTS (
+		SELECT 1 FROM event_date_has_ticket_type edtt
+		WHERE edtt.event_date_id = ed.id AND edtt.remaining_tickets > 0
+	))
+)`
+
+// eventDateMinPrice is the cheapest seat or tier the event_date aliased ed
+// still has on sale, NULL when sold out
+const eventDateMinPrice = `(CASE WHEN ed.seating_mode = 'SEATED' THEN (
+	SELECT MIN(eds.price) FROM event_date_has_seat eds
+	WHERE eds.event_date_id = ed.id AND NOT EXISTS (
+		SELECT 1 FROM ticket t WHERE t.event_date_id = eds.event_date_id AND t.held_seat_id = eds.seat_id
+	)
+) ELSE (
+	SELECT MIN(edtt.price) FROM event_date_has_ticket_type edtt
+	WHERE edtt.event_date_id = ed.id AND edtt.remaining_tickets > 0
+) END)`
+
+// Sort keys for events without a matching date, which keep them after every
+// dated event in either direction
+const (
+	noDateSortKeyAscending  = "9999-12-31 23:59:59"
+	noDateSortKeyDescending = "0000-01-01 00:00:00"
+)
+
+// EventCursor is the position after the last event of a page: its sort key
+// (the first matching date, or the title) and ID
+type EventCursor struct {
+	Value string
+	ID    int
+}
+
+// EventFilter narrows the event catalog. Query matches every word against
+// the title, description or a performer's name. Category and Performer are
+// slugs; an event must have every one of Tags. The date filters (From, To,
+// VenueID, VenueSlug, SeatingMode, Available) select dates; an event matches
+// when any of its dates does, and only matching dates are returned.
+type EventFilter struct {
+	Query       string
+	Category    string
+	Tags        []string
+	Performer   string
+	From        *time.Time
+	To          *time.Time
+	VenueID     int
+	VenueSlug   string
+	SeatingMode string
+	Available   *bool
+	Sort        string
+	Descending  bool
+	After       *EventCursor
+	Limit       int
+}
+
+func (f *EventFilter) hasDateFilter() bool {
+	return f.From != nil || f.To != nil || f.VenueID != 0 || f.VenueSlug != "" || f.SeatingMode != "" || f.Available != nil
+}
+
+// dateCondition restricts event_date aliased ed, joined to venue aliased v.
+// Draft dates are never listed.
+func (f *EventFilter) dateCondition() (string, []interface{}) {
+	conditions := []string{"ed.status <> 'DRAFT'"}
+	var args []interface{}
+
+	if f.From != nil {
+		conditions = append(conditions, "ed.date >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if f.To != nil {
+		conditions = append(conditions, "ed.date < ?")
+		args = append(args, f.To.UTC())
+	}
+	if f.VenueID != 0 {
+		conditions = append(conditions, "v.id = ?")
+		args = append(args, f.VenueID)
+	}
+	if f.VenueSlug != "" {
+		conditions = append(conditions, "v.slug = ?")
+		args = append(args, f.VenueSlug)
+	}
+	if f.SeatingMode != "" {
+		conditions = append(conditions, "ed.seating_mode = ?")
+		args = append(args, f.SeatingMode)
+	}
+	if f.Available != nil {
+		if *f.Available {
+			conditions = append(conditions, eventDateOnSale+" AND "+eventDateAvailable)
+		} else {
+			conditions = append(conditions, "NOT ("+eventDateOnSale+" AND "+eventDateAvailable+")")
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// eventCondition restricts event aliased e
+func (f *EventFilter) eventCondition() (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	for _, word := range strings.Fields(f.Query) {
+		pattern := "%" + escapeLike(word) + "%"
+		conditions = append(conditions, `(e.title LIKE ? OR e.description LIKE ? OR EXISTS (
+			SELECT 1 FROM event_has_performer ehp
+			INNER JOIN performer p ON p.id = ehp.performer_id
+			WHERE ehp.event_id = e.id AND p.name LIKE ?
+		))`)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	if f.Category != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM event_has_category ehc
+			INNER JOIN category c ON c.id = ehc.category_id
+			WHERE ehc.event_id = e.id AND c.slug = ?
+		)`)
+		args = append(args, f.Category)
+	}
+	for _, tag := range f.Tags {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM event_has_tag eht
+			INNER JOIN tag t ON t.id = eht.tag_id
+			WHERE eht.event_id = e.id AND t.name = ?
+		)`)
+		args = append(args, tag)
+	}
+	if f.Performer != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM event_has_performer ehp
+			INNER JOIN performer p ON p.id = ehp.performer_id
+			WHERE ehp.event_id = e.id AND p.slug = ?
+		)`)
+		args = append(args, f.Performer)
+	}
+
+	if f.hasDateFilter() {
+		dateCondition, dateArgs := f.dateCondition()
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM event_date ed
+			LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
+			WHERE ed.event_id = e.id AND `+dateCondition+`
+		)`)
+		args = append(args, dateArgs...)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// SearchEvents returns a page of the catalog and the total number of matching
+// events. Events are ordered by their first matching date (events without one
+// last) or by title, with the event ID breaking ties so pages never overlap.
+func (r *EventRepository) SearchEvents(filter *EventFilter) ([]*models.EventListItem, int, error) {
+	eventCondition, eventArgs := filter.eventCondition()
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM event e WHERE "+eventCondition, eventArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	dateCondition, dateArgs := filter.dateCondition()
+	noDateSortKey := noDateSortKeyAscending
+	if filter.Descending {
+		noDateSortKey = noDateSortKeyDescending
+	}
+	sortExpr := "COALESCE(e.title, '')"
+	if filter.Sort != EventSortTitle {
+		sortExpr = fmt.Sprintf(`COALESCE((
+			SELECT DATE_FORMAT(MIN(ed.date), '%%Y-%%m-%%d %%H:%%i:%%s') FROM event_date ed
+			LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
+			WHERE ed.event_id = e.id AND %s
+		), '%s')`, dateCondition, noDateSortKey)
+	}
+
+	args := []interface{}{}
+	if filter.Sort != EventSortTitle {
+		args = append(args, dateArgs...)
+	}
+	args = append(args, eventArgs...)
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := `
+		SELECT id, slug, title, description, sort_key FROM (
+			SELECT e.id, e.slug, e.title, e.description, ` + sortExpr + ` AS sort_key
+			FROM event e
+			WHERE ` + eventCondition + `
+		) page
+	`
+	if filter.After != nil {
+		query += fmt.Sprintf(" WHERE (sort_key %s ? OR (sort_key = ? AND id %s ?))", comparison, comparison)
+		args = append(args, filter.After.Value, filter.After.Value, filter.After.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY sort_key %s, id %s LIMIT ?", direction, direction)
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*models.EventListItem{}
+	byID := make(map[int]*models.EventListItem)
+	for rows.Next() {
+		var event models.EventListItem
+		var slug, title, description sql.NullString
+		if err := rows.Scan(&event.ID, &slug, &title, &description, &event.SortKey); err != nil {
+			return nil, 0, err
+		}
+
+		event.Slug = slug.String
+		event.Title = title.String
+		event.Description = description.String
+		event.Dates = []*models.EventDateItem{}
+		events = append(events, &event)
+		byID[event.ID] = &event
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if len(events) > 0 {
+		if err := r.attachEventDates(byID, dateCondition, dateArgs); err != nil {
+			return nil, 0, err
+		}
+		if err := r.attachClassifications(byID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return events, total, nil
+}
+
+// attachClassifications adds categories, tags, lineup and the first image
+func (r *EventRepository) attachClassifications(events map[int]*models.EventListItem) error {
+	eventIDs := make([]int, 0, len(events))
+	for id := range events {
+		eventIDs = append(eventIDs, id)
+	}
+
+	classifications, err := loadEventClassifications(r.db, eventIDs)
+	if err != nil {
+		return err
+	}
+
+	for id, event := range events {
+		classification := classifications[id]
+		event.Categories = classification.Categories
+		event.Tags = classification.Tags
+		event.Performers = classification.Performers
+		for _, media := range classification.Media {
+			if media.Kind == MediaImage {
+				event.ImageURL = media.URL
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// attachEventDates loads the matching dates of the given events, earliest first
+func (r *EventRepository) attachEventDates(events map[int]*models.EventListItem, dateCondition string, dateArgs []interface{}) error {
+	eventIDs := make([]int, 0, len(events))
+	for id := range events {
+		eventIDs = append(eventIDs, id)
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT ed.event_id, ed.id, ed.date, ed.doors_open_at, ed.ends_at, ed.seating_mode, ed.status, v.name, `+venueTimeZone+`,
+			`+eventDateOnSale+` AND `+eventDateAvailable+`
+		FROM event_date ed
+		LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
+		WHERE ed.event_id IN (?) AND `+dateCondition+`
+		ORDER BY ed.date, ed.id
+	`, append([]interface{}{eventIDs}, dateArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.db.Query(r.db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID int
+		var item models.EventDateItem
+		var date, doorsOpen, endsAt sql.NullTime
+		var seatingMode, venueName sql.NullString
+		if err := rows.Scan(&eventID, &item.ID, &date, &doorsOpen, &endsAt, &seatingMode, &item.Status, &venueName, &item.TimeZone, &item.Available); err != nil {
+			return err
+		}
+
+		item.SeatingMode = seatingMode.String
+		item.VenueName = venueName.String
+		item.Date = formatLocal(date, item.TimeZone)
+		item.DoorsOpen = formatLocal(doorsOpen, item.TimeZone)
+		item.EndsAt = formatLocal(endsAt, item.TimeZone)
+		if event, found := events[eventID]; found {
+			event.Dates = append(event.Dates, &item)
+		}
+	}
+
+	return rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
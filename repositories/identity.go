@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+type IdentityRepository struct {
+	db *db.DB
+}
+
+func NewIdentityRepository(db *db.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// GetIdentity finds the link between an external account and a user
+func (r *IdentityRepository) GetIdentity(provider string, subject string) (*models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identity
+		WHERE provider = ? AND subject = ?
+	`
+
+	var identity models.UserIdentity
+	var email sql.NullString
+	var lastLoginAt sql.NullTime
+	err := r.db.QueryRow(query, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &email, &identity.CreatedAt, &lastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.Email = email.String
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return &identity, nil
+}
+
+// ListIdentities returns the external accounts linked to a user
+func (r *IdentityRepository) ListIdentities(userID int) ([]*models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identity
+		WHERE user_id = ?
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*models.UserIdentity
+	for rows.Next() {
+		var identity models.UserIdentity
+		var email sql.NullString
+		var lastLoginAt sql.NullTime
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &email, &identity.CreatedAt, &lastLoginAt); err != nil {
+			return nil, err
+		}
+
+		identity.Email = email.String
+		if lastLoginAt.Valid {
+			identity.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, &identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// CreateIdentity links an external account to a user
+func (r *IdentityRepository) CreateIdentity(tx *sqlx.Tx, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identity (user_id, provider, subject, email, last_login_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := tx.Exec(query, identity.UserID, identity.Provider, identity.Subject, nullableString(identity.Email), identity.LastLoginAt)
+	return err
+}
+
+// TouchIdentity records a login and the email the provider currently reports
+func (r *IdentityRepository) TouchIdentity(id int, email string, now time.Time) error {
+	_, err := r.db.Exec("UPDATE user_identity SET email = ?, last_login_at = ? WHERE id = ?", nullableString(email), now.UTC(), id)
+	return err
+}
+
+// DeleteIdentities unlinks every external account from a user
+func (r *IdentityRepository) DeleteIdentities(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec("DELETE FROM user_identity WHERE user_id = ?", userID)
+	return err
+}
+
+// CreateAuthRequest stores the PKCE verifier and nonce of a login started with a provider
+func (r *IdentityRepository) CreateAuthRequest(request *models.OIDCAuthRequest) error {
+	query := `
+		INSERT INTO oidc_auth_request (state_hash, provider, code_verifier, nonce, redirect_uri, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.Exec(query, request.StateHash, request.Provider, request.CodeVerifier, request.Nonce,
+		request.RedirectURI, request.ExpiresAt.UTC())
+	return err
+}
+
+// ConsumeAuthRequest deletes and returns an unexpired login request by state, so
+// each callback can be used once. It returns sql.ErrNoRows for unknown states.
+func (r *IdentityRepository) ConsumeAuthRequest(tx *sqlx.Tx, stateHash string, now time.Time) (*models.OIDCAuthRequest, error) {
+	query := `
+		SELECT id, state_hash, provider, code_verifier, nonce, redirect_uri, expires_at
+		FROM oidc_auth_request
+		WHERE state_hash = ? AND expires_at > ?
+		FOR UPDATE
+	`
+
+	var request models.OIDCAuthRequest
+	err := tx.QueryRow(query, stateHash, now.UTC()).Scan(
+		&request.ID, &request.StateHash, &request.Provider, &request.CodeVerifier, &request.Nonce,
+		&request.RedirectURI, &request.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM oidc_auth_request WHERE id = ?", request.ID); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// DeleteExpiredAuthRequests removes abandoned login requests
+func (r *IdentityRepository) DeleteExpiredAuthRequests(now time.Time) error {
+	_, err := r.db.Exec("DELETE FROM oidc_auth_request WHERE expires_at <= ?", now.UTC())
+	return err
+}
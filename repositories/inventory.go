@@ -38,6 +38,19 @@ func (r *InventoryRepository) UpdateGATicketInventory(tx *sqlx.Tx, eventDateID i
 	return rowsAffected, nil
 }
 
+// ReleaseGATicketInventory returns refunded GA tickets to sale
+func (r *InventoryRepository) ReleaseGATicketInventory(tx *sqlx.Tx, eventDateID int, ticketTypeID int, quantity int) error {
+	query := `
+		UPDATE event_date_has_ticket_type
+		SET remaining_tickets = remaining_tickets + ?
+		WHERE event_date_id = ?
+		  AND ticket_type_id = ?
+	`
+
+	_, err := tx.Exec(query, quantity, eventDateID, ticketTypeID)
+	return err
+}
+
 // GetGATicketPriceAndRemaining gets the price and remaining count for a GA ticket type
 func (r *InventoryRepository) GetGATicketPriceAndRemaining(eventDateID int, ticketTypeID int) (float64, int, error) {
 	query := `
@@ -65,7 +78,7 @@ func (r *InventoryRepository) CheckSeatAvailability(eventDateID int, seatIDs []i
 	query := `
 		SELECT seat_id
 		FROM ticket
-		WHERE event_date_id = ? AND seat_id IN (?)
+		WHERE event_date_id = ? AND seat_id IN (?) AND inventory_released_at IS NULL
 	`
 
 	query, args, err := sqlx.In(query, eventDateID, seatIDs)
@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/ledger"
+)
+
+// LedgerRepository appends to and sums the double-entry ledger. Like the audit
+// log it has no update or delete, and database triggers reject both.
+type LedgerRepository struct {
+	db *db.DB
+}
+
+func NewLedgerRepository(db *db.DB) *LedgerRepository {
+	return &LedgerRepository{db: db}
+}
+
+// CreateTransaction writes a transaction and its entries inside tx. Callers
+// validate it first.
+func (r *LedgerRepository) CreateTransaction(tx *sqlx.Tx, t *ledger.Transaction) (int64, error) {
+	query := `
+		INSERT INTO ledger_transaction (kind, order_id, refund_id, event_id, memo, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query, t.Kind, t.OrderID, t.RefundID, t.EventID, nullableString(t.Memo), t.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	transactionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range t.Entries {
+		_, err := tx.Exec(
+			"INSERT INTO ledger_entry (transaction_id, account, debit, credit) VALUES (?, ?, ?, ?)",
+			transactionID, entry.Account, entry.Debit.String(), entry.Credit.String(),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return transactionID, nil
+}
+
+// GetOrderSaleSplit returns how an order's sale was split between accounts.
+// Returns sql.ErrNoRows for orders with no recorded sale.
+func (r *LedgerRepository) GetOrderSaleSplit(tx *sqlx.Tx, orderID int) (ledger.Split, error) {
+	query := `
+		SELECT le.account, SUM(le.credit) - SUM(le.debit)
+		FROM ledger_entry le
+		INNER JOIN ledger_transaction lt ON lt.id = le.transaction_id
+		WHERE lt.order_id = ? AND lt.kind = ?
+		GROUP BY le.account
+	`
+
+	rows, err := tx.Query(query, orderID, ledger.KindSale)
+	if err != nil {
+		return ledger.Split{}, err
+	}
+	defer rows.Close()
+
+	var split ledger.Split
+	found := false
+	for rows.Next() {
+		var account ledger.Account
+		var net string
+		if err := rows.Scan(&account, &net); err != nil {
+			return ledger.Split{}, err
+		}
+
+		amount, err := ledger.ParseAmount(net)
+		if err != nil {
+			return ledger.Split{}, err
+		}
+		switch account {
+		case ledger.OrganizerPayable:
+			split.Organizer = amount
+		case ledger.PlatformFees:
+			split.Fees = amount
+		case ledger.TaxPayable:
+			split.Tax = amount
+		}
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return ledger.Split{}, err
+	}
+	if !found {
+		return ledger.Split{}, sql.ErrNoRows
+	}
+
+	return split, nil
+}
+
+// ListBalances sums debits and credits per account over transactions created
+// before asOf (all of them when nil)
+func (r *LedgerRepository) ListBalances(asOf *time.Time) ([]ledger.Balance, error) {
+	query := `
+		SELECT le.account, SUM(le.debit), SUM(le.credit)
+		FROM ledger_entry le
+		INNER JOIN ledger_transaction lt ON lt.id = le.transaction_id
+		WHERE (? IS NULL OR lt.created_at < ?)
+		GROUP BY le.account
+	`
+
+	var cutoff interface{}
+	if asOf != nil {
+		cutoff = asOf.UTC()
+	}
+
+	rows, err := r.db.Query(query, cutoff, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []ledger.Balance
+	for rows.Next() {
+		var balance ledger.Balance
+		var debit, credit string
+		if err := rows.Scan(&balance.Account, &debit, &credit); err != nil {
+			return nil, err
+		}
+		if balance.Debit, err = ledger.ParseAmount(debit); err != nil {
+			return nil, err
+		}
+		if balance.Credit, err = ledger.ParseAmount(credit); err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, rows.Err()
+}
+
+// CountUnbalancedTransactions counts transactions whose debits and credits
+// differ. It should always be zero.
+func (r *LedgerRepository) CountUnbalancedTransactions(asOf *time.Time) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT le.transaction_id
+			FROM ledger_entry le
+			INNER JOIN ledger_transaction lt ON lt.id = le.transaction_id
+			WHERE (? IS NULL OR lt.created_at < ?)
+			GROUP BY le.transaction_id
+			HAVING SUM(le.debit) <> SUM(le.credit)
+		) unbalanced
+	`
+
+	var cutoff interface{}
+	if asOf != nil {
+		cutoff = asOf.UTC()
+	}
+
+	var count int
+	err := r.db.QueryRow(query, cutoff, cutoff).Scan(&count)
+	return count, err
+}
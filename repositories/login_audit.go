@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+type LoginAuditRepository struct {
+	db *db.DB
+}
+
+func NewLoginAuditRepository(db *db.DB) *LoginAuditRepository {
+	return &LoginAuditRepository{db: db}
+}
+
+// CreateLockout records a temporary login lockout
+func (r *LoginAuditRepository) CreateLockout(lockout *models.LoginLockout) error {
+	query := `
+		INSERT INTO login_lockout (scope, subject, user_id, ip_address, failures, locked_until)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := r.db.Exec(query, lockout.Scope, lockout.Subject, lockout.UserID,
+		nullableString(lockout.IPAddress), lockout.Failures, lockout.LockedUntil.UTC())
+	return err
+}
+
+// ListUserLockouts returns the account lockouts recorded for a user
+func (r *LoginAuditRepository) ListUserLockouts(userID int) ([]*models.LoginLockout, error) {
+	query := `
+		SELECT id, scope, subject, user_id, ip_address, failures, locked_until, created_at
+		FROM login_lockout
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []*models.LoginLockout
+	for rows.Next() {
+		var lockout models.LoginLockout
+		var lockoutUserID sql.NullInt64
+		var ipAddress sql.NullString
+		if err := rows.Scan(
+			&lockout.ID, &lockout.Scope, &lockout.Subject, &lockoutUserID, &ipAddress,
+			&lockout.Failures, &lockout.LockedUntil, &lockout.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		lockout.IPAddress = ipAddress.String
+		if lockoutUserID.Valid {
+			id := int(lockoutUserID.Int64)
+			lockout.UserID = &id
+		}
+		lockouts = append(lockouts, &lockout)
+	}
+
+	return lockouts, rows.Err()
+}
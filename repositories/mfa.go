@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+type MFARepository struct {
+	db *db.DB
+}
+
+func NewMFARepository(db *db.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+const userMFAColumns = "user_id, totp_secret, confirmed_at, last_used_step, created_at"
+
+// GetMFA fetches a user's TOTP enrollment, confirmed or pending
+func (r *MFARepository) GetMFA(userID int) (*models.UserMFA, error) {
+	return scanUserMFA(r.db.QueryRow("SELECT "+userMFAColumns+" FROM user_mfa WHERE user_id = ?", userID))
+}
+
+// GetMFAForUpdate locks a user's TOTP enrollment, so a code cannot be used twice concurrently
+func (r *MFARepository) GetMFAForUpdate(tx *sqlx.Tx, userID int) (*models.UserMFA, error) {
+	return scanUserMFA(tx.QueryRow("SELECT "+userMFAColumns+" FROM user_mfa WHERE user_id = ? FOR UPDATE", userID))
+}
+
+// SavePendingMFA stores a new unconfirmed secret, replacing any earlier pending one
+func (r *MFARepository) SavePendingMFA(tx *sqlx.Tx, userID int, encryptedSecret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret, confirmed_at, last_used_step)
+		VALUES (?, ?, NULL, 0)
+		ON DUPLICATE KEY UPDATE totp_secret = VALUES(totp_secret), confirmed_at = NULL, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+	`
+	_, err := tx.Exec(query, userID, encryptedSecret)
+	return err
+}
+
+// ConfirmMFA activates a pending enrollment
+func (r *MFARepository) ConfirmMFA(tx *sqlx.Tx, userID int, step int64, now time.Time) error {
+	_, err := tx.Exec("UPDATE user_mfa SET confirmed_at = ?, last_used_step = ? WHERE user_id = ?", now.UTC(), step, userID)
+	return err
+}
+
+// SetLastUsedStep records the time step of an accepted code so it cannot be replayed
+func (r *MFARepository) SetLastUsedStep(tx *sqlx.Tx, userID int, step int64) error {
+	_, err := tx.Exec("UPDATE user_mfa SET last_used_step = ? WHERE user_id = ?", step, userID)
+	return err
+}
+
+// DeleteMFA removes the second factor and its recovery codes
+func (r *MFARepository) DeleteMFA(tx *sqlx.Tx, userID int) error {
+	if _, err := tx.Exec("DELETE FROM user_recovery_code WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID)
+	return err
+}
+
+// ReplaceRecoveryCodes discards every existing recovery code and stores the new hashes
+func (r *MFARepository) ReplaceRecoveryCodes(tx *sqlx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM user_recovery_code WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO user_recovery_code (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used; it returns false if
+// no such code exists
+func (r *MFARepository) UseRecoveryCode(tx *sqlx.Tx, userID int, codeHash string, now time.Time) (bool, error) {
+	result, err := tx.Exec(
+		"UPDATE user_recovery_code SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now.UTC(), userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (r *MFARepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM user_recovery_code WHERE user_id = ? AND used_at IS NULL", userID)
+	return count, err
+}
+
+func scanUserMFA(row rowScanner) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	var confirmedAt sql.NullTime
+
+	err := row.Scan(&mfa.UserID, &mfa.TOTPSecret, &confirmedAt, &mfa.LastUsedStep, &mfa.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		mfa.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return &mfa, nil
+}
@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Outbox message statuses
+const (
+	OutboxPending = "PENDING"
+	OutboxSent    = "SENT"
+	OutboxFailed  = "FAILED"
+)
+
+type OutboxRepository struct {
+	db *db.DB
+}
+
+func NewOutboxRepository(db *db.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Enqueue stores an email inside the caller's transaction, so it is only sent
+// if the change that triggered it commits
+func (r *OutboxRepository) Enqueue(tx *sqlx.Tx, msg *models.OutboxMessage) error {
+	query := `
+		INSERT INTO email_outbox (template, locale, to_email, to_name, order_id, payload, status, attempts, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)
+	`
+
+	_, err := tx.Exec(query, msg.Template, msg.Locale, msg.ToEmail, nullableString(msg.ToName), msg.OrderID, msg.Payload, OutboxPending, time.Now().UTC())
+	return err
+}
+
+// ClaimDue locks up to limit pending messages that are due and pushes their next
+// attempt out by lease, so concurrent workers skip them while they are being sent
+func (r *OutboxRepository) ClaimDue(limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	var messages []*models.OutboxMessage
+
+	err := r.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		query := `
+			SELECT id, template, locale, to_email, to_name, order_id, payload, status, attempts, next_attempt_at, last_error, created_at
+			FROM email_outbox
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		`
+
+		rows, err := tx.Query(query, OutboxPending, now, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var msg models.OutboxMessage
+			var toName, lastError sql.NullString
+			var orderID sql.NullInt64
+			var createdAt sql.NullTime
+
+			if err := rows.Scan(
+				&msg.ID, &msg.Template, &msg.Locale, &msg.ToEmail, &toName, &orderID, &msg.Payload, &msg.Status,
+				&msg.Attempts, &msg.NextAttemptAt, &lastError, &createdAt,
+			); err != nil {
+				return err
+			}
+
+			msg.ToName = toName.String
+			msg.LastError = lastError.String
+			if orderID.Valid {
+				id := int(orderID.Int64)
+				msg.OrderID = &id
+			}
+			if createdAt.Valid {
+				msg.CreatedAt = &createdAt.Time
+			}
+			messages = append(messages, &msg)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]interface{}, 0, len(messages)+1)
+		ids = append(ids, now.Add(lease))
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messages)), ",")
+
+		_, err = tx.Exec("UPDATE email_outbox SET next_attempt_at = ? WHERE id IN ("+placeholders+")", ids...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkSent records a successful delivery
+func (r *OutboxRepository) MarkSent(id int, attempts int) error {
+	_, err := r.db.Exec(
+		"UPDATE email_outbox SET status = ?, attempts = ?, sent_at = ?, last_error = NULL WHERE id = ?",
+		OutboxSent, attempts, time.Now().UTC(), id,
+	)
+	return err
+}
+
+// MarkRetry records a failed attempt and schedules the next one
+func (r *OutboxRepository) MarkRetry(id int, attempts int, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.db.Exec(
+		"UPDATE email_outbox SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?",
+		attempts, nextAttemptAt.UTC(), lastError, id,
+	)
+	return err
+}
+
+// MarkFailed gives up on a message after its final attempt
+func (r *OutboxRepository) MarkFailed(id int, attempts int, lastError string) error {
+	_, err := r.db.Exec(
+		"UPDATE email_outbox SET status = ?, attempts = ?, last_error = ? WHERE id = ?",
+		OutboxFailed, attempts, lastError, id,
+	)
+	return err
+}
+
+// DeleteForUser deletes the emails addressed to a user or sent about their
+// orders, sent or not, since recipients and payloads hold personal data
+func (r *OutboxRepository) DeleteForUser(tx *sqlx.Tx, userID int, email string) error {
+	query := `
+		DELETE FROM email_outbox
+		WHERE to_email = ? OR order_id IN (SELECT id FROM ` + "`order`" + ` WHERE user_id = ?)
+	`
+	_, err := tx.Exec(query, email, userID)
+	return err
+}
+
+// ListForUser returns the emails addressed to a user or sent about their orders
+func (r *OutboxRepository) ListForUser(userID int, email string) ([]*models.OutboxMessage, error) {
+	query := `
+		SELECT id, template, locale, to_email, to_name, order_id, status, attempts, next_attempt_at, last_error, created_at, sent_at
+		FROM email_outbox
+		WHERE to_email = ? OR order_id IN (SELECT id FROM ` + "`order`" + ` WHERE user_id = ?)
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(query, email, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var toName, lastError sql.NullString
+		var orderID sql.NullInt64
+		var createdAt, sentAt sql.NullTime
+
+		if err := rows.Scan(
+			&msg.ID, &msg.Template, &msg.Locale, &msg.ToEmail, &toName, &orderID, &msg.Status,
+			&msg.Attempts, &msg.NextAttemptAt, &lastError, &createdAt, &sentAt,
+		); err != nil {
+			return nil, err
+		}
+
+		msg.ToName = toName.String
+		msg.LastError = lastError.String
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			msg.OrderID = &id
+		}
+		if createdAt.Valid {
+			msg.CreatedAt = &createdAt.Time
+		}
+		if sentAt.Valid {
+			msg.SentAt = &sentAt.Time
+		}
+		messages = append(messages, &msg)
+	}
+
+	return messages, rows.Err()
+}
@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Refund types
+const (
+	RefundFull    = "FULL"
+	RefundTickets = "TICKETS"
+	RefundAmount  = "AMOUNT"
+)
+
+// RefundRepository stores refunds. Every write runs inside a transaction that
+// holds the order's row lock from LockOrder, which serializes refunds per order.
+type RefundRepository struct {
+	db *db.DB
+}
+
+func NewRefundRepository(db *db.DB) *RefundRepository {
+	return &RefundRepository{db: db}
+}
+
+// LockOrder fetches an order without its tickets and locks it until the
+// transaction ends
+func (r *RefundRepository) LockOrder(tx *sqlx.Tx, orderID int) (*models.Order, error) {
+	query := "SELECT id, user_id, COALESCE(amount, '0'), customer_name, customer_email, locale, refunded_amount FROM `order` WHERE id = ? FOR UPDATE"
+
+	var order models.Order
+	var customerName, customerEmail sql.NullString
+	err := tx.QueryRow(query, orderID).Scan(
+		&order.ID, &order.UserID, &order.Amount, &customerName, &customerEmail, &order.Locale, &order.RefundedAmount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order.CustomerName = customerName.String
+	order.CustomerEmail = customerEmail.String
+	return &order, nil
+}
+
+// GetOrderTicketsForUpdate fetches and locks an order's tickets, with the
+// event title for notifications
+func (r *RefundRepository) GetOrderTicketsForUpdate(tx *sqlx.Tx, orderID int) ([]*models.Ticket, error) {
+	query := `
+		SELECT t.id, t.ticket_type_id, t.event_date_id, t.seat_id, t.price, t.refunded_at, e.id, e.title
+		FROM ticket t
+		INNER JOIN order_hast_tickets oht ON oht.ticket_id = t.id
+		INNER JOIN event_date ed ON t.event_date_id = ed.id
+		INNER JOIN event e ON ed.event_id = e.id
+		WHERE oht.order_id = ?
+		ORDER BY t.id
+		FOR UPDATE OF t
+	`
+
+	rows, err := tx.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []*models.Ticket
+	for rows.Next() {
+		var ticket models.Ticket
+		var event models.Event
+		var seatID sql.NullInt64
+		var refundedAt sql.NullTime
+
+		if err := rows.Scan(
+			&ticket.ID, &ticket.TicketTypeID, &ticket.EventDateID, &seatID, &ticket.Price, &refundedAt, &event.ID, &event.Title,
+		); err != nil {
+			return nil, err
+		}
+
+		if seatID.Valid {
+			ticket.SeatID = int(seatID.Int64)
+		}
+		if refundedAt.Valid {
+			ticket.RefundedAt = &refundedAt.Time
+		}
+		ticket.OrderID = orderID
+		ticket.Event = &event
+		tickets = append(tickets, &ticket)
+	}
+
+	return tickets, rows.Err()
+}
+
+// AddRefundedAmount adds amount (a decimal string) to the order's refunded
+// total. Returns false, changing nothing, if that would exceed what was paid.
+func (r *RefundRepository) AddRefundedAmount(tx *sqlx.Tx, orderID int, amount string) (bool, error) {
+	query := `
+		UPDATE ` + "`order`" + `
+		SET refunded_amount = refunded_amount + ?
+		WHERE id = ?
+		  AND refunded_amount + ? <= CAST(COALESCE(amount, '0') AS DECIMAL(19,2))
+	`
+
+	result, err := tx.Exec(query, amount, orderID, amount)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// CreateRefund inserts a refund and the tickets it covers
+func (r *RefundRepository) CreateRefund(tx *sqlx.Tx, refund *models.OrderRefund) (int64, error) {
+	query := `
+		INSERT INTO order_refund (order_id, type, amount, reason, operator_user_id, restocked, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query, refund.OrderID, refund.Type, refund.Amount, refund.Reason, refund.OperatorUserID, refund.Restocked, refund.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	refundID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ticketID := range refund.TicketIDs {
+		if _, err := tx.Exec("INSERT INTO order_refund_ticket (refund_id, ticket_id) VALUES (?, ?)", refundID, ticketID); err != nil {
+			return 0, err
+		}
+	}
+
+	return refundID, nil
+}
+
+// MarkTicketsRefunded flags tickets as refunded, and when restock is set
+// releases their seats so they can be sold again. Returns the number of
+// tickets changed; tickets already refunded are skipped.
+func (r *RefundRepository) MarkTicketsRefunded(tx *sqlx.Tx, ticketIDs []int, restock bool, at time.Time) (int64, error) {
+	if len(ticketIDs) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		UPDATE ticket
+		SET refunded_at = ?, inventory_released_at = IF(?, ?, inventory_released_at)
+		WHERE id IN (?) AND refunded_at IS NULL
+	`
+
+	query, args, err := sqlx.In(query, at.UTC(), restock, at.UTC(), ticketIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(tx.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ListRefunds returns an order's refunds, oldest first
+func (r *RefundRepository) ListRefunds(orderID int) ([]*models.OrderRefund, error) {
+	query := `
+		SELECT id, order_id, type, amount, reason, operator_user_id, restocked, created_at
+		FROM order_refund
+		WHERE order_id = ?
+		ORDER BY id
+	`
+
+	var refunds []*models.OrderRefund
+	if err := r.db.Select(&refunds, query, orderID); err != nil {
+		return nil, err
+	}
+	if len(refunds) == 0 {
+		return refunds, nil
+	}
+
+	byID := make(map[int]*models.OrderRefund, len(refunds))
+	ids := make([]int, 0, len(refunds))
+	for _, refund := range refunds {
+		refund.TicketIDs = []int{}
+		byID[refund.ID] = refund
+		ids = append(ids, refund.ID)
+	}
+
+	query, args, err := sqlx.In("SELECT refund_id, ticket_id FROM order_refund_ticket WHERE refund_id IN (?) ORDER BY ticket_id", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(r.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var refundID, ticketID int
+		if err := rows.Scan(&refundID, &ticketID); err != nil {
+			return nil, err
+		}
+		byID[refundID].TicketIDs = append(byID[refundID].TicketIDs, ticketID)
+	}
+
+	return refunds, rows.Err()
+}
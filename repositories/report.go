@@ -0,0 +1,319 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Sales velocity intervals
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// SalesScope selects the tickets a sales report covers: every date of an
+// event, or one event date when EventDateID is set. From and To bound the
+// order's created_at.
+type SalesScope struct {
+	EventID     int
+	EventDateID int
+	From        *time.Time
+	To          *time.Time
+}
+
+// dateCondition restricts the event_date aliased ed to the scope
+func (s *SalesScope) dateCondition() (string, []interface{}) {
+	if s.EventDateID != 0 {
+		return "ed.id = ?", []interface{}{s.EventDateID}
+	}
+	return "ed.event_id = ?", []interface{}{s.EventID}
+}
+
+// saleCondition restricts tickets aliased t, of orders aliased o, to the
+// scope. Refunded tickets are left out.
+func (s *SalesScope) saleCondition() (string, []interface{}) {
+	condition, args := s.dateCondition()
+	condition += " AND t.refunded_at IS NULL"
+	if s.From != nil {
+		condition += " AND o.created_at >= ?"
+		args = append(args, s.From.UTC())
+	}
+	if s.To != nil {
+		condition += " AND o.created_at < ?"
+		args = append(args, s.To.UTC())
+	}
+	return condition, args
+}
+
+// saleJoins joins a ticket aliased t to its order and event date
+const saleJoins = `
+	INNER JOIN order_hast_tickets oht ON oht.ticket_id = t.id
+	INNER JOIN ` + "`order`" + ` o ON o.id = oht.order_id
+	INNER JOIN event_date ed ON ed.id = t.event_date_id
+`
+
+// ReportDate is an event date covered by a sales report
+type ReportDate struct {
+	EventID      int
+	EventTitle   string
+	EventDateID  int
+	Date         *time.Time
+	SeatingMode  string
+	TotalTickets *int
+}
+
+// TierSalesRow is one ticket type's sales on one event date
+type TierSalesRow struct {
+	EventDateID  int
+	TicketTypeID int
+	Name         string
+	Sold         int
+	Refunded     int
+	Revenue      float64
+}
+
+// TierCapacityRow is how many tickets of a type one event date can sell:
+// MaxQuantity from event_date_has_ticket_type, Seats from the seat map
+type TierCapacityRow struct {
+	EventDateID  int
+	TicketTypeID int
+	Name         string
+	MaxQuantity  *int
+	Seats        int
+}
+
+// ReportRepository runs the read-only aggregations behind sales reports
+type ReportRepository struct {
+	db *db.DB
+}
+
+func NewReportRepository(db *db.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// GetEventTitle returns sql.ErrNoRows if the event does not exist
+func (r *ReportRepository) GetEventTitle(eventID int) (string, error) {
+	var title sql.NullString
+	err := r.db.QueryRow("SELECT title FROM event WHERE id = ?", eventID).Scan(&title)
+	return title.String, err
+}
+
+// ListDates returns the event dates in scope, earliest first
+func (r *ReportRepository) ListDates(scope *SalesScope) ([]*ReportDate, error) {
+	condition, args := scope.dateCondition()
+	query := `
+		SELECT e.id, e.title, ed.id, ed.date, ed.seating_mode, ed.tota_tickets
+		FROM event_date ed
+		INNER JOIN event e ON e.id = ed.event_id
+		WHERE ` + condition + `
+		ORDER BY ed.date, ed.id
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dates []*ReportDate
+	for rows.Next() {
+		var date ReportDate
+		var title, seatingMode sql.NullString
+		var at sql.NullTime
+		var total sql.NullInt64
+		if err := rows.Scan(&date.EventID, &title, &date.EventDateID, &at, &seatingMode, &total); err != nil {
+			return nil, err
+		}
+
+		date.EventTitle = title.String
+		date.SeatingMode = seatingMode.String
+		if at.Valid {
+			date.Date = &at.Time
+		}
+		if total.Valid {
+			value := int(total.Int64)
+			date.TotalTickets = &value
+		}
+		dates = append(dates, &date)
+	}
+
+	return dates, rows.Err()
+}
+
+// SalesByTier counts tickets sold and refunded per event date and ticket type
+func (r *ReportRepository) SalesByTier(scope *SalesScope) ([]*TierSalesRow, error) {
+	condition, args := scope.dateCondition()
+	if scope.From != nil {
+		condition += " AND o.created_at >= ?"
+		args = append(args, scope.From.UTC())
+	}
+	if scope.To != nil {
+		condition += " AND o.created_at < ?"
+		args = append(args, scope.To.UTC())
+	}
+
+	query := `
+		SELECT t.event_date_id, t.ticket_type_id, COALESCE(tt.name, ''),
+			SUM(t.refunded_at IS NULL),
+			SUM(t.refunded_at IS NOT NULL),
+			COALESCE(SUM(CASE WHEN t.refunded_at IS NULL THEN t.price END), 0)
+		FROM ticket t` + saleJoins + `
+		LEFT JOIN ticket_type tt ON tt.id = t.ticket_type_id
+		WHERE ` + condition + `
+		GROUP BY t.event_date_id, t.ticket_type_id, tt.name
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sales []*TierSalesRow
+	for rows.Next() {
+		var row TierSalesRow
+		if err := rows.Scan(&row.EventDateID, &row.TicketTypeID, &row.Name, &row.Sold, &row.Refunded, &row.Revenue); err != nil {
+			return nil, err
+		}
+		sales = append(sales, &row)
+	}
+
+	return sales, rows.Err()
+}
+
+// TierCapacities returns every tier configured for the dates in scope, with
+// its max_quantity and the number of seats priced at it
+func (r *ReportRepository) TierCapacities(scope *SalesScope) ([]*TierCapacityRow, error) {
+	condition, args := scope.dateCondition()
+	query := `
+		SELECT edtt.event_date_id, edtt.ticket_type_id, COALESCE(tt.name, ''), edtt.max_quantity, 0
+		FROM event_date_has_ticket_type edtt
+		INNER JOIN event_date ed ON ed.id = edtt.event_date_id
+		LEFT JOIN ticket_type tt ON tt.id = edtt.ticket_type_id
+		WHERE ` + condition + `
+		UNION ALL
+		SELECT eds.event_date_id, eds.ticket_type_id, COALESCE(tt.name, ''), NULL, COUNT(*)
+		FROM event_date_has_seat eds
+		INNER JOIN event_date ed ON ed.id = eds.event_date_id
+		LEFT JOIN ticket_type tt ON tt.id = eds.ticket_type_id
+		WHERE ` + condition + `
+		GROUP BY eds.event_date_id, eds.ticket_type_id, tt.name
+	`
+
+	rows, err := r.db.Query(query, append(args, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type tierKey struct{ eventDateID, ticketTypeID int }
+	byTier := make(map[tierKey]*TierCapacityRow)
+	var capacities []*TierCapacityRow
+	for rows.Next() {
+		var row TierCapacityRow
+		var maxQuantity sql.NullInt64
+		if err := rows.Scan(&row.EventDateID, &row.TicketTypeID, &row.Name, &maxQuantity, &row.Seats); err != nil {
+			return nil, err
+		}
+
+		key := tierKey{row.EventDateID, row.TicketTypeID}
+		existing, found := byTier[key]
+		if !found {
+			existing = &TierCapacityRow{EventDateID: row.EventDateID, TicketTypeID: row.TicketTypeID, Name: row.Name}
+			byTier[key] = existing
+			capacities = append(capacities, existing)
+		}
+		if maxQuantity.Valid {
+			value := int(maxQuantity.Int64)
+			existing.MaxQuantity = &value
+		}
+		existing.Seats += row.Seats
+	}
+
+	return capacities, rows.Err()
+}
+
+// SalesVelocity buckets sales by the hour or day the order was placed
+func (r *ReportRepository) SalesVelocity(scope *SalesScope, interval string) ([]*models.SalesVelocityPoint, error) {
+	// The format is one of two constants, inlined so the grouped expression
+	// matches the selected one
+	format := "%Y-%m-%d 00:00:00"
+	if interval == IntervalHour {
+		format = "%Y-%m-%d %H:00:00"
+	}
+
+	condition, args := scope.saleCondition()
+	query := `
+		SELECT DATE_FORMAT(o.created_at, '` + format + `') AS period, COUNT(*), COALESCE(SUM(t.price), 0)
+		FROM ticket t` + saleJoins + `
+		WHERE ` + condition + `
+		GROUP BY period
+		ORDER BY period
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*models.SalesVelocityPoint
+	for rows.Next() {
+		var point models.SalesVelocityPoint
+		var period string
+		if err := rows.Scan(&period, &point.TicketsSold, &point.GrossRevenue); err != nil {
+			return nil, err
+		}
+		if point.Period, err = time.Parse("2006-01-02 15:04:05", period); err != nil {
+			return nil, fmt.Errorf("velocity period %q: %w", period, err)
+		}
+		points = append(points, &point)
+	}
+
+	return points, rows.Err()
+}
+
+// SalesBySection counts seated sales and seats per section, unordered
+func (r *ReportRepository) SalesBySection(scope *SalesScope) ([]*models.SectionSales, error) {
+	dateCondition, dateArgs := scope.dateCondition()
+	saleCondition, saleArgs := scope.saleCondition()
+	query := `
+		SELECT section, SUM(sold), SUM(revenue), SUM(seats)
+		FROM (
+			SELECT s.section, COUNT(*) AS sold, COALESCE(SUM(t.price), 0) AS revenue, 0 AS seats
+			FROM ticket t` + saleJoins + `
+			INNER JOIN seat s ON s.id = t.seat_id
+			WHERE ` + saleCondition + `
+			GROUP BY s.section
+			UNION ALL
+			SELECT s.section, 0, 0, COUNT(*)
+			FROM event_date_has_seat eds
+			INNER JOIN event_date ed ON ed.id = eds.event_date_id
+			INNER JOIN seat s ON s.id = eds.seat_id
+			WHERE ` + dateCondition + `
+			GROUP BY s.section
+		) sections
+		GROUP BY section
+	`
+
+	rows, err := r.db.Query(query, append(saleArgs, dateArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sections []*models.SectionSales
+	for rows.Next() {
+		var section models.SectionSales
+		if err := rows.Scan(&section.Section, &section.TicketsSold, &section.GrossRevenue, &section.Seats); err != nil {
+			return nil, err
+		}
+		sections = append(sections, &section)
+	}
+
+	return sections, rows.Err()
+}
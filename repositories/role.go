@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+)
+
+// Role names, as stored in role.name
+const (
+	RoleAdmin     = "ADMIN"
+	RoleOrganizer = "ORGANIZER"
+	RoleViewer    = "VIEWER"
+	RoleBoxOffice = "BOX_OFFICE"
+	RoleScanner   = "SCANNER"
+)
+
+type RoleRepository struct {
+	db *db.DB
+}
+
+func NewRoleRepository(db *db.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// GetUserRoles returns the names of the roles assigned to a user
+func (r *RoleRepository) GetUserRoles(userID int) ([]string, error) {
+	query := `
+		SELECT r.name
+		FROM role_has_user rhu
+		JOIN role r ON r.id = rhu.role_id
+		WHERE rhu.user_id = ?
+		ORDER BY r.id
+	`
+
+	var roles []string
+	if err := r.db.Select(&roles, query, userID); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetUserRolesForUpdate returns the role names assigned to a user, locking the
+// assignments inside a transaction
+func (r *RoleRepository) GetUserRolesForUpdate(tx *sqlx.Tx, userID int) ([]string, error) {
+	query := `
+		SELECT r.name
+		FROM role_has_user rhu
+		JOIN role r ON r.id = rhu.role_id
+		WHERE rhu.user_id = ?
+		ORDER BY r.id
+		FOR UPDATE
+	`
+
+	var roles []string
+	if err := tx.Select(&roles, query, userID); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// HasAnyRole reports whether the user holds at least one of the given roles
+func (r *RoleRepository) HasAnyRole(userID int, roles ...string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	args := []interface{}{userID}
+	for _, role := range roles {
+		args = append(args, role)
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM role_has_user rhu
+		JOIN role r ON r.id = rhu.role_id
+		WHERE rhu.user_id = ? AND r.name IN (?` + strings.Repeat(", ?", len(roles)-1) + `)
+	`
+
+	var count int
+	if err := r.db.Get(&count, query, args...); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RemoveUserRoles takes every role away from a user
+func (r *RoleRepository) RemoveUserRoles(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec("DELETE FROM role_has_user WHERE user_id = ?", userID)
+	return err
+}
@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// Reasons recorded when a session is revoked
+const (
+	SessionRevokedLogout         = "LOGOUT"
+	SessionRevokedByUser         = "REVOKED_BY_USER"
+	SessionRevokedAll            = "REVOKE_ALL"
+	SessionRevokedTokenReuse     = "REFRESH_TOKEN_REUSE"
+	SessionRevokedPasswordReset  = "PASSWORD_RESET"
+	SessionRevokedAccountLinked  = "ACCOUNT_LINKED"
+	SessionRevokedPasswordChange = "PASSWORD_CHANGE"
+	SessionRevokedAccountDeleted = "ACCOUNT_DELETED"
+)
+
+type SessionRepository struct {
+	db *db.DB
+}
+
+func NewSessionRepository(db *db.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+const sessionColumns = "id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at, revoke_reason"
+
+// CreateSession starts a session and returns its ID
+func (r *SessionRepository) CreateSession(tx *sqlx.Tx, session *models.Session) (int64, error) {
+	query := `
+		INSERT INTO user_session (user_id, user_agent, ip_address, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query, session.UserID, nullableString(session.UserAgent), nullableString(session.IPAddress),
+		session.CreatedAt.UTC(), session.LastUsedAt.UTC(), session.ExpiresAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// GetSession fetches a session by ID
+func (r *SessionRepository) GetSession(id int) (*models.Session, error) {
+	return scanSession(r.db.QueryRow("SELECT "+sessionColumns+" FROM user_session WHERE id = ?", id))
+}
+
+// GetSessionForUpdate locks a session row inside a transaction
+func (r *SessionRepository) GetSessionForUpdate(tx *sqlx.Tx, id int) (*models.Session, error) {
+	return scanSession(tx.QueryRow("SELECT "+sessionColumns+" FROM user_session WHERE id = ? FOR UPDATE", id))
+}
+
+// ListActiveSessions returns a user's sessions that are neither revoked nor expired
+func (r *SessionRepository) ListActiveSessions(userID int, now time.Time) ([]*models.Session, error) {
+	return r.listSessions(
+		"SELECT "+sessionColumns+" FROM user_session WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_used_at DESC, id DESC",
+		userID, now.UTC(),
+	)
+}
+
+// ListUserSessions returns every session a user has had, including revoked and expired ones
+func (r *SessionRepository) ListUserSessions(userID int) ([]*models.Session, error) {
+	return r.listSessions("SELECT "+sessionColumns+" FROM user_session WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+}
+
+func (r *SessionRepository) listSessions(query string, args ...interface{}) ([]*models.Session, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records a refresh and slides the session expiry
+func (r *SessionRepository) TouchSession(tx *sqlx.Tx, id int, usedAt time.Time, expiresAt time.Time) error {
+	_, err := tx.Exec("UPDATE user_session SET last_used_at = ?, expires_at = ? WHERE id = ?", usedAt.UTC(), expiresAt.UTC(), id)
+	return err
+}
+
+// RevokeSession revokes one session; it returns false if it was already revoked
+func (r *SessionRepository) RevokeSession(tx *sqlx.Tx, id int, reason string, now time.Time) (bool, error) {
+	result, err := tx.Exec(
+		"UPDATE user_session SET revoked_at = ?, revoke_reason = ? WHERE id = ? AND revoked_at IS NULL",
+		now.UTC(), reason, id,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// RevokeAllSessions revokes every active session of a user and returns how many were revoked
+func (r *SessionRepository) RevokeAllSessions(tx *sqlx.Tx, userID int, reason string, now time.Time) (int64, error) {
+	result, err := tx.Exec(
+		"UPDATE user_session SET revoked_at = ?, revoke_reason = ? WHERE user_id = ? AND revoked_at IS NULL",
+		now.UTC(), reason, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// RevokeOtherSessions revokes every active session of a user except one
+func (r *SessionRepository) RevokeOtherSessions(tx *sqlx.Tx, userID int, keepSessionID int, reason string, now time.Time) (int64, error) {
+	result, err := tx.Exec(
+		"UPDATE user_session SET revoked_at = ?, revoke_reason = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		now.UTC(), reason, userID, keepSessionID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// CreateRefreshToken stores the hash of a refresh token issued for a session
+func (r *SessionRepository) CreateRefreshToken(tx *sqlx.Tx, sessionID int, tokenHash string, now time.Time) error {
+	_, err := tx.Exec(
+		"INSERT INTO session_refresh_token (session_id, token_hash, created_at) VALUES (?, ?, ?)",
+		sessionID, tokenHash, now.UTC(),
+	)
+	return err
+}
+
+// GetRefreshTokenForUpdate locks a refresh token by hash. Rotated tokens are kept,
+// so presenting one again can be recognised as reuse.
+func (r *SessionRepository) GetRefreshTokenForUpdate(tx *sqlx.Tx, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	var rotatedAt sql.NullTime
+
+	err := tx.QueryRow(
+		"SELECT id, session_id, token_hash, created_at, rotated_at FROM session_refresh_token WHERE token_hash = ? FOR UPDATE",
+		tokenHash,
+	).Scan(&token.ID, &token.SessionID, &token.TokenHash, &token.CreatedAt, &rotatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if rotatedAt.Valid {
+		token.RotatedAt = &rotatedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenRotated retires a refresh token once its replacement is issued
+func (r *SessionRepository) MarkRefreshTokenRotated(tx *sqlx.Tx, id int, now time.Time) error {
+	_, err := tx.Exec("UPDATE session_refresh_token SET rotated_at = ? WHERE id = ?", now.UTC(), id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	var userAgent, ipAddress, revokeReason sql.NullString
+	var revokedAt sql.NullTime
+
+	err := row.Scan(
+		&session.ID, &session.UserID, &userAgent, &ipAddress,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &revokedAt, &revokeReason,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
+	session.RevokeReason = revokeReason.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,344 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+)
+
+// organizerOrderCondition matches orders whose tickets belong to an event of
+// the organizer given as its single parameter; it expects the order aliased o
+const organizerOrderCondition = `EXISTS (
+	SELECT 1
+	FROM order_hast_tickets oht
+	INNER JOIN ticket t ON t.id = oht.ticket_id
+	INNER JOIN event_date ed ON ed.id = t.event_date_id
+	INNER JOIN event e ON e.id = ed.event_id
+	WHERE oht.order_id = o.id AND e.organizer_id = ?
+)`
+
+// SettlementFilter narrows a settlement listing; zero values match everything.
+// From and To compare against the period end. Before pages backwards by ID.
+type SettlementFilter struct {
+	OrganizerID int
+	From        *time.Time
+	To          *time.Time
+	Before      int
+	Limit       int
+}
+
+// SettlementRepository stores organizer payout statements and claims the
+// orders and refunds they cover. An order or refund is claimed by setting its
+// settlement_id only while it is still NULL, so nothing is settled twice.
+type SettlementRepository struct {
+	db *db.DB
+}
+
+func NewSettlementRepository(db *db.DB) *SettlementRepository {
+	return &SettlementRepository{db: db}
+}
+
+// ListUnsettledOrganizers returns organizers with orders placed in
+// [start, end) or refunds issued before end that no settlement covers yet
+func (r *SettlementRepository) ListUnsettledOrganizers(start time.Time, end time.Time) ([]int, error) {
+	query := `
+		SELECT e.organizer_id
+		FROM ` + "`order`" + ` o
+		INNER JOIN order_hast_tickets oht ON oht.order_id = o.id
+		INNER JOIN ticket t ON t.id = oht.ticket_id
+		INNER JOIN event_date ed ON ed.id = t.event_date_id
+		INNER JOIN event e ON e.id = ed.event_id
+		WHERE o.settlement_id IS NULL AND o.created_at >= ? AND o.created_at < ? AND e.organizer_id IS NOT NULL
+		UNION
+		SELECT e.organizer_id
+		FROM order_refund rf
+		INNER JOIN order_hast_tickets oht ON oht.order_id = rf.order_id
+		INNER JOIN ticket t ON t.id = oht.ticket_id
+		INNER JOIN event_date ed ON ed.id = t.event_date_id
+		INNER JOIN event e ON e.id = ed.event_id
+		WHERE rf.settlement_id IS NULL AND rf.created_at < ? AND e.organizer_id IS NOT NULL
+		ORDER BY 1
+	`
+
+	var organizerIDs []int
+	err := r.db.Select(&organizerIDs, query, start.UTC(), end.UTC(), end.UTC())
+	return organizerIDs, err
+}
+
+// CountUnassignedOrders counts unsettled orders in [start, end) for events
+// with no organizer. They cannot be settled until one is assigned.
+func (r *SettlementRepository) CountUnassignedOrders(start time.Time, end time.Time) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT o.id)
+		FROM ` + "`order`" + ` o
+		INNER JOIN order_hast_tickets oht ON oht.order_id = o.id
+		INNER JOIN ticket t ON t.id = oht.ticket_id
+		INNER JOIN event_date ed ON ed.id = t.event_date_id
+		INNER JOIN event e ON e.id = ed.event_id
+		WHERE o.settlement_id IS NULL AND o.created_at >= ? AND o.created_at < ? AND e.organizer_id IS NULL
+	`
+
+	var count int
+	err := r.db.QueryRow(query, start.UTC(), end.UTC()).Scan(&count)
+	return count, err
+}
+
+// CreateSettlement inserts an empty statement; its totals are filled in by
+// FinalizeSettlement once orders and refunds are claimed
+func (r *SettlementRepository) CreateSettlement(tx *sqlx.Tx, settlement *models.Settlement) (int64, error) {
+	query := `
+		INSERT INTO settlement (organizer_id, period_start, period_end, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query,
+		settlement.OrganizerID, settlement.PeriodStart.UTC(), settlement.PeriodEnd.UTC(),
+		settlement.CreatedBy, settlement.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ClaimOrders locks the organizer's unsettled orders placed in [start, end)
+// into a settlement and returns how many were claimed
+func (r *SettlementRepository) ClaimOrders(tx *sqlx.Tx, settlementID int, organizerID int, start time.Time, end time.Time) (int64, error) {
+	query := "UPDATE `order` o SET o.settlement_id = ?" + `
+		WHERE o.settlement_id IS NULL AND o.created_at >= ? AND o.created_at < ? AND ` + organizerOrderCondition
+
+	result, err := tx.Exec(query, settlementID, start.UTC(), end.UTC(), organizerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClaimRefunds locks the organizer's unsettled refunds issued before end into
+// a settlement. Only refunds of orders that are already settled (including by
+// this settlement) qualify, so a refund is never paid out ahead of its sale.
+func (r *SettlementRepository) ClaimRefunds(tx *sqlx.Tx, settlementID int, organizerID int, end time.Time) (int64, error) {
+	query := "UPDATE order_refund rf INNER JOIN `order` o ON o.id = rf.order_id SET rf.settlement_id = ?" + `
+		WHERE rf.settlement_id IS NULL AND rf.created_at < ? AND o.settlement_id IS NOT NULL AND ` + organizerOrderCondition
+
+	result, err := tx.Exec(query, settlementID, end.UTC(), organizerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SumClaimed totals, per event, the ledger transactions of the sales and
+// refunds claimed by a settlement. Orders that moved no money have no ledger
+// transactions and do not appear.
+func (r *SettlementRepository) SumClaimed(tx *sqlx.Tx, settlementID int) ([]*models.SettlementLine, error) {
+	query := `
+		SELECT lt.event_id,
+			COUNT(DISTINCT CASE WHEN lt.kind = ? THEN lt.order_id END),
+			COUNT(DISTINCT CASE WHEN lt.kind = ? THEN lt.refund_id END),
+			COALESCE(SUM(CASE WHEN lt.kind = ? AND le.account = ? THEN le.debit - le.credit END), 0),
+			COALESCE(SUM(CASE WHEN le.account = ? THEN le.credit - le.debit END), 0),
+			COALESCE(SUM(CASE WHEN le.account = ? THEN le.credit - le.debit END), 0),
+			COALESCE(SUM(CASE WHEN le.account = ? THEN le.credit - le.debit END), 0),
+			COALESCE(SUM(CASE WHEN le.account = ? THEN le.credit - le.debit END), 0)
+		FROM ledger_transaction lt
+		INNER JOIN ledger_entry le ON le.transaction_id = lt.id
+		WHERE (lt.kind = ? AND lt.order_id IN (SELECT id FROM ` + "`order`" + ` WHERE settlement_id = ?))
+			OR (lt.kind = ? AND lt.refund_id IN (SELECT id FROM order_refund WHERE settlement_id = ?))
+		GROUP BY lt.event_id
+		ORDER BY lt.event_id
+	`
+
+	rows, err := tx.Query(query,
+		ledger.KindSale, ledger.KindRefund,
+		ledger.KindSale, ledger.CustomerReceivable,
+		ledger.Refunds, ledger.PlatformFees, ledger.TaxPayable, ledger.OrganizerPayable,
+		ledger.KindSale, settlementID, ledger.KindRefund, settlementID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []*models.SettlementLine
+	for rows.Next() {
+		line := &models.SettlementLine{SettlementID: settlementID}
+		var gross, refunds, fees, tax, net string
+		if err := rows.Scan(&line.EventID, &line.OrderCount, &line.RefundCount, &gross, &refunds, &fees, &tax, &net); err != nil {
+			return nil, err
+		}
+
+		for _, field := range []struct {
+			value string
+			dest  *float64
+		}{
+			{gross, &line.GrossSales},
+			{refunds, &line.Refunds},
+			{fees, &line.PlatformFees},
+			{tax, &line.Tax},
+			{net, &line.NetPayout},
+		} {
+			amount, err := ledger.ParseAmount(field.value)
+			if err != nil {
+				return nil, err
+			}
+			*field.dest = amount.Float()
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// CreateLine stores one event's totals for a settlement
+func (r *SettlementRepository) CreateLine(tx *sqlx.Tx, line *models.SettlementLine) error {
+	query := `
+		INSERT INTO settlement_line (settlement_id, event_id, order_count, refund_count, gross_sales, refunds, platform_fees, tax, net_payout)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := tx.Exec(query,
+		line.SettlementID, line.EventID, line.OrderCount, line.RefundCount,
+		ledger.FromFloat(line.GrossSales).String(), ledger.FromFloat(line.Refunds).String(),
+		ledger.FromFloat(line.PlatformFees).String(), ledger.FromFloat(line.Tax).String(),
+		ledger.FromFloat(line.NetPayout).String(),
+	)
+	return err
+}
+
+// FinalizeSettlement stores a settlement's reference, counts and totals
+func (r *SettlementRepository) FinalizeSettlement(tx *sqlx.Tx, settlement *models.Settlement) error {
+	query := `
+		UPDATE settlement
+		SET reference = ?, order_count = ?, refund_count = ?, gross_sales = ?, refunds = ?, platform_fees = ?, tax = ?, net_payout = ?
+		WHERE id = ?
+	`
+
+	_, err := tx.Exec(query,
+		settlement.Reference, settlement.OrderCount, settlement.RefundCount,
+		ledger.FromFloat(settlement.GrossSales).String(), ledger.FromFloat(settlement.Refunds).String(),
+		ledger.FromFloat(settlement.PlatformFees).String(), ledger.FromFloat(settlement.Tax).String(),
+		ledger.FromFloat(settlement.NetPayout).String(),
+		settlement.ID,
+	)
+	return err
+}
+
+// GetSettlement returns a settlement with its lines. Returns sql.ErrNoRows if
+// there is no such settlement.
+func (r *SettlementRepository) GetSettlement(id int) (*models.Settlement, error) {
+	query := settlementSelect + " WHERE s.id = ?"
+
+	settlement, err := scanSettlement(r.db.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	lineQuery := `
+		SELECT sl.settlement_id, sl.event_id, e.title, sl.order_count, sl.refund_count,
+			sl.gross_sales, sl.refunds, sl.platform_fees, sl.tax, sl.net_payout
+		FROM settlement_line sl
+		INNER JOIN event e ON e.id = sl.event_id
+		WHERE sl.settlement_id = ?
+		ORDER BY sl.event_id
+	`
+
+	rows, err := r.db.Query(lineQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.SettlementLine
+		if err := rows.Scan(
+			&line.SettlementID, &line.EventID, &line.EventTitle, &line.OrderCount, &line.RefundCount,
+			&line.GrossSales, &line.Refunds, &line.PlatformFees, &line.Tax, &line.NetPayout,
+		); err != nil {
+			return nil, err
+		}
+		settlement.Lines = append(settlement.Lines, &line)
+	}
+
+	return settlement, rows.Err()
+}
+
+// ListSettlements returns matching settlements without their lines, newest first
+func (r *SettlementRepository) ListSettlements(filter *SettlementFilter) ([]*models.Settlement, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.OrganizerID != 0 {
+		conditions = append(conditions, "s.organizer_id = ?")
+		args = append(args, filter.OrganizerID)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "s.period_end >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "s.period_end < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Before != 0 {
+		conditions = append(conditions, "s.id < ?")
+		args = append(args, filter.Before)
+	}
+
+	query := settlementSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY s.id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settlements []*models.Settlement
+	for rows.Next() {
+		settlement, err := scanSettlement(rows)
+		if err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, settlement)
+	}
+
+	return settlements, rows.Err()
+}
+
+const settlementSelect = `
+	SELECT s.id, s.reference, s.organizer_id, u.name, u.last_name, s.period_start, s.period_end,
+		s.order_count, s.refund_count, s.gross_sales, s.refunds, s.platform_fees, s.tax, s.net_payout,
+		s.created_by, s.created_at
+	FROM settlement s
+	INNER JOIN ` + "`user`" + ` u ON u.id = s.organizer_id
+`
+
+func scanSettlement(row rowScanner) (*models.Settlement, error) {
+	var settlement models.Settlement
+	var reference sql.NullString
+	var name, lastName string
+
+	if err := row.Scan(
+		&settlement.ID, &reference, &settlement.OrganizerID, &name, &lastName,
+		&settlement.PeriodStart, &settlement.PeriodEnd,
+		&settlement.OrderCount, &settlement.RefundCount,
+		&settlement.GrossSales, &settlement.Refunds, &settlement.PlatformFees, &settlement.Tax, &settlement.NetPayout,
+		&settlement.CreatedBy, &settlement.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	settlement.Reference = reference.String
+	settlement.OrganizerName = strings.TrimSpace(name + " " + lastName)
+	return &settlement, nil
+}
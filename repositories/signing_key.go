@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+const (
+	SigningKeyActive  = "ACTIVE"
+	SigningKeyRetired = "RETIRED"
+	SigningKeyRevoked = "REVOKED"
+)
+
+type SigningKeyRepository struct {
+	db *db.DB
+}
+
+func NewSigningKeyRepository(db *db.DB) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+// GetActiveKey fetches the key currently used to sign credentials for an event
+func (r *SigningKeyRepository) GetActiveKey(eventID int) (*models.SigningKey, error) {
+	query := `
+		SELECT id, event_id, version, key_id, public_key, COALESCE(private_key, '') AS private_key, status, created_at, retired_at
+		FROM event_signing_key
+		WHERE event_id = ? AND status = ?
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	var key models.SigningKey
+	if err := r.db.Get(&key, query, eventID, SigningKeyActive); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetKeyByKeyID fetches a key by its public key ID
+func (r *SigningKeyRepository) GetKeyByKeyID(keyID string) (*models.SigningKey, error) {
+	query := `
+		SELECT id, event_id, version, key_id, public_key, COALESCE(private_key, '') AS private_key, status, created_at, retired_at
+		FROM event_signing_key
+		WHERE key_id = ?
+	`
+
+	var key models.SigningKey
+	if err := r.db.Get(&key, query, keyID); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ListKeys fetches every key for an event, newest first
+func (r *SigningKeyRepository) ListKeys(eventID int) ([]*models.SigningKey, error) {
+	query := `
+		SELECT id, event_id, version, key_id, public_key, COALESCE(private_key, '') AS private_key, status, created_at, retired_at
+		FROM event_signing_key
+		WHERE event_id = ?
+		ORDER BY version DESC
+	`
+
+	keys := []*models.SigningKey{}
+	if err := r.db.Select(&keys, query, eventID); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetLatestVersion returns the highest key version for an event, or 0 if none exist
+func (r *SigningKeyRepository) GetLatestVersion(eventID int) (int, error) {
+	var version int
+	err := r.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM event_signing_key WHERE event_id = ?", eventID).Scan(&version)
+	return version, err
+}
+
+// RotateKey retires (or revokes) the event's current keys and inserts the new active key.
+// The unique (event_id, version) index makes concurrent rotations fail instead of forking.
+func (r *SigningKeyRepository) RotateKey(tx *sqlx.Tx, key *models.SigningKey, revokePrevious bool) error {
+	previousStatus := SigningKeyRetired
+	if revokePrevious {
+		previousStatus = SigningKeyRevoked
+	}
+
+	_, err := tx.Exec(
+		"UPDATE event_signing_key SET status = ?, retired_at = NOW() WHERE event_id = ? AND status = ?",
+		previousStatus, key.EventID, SigningKeyActive,
+	)
+	if err != nil {
+		return err
+	}
+
+	if revokePrevious {
+		_, err = tx.Exec(
+			"UPDATE event_signing_key SET status = ? WHERE event_id = ? AND status = ?",
+			SigningKeyRevoked, key.EventID, SigningKeyRetired,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO event_signing_key (event_id, version, key_id, public_key, private_key, status) VALUES (?, ?, ?, ?, ?, ?)",
+		key.EventID, key.Version, key.KeyID, key.PublicKey, key.SealedPrivateKey, SigningKeyActive,
+	)
+	return err
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+type TicketRepository struct {
+	db *db.DB
+}
+
+func NewTicketRepository(db *db.DB) *TicketRepository {
+	return &TicketRepository{db: db}
+}
+
+// GetTicketByID fetches a single ticket with its ticket type, seat, event date, event and venue
+func (r *TicketRepository) GetTicketByID(id int) (*models.Ticket, error) {
+	query := `
+		SELECT
+			t.id, t.event_id, t.user_id, t.ticket_type_id, t.to_name, t.to_email, t.event_date_id, t.seat_id, t.price, t.credential_nonce,
+			t.admitted_at, t.admitted_gate, t.admitted_device, t.refunded_at,
+			COALESCE(oht.order_id, 0),
+			tt.id, tt.name,
+			s.section, s.row, s.number,
+			e.id, e.slug, e.title, e.description,
+			ed.date, ed.doors_open_at, ed.ends_at, ed.seating_mode,
+			v.id, v.name, v.slug, ` + venueTimeZone + `
+		FROM ticket t
+		LEFT JOIN order_hast_tickets oht ON oht.ticket_id = t.id
+		INNER JOIN ticket_type tt ON t.ticket_type_id = tt.id
+		LEFT JOIN seat s ON t.seat_id = s.id
+		INNER JOIN event_date ed ON t.event_date_id = ed.id
+		INNER JOIN event e ON ed.event_id = e.id
+		LEFT JOIN venue v ON CAST(ed.id_venue AS UNSIGNED) = v.id
+		WHERE t.id = ?
+	`
+
+	var ticket models.Ticket
+	var ticketType models.TicketType
+	var event models.Event
+	var toEmail, credentialNonce sql.NullString
+	var admittedAt, refundedAt sql.NullTime
+	var admittedGate, admittedDevice sql.NullString
+	var seatID sql.NullInt64
+	var seatSection, seatRow, seatNumber sql.NullString
+	var eventDate, doorsOpen, endsAt sql.NullTime
+	var seatingMode sql.NullString
+	var venueID sql.NullInt64
+	var venueName, venueSlug sql.NullString
+	var timeZone string
+
+	err := r.db.QueryRow(query, id).Scan(
+		&ticket.ID, &ticket.EventID, &ticket.UserID, &ticket.TicketTypeID, &ticket.ToName, &toEmail, &ticket.EventDateID, &seatID, &ticket.Price, &credentialNonce,
+		&admittedAt, &admittedGate, &admittedDevice, &refundedAt,
+		&ticket.OrderID,
+		&ticketType.ID, &ticketType.Name,
+		&seatSection, &seatRow, &seatNumber,
+		&event.ID, &event.Slug, &event.Title, &event.Description,
+		&eventDate, &doorsOpen, &endsAt, &seatingMode,
+		&venueID, &venueName, &venueSlug, &timeZone,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket.ToEmail = toEmail.String
+	ticket.CredentialNonce = credentialNonce.String
+	if admittedAt.Valid {
+		ticket.AdmittedAt = &admittedAt.Time
+		ticket.AdmittedGate = admittedGate.String
+		ticket.AdmittedDevice = admittedDevice.String
+	}
+	if refundedAt.Valid {
+		ticket.RefundedAt = &refundedAt.Time
+	}
+	if seatID.Valid {
+		ticket.SeatID = int(seatID.Int64)
+	}
+
+	ticket.TicketType = &ticketType
+	if seatSection.Valid && seatRow.Valid && seatNumber.Valid {
+		ticket.Seat = &models.Seat{
+			ID:      ticket.SeatID,
+			Section: seatSection.String,
+			Row:     seatRow.String,
+			Number:  seatNumber.String,
+		}
+	}
+
+	ticket.Event = &event
+	ticket.EventDate = &models.EventDate{
+		ID:          ticket.EventDateID,
+		EventID:     event.ID,
+		SeatingMode: seatingMode.String,
+		Date:        localTime(eventDate, timeZone),
+		DoorsOpenAt: localTime(doorsOpen, timeZone),
+		EndsAt:      localTime(endsAt, timeZone),
+		TimeZone:    timeZone,
+	}
+	if venueID.Valid {
+		ticket.EventDate.Venue = &models.Venue{
+			ID:       int(venueID.Int64),
+			Name:     venueName.String,
+			Slug:     venueSlug.String,
+			TimeZone: timeZone,
+		}
+	}
+
+	return &ticket, nil
+}
+
+// AnonymizeTicketHolder replaces the holder name and email on every ticket a
+// user bought. Tickets and their orders are kept for accounting.
+func (r *TicketRepository) AnonymizeTicketHolder(tx *sqlx.Tx, userID int, name string) error {
+	_, err := tx.Exec("UPDATE ticket SET to_name = ?, to_email = NULL WHERE user_id = ?", name, strconv.Itoa(userID))
+	return err
+}
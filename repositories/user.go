@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"ticketbooth-backend/db"
 	"ticketbooth-backend/models"
 )
@@ -31,8 +33,43 @@ func (r *UserRepository) CreateUser(user *models.User) (int64, error) {
 	return result.LastInsertId()
 }
 
-// UpdateUser updates provided fields for a user.
-func (r *UserRepository) UpdateUser(id int, updates map[string]interface{}) error {
+// CreateVerifiedUser inserts a user whose email address was already verified,
+// e.g. by an identity provider, and returns the insert ID.
+func (r *UserRepository) CreateVerifiedUser(tx *sqlx.Tx, user *models.User, verifiedAt time.Time) (int64, error) {
+	query := "INSERT INTO `user` (username, name, last_name, email, hashed_password, email_verified_at, date_created, date_updated) " +
+		"VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())"
+
+	result, err := tx.Exec(query, user.Username, user.FirstName, user.LastName, user.Email, user.HashedPassword, verifiedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// AnonymizeUser replaces a deleted user's personal data with placeholders. The
+// row is kept so orders still reference it.
+func (r *UserRepository) AnonymizeUser(tx *sqlx.Tx, id int, hashedPassword string, deletedAt time.Time) error {
+	placeholder := fmt.Sprintf("deleted-%d", id)
+	_, err := tx.Exec(
+		"UPDATE `user` SET username = ?, name = ?, last_name = ?, email = ?, hashed_password = ?, "+
+			"email_verified_at = NULL, deleted_at = ?, date_updated = NOW() WHERE id = ?",
+		placeholder, "Deleted", "User", placeholder+"@deleted.invalid", hashedPassword, deletedAt.UTC(), id,
+	)
+	return err
+}
+
+// UsernameExists reports whether any user already has the username.
+func (r *UserRepository) UsernameExists(username string) (bool, error) {
+	var count int
+	if err := r.db.Get(&count, "SELECT COUNT(*) FROM `user` WHERE username = ?", username); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UpdateUser updates provided fields for a user inside a transaction.
+func (r *UserRepository) UpdateUser(tx *sqlx.Tx, id int, updates map[string]interface{}) error {
 	if len(updates) == 0 {
 		return errors.New("no fields to update")
 	}
@@ -49,7 +86,7 @@ func (r *UserRepository) UpdateUser(id int, updates map[string]interface{}) erro
 	query := fmt.Sprintf("UPDATE `user` SET %s WHERE id = ?", strings.Join(setClauses, ", "))
 	args = append(args, id)
 
-	result, err := r.db.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		return err
 	}
@@ -66,54 +103,65 @@ func (r *UserRepository) UpdateUser(id int, updates map[string]interface{}) erro
 	return nil
 }
 
+// UpdatePassword replaces a user's password hash inside a transaction.
+func (r *UserRepository) UpdatePassword(tx *sqlx.Tx, id int, hashedPassword string) error {
+	_, err := tx.Exec("UPDATE `user` SET hashed_password = ?, date_updated = NOW() WHERE id = ?", hashedPassword, id)
+	return err
+}
+
+// MarkEmailVerified records when the user proved they own their email address.
+func (r *UserRepository) MarkEmailVerified(tx *sqlx.Tx, id int, verifiedAt time.Time) error {
+	_, err := tx.Exec("UPDATE `user` SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", verifiedAt, id)
+	return err
+}
+
 // GetUserByID fetches a single user by ID.
 func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
-	query := "SELECT id, username, name, last_name, email, hashed_password, date_created, date_updated FROM `user` WHERE id = ?"
-
-	var user models.User
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.HashedPassword,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
+	query := "SELECT id, username, name, last_name, email, hashed_password, email_verified_at, date_created, date_updated FROM `user` WHERE id = ?"
+	return r.scanUser(query, id)
+}
 
-	return &user, nil
+// GetUserForUpdate fetches and locks a user inside a transaction.
+func (r *UserRepository) GetUserForUpdate(tx *sqlx.Tx, id int) (*models.User, error) {
+	query := "SELECT id, username, name, last_name, email, hashed_password, email_verified_at, date_created, date_updated FROM `user` WHERE id = ? FOR UPDATE"
+	return scanUserRow(tx.QueryRow(query, id))
 }
 
 // GetUserByEmail fetches a user by email.
 func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
-	query := "SELECT id, username, name, last_name, email, hashed_password, date_created, date_updated FROM `user` WHERE email = ?"
+	query := "SELECT id, username, name, last_name, email, hashed_password, email_verified_at, date_created, date_updated FROM `user` WHERE email = ?"
 	return r.scanUser(query, email)
 }
 
 // GetUserByUsername fetches a user by username.
 func (r *UserRepository) GetUserByUsername(username string) (*models.User, error) {
-	query := "SELECT id, username, name, last_name, email, hashed_password, date_created, date_updated FROM `user` WHERE username = ?"
+	query := "SELECT id, username, name, last_name, email, hashed_password, email_verified_at, date_created, date_updated FROM `user` WHERE username = ?"
 	return r.scanUser(query, username)
 }
 
 func (r *UserRepository) scanUser(query string, arg interface{}) (*models.User, error) {
+	return scanUserRow(r.db.QueryRow(query, arg))
+}
+
+func scanUserRow(row rowScanner) (*models.User, error) {
 	var user models.User
-	err := r.db.QueryRow(query, arg).Scan(
+	var emailVerifiedAt sql.NullTime
+	err := row.Scan(
 		&user.ID,
 		&user.Username,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
 		&user.HashedPassword,
+		&emailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
 	return &user, nil
 }
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+)
+
+// User token purposes
+const (
+	TokenPasswordReset = "PASSWORD_RESET"
+	TokenEmailVerify   = "EMAIL_VERIFY"
+	// Issued after a correct password when the second factor is still pending
+	TokenMFAChallenge = "MFA_CHALLENGE"
+	TokenMFAEnroll    = "MFA_ENROLL"
+)
+
+type UserTokenRepository struct {
+	db *db.DB
+}
+
+func NewUserTokenRepository(db *db.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+// CreateToken stores the hash of a newly issued token
+func (r *UserTokenRepository) CreateToken(tx *sqlx.Tx, userID int, purpose string, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO user_token (user_id, purpose, token_hash, expires_at)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err := tx.Exec(query, userID, purpose, tokenHash, expiresAt.UTC())
+	return err
+}
+
+// InvalidateTokens marks every outstanding token of a purpose as used, so only
+// the most recently issued link works
+func (r *UserTokenRepository) InvalidateTokens(tx *sqlx.Tx, userID int, purpose string, now time.Time) error {
+	_, err := tx.Exec(
+		"UPDATE user_token SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		now.UTC(), userID, purpose,
+	)
+	return err
+}
+
+// DeleteUserTokens removes every token of a user, of any purpose
+func (r *UserTokenRepository) DeleteUserTokens(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec("DELETE FROM user_token WHERE user_id = ?", userID)
+	return err
+}
+
+// ConsumeToken locks an unused, unexpired token and marks it used. It returns
+// sql.ErrNoRows when the token is unknown, expired or already used.
+func (r *UserTokenRepository) ConsumeToken(tx *sqlx.Tx, purpose string, tokenHash string, now time.Time) (*models.UserToken, error) {
+	token, err := r.GetActiveTokenForUpdate(tx, purpose, tokenHash, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.MarkTokenUsed(tx, token.ID, now); err != nil {
+		return nil, err
+	}
+	usedAt := now.UTC()
+	token.UsedAt = &usedAt
+
+	return token, nil
+}
+
+// GetActiveToken fetches an unused, unexpired token without consuming it
+func (r *UserTokenRepository) GetActiveToken(purpose string, tokenHash string, now time.Time) (*models.UserToken, error) {
+	return scanUserToken(r.db.QueryRow(activeTokenQuery, tokenHash, purpose, now.UTC()))
+}
+
+// GetActiveTokenForUpdate locks an unused, unexpired token, for flows that only
+// consume it once a further check (e.g. an MFA code) succeeds
+func (r *UserTokenRepository) GetActiveTokenForUpdate(tx *sqlx.Tx, purpose string, tokenHash string, now time.Time) (*models.UserToken, error) {
+	return scanUserToken(tx.QueryRow(activeTokenQuery+" FOR UPDATE", tokenHash, purpose, now.UTC()))
+}
+
+// MarkTokenUsed consumes a token
+func (r *UserTokenRepository) MarkTokenUsed(tx *sqlx.Tx, id int, now time.Time) error {
+	_, err := tx.Exec("UPDATE user_token SET used_at = ? WHERE id = ?", now.UTC(), id)
+	return err
+}
+
+const activeTokenQuery = `
+	SELECT id, user_id, purpose, token_hash, expires_at, created_at
+	FROM user_token
+	WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`
+
+func scanUserToken(row rowScanner) (*models.UserToken, error) {
+	var token models.UserToken
+	var createdAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if createdAt.Valid {
+		token.CreatedAt = &createdAt.Time
+	}
+
+	return &token, nil
+}
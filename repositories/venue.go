@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/timezone"
+)
+
+// venueTimeZone selects the zone of the venue aliased v, UTC when there is
+// no venue
+const venueTimeZone = "COALESCE(v.time_zone, '" + timezone.Default + "')"
+
+type VenueRepository struct {
+	db *db.DB
+}
+
+func NewVenueRepository(db *db.DB) *VenueRepository {
+	return &VenueRepository{db: db}
+}
+
+// GetVenueBySlug fetches a venue and its dates from now on, earliest first.
+// Returns sql.ErrNoRows if no venue has the slug.
+func (r *VenueRepository) GetVenueBySlug(slug string) (*models.VenueDetailResponse, error) {
+	var venue models.VenueDetailResponse
+	var name, description, venueSlug, venueType sql.NullString
+	var capacity sql.NullInt64
+	var accessible sql.NullBool
+	err := r.db.QueryRow(`
+		SELECT id, slug, name, description, capacity, venue_type, accessible_weelchair, time_zone
+		FROM venue
+		WHERE slug = ?
+	`, slug).Scan(&venue.ID, &venueSlug, &name, &description, &capacity, &venueType, &accessible, &venue.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	venue.Slug = venueSlug.String
+	venue.Name = name.String
+	venue.Description = description.String
+	venue.Capacity = int(capacity.Int64)
+	venue.VenueType = venueType.String
+	venue.AccessibleWheelchair = accessible.Bool
+
+	rows, err := r.db.Query(`
+		SELECT ed.id, ed.date, ed.doors_open_at, ed.ends_at, ed.seating_mode, ed.status, e.id, e.slug, e.title, e.description,
+			`+eventDateMinPrice+`, `+eventDateAvailable+`
+		FROM event_date ed
+		INNER JOIN event e ON e.id = ed.event_id
+		WHERE CAST(ed.id_venue AS UNSIGNED) = ? AND ed.date >= ? AND ed.status <> 'DRAFT'
+		ORDER BY ed.date, ed.id
+	`, venue.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	venue.UpcomingDates = []*models.VenueDateItem{}
+	for rows.Next() {
+		var item models.VenueDateItem
+		var event models.EventInfo
+		var date, doorsOpen, endsAt sql.NullTime
+		var seatingMode, eventSlug, title, eventDescription sql.NullString
+		var minPrice sql.NullFloat64
+		var available bool
+		if err := rows.Scan(&item.ID, &date, &doorsOpen, &endsAt, &seatingMode, &item.Status, &event.ID, &eventSlug, &title, &eventDescription, &minPrice, &available); err != nil {
+			return nil, err
+		}
+
+		event.Slug = eventSlug.String
+		event.Title = title.String
+		event.Description = eventDescription.String
+		item.Event = &event
+		item.SeatingMode = seatingMode.String
+		item.SoldOut = !available || item.Status == EventDateSoldOut
+		item.Date = formatLocal(date, venue.TimeZone)
+		item.DoorsOpen = formatLocal(doorsOpen, venue.TimeZone)
+		item.EndsAt = formatLocal(endsAt, venue.TimeZone)
+		if minPrice.Valid {
+			price := minPrice.Float64
+			item.MinPrice = &price
+		}
+		venue.UpcomingDates = append(venue.UpcomingDates, &item)
+	}
+
+	return &venue, rows.Err()
+}
+
+// GetTimeZone returns the IANA zone of the venue, or sql.ErrNoRows if there is
+// no such venue
+func (r *VenueRepository) GetTimeZone(id int) (string, error) {
+	var zone string
+	err := r.db.QueryRow("SELECT time_zone FROM venue WHERE id = ?", id).Scan(&zone)
+	return zone, err
+}
+
+func (r *VenueRepository) UpdateTimeZone(tx *sqlx.Tx, id int, zone string) error {
+	_, err := tx.Exec("UPDATE venue SET time_zone = ? WHERE id = ?", zone, id)
+	return err
+}
+
+// localTime puts a stored UTC instant on the wall clock of zone
+func localTime(value sql.NullTime, zone string) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	local := timezone.In(value.Time, zone)
+	return &local
+}
+
+// formatLocal is localTime as RFC3339, with the zone's offset, or "" for NULL
+func formatLocal(value sql.NullTime, zone string) string {
+	if !value.Valid {
+		return ""
+	}
+	return timezone.In(value.Time, zone).Format(time.RFC3339)
+}
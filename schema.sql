@@ -36,6 +36,8 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`user` (
   `last_name` VARCHAR(45) NOT NULL,
   `email` VARCHAR(255) NOT NULL,
   `hashed_password` VARCHAR(255) NOT NULL,
+  `email_verified_at` DATETIME NULL,
+  `deleted_at` DATETIME NULL,
   `date_created` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `date_updated` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`),
@@ -44,6 +46,257 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`user` (
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`user_token`
+-- Single-use account tokens (password reset, email verification, MFA login
+-- challenges), stored hashed
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`user_token` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`user_token` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `purpose` ENUM('PASSWORD_RESET', 'EMAIL_VERIFY', 'MFA_CHALLENGE', 'MFA_ENROLL') NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  `used_at` DATETIME NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_user_token_hash` (`token_hash` ASC) VISIBLE,
+  INDEX `idx_user_token_user_purpose` (`user_id` ASC, `purpose` ASC) VISIBLE,
+  CONSTRAINT `fk_user_token_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`user_identity`
+-- External OpenID Connect accounts (social login) linked to users
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`user_identity` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`user_identity` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `provider` VARCHAR(45) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `email` VARCHAR(255) NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_login_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_user_identity_provider_subject` (`provider` ASC, `subject` ASC) VISIBLE,
+  INDEX `fk_user_identity_user1_idx` (`user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_user_identity_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`oidc_auth_request`
+-- Social logins in progress: PKCE verifier and nonce, keyed by the hashed
+-- state. Rows are deleted on callback or once expired.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`oidc_auth_request` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`oidc_auth_request` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `state_hash` CHAR(64) NOT NULL,
+  `provider` VARCHAR(45) NOT NULL,
+  `code_verifier` VARCHAR(128) NOT NULL,
+  `nonce` VARCHAR(128) NOT NULL,
+  `redirect_uri` VARCHAR(512) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_oidc_auth_request_state` (`state_hash` ASC) VISIBLE,
+  INDEX `idx_oidc_auth_request_expires` (`expires_at` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`data_export`
+-- Personal data exports, generated in the background. The archive is kept
+-- until expires_at and then dropped.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`data_export` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`data_export` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `format` ENUM('JSON', 'ZIP') NOT NULL,
+  `status` ENUM('PENDING', 'RUNNING', 'READY', 'FAILED', 'EXPIRED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `lease_until` DATETIME NULL,
+  `last_error` TEXT NULL,
+  `file_name` VARCHAR(255) NULL,
+  `content_type` VARCHAR(100) NULL,
+  `size_bytes` INT NULL,
+  `data` LONGBLOB NULL,
+  `requested_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completed_at` DATETIME NULL,
+  `expires_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_data_export_status` (`status` ASC, `requested_at` ASC) VISIBLE,
+  INDEX `fk_data_export_user1_idx` (`user_id` ASC, `requested_at` ASC) VISIBLE,
+  CONSTRAINT `fk_data_export_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`user_mfa`
+-- TOTP second factor. The secret is encrypted with a key derived from
+-- AUTH_SECRET; confirmed_at stays NULL until the first code is verified.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`user_mfa` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`user_mfa` (
+  `user_id` INT NOT NULL,
+  `totp_secret` VARCHAR(255) NOT NULL,
+  `confirmed_at` DATETIME NULL,
+  `last_used_step` BIGINT NOT NULL DEFAULT 0,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `fk_user_mfa_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`user_recovery_code`
+-- One-time MFA recovery codes, stored hashed
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`user_recovery_code` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`user_recovery_code` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `code_hash` CHAR(64) NOT NULL,
+  `used_at` DATETIME NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_user_recovery_code` (`user_id` ASC, `code_hash` ASC) VISIBLE,
+  CONSTRAINT `fk_user_recovery_code_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`user_session`
+-- One row per login; revoking it ends access and refresh for that device
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`user_session` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`user_session` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `user_agent` VARCHAR(255) NULL,
+  `ip_address` VARCHAR(45) NULL,
+  `created_at` DATETIME NOT NULL,
+  `last_used_at` DATETIME NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  `revoked_at` DATETIME NULL,
+  `revoke_reason` VARCHAR(32) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_user_session_user_active` (`user_id` ASC, `revoked_at` ASC, `expires_at` ASC) VISIBLE,
+  CONSTRAINT `fk_user_session_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`session_refresh_token`
+-- Every refresh token issued for a session, hashed. Rotated tokens are kept
+-- so that presenting one again is detected as reuse.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`session_refresh_token` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`session_refresh_token` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `session_id` INT NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `created_at` DATETIME NOT NULL,
+  `rotated_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uniq_session_refresh_token_hash` (`token_hash` ASC) VISIBLE,
+  INDEX `fk_session_refresh_token_session1_idx` (`session_id` ASC) VISIBLE,
+  CONSTRAINT `fk_session_refresh_token_session1`
+    FOREIGN KEY (`session_id`)
+    REFERENCES `ticketbooth`.`user_session` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`audit_log`
+-- Append-only record of state changes, written in the same transaction as the
+-- change. actor_user_id has no foreign key so entries outlive their actors.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`audit_log` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`audit_log` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `actor_user_id` INT NULL,
+  `action` VARCHAR(64) NOT NULL,
+  `entity_type` VARCHAR(45) NOT NULL,
+  `entity_id` VARCHAR(64) NOT NULL,
+  `before_data` JSON NULL,
+  `after_data` JSON NULL,
+  `request_id` VARCHAR(100) NULL,
+  `ip_address` VARCHAR(45) NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_audit_log_entity` (`entity_type` ASC, `entity_id` ASC, `id` ASC) VISIBLE,
+  INDEX `idx_audit_log_actor` (`actor_user_id` ASC, `id` ASC) VISIBLE,
+  INDEX `idx_audit_log_action` (`action` ASC, `id` ASC) VISIBLE,
+  INDEX `idx_audit_log_created` (`created_at` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`login_lockout`
+-- Audit trail of temporary login lockouts, per account or client IP
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`login_lockout` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`login_lockout` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `scope` ENUM('ACCOUNT', 'IP') NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `user_id` INT NULL,
+  `ip_address` VARCHAR(45) NULL,
+  `failures` INT NOT NULL,
+  `locked_until` DATETIME NOT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_login_lockout_created` (`created_at` ASC) VISIBLE,
+  INDEX `fk_login_lockout_user1_idx` (`user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_login_lockout_user1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
 -- -----------------------------------------------------
 -- Table `ticketbooth`.`ticket_type`
 -- -----------------------------------------------------
@@ -71,9 +324,16 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`event` (
   `slug` VARCHAR(45) NULL,
   `title` VARCHAR(200) NULL,
   `description` VARCHAR(500) NULL,
+  `organizer_id` INT NULL,
   PRIMARY KEY (`id`),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC) VISIBLE,
-  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC) VISIBLE)
+  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC) VISIBLE,
+  INDEX `fk_event_organizer1_idx` (`organizer_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_organizer1`
+    FOREIGN KEY (`organizer_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
 ENGINE = InnoDB;
 
 
@@ -88,7 +348,18 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_date` (
   `tota_tickets` INT NULL,
   `event_id` INT NOT NULL,
   `seating_mode` ENUM('GA', 'SEATED') NULL,
+  -- date, doors_open_at and ends_at are UTC instants; they are shown in the
+  -- venue's time_zone
   `date` DATETIME NULL,
+  `doors_open_at` DATETIME NULL,
+  `ends_at` DATETIME NULL,
+  -- Bookings need ON_SALE and now inside [sales_open_at, sales_close_at); a
+  -- NULL open is immediate and a NULL close is the start time
+  `status` ENUM('DRAFT', 'ON_SALE', 'PAUSED', 'SOLD_OUT', 'CANCELLED', 'POSTPONED', 'COMPLETED') NOT NULL DEFAULT 'ON_SALE',
+  `status_reason` VARCHAR(500) NULL,
+  `status_changed_at` DATETIME NULL,
+  `sales_open_at` DATETIME NULL,
+  `sales_close_at` DATETIME NULL,
   PRIMARY KEY (`id`),
   INDEX `fk_event_date_event1_idx` (`event_id` ASC) VISIBLE,
   CONSTRAINT `fk_event_date_event1`
@@ -112,8 +383,11 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`venue` (
   `capacity` INT NULL,
   `venue_type` VARCHAR(45) NULL,
   `accessible_weelchair` TINYINT NULL,
+  -- IANA zone name, such as America/Mexico_City
+  `time_zone` VARCHAR(64) NOT NULL DEFAULT 'UTC',
   PRIMARY KEY (`id`),
-  UNIQUE INDEX `id_UNIQUE` (`id` ASC) VISIBLE)
+  UNIQUE INDEX `id_UNIQUE` (`id` ASC) VISIBLE,
+  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC) VISIBLE)
 ENGINE = InnoDB;
 
 
@@ -184,15 +458,27 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`ticket` (
   `user_id` VARCHAR(45) NULL,
   `ticket_type_id` INT NOT NULL,
   `to_name` VARCHAR(255) NULL,
+  `to_email` VARCHAR(255) NULL,
   `event_date_id` INT NOT NULL,
   `seat_id` INT,
+  `price` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `credential_nonce` VARCHAR(32) NULL,
+  `admitted_at` DATETIME NULL,
+  `admitted_gate` VARCHAR(45) NULL,
+  `admitted_device` VARCHAR(100) NULL,
+  `refunded_at` DATETIME NULL,
+  `inventory_released_at` DATETIME NULL,
+  -- The seat while the ticket still holds it; NULL once released back to sale
+  `held_seat_id` INT AS (IF(`inventory_released_at` IS NULL, `seat_id`, NULL)) STORED,
 PRIMARY KEY (`id`),
 UNIQUE INDEX `id_UNIQUE` (`id` ASC) VISIBLE,
 INDEX `fk_ticket_ticket_type1_idx` (`ticket_type_id` ASC) VISIBLE,
 INDEX `fk_ticket_event_date1_idx` (`event_date_id` ASC) VISIBLE,
+INDEX `fk_ticket_event_date_has_seat1_idx` (`event_date_id`, `seat_id`) VISIBLE,
 
--- This unique index enforces one ticket per (event_date, seat)
-UNIQUE INDEX `uniq_ticket_eventdate_seat` (`event_date_id`, `seat_id`) VISIBLE,
+-- This unique index enforces one held ticket per (event_date, seat); a seat
+-- released by a refund can be sold again
+UNIQUE INDEX `uniq_ticket_eventdate_seat` (`event_date_id`, `held_seat_id`) VISIBLE,
 
 CONSTRAINT `fk_ticket_ticket_type1`
   FOREIGN KEY (`ticket_type_id`)
@@ -214,6 +500,65 @@ CONSTRAINT `fk_ticket_event_date_has_seat1`
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_signing_key`
+-- Per-event Ed25519 keys for ticket credentials. private_key is the random
+-- seed, encrypted with a key derived from TICKET_SIGNING_SECRET
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`event_signing_key` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_signing_key` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `event_id` INT NOT NULL,
+  `version` INT NOT NULL,
+  `key_id` VARCHAR(45) NOT NULL,
+  `public_key` VARCHAR(64) NOT NULL,
+  `private_key` VARCHAR(255) NULL,
+  `status` ENUM('ACTIVE', 'RETIRED', 'REVOKED') NOT NULL DEFAULT 'ACTIVE',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `retired_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `key_id_UNIQUE` (`key_id` ASC) VISIBLE,
+  UNIQUE INDEX `uniq_signing_key_event_version` (`event_id` ASC, `version` ASC) VISIBLE,
+  CONSTRAINT `fk_event_signing_key_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `ticketbooth`.`event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`ticket_scan`
+-- Append-only log of every door scan, live or synced from an offline device
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`ticket_scan` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`ticket_scan` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `ticket_id` INT NULL,
+  `event_date_id` INT NOT NULL,
+  `gate` VARCHAR(45) NOT NULL,
+  `device_id` VARCHAR(100) NOT NULL,
+  `client_scan_id` VARCHAR(100) NULL,
+  `source` ENUM('ONLINE', 'OFFLINE') NOT NULL,
+  `result` VARCHAR(32) NOT NULL,
+  `conflict` TINYINT NOT NULL DEFAULT 0,
+  `scanned_at` DATETIME NOT NULL,
+  `received_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_ticket_scan_ticket1_idx` (`ticket_id` ASC) VISIBLE,
+  INDEX `idx_ticket_scan_event_date` (`event_date_id` ASC, `scanned_at` ASC) VISIBLE,
+  -- Makes re-uploading the same offline batch idempotent
+  UNIQUE INDEX `uniq_ticket_scan_device_client` (`device_id` ASC, `client_scan_id` ASC) VISIBLE,
+  CONSTRAINT `fk_ticket_scan_ticket1`
+    FOREIGN KEY (`ticket_id`)
+    REFERENCES `ticketbooth`.`ticket` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
 -- -----------------------------------------------------
 -- Table `ticketbooth`.`venue_types`
 -- -----------------------------------------------------
@@ -282,25 +627,211 @@ ENGINE = InnoDB;
 
 
 -- -----------------------------------------------------
--- Table `ticketbooth`.`event_has_venue_has_venue_types`
+-- Table `ticketbooth`.`category`
+-- Catalog categories such as music, theatre or sports
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`category` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`category` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `slug` VARCHAR(45) NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_has_category`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`event_has_category` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_has_category` (
+  `event_id` INT NOT NULL,
+  `category_id` INT NOT NULL,
+  PRIMARY KEY (`event_id`, `category_id`),
+  INDEX `fk_event_has_category_category1_idx` (`category_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_has_category_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `ticketbooth`.`event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_has_category_category1`
+    FOREIGN KEY (`category_id`)
+    REFERENCES `ticketbooth`.`category` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`tag`
+-- Free-form event tags, stored lower-case
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`tag` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`tag` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(45) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `name_UNIQUE` (`name` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_has_tag`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`event_has_tag` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_has_tag` (
+  `event_id` INT NOT NULL,
+  `tag_id` INT NOT NULL,
+  PRIMARY KEY (`event_id`, `tag_id`),
+  INDEX `fk_event_has_tag_tag1_idx` (`tag_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_has_tag_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `ticketbooth`.`event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_has_tag_tag1`
+    FOREIGN KEY (`tag_id`)
+    REFERENCES `ticketbooth`.`tag` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`performer`
+-- Artists, bands, teams and companies that appear at events
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`performer` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`performer` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `slug` VARCHAR(45) NOT NULL,
+  `name` VARCHAR(200) NOT NULL,
+  `description` VARCHAR(500) NULL,
+  `image_url` VARCHAR(500) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `slug_UNIQUE` (`slug` ASC) VISIBLE)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_has_performer`
+-- The event's lineup; billing_order 0 is the headliner
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`event_has_performer` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_has_performer` (
+  `event_id` INT NOT NULL,
+  `performer_id` INT NOT NULL,
+  `billing_order` INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`event_id`, `performer_id`),
+  INDEX `fk_event_has_performer_performer1_idx` (`performer_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_has_performer_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `ticketbooth`.`event` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_has_performer_performer1`
+    FOREIGN KEY (`performer_id`)
+    REFERENCES `ticketbooth`.`performer` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_media`
+-- Images and videos shown with an event, by reference (URL)
 -- -----------------------------------------------------
-DROP TABLE IF EXISTS `ticketbooth`.`event_has_venue_has_venue_types` ;
+DROP TABLE IF EXISTS `ticketbooth`.`event_media` ;
 
-CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_has_venue_has_venue_types` (
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_media` (
+  `id` INT NOT NULL AUTO_INCREMENT,
   `event_id` INT NOT NULL,
-  `venue_has_venue_types_venue_id` INT NOT NULL,
-  `venue_has_venue_types_venue_types_id` INT NOT NULL,
-  PRIMARY KEY (`event_id`, `venue_has_venue_types_venue_id`, `venue_has_venue_types_venue_types_id`),
-  INDEX `fk_event_has_venue_has_venue_types_venue_has_venue_types1_idx` (`venue_has_venue_types_venue_id` ASC, `venue_has_venue_types_venue_types_id` ASC) VISIBLE,
-  INDEX `fk_event_has_venue_has_venue_types_event1_idx` (`event_id` ASC) VISIBLE,
-  CONSTRAINT `fk_event_has_venue_has_venue_types_event1`
+  `kind` ENUM('IMAGE', 'VIDEO') NOT NULL,
+  `url` VARCHAR(500) NOT NULL,
+  `alt_text` VARCHAR(255) NULL,
+  `position` INT NOT NULL DEFAULT 0,
+  `created_at` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `fk_event_media_event1_idx` (`event_id` ASC, `position` ASC) VISIBLE,
+  CONSTRAINT `fk_event_media_event1`
     FOREIGN KEY (`event_id`)
     REFERENCES `ticketbooth`.`event` (`id`)
     ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`settlement`
+-- One organizer payout statement for a period. Orders and refunds it covers
+-- point back to it through their settlement_id.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`settlement` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`settlement` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `reference` VARCHAR(45) NULL,
+  `organizer_id` INT NOT NULL,
+  `period_start` DATETIME NOT NULL,
+  `period_end` DATETIME NOT NULL,
+  `order_count` INT NOT NULL DEFAULT 0,
+  `refund_count` INT NOT NULL DEFAULT 0,
+  `gross_sales` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `refunds` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `platform_fees` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `tax` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `net_payout` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `created_by` INT NOT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `reference_UNIQUE` (`reference` ASC) VISIBLE,
+  INDEX `idx_settlement_organizer` (`organizer_id` ASC, `period_end` ASC) VISIBLE,
+  INDEX `fk_settlement_user1_idx` (`created_by` ASC) VISIBLE,
+  CONSTRAINT `fk_settlement_organizer1`
+    FOREIGN KEY (`organizer_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE NO ACTION
     ON UPDATE NO ACTION,
-  CONSTRAINT `fk_event_has_venue_has_venue_types_venue_has_venue_types1`
-    FOREIGN KEY (`venue_has_venue_types_venue_id` , `venue_has_venue_types_venue_types_id`)
-    REFERENCES `ticketbooth`.`venue_has_venue_types` (`venue_id` , `venue_types_id`)
+  CONSTRAINT `fk_settlement_user1`
+    FOREIGN KEY (`created_by`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`settlement_line`
+-- A settlement's totals for one event
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`settlement_line` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`settlement_line` (
+  `settlement_id` INT NOT NULL,
+  `event_id` INT NOT NULL,
+  `order_count` INT NOT NULL DEFAULT 0,
+  `refund_count` INT NOT NULL DEFAULT 0,
+  `gross_sales` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `refunds` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `platform_fees` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `tax` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `net_payout` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`settlement_id`, `event_id`),
+  INDEX `fk_settlement_line_event1_idx` (`event_id` ASC) VISIBLE,
+  CONSTRAINT `fk_settlement_line_settlement1`
+    FOREIGN KEY (`settlement_id`)
+    REFERENCES `ticketbooth`.`settlement` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_settlement_line_event1`
+    FOREIGN KEY (`event_id`)
+    REFERENCES `ticketbooth`.`event` (`id`)
     ON DELETE NO ACTION
     ON UPDATE NO ACTION)
 ENGINE = InnoDB;
@@ -317,14 +848,27 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`order` (
   `total_tickets` INT NULL,
   `amount` VARCHAR(45) NULL,
   `payment_source` VARCHAR(45) NULL,
+  `customer_name` VARCHAR(255) NULL,
+  `customer_email` VARCHAR(255) NULL,
+  `locale` VARCHAR(10) NOT NULL DEFAULT 'en',
+  `refunded_amount` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  -- Set once the order is included in an organizer settlement, which locks it
+  -- against being settled again
+  `settlement_id` INT NULL,
   `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC) VISIBLE,
   INDEX `fk_Order_User1_idx` (`user_id` ASC) VISIBLE,
+  INDEX `idx_order_unsettled` (`settlement_id` ASC, `created_at` ASC) VISIBLE,
   CONSTRAINT `fk_Order_User1`
     FOREIGN KEY (`user_id`)
     REFERENCES `ticketbooth`.`user` (`id`)
     ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_order_settlement1`
+    FOREIGN KEY (`settlement_id`)
+    REFERENCES `ticketbooth`.`settlement` (`id`)
+    ON DELETE NO ACTION
     ON UPDATE NO ACTION)
 ENGINE = InnoDB;
 
@@ -353,6 +897,233 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`order_hast_tickets` (
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`order_refund`
+-- One row per refund issued against an order; an order's refunded_amount is
+-- the sum of its refunds
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`order_refund` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`order_refund` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `order_id` INT NOT NULL,
+  `type` ENUM('FULL', 'TICKETS', 'AMOUNT') NOT NULL,
+  `amount` DECIMAL(19,2) NOT NULL,
+  `reason` VARCHAR(500) NOT NULL,
+  `operator_user_id` INT NOT NULL,
+  `restocked` TINYINT(1) NOT NULL DEFAULT 0,
+  `settlement_id` INT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_order_refund_order1_idx` (`order_id` ASC) VISIBLE,
+  INDEX `fk_order_refund_user1_idx` (`operator_user_id` ASC) VISIBLE,
+  INDEX `fk_order_refund_settlement1_idx` (`settlement_id` ASC) VISIBLE,
+  CONSTRAINT `fk_order_refund_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `ticketbooth`.`order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_order_refund_user1`
+    FOREIGN KEY (`operator_user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_order_refund_settlement1`
+    FOREIGN KEY (`settlement_id`)
+    REFERENCES `ticketbooth`.`settlement` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`order_refund_ticket`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`order_refund_ticket` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`order_refund_ticket` (
+  `refund_id` INT NOT NULL,
+  `ticket_id` INT NOT NULL,
+  PRIMARY KEY (`refund_id`, `ticket_id`),
+  UNIQUE INDEX `uniq_order_refund_ticket` (`ticket_id` ASC) VISIBLE,
+  CONSTRAINT `fk_order_refund_ticket_refund1`
+    FOREIGN KEY (`refund_id`)
+    REFERENCES `ticketbooth`.`order_refund` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_order_refund_ticket_ticket1`
+    FOREIGN KEY (`ticket_id`)
+    REFERENCES `ticketbooth`.`ticket` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_date_change`
+-- A cancellation or postponement run; the worker refunds or notifies each
+-- event_date_change_order row, marking it in the same transaction
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`event_date_change` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_date_change` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `event_date_id` INT NOT NULL,
+  `kind` ENUM('CANCEL', 'POSTPONE') NOT NULL,
+  `reason` VARCHAR(500) NOT NULL,
+  `previous_date` DATETIME NULL,
+  `new_date` DATETIME NULL,
+  -- Until when holders of a postponed date may ask for a refund
+  `refund_deadline` DATETIME NULL,
+  `operator_user_id` INT NOT NULL,
+  `status` ENUM('PENDING', 'RUNNING', 'COMPLETED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  -- Until when a worker holds a RUNNING change, or when a PENDING one that
+  -- still has orders to retry is next due
+  `lease_until` DATETIME NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `completed_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_event_date_change_status` (`status` ASC, `created_at` ASC) VISIBLE,
+  INDEX `fk_event_date_change_event_date1_idx` (`event_date_id` ASC, `kind` ASC) VISIBLE,
+  INDEX `fk_event_date_change_user1_idx` (`operator_user_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_date_change_event_date1`
+    FOREIGN KEY (`event_date_id`)
+    REFERENCES `ticketbooth`.`event_date` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_date_change_user1`
+    FOREIGN KEY (`operator_user_id`)
+    REFERENCES `ticketbooth`.`user` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`event_date_change_order`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`event_date_change_order` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`event_date_change_order` (
+  `change_id` INT NOT NULL,
+  `order_id` INT NOT NULL,
+  `status` ENUM('PENDING', 'DONE', 'SKIPPED', 'FAILED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `last_error` TEXT NULL,
+  `refund_id` INT NULL,
+  `refund_amount` DECIMAL(19,2) NULL,
+  `processed_at` DATETIME NULL,
+  PRIMARY KEY (`change_id`, `order_id`),
+  INDEX `idx_event_date_change_order_status` (`change_id` ASC, `status` ASC, `order_id` ASC) VISIBLE,
+  INDEX `fk_event_date_change_order_order1_idx` (`order_id` ASC) VISIBLE,
+  CONSTRAINT `fk_event_date_change_order_change1`
+    FOREIGN KEY (`change_id`)
+    REFERENCES `ticketbooth`.`event_date_change` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_date_change_order_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `ticketbooth`.`order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_event_date_change_order_refund1`
+    FOREIGN KEY (`refund_id`)
+    REFERENCES `ticketbooth`.`order_refund` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`ledger_transaction`
+-- Double-entry ledger: one transaction per sale or refund, written in the
+-- same database transaction as the order or refund. Append-only.
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`ledger_transaction` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`ledger_transaction` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `kind` ENUM('SALE', 'REFUND') NOT NULL,
+  `order_id` INT NOT NULL,
+  `refund_id` INT NULL,
+  `event_id` INT NOT NULL,
+  `memo` VARCHAR(255) NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_ledger_transaction_order1_idx` (`order_id` ASC) VISIBLE,
+  INDEX `fk_ledger_transaction_refund1_idx` (`refund_id` ASC) VISIBLE,
+  INDEX `idx_ledger_transaction_event` (`event_id` ASC, `created_at` ASC) VISIBLE,
+  INDEX `idx_ledger_transaction_created` (`created_at` ASC) VISIBLE,
+  CONSTRAINT `fk_ledger_transaction_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `ticketbooth`.`order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_ledger_transaction_refund1`
+    FOREIGN KEY (`refund_id`)
+    REFERENCES `ticketbooth`.`order_refund` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`ledger_entry`
+-- One debit or credit; a transaction's debits always equal its credits
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`ledger_entry` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`ledger_entry` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `transaction_id` BIGINT NOT NULL,
+  `account` ENUM('CUSTOMER_RECEIVABLE', 'ORGANIZER_PAYABLE', 'PLATFORM_FEES', 'TAX_PAYABLE', 'REFUNDS') NOT NULL,
+  `debit` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  `credit` DECIMAL(19,2) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  INDEX `fk_ledger_entry_transaction1_idx` (`transaction_id` ASC) VISIBLE,
+  INDEX `idx_ledger_entry_account` (`account` ASC) VISIBLE,
+  CONSTRAINT `chk_ledger_entry_one_side` CHECK (`debit` >= 0 AND `credit` >= 0 AND (`debit` = 0) <> (`credit` = 0)),
+  CONSTRAINT `fk_ledger_entry_transaction1`
+    FOREIGN KEY (`transaction_id`)
+    REFERENCES `ticketbooth`.`ledger_transaction` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `ticketbooth`.`email_outbox`
+-- Transactional emails, written in the same transaction as the change that
+-- triggered them and delivered by the email worker
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `ticketbooth`.`email_outbox` ;
+
+CREATE TABLE IF NOT EXISTS `ticketbooth`.`email_outbox` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `template` VARCHAR(64) NOT NULL,
+  `locale` VARCHAR(10) NOT NULL,
+  `to_email` VARCHAR(255) NOT NULL,
+  `to_name` VARCHAR(255) NULL,
+  `order_id` INT NULL,
+  `payload` JSON NOT NULL,
+  `status` ENUM('PENDING', 'SENT', 'FAILED') NOT NULL DEFAULT 'PENDING',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt_at` DATETIME NOT NULL,
+  `last_error` TEXT NULL,
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `sent_at` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_email_outbox_due` (`status` ASC, `next_attempt_at` ASC) VISIBLE,
+  INDEX `fk_email_outbox_order1_idx` (`order_id` ASC) VISIBLE,
+  CONSTRAINT `fk_email_outbox_order1`
+    FOREIGN KEY (`order_id`)
+    REFERENCES `ticketbooth`.`order` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
 -- -----------------------------------------------------
 -- Table `ticketbooth`.`role`
 -- -----------------------------------------------------
@@ -429,6 +1200,57 @@ CREATE TABLE IF NOT EXISTS `ticketbooth`.`role_has_permission` (
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Triggers `audit_log_no_update`, `audit_log_no_delete`
+-- Reject any change to audit_log rows once written
+-- -----------------------------------------------------
+DROP TRIGGER IF EXISTS `ticketbooth`.`audit_log_no_update`;
+DROP TRIGGER IF EXISTS `ticketbooth`.`audit_log_no_delete`;
+DELIMITER $$
+CREATE TRIGGER `ticketbooth`.`audit_log_no_update` BEFORE UPDATE ON `ticketbooth`.`audit_log`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+END$$
+
+CREATE TRIGGER `ticketbooth`.`audit_log_no_delete` BEFORE DELETE ON `ticketbooth`.`audit_log`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+END$$
+DELIMITER ;
+
+DROP TRIGGER IF EXISTS `ticketbooth`.`ledger_transaction_no_update`;
+DROP TRIGGER IF EXISTS `ticketbooth`.`ledger_transaction_no_delete`;
+DROP TRIGGER IF EXISTS `ticketbooth`.`ledger_entry_no_update`;
+DROP TRIGGER IF EXISTS `ticketbooth`.`ledger_entry_no_delete`;
+DELIMITER $$
+CREATE TRIGGER `ticketbooth`.`ledger_transaction_no_update` BEFORE UPDATE ON `ticketbooth`.`ledger_transaction`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+
+CREATE TRIGGER `ticketbooth`.`ledger_transaction_no_delete` BEFORE DELETE ON `ticketbooth`.`ledger_transaction`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+
+CREATE TRIGGER `ticketbooth`.`ledger_entry_no_update` BEFORE UPDATE ON `ticketbooth`.`ledger_entry`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+
+CREATE TRIGGER `ticketbooth`.`ledger_entry_no_delete` BEFORE DELETE ON `ticketbooth`.`ledger_entry`
+FOR EACH ROW
+BEGIN
+  SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END$$
+DELIMITER ;
+
+
 -- -----------------------------------------------------
 -- Stored Procedure `sp_reserve_ga_tickets`
 -- Provides transactional reservation semantics for GA inventory
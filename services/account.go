@@ -0,0 +1,423 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	// recentLoginWindow is how fresh a session must be to delete an account
+	// that has no password to confirm
+	recentLoginWindow = 10 * time.Minute
+	// deletedHolderName replaces the holder and purchaser names on a deleted
+	// user's tickets and orders
+	deletedHolderName = "Deleted user"
+)
+
+var (
+	ErrInvalidToken             = errors.New("INVALID_TOKEN")
+	ErrInvalidPassword          = errors.New("INVALID_PASSWORD")
+	ErrReauthenticationRequired = errors.New("REAUTHENTICATION_REQUIRED")
+)
+
+// AccountService handles account recovery, email verification, password
+// changes and account deletion. Tokens are random, sent only by email, stored
+// as SHA-256 hashes and usable once.
+type AccountService struct {
+	db            *db.DB
+	userRepo      *repositories.UserRepository
+	tokenRepo     *repositories.UserTokenRepository
+	sessionRepo   *repositories.SessionRepository
+	ticketRepo    *repositories.TicketRepository
+	bookingRepo   *repositories.BookingRepository
+	outboxRepo    *repositories.OutboxRepository
+	exportRepo    *repositories.DataExportRepository
+	mfaRepo       *repositories.MFARepository
+	identityRepo  *repositories.IdentityRepository
+	roleRepo      *repositories.RoleRepository
+	notifications *NotificationService
+	audit         *AuditService
+	authSecret    string
+	appBaseURL    string
+}
+
+func NewAccountService(
+	db *db.DB,
+	userRepo *repositories.UserRepository,
+	tokenRepo *repositories.UserTokenRepository,
+	sessionRepo *repositories.SessionRepository,
+	ticketRepo *repositories.TicketRepository,
+	bookingRepo *repositories.BookingRepository,
+	outboxRepo *repositories.OutboxRepository,
+	exportRepo *repositories.DataExportRepository,
+	mfaRepo *repositories.MFARepository,
+	identityRepo *repositories.IdentityRepository,
+	roleRepo *repositories.RoleRepository,
+	notifications *NotificationService,
+	audit *AuditService,
+	authSecret string,
+	appBaseURL string,
+) *AccountService {
+	return &AccountService{
+		db:            db,
+		userRepo:      userRepo,
+		tokenRepo:     tokenRepo,
+		sessionRepo:   sessionRepo,
+		ticketRepo:    ticketRepo,
+		bookingRepo:   bookingRepo,
+		outboxRepo:    outboxRepo,
+		exportRepo:    exportRepo,
+		mfaRepo:       mfaRepo,
+		identityRepo:  identityRepo,
+		roleRepo:      roleRepo,
+		notifications: notifications,
+		audit:         audit,
+		authSecret:    authSecret,
+		appBaseURL:    strings.TrimRight(appBaseURL, "/"),
+	}
+}
+
+// HashPassword hashes a password with the server auth secret
+func HashPassword(authSecret string, password string) string {
+	sum := sha256.Sum256([]byte(authSecret + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to an account.
+// Unknown addresses succeed silently so the endpoint cannot be used to probe accounts.
+func (s *AccountService) RequestPasswordReset(email string, locale string) error {
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		token, expiresAt, err := s.issueToken(tx, user.ID, repositories.TokenPasswordReset, passwordResetTTL)
+		if err != nil {
+			return err
+		}
+
+		return s.notifications.Queue(tx, &Email{
+			Template: EmailPasswordReset,
+			Locale:   locale,
+			ToEmail:  user.Email,
+			ToName:   user.FirstName,
+			Data: &PasswordResetEmail{
+				Name:      user.FirstName,
+				ResetURL:  s.link("/reset-password", token),
+				ExpiresAt: &expiresAt,
+			},
+		})
+	})
+}
+
+// ResetPassword consumes a reset token and sets the new password. Following the
+// emailed link proves ownership of the address, so the email is marked verified.
+// Every existing session is revoked, logging out whoever knew the old password.
+func (s *AccountService) ResetPassword(token string, newPassword string, actor *models.AuditActor) (*models.User, error) {
+	var userID int
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		consumed, err := s.tokenRepo.ConsumeToken(tx, repositories.TokenPasswordReset, hashToken(token), now)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		userID = consumed.UserID
+
+		if err := s.userRepo.UpdatePassword(tx, userID, HashPassword(s.authSecret, newPassword)); err != nil {
+			return err
+		}
+		if err := s.userRepo.MarkEmailVerified(tx, userID, now); err != nil {
+			return err
+		}
+		if _, err := s.sessionRepo.RevokeAllSessions(tx, userID, repositories.SessionRevokedPasswordReset, now); err != nil {
+			return err
+		}
+		if err := s.tokenRepo.InvalidateTokens(tx, userID, repositories.TokenPasswordReset, now); err != nil {
+			return err
+		}
+		// Whoever holds the emailed token acts as the user
+		return s.audit.Record(tx, actingAs(actor, userID), AuditPasswordReset, AuditEntityUser, userID, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.GetUserByID(userID)
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// other session is revoked; the one making the change stays signed in.
+func (s *AccountService) ChangePassword(userID int, sessionID int, currentPassword string, newPassword string, actor *models.AuditActor) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !s.checkPassword(user, currentPassword) {
+		return ErrInvalidPassword
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.userRepo.UpdatePassword(tx, userID, HashPassword(s.authSecret, newPassword)); err != nil {
+			return err
+		}
+		if _, err := s.sessionRepo.RevokeOtherSessions(tx, userID, sessionID, repositories.SessionRevokedPasswordChange, time.Now()); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditPasswordChanged, AuditEntityUser, userID, nil, nil)
+	})
+}
+
+// UpdateProfile applies profile changes (column name to value) and records the
+// fields that changed. A changed email has to be verified again. It returns
+// the user before and after the change.
+func (s *AccountService) UpdateProfile(userID int, updates map[string]interface{}, actor *models.AuditActor) (*models.User, *models.User, error) {
+	var before, after *models.User
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		var err error
+		before, err = s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if email, ok := updates["email"]; ok && email != before.Email {
+			updates["email_verified_at"] = nil
+		}
+		if err := s.userRepo.UpdateUser(tx, userID, updates); err != nil {
+			return err
+		}
+
+		after, err = s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		changedBefore, changedAfter := profileChanges(before, after)
+		return s.audit.Record(tx, actor, AuditUserUpdated, AuditEntityUser, userID, changedBefore, changedAfter)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return before, after, nil
+}
+
+// DeleteAccount anonymizes a user: personal data on the user row and on the
+// tickets they bought is replaced, credentials, linked identities and roles are
+// removed and every session ends. Orders are left intact for accounting.
+//
+// Accounts with a password must confirm it; accounts created through social
+// login must have signed in within recentLoginWindow instead.
+func (s *AccountService) DeleteAccount(userID int, sessionID int, password string, actor *models.AuditActor) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if hasUsablePassword(user) {
+		if !s.checkPassword(user, password) {
+			return ErrInvalidPassword
+		}
+	} else {
+		session, err := s.sessionRepo.GetSession(sessionID)
+		if err != nil {
+			return err
+		}
+		if time.Since(session.CreatedAt) > recentLoginWindow {
+			return ErrReauthenticationRequired
+		}
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		// Read in the transaction so the audit entry has the roles actually removed
+		roles, err := s.roleRepo.GetUserRolesForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.userRepo.AnonymizeUser(tx, userID, unusablePassword(), now); err != nil {
+			return err
+		}
+		if err := s.ticketRepo.AnonymizeTicketHolder(tx, userID, deletedHolderName); err != nil {
+			return err
+		}
+		if err := s.bookingRepo.AnonymizeCustomer(tx, userID, deletedHolderName); err != nil {
+			return err
+		}
+		if err := s.outboxRepo.DeleteForUser(tx, userID, user.Email); err != nil {
+			return err
+		}
+		if err := s.exportRepo.DeleteUserExports(tx, userID); err != nil {
+			return err
+		}
+		if err := s.mfaRepo.DeleteMFA(tx, userID); err != nil {
+			return err
+		}
+		if err := s.identityRepo.DeleteIdentities(tx, userID); err != nil {
+			return err
+		}
+		if err := s.tokenRepo.DeleteUserTokens(tx, userID); err != nil {
+			return err
+		}
+		if err := s.roleRepo.RemoveUserRoles(tx, userID); err != nil {
+			return err
+		}
+		if _, err := s.sessionRepo.RevokeAllSessions(tx, userID, repositories.SessionRevokedAccountDeleted, now); err != nil {
+			return err
+		}
+
+		if len(roles) > 0 {
+			if err := s.audit.Record(tx, actor, AuditRolesChanged, AuditEntityUser, userID,
+				map[string]interface{}{"roles": roles}, map[string]interface{}{"roles": []string{}}); err != nil {
+				return err
+			}
+		}
+		// Personal data is left out: the point of deleting is that it goes away
+		return s.audit.Record(tx, actor, AuditAccountDeleted, AuditEntityUser, userID, nil, nil)
+	})
+}
+
+// profileChanges returns the profile fields that differ between two versions
+// of a user, keyed by their API names
+func profileChanges(before *models.User, after *models.User) (map[string]interface{}, map[string]interface{}) {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+
+	compare := func(field string, old interface{}, new interface{}) {
+		if old != new {
+			changedBefore[field] = old
+			changedAfter[field] = new
+		}
+	}
+	compare("username", before.Username, after.Username)
+	compare("firstName", before.FirstName, after.FirstName)
+	compare("lastName", before.LastName, after.LastName)
+	compare("email", before.Email, after.Email)
+	compare("emailVerified", before.EmailVerifiedAt != nil, after.EmailVerifiedAt != nil)
+
+	return changedBefore, changedAfter
+}
+
+func (s *AccountService) checkPassword(user *models.User, password string) bool {
+	expected := HashPassword(s.authSecret, password)
+	return hasUsablePassword(user) && subtle.ConstantTimeCompare([]byte(expected), []byte(user.HashedPassword)) == 1
+}
+
+// SendVerification emails a verification link to the user's current address
+func (s *AccountService) SendVerification(user *models.User, locale string) error {
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		token, expiresAt, err := s.issueToken(tx, user.ID, repositories.TokenEmailVerify, emailVerificationTTL)
+		if err != nil {
+			return err
+		}
+
+		return s.notifications.Queue(tx, &Email{
+			Template: EmailVerification,
+			Locale:   locale,
+			ToEmail:  user.Email,
+			ToName:   user.FirstName,
+			Data: &EmailVerificationEmail{
+				Name:      user.FirstName,
+				VerifyURL: s.link("/verify-email", token),
+				ExpiresAt: &expiresAt,
+			},
+		})
+	})
+}
+
+// ResendVerification sends a new verification link to an unverified account.
+// Unknown and already verified addresses succeed silently.
+func (s *AccountService) ResendVerification(email string, locale string) error {
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.SendVerification(user, locale)
+}
+
+// VerifyEmail consumes a verification token and marks the address verified
+func (s *AccountService) VerifyEmail(token string) (*models.User, error) {
+	var userID int
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		consumed, err := s.tokenRepo.ConsumeToken(tx, repositories.TokenEmailVerify, hashToken(token), now)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		userID = consumed.UserID
+
+		if err := s.userRepo.MarkEmailVerified(tx, userID, now); err != nil {
+			return err
+		}
+		return s.tokenRepo.InvalidateTokens(tx, userID, repositories.TokenEmailVerify, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.GetUserByID(userID)
+}
+
+// issueToken replaces any outstanding token of the purpose with a fresh one
+func (s *AccountService) issueToken(tx *sqlx.Tx, userID int, purpose string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now().UTC()
+	if err := s.tokenRepo.InvalidateTokens(tx, userID, purpose, now); err != nil {
+		return "", time.Time{}, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := now.Add(ttl)
+
+	if err := s.tokenRepo.CreateToken(tx, userID, purpose, hashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+func (s *AccountService) link(path string, token string) string {
+	return s.appBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const testAuthSecret = "test-secret"
+
+func newTestAccountService(t *testing.T) (*AccountService, *stubSQL) {
+	t.Helper()
+
+	sqlStub, database := newStubSQL(t)
+	service := NewAccountService(
+		database,
+		repositories.NewUserRepository(database),
+		repositories.NewUserTokenRepository(database),
+		repositories.NewSessionRepository(database),
+		repositories.NewTicketRepository(database),
+		repositories.NewBookingRepository(database),
+		repositories.NewOutboxRepository(database),
+		repositories.NewDataExportRepository(database),
+		repositories.NewMFARepository(database),
+		repositories.NewIdentityRepository(database),
+		repositories.NewRoleRepository(database),
+		nil,
+		NewAuditService(repositories.NewAuditRepository(database)),
+		testAuthSecret,
+		"https://tickets.test",
+	)
+	return service, sqlStub
+}
+
+// scriptAccountDeletion answers the statements of deleting user 7, who holds roles
+func scriptAccountDeletion(sqlStub *stubSQL, roles ...string) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	sqlStub.onQuery("FROM `user` WHERE id = ?", userColumns,
+		[]driver.Value{int64(7), "bob", "Bob", "Example", "bob@example.com", HashPassword(testAuthSecret, "secret"), created, created, created})
+
+	roleRows := make([][]driver.Value, 0, len(roles))
+	for _, role := range roles {
+		roleRows = append(roleRows, []driver.Value{role})
+	}
+	sqlStub.onQuery("FROM role_has_user", []string{"name"}, roleRows...)
+
+	sqlStub.onExec("UPDATE `user` SET username", 0, 1)
+	sqlStub.onExec("UPDATE ticket SET to_name", 0, 0)
+	sqlStub.onExec("UPDATE `order` SET customer_name", 0, 0)
+	sqlStub.onExec("DELETE FROM email_outbox", 0, 0)
+	sqlStub.onExec("DELETE FROM data_export", 0, 0)
+	sqlStub.onExec("DELETE FROM user_recovery_code", 0, 0)
+	sqlStub.onExec("DELETE FROM user_mfa", 0, 0)
+	sqlStub.onExec("DELETE FROM user_identity", 0, 0)
+	sqlStub.onExec("DELETE FROM user_token", 0, 0)
+	sqlStub.onExec("DELETE FROM role_has_user", 0, int64(len(roles)))
+	sqlStub.onExec("UPDATE user_session SET revoked_at", 0, 1)
+	sqlStub.onExec("INSERT INTO audit_log", 1, 1)
+}
+
+func TestDeleteAccountAuditsRemovedRolesInTransaction(t *testing.T) {
+	service, sqlStub := newTestAccountService(t)
+	scriptAccountDeletion(sqlStub, repositories.RoleAdmin, repositories.RoleBoxOffice)
+
+	actorID := 7
+	actor := &models.AuditActor{UserID: &actorID, RequestID: "req-1", IPAddress: "203.0.113.7"}
+	if err := service.DeleteAccount(7, 31, "secret", actor); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	// The roles are read, removed and audited between BEGIN and COMMIT
+	var steps []string
+	for _, statement := range sqlStub.statements {
+		switch {
+		case statement.Query == "BEGIN", statement.Query == "COMMIT":
+			steps = append(steps, statement.Query)
+		case containsAll(statement.Query, "FROM role_has_user", "FOR UPDATE"):
+			steps = append(steps, "read roles")
+		case containsAll(statement.Query, "DELETE FROM role_has_user"):
+			steps = append(steps, "remove roles")
+		case containsAll(statement.Query, "INSERT INTO audit_log"):
+			// actor_user_id, action, entity_type, entity_id, before_data, after_data, ...
+			steps = append(steps, statement.Args[1].(string))
+		}
+	}
+	want := []string{"BEGIN", "read roles", "remove roles", AuditRolesChanged, AuditAccountDeleted, "COMMIT"}
+	if len(steps) != len(want) {
+		t.Fatalf("steps %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Fatalf("steps %v, want %v", steps, want)
+		}
+	}
+
+	entry := sqlStub.ran("INSERT INTO audit_log")[0].Args
+	if entry[0] != int64(7) || entry[2] != AuditEntityUser || entry[3] != "7" || entry[6] != "req-1" || entry[7] != "203.0.113.7" {
+		t.Errorf("ROLES_CHANGED entry %v", entry)
+	}
+	var before, after struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.Unmarshal([]byte(entry[4].(string)), &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(entry[5].(string)), &after); err != nil {
+		t.Fatal(err)
+	}
+	if len(before.Roles) != 2 || before.Roles[0] != repositories.RoleAdmin || before.Roles[1] != repositories.RoleBoxOffice || len(after.Roles) != 0 {
+		t.Errorf("ROLES_CHANGED before %v after %v", before.Roles, after.Roles)
+	}
+}
+
+func TestDeleteAccountRemovesPersonalDataInTransaction(t *testing.T) {
+	service, sqlStub := newTestAccountService(t)
+	scriptAccountDeletion(sqlStub)
+
+	if err := service.DeleteAccount(7, 31, "secret", nil); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	inTransaction := false
+	scrubbed := map[string][]driver.Value{}
+	for _, statement := range sqlStub.statements {
+		switch {
+		case statement.Query == "BEGIN":
+			inTransaction = true
+		case statement.Query == "COMMIT":
+			inTransaction = false
+		case containsAll(statement.Query, "UPDATE `order` SET customer_name = ?, customer_email = NULL", "WHERE user_id = ?"):
+			scrubbed["orders"] = statement.Args
+		case containsAll(statement.Query, "DELETE FROM email_outbox", "to_email = ?", "WHERE user_id = ?"):
+			scrubbed["outbox"] = statement.Args
+		case containsAll(statement.Query, "DELETE FROM data_export WHERE user_id = ?"):
+			scrubbed["exports"] = statement.Args
+		default:
+			continue
+		}
+		if !inTransaction && statement.Query != "COMMIT" {
+			t.Errorf("%q ran outside the deletion transaction", statement.Query)
+		}
+	}
+
+	if args := scrubbed["orders"]; len(args) != 2 || args[0] != deletedHolderName || args[1] != int64(7) {
+		t.Errorf("order purchaser update args %v, want the placeholder name for user 7", args)
+	}
+	if args := scrubbed["exports"]; len(args) != 1 || args[0] != int64(7) {
+		t.Errorf("data export delete args %v, want user 7", args)
+	}
+	// The outbox is matched on the address the user had before anonymization
+	if args := scrubbed["outbox"]; len(args) != 2 || args[0] != "bob@example.com" || args[1] != int64(7) {
+		t.Errorf("outbox delete args %v, want user 7's email and ID", args)
+	}
+}
+
+func TestDeleteAccountWithoutRolesSkipsRolesAudit(t *testing.T) {
+	service, sqlStub := newTestAccountService(t)
+	scriptAccountDeletion(sqlStub)
+
+	if err := service.DeleteAccount(7, 31, "secret", nil); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	entries := sqlStub.ran("INSERT INTO audit_log")
+	if len(entries) != 1 || entries[0].Args[1] != AuditAccountDeleted {
+		t.Errorf("audit entries %v, want only ACCOUNT_DELETED", entries)
+	}
+}
+
+func TestDeleteAccountWrongPasswordChangesNothing(t *testing.T) {
+	service, sqlStub := newTestAccountService(t)
+	scriptAccountDeletion(sqlStub, repositories.RoleAdmin)
+
+	if err := service.DeleteAccount(7, 31, "wrong", nil); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("DeleteAccount: %v, want ErrInvalidPassword", err)
+	}
+	if len(sqlStub.ran("BEGIN")) != 0 {
+		t.Errorf("a transaction was started for a wrong password")
+	}
+}
+
+func containsAll(query string, fragments ...string) bool {
+	for _, fragment := range fragments {
+		if !strings.Contains(query, fragment) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// Audited actions
+const (
+	AuditOrderCreated           = "ORDER_CREATED"
+	AuditOrderRefunded          = "ORDER_REFUNDED"
+	AuditTicketAdmitted         = "TICKET_ADMITTED"
+	AuditUserUpdated            = "USER_UPDATED"
+	AuditPasswordChanged        = "PASSWORD_CHANGED"
+	AuditPasswordReset          = "PASSWORD_RESET"
+	AuditAccountDeleted         = "ACCOUNT_DELETED"
+	AuditRolesChanged           = "ROLES_CHANGED"
+	AuditSettlementCreated      = "SETTLEMENT_CREATED"
+	AuditCategoryChanged        = "CATEGORY_CHANGED"
+	AuditPerformerChanged       = "PERFORMER_CHANGED"
+	AuditEventClassified        = "EVENT_CLASSIFIED"
+	AuditEventMediaChanged      = "EVENT_MEDIA_CHANGED"
+	AuditEventDateScheduled     = "EVENT_DATE_SCHEDULED"
+	AuditEventDateStatusChanged = "EVENT_DATE_STATUS_CHANGED"
+	AuditEventDateChangeRetried = "EVENT_DATE_CHANGE_RETRIED"
+	AuditSigningKeyRotated      = "SIGNING_KEY_ROTATED"
+	AuditVenueTimeZoneChanged   = "VENUE_TIME_ZONE_CHANGED"
+)
+
+// Audited entity types
+const (
+	AuditEntityOrder      = "order"
+	AuditEntityTicket     = "ticket"
+	AuditEntityUser       = "user"
+	AuditEntitySettlement = "settlement"
+	AuditEntityCategory   = "category"
+	AuditEntityPerformer  = "performer"
+	AuditEntityEvent      = "event"
+	AuditEntityEventDate  = "event_date"
+	AuditEntityVenue      = "venue"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 200
+)
+
+// AuditService writes the audit log. Record must be called with the
+// transaction making the change, so the entry commits or rolls back with it.
+type AuditService struct {
+	auditRepo *repositories.AuditRepository
+}
+
+func NewAuditService(auditRepo *repositories.AuditRepository) *AuditService {
+	return &AuditService{
+		auditRepo: auditRepo,
+	}
+}
+
+// Record appends an entry. before and after are stored as JSON; pass nil when
+// there is no prior or resulting state.
+func (s *AuditService) Record(tx *sqlx.Tx, actor *models.AuditActor, action string, entityType string, entityID interface{}, before interface{}, after interface{}) error {
+	entry := &models.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if actor != nil {
+		entry.ActorUserID = actor.UserID
+		entry.RequestID = actor.RequestID
+		entry.IPAddress = actor.IPAddress
+	}
+
+	var err error
+	if entry.Before, err = auditJSON(before); err != nil {
+		return err
+	}
+	if entry.After, err = auditJSON(after); err != nil {
+		return err
+	}
+
+	return s.auditRepo.CreateEntry(tx, entry)
+}
+
+// List returns matching entries, newest first, clamping the page size
+func (s *AuditService) List(filter *repositories.AuditFilter) ([]*models.AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+	return s.auditRepo.ListEntries(filter)
+}
+
+// actingAs attributes a change to userID when the request itself was not
+// authenticated, such as a password reset by emailed token
+func actingAs(actor *models.AuditActor, userID int) *models.AuditActor {
+	acting := &models.AuditActor{UserID: &userID}
+	if actor != nil {
+		acting.RequestID = actor.RequestID
+		acting.IPAddress = actor.IPAddress
+	}
+	return acting
+}
+
+func auditJSON(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	AccessTokenTTL = 15 * time.Minute
+	// SessionIdleTTL is how long a session survives without a refresh
+	SessionIdleTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrUnauthenticated     = errors.New("UNAUTHENTICATED")
+	ErrInvalidRefreshToken = errors.New("INVALID_REFRESH_TOKEN")
+	ErrRefreshTokenReused  = errors.New("REFRESH_TOKEN_REUSED")
+	ErrSessionNotFound     = errors.New("SESSION_NOT_FOUND")
+)
+
+// TokenPair is what a client receives on login and on every refresh
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+	SessionID    int
+}
+
+// AccessClaims identifies the user and session behind an access token
+type AccessClaims struct {
+	UserID    int
+	SessionID int
+	ExpiresAt time.Time
+}
+
+// AuthService issues short-lived access tokens bound to a session, and refresh
+// tokens that rotate on every use. Every refresh token ever issued for a session
+// is kept (hashed), so presenting a rotated one is detected as reuse and revokes
+// the whole session.
+type AuthService struct {
+	db          *db.DB
+	sessionRepo *repositories.SessionRepository
+	secret      []byte
+}
+
+func NewAuthService(db *db.DB, sessionRepo *repositories.SessionRepository, authSecret string) *AuthService {
+	return &AuthService{
+		db:          db,
+		sessionRepo: sessionRepo,
+		secret:      []byte(authSecret),
+	}
+}
+
+// Login starts a new session for an authenticated user
+func (s *AuthService) Login(user *models.User, userAgent string, ipAddress string) (*TokenPair, error) {
+	var pair *TokenPair
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		sessionID, err := s.sessionRepo.CreateSession(tx, &models.Session{
+			UserID:     user.ID,
+			UserAgent:  truncate(userAgent, 255),
+			IPAddress:  ipAddress,
+			CreatedAt:  now,
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(SessionIdleTTL),
+		})
+		if err != nil {
+			return err
+		}
+
+		pair, err = s.issuePair(tx, user.ID, int(sessionID), now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new pair and retires the old token
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	reused := false
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		token, err := s.sessionRepo.GetRefreshTokenForUpdate(tx, hashToken(refreshToken))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		session, err := s.sessionRepo.GetSessionForUpdate(tx, token.SessionID)
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		if token.RotatedAt != nil {
+			// Someone holds a copy of an old token; end the session for everyone.
+			// Returning nil commits the revocation.
+			reused = true
+			_, err := s.sessionRepo.RevokeSession(tx, session.ID, repositories.SessionRevokedTokenReuse, now)
+			return err
+		}
+
+		if err := s.sessionRepo.MarkRefreshTokenRotated(tx, token.ID, now); err != nil {
+			return err
+		}
+		if err := s.sessionRepo.TouchSession(tx, session.ID, now, now.Add(SessionIdleTTL)); err != nil {
+			return err
+		}
+
+		pair, err = s.issuePair(tx, session.UserID, session.ID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+
+	return pair, nil
+}
+
+// Authenticate verifies an access token and checks its session is still active,
+// so logging out takes effect immediately
+func (s *AuthService) Authenticate(accessToken string) (*AccessClaims, error) {
+	claims, err := s.parseAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.GetSession(claims.SessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUnauthenticated
+		}
+		return nil, err
+	}
+	if session.UserID != claims.UserID || session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, ErrUnauthenticated
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the session the access token belongs to
+func (s *AuthService) Logout(claims *AccessClaims) error {
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		_, err := s.sessionRepo.RevokeSession(tx, claims.SessionID, repositories.SessionRevokedLogout, time.Now())
+		return err
+	})
+}
+
+// RevokeSession lets a user end one of their own sessions
+func (s *AuthService) RevokeSession(userID int, sessionID int) error {
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		session, err := s.sessionRepo.GetSessionForUpdate(tx, sessionID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		if session.UserID != userID || session.RevokedAt != nil {
+			return ErrSessionNotFound
+		}
+
+		_, err = s.sessionRepo.RevokeSession(tx, sessionID, repositories.SessionRevokedByUser, time.Now())
+		return err
+	})
+}
+
+// RevokeAll ends every session of the user, including the current one
+func (s *AuthService) RevokeAll(userID int, reason string) (int64, error) {
+	var revoked int64
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		var err error
+		revoked, err = s.sessionRepo.RevokeAllSessions(tx, userID, reason, time.Now())
+		return err
+	})
+	return revoked, err
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *AuthService) ListSessions(userID int) ([]*models.Session, error) {
+	return s.sessionRepo.ListActiveSessions(userID, time.Now())
+}
+
+func (s *AuthService) issuePair(tx *sqlx.Tx, userID int, sessionID int, now time.Time) (*TokenPair, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := s.sessionRepo.CreateRefreshToken(tx, sessionID, hashToken(refreshToken), now); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  s.signAccessToken(userID, sessionID, now.Add(AccessTokenTTL)),
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL / time.Second),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// signAccessToken encodes <userId>:<sessionId>:<expiry> with an HMAC-SHA256 signature
+func (s *AuthService) signAccessToken(userID int, sessionID int, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d:%d:%d", userID, sessionID, expiresAt.Unix())
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded))
+}
+
+func (s *AuthService) parseAccessToken(token string) (*AccessClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.mac(encoded)) {
+		return nil, ErrUnauthenticated
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 3 {
+		return nil, ErrUnauthenticated
+	}
+
+	userID, err1 := strconv.Atoi(parts[0])
+	sessionID, err2 := strconv.Atoi(parts[1])
+	expiry, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	expiresAt := time.Unix(expiry, 0)
+	if !expiresAt.After(time.Now()) {
+		return nil, ErrUnauthenticated
+	}
+
+	return &AccessClaims{UserID: userID, SessionID: sessionID, ExpiresAt: expiresAt}, nil
+}
+
+func (s *AuthService) mac(data string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("access-token:" + data))
+	return mac.Sum(nil)
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 	"ticketbooth-backend/db"
+	"ticketbooth-backend/ledger"
 	"ticketbooth-backend/models"
 	"ticketbooth-backend/repositories"
 	"github.com/jmoiron/sqlx"
@@ -25,6 +27,10 @@ type BookingService struct {
 	eventRepo       *repositories.EventRepository
 	ticketTypeRepo  *repositories.TicketTypeRepository
 	seatRepo        *repositories.SeatRepository
+	credentials     *CredentialService
+	notifications   *NotificationService
+	audit           *AuditService
+	ledger          *LedgerService
 }
 
 func NewBookingService(
@@ -34,6 +40,10 @@ func NewBookingService(
 	eventRepo *repositories.EventRepository,
 	ticketTypeRepo *repositories.TicketTypeRepository,
 	seatRepo *repositories.SeatRepository,
+	credentials *CredentialService,
+	notifications *NotificationService,
+	audit *AuditService,
+	ledger *LedgerService,
 ) *BookingService {
 	return &BookingService{
 		db:            db,
@@ -42,11 +52,15 @@ func NewBookingService(
 		eventRepo:    eventRepo,
 		ticketTypeRepo: ticketTypeRepo,
 		seatRepo:     seatRepo,
+		credentials:  credentials,
+		notifications: notifications,
+		audit:         audit,
+		ledger:        ledger,
 	}
 }
 
 // BookGATickets handles GA booking with transaction and concurrency control
-func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.BookingResponse, error) {
+func (s *BookingService) BookGATickets(req *models.BookingRequest, actor *models.AuditActor) (*models.BookingResponse, error) {
 	// First, get the event date to verify it's GA
 	eventDate, err := s.eventRepo.GetEventDateByID(req.EventDateID)
 	if err != nil {
@@ -60,12 +74,24 @@ func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.Book
 		return nil, fmt.Errorf("event date is not GA mode")
 	}
 
+	signingKey, err := s.credentials.ActiveKey(eventDate.EventID)
+	if err != nil {
+		return nil, err
+	}
+
 	var response *models.BookingResponse
 
 	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		// Sales must be open; the shared lock holds off status changes until
+		// the booking commits
+		if err := s.lockOnSale(tx, req.EventDateID); err != nil {
+			return err
+		}
+
 		// Validate and update inventory for each tier
 		totalAmount := 0.0
 		totalTickets := 0
+		tierPrices := make(map[int]float64)
 
 		for _, tier := range req.Tiers {
 			// Atomically update inventory
@@ -90,12 +116,13 @@ func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.Book
 				return err
 			}
 
+			tierPrices[tier.TicketTypeID] = price
 			totalAmount += price * float64(tier.Quantity)
 			totalTickets += tier.Quantity
 		}
 
 		// Create order
-		orderID, err := s.bookingRepo.CreateOrder(tx, req.UserID, totalTickets, fmt.Sprintf("%.2f", totalAmount), req.PaymentSource)
+		orderID, err := s.bookingRepo.CreateOrder(tx, req.UserID, totalTickets, fmt.Sprintf("%.2f", totalAmount), req.PaymentSource, req.CustomerName, req.CustomerEmail, s.notifications.SupportedLocale(req.Locale))
 		if err != nil {
 			return err
 		}
@@ -107,7 +134,32 @@ func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.Book
 
 		for _, tier := range req.Tiers {
 			for i := 0; i < tier.Quantity; i++ {
-				ticketID, err := s.bookingRepo.CreateTicket(tx, int(orderID), userIDStr, eventIDStr, req.EventDateID, tier.TicketTypeID, 0, req.CustomerName)
+				var attendee *models.AttendeeRequest
+				if i < len(tier.Attendees) {
+					attendee = tier.Attendees[i]
+				}
+				toName, toEmail := attendeeFor(req, attendee)
+
+				nonce, err := NewCredentialNonce()
+				if err != nil {
+					return err
+				}
+
+				ticketID, err := s.bookingRepo.CreateTicket(tx, int(orderID), &models.Ticket{
+					EventID:         eventIDStr,
+					UserID:          userIDStr,
+					TicketTypeID:    tier.TicketTypeID,
+					ToName:          toName,
+					ToEmail:         toEmail,
+					EventDateID:     req.EventDateID,
+					Price:           tierPrices[tier.TicketTypeID],
+					CredentialNonce: nonce,
+				})
+				if err != nil {
+					return err
+				}
+
+				credential, err := s.credentials.Issue(signingKey, newTicketCredential(int(ticketID), eventDate, "", nonce))
 				if err != nil {
 					return err
 				}
@@ -123,7 +175,10 @@ func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.Book
 					ID:         int(ticketID),
 					TicketType: ticketTypeName,
 					SeatLabel:  nil,
-					ToName:     req.CustomerName,
+					Price:      tierPrices[tier.TicketTypeID],
+					ToName:     toName,
+					ToEmail:    toEmail,
+					Credential: credential,
 				})
 			}
 		}
@@ -134,7 +189,15 @@ func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.Book
 			Tickets:     tickets,
 		}
 
-		return nil
+		if err := s.audit.Record(tx, actor, AuditOrderCreated, AuditEntityOrder, orderID, nil, orderAuditState(req, response)); err != nil {
+			return err
+		}
+
+		if err := s.ledger.RecordSale(tx, int(orderID), eventDate.EventID, ledger.FromFloat(totalAmount)); err != nil {
+			return err
+		}
+
+		return s.notifications.QueueOrderConfirmation(tx, req, eventDate, response)
 	})
 
 	if err != nil {
@@ -145,7 +208,7 @@ func (s *BookingService) BookGATickets(req *models.BookingRequest) (*models.Book
 }
 
 // BookSeatedTickets handles seated booking with transaction and unique constraint protection
-func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.BookingResponse, error) {
+func (s *BookingService) BookSeatedTickets(req *models.BookingRequest, actor *models.AuditActor) (*models.BookingResponse, error) {
 	// First, get the event date to verify it's SEATED
 	eventDate, err := s.eventRepo.GetEventDateByID(req.EventDateID)
 	if err != nil {
@@ -159,9 +222,20 @@ func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.
 		return nil, fmt.Errorf("event date is not SEATED mode")
 	}
 
+	signingKey, err := s.credentials.ActiveKey(eventDate.EventID)
+	if err != nil {
+		return nil, err
+	}
+
 	var response *models.BookingResponse
 
 	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		// Sales must be open; the shared lock holds off status changes until
+		// the booking commits
+		if err := s.lockOnSale(tx, req.EventDateID); err != nil {
+			return err
+		}
+
 		// Check if any seats are already taken
 		seatIDs := make([]int, len(req.Seats))
 		for i, seat := range req.Seats {
@@ -188,7 +262,7 @@ func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.
 		}
 
 		// Create order
-		orderID, err := s.bookingRepo.CreateOrder(tx, req.UserID, len(req.Seats), fmt.Sprintf("%.2f", totalAmount), req.PaymentSource)
+		orderID, err := s.bookingRepo.CreateOrder(tx, req.UserID, len(req.Seats), fmt.Sprintf("%.2f", totalAmount), req.PaymentSource, req.CustomerName, req.CustomerEmail, s.notifications.SupportedLocale(req.Locale))
 		if err != nil {
 			return err
 		}
@@ -204,9 +278,24 @@ func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.
 			if err != nil {
 				return err
 			}
-			_ = price
 
-			ticketID, err := s.bookingRepo.CreateTicket(tx, int(orderID), userIDStr, eventIDStr, req.EventDateID, ticketTypeID, seatReq.SeatID, req.CustomerName)
+			toName, toEmail := attendeeFor(req, seatReq.Attendee)
+			nonce, err := NewCredentialNonce()
+			if err != nil {
+				return err
+			}
+
+			ticketID, err := s.bookingRepo.CreateTicket(tx, int(orderID), &models.Ticket{
+				EventID:         eventIDStr,
+				UserID:          userIDStr,
+				TicketTypeID:    ticketTypeID,
+				ToName:          toName,
+				ToEmail:         toEmail,
+				EventDateID:     req.EventDateID,
+				SeatID:          seatReq.SeatID,
+				Price:           price,
+				CredentialNonce: nonce,
+			})
 			if err != nil {
 				// Check if it's a unique constraint violation
 				if isUniqueConstraintError(err) {
@@ -229,11 +318,19 @@ func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.
 				ticketTypeName = ticketType.Name
 			}
 
+			credential, err := s.credentials.Issue(signingKey, newTicketCredential(int(ticketID), eventDate, seatLabel, nonce))
+			if err != nil {
+				return err
+			}
+
 			tickets = append(tickets, &models.TicketResponse{
 				ID:         int(ticketID),
 				TicketType: ticketTypeName,
 				SeatLabel:  &seatLabel,
-				ToName:     req.CustomerName,
+				Price:      price,
+				ToName:     toName,
+				ToEmail:    toEmail,
+				Credential: credential,
 			})
 		}
 
@@ -243,7 +340,15 @@ func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.
 			Tickets:     tickets,
 		}
 
-		return nil
+		if err := s.audit.Record(tx, actor, AuditOrderCreated, AuditEntityOrder, orderID, nil, orderAuditState(req, response)); err != nil {
+			return err
+		}
+
+		if err := s.ledger.RecordSale(tx, int(orderID), eventDate.EventID, ledger.FromFloat(totalAmount)); err != nil {
+			return err
+		}
+
+		return s.notifications.QueueOrderConfirmation(tx, req, eventDate, response)
 	})
 
 	if err != nil {
@@ -253,6 +358,66 @@ func (s *BookingService) BookSeatedTickets(req *models.BookingRequest) (*models.
 	return response, nil
 }
 
+// orderAuditState is what the audit log keeps about a new order; credentials
+// and attendee details are left out
+func orderAuditState(req *models.BookingRequest, response *models.BookingResponse) map[string]interface{} {
+	tickets := make([]map[string]interface{}, 0, len(response.Tickets))
+	for _, ticket := range response.Tickets {
+		entry := map[string]interface{}{
+			"id":         ticket.ID,
+			"ticketType": ticket.TicketType,
+			"price":      ticket.Price,
+		}
+		if ticket.SeatLabel != nil {
+			entry["seat"] = *ticket.SeatLabel
+		}
+		tickets = append(tickets, entry)
+	}
+
+	return map[string]interface{}{
+		"userId":        req.UserID,
+		"eventDateId":   req.EventDateID,
+		"paymentSource": req.PaymentSource,
+		"totalAmount":   response.TotalAmount,
+		"tickets":       tickets,
+	}
+}
+
+// attendeeFor returns the name and email a ticket is issued to, defaulting to the purchaser
+func attendeeFor(req *models.BookingRequest, attendee *models.AttendeeRequest) (string, string) {
+	if attendee == nil || attendee.Name == "" {
+		return req.CustomerName, req.CustomerEmail
+	}
+	return attendee.Name, attendee.Email
+}
+
+// newTicketCredential builds the signed payload for a ticket created during booking
+func newTicketCredential(ticketID int, eventDate *models.EventDate, seatLabel string, nonce string) *models.TicketCredential {
+	credential := &models.TicketCredential{
+		TicketID:    ticketID,
+		EventDateID: eventDate.ID,
+		Seat:        seatLabel,
+		Nonce:       nonce,
+	}
+	if eventDate.Date != nil {
+		credential.EventDate = eventDate.Date.Unix()
+	}
+	return credential
+}
+
+// lockOnSale locks the event date against status changes for the rest of tx
+// and checks it is taking bookings
+func (s *BookingService) lockOnSale(tx *sqlx.Tx, eventDateID int) error {
+	eventDate, err := s.eventRepo.LockEventDateForSale(tx, eventDateID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return CheckOnSale(eventDate, time.Now())
+}
+
 // isUniqueConstraintError checks if an error is a unique constraint violation
 func isUniqueConstraintError(err error) bool {
 	if err == nil {
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/timezone"
+)
+
+var (
+	ErrSlugTaken        = errors.New("SLUG_TAKEN")
+	ErrUnknownCategory  = errors.New("UNKNOWN_CATEGORY")
+	ErrUnknownPerformer = errors.New("UNKNOWN_PERFORMER")
+	ErrUnknownTimeZone  = errors.New("UNKNOWN_TIME_ZONE")
+)
+
+const (
+	performerDefaultLimit = 50
+	performerMaxLimit     = 200
+)
+
+// CatalogService manages event categories, tags, performers, media and venue
+// time zones for admins. Every change is audited.
+type CatalogService struct {
+	db          *db.DB
+	catalogRepo *repositories.CatalogRepository
+	venueRepo   *repositories.VenueRepository
+	audit       *AuditService
+}
+
+func NewCatalogService(
+	db *db.DB,
+	catalogRepo *repositories.CatalogRepository,
+	venueRepo *repositories.VenueRepository,
+	audit *AuditService,
+) *CatalogService {
+	return &CatalogService{
+		db:          db,
+		catalogRepo: catalogRepo,
+		venueRepo:   venueRepo,
+		audit:       audit,
+	}
+}
+
+func (s *CatalogService) ListCategories() ([]*models.Category, error) {
+	return s.catalogRepo.ListCategories()
+}
+
+func (s *CatalogService) CreateCategory(req *models.CategoryRequest, actor *models.AuditActor) (*models.Category, error) {
+	category := &models.Category{Slug: req.Slug, Name: req.Name}
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		id, err := s.catalogRepo.CreateCategory(tx, category)
+		if err != nil {
+			return err
+		}
+		category.ID = id
+		return s.audit.Record(tx, actor, AuditCategoryChanged, AuditEntityCategory, id, nil, category)
+	})
+	if isUniqueConstraintError(err) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (s *CatalogService) UpdateCategory(id int, req *models.CategoryRequest, actor *models.AuditActor) (*models.Category, error) {
+	before, err := s.catalogRepo.GetCategory(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	category := &models.Category{ID: id, Slug: req.Slug, Name: req.Name}
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.catalogRepo.UpdateCategory(tx, category); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditCategoryChanged, AuditEntityCategory, id, before, category)
+	})
+	if isUniqueConstraintError(err) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// DeleteCategory also removes the category from every event
+func (s *CatalogService) DeleteCategory(id int, actor *models.AuditActor) error {
+	before, err := s.catalogRepo.GetCategory(id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.catalogRepo.DeleteCategory(tx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditCategoryChanged, AuditEntityCategory, id, before, nil)
+	})
+}
+
+// ListPerformers returns performers by name, clamping the page size
+func (s *CatalogService) ListPerformers(query string, limit int) ([]*models.Performer, error) {
+	if limit <= 0 {
+		limit = performerDefaultLimit
+	}
+	if limit > performerMaxLimit {
+		limit = performerMaxLimit
+	}
+	return s.catalogRepo.ListPerformers(query, limit)
+}
+
+func (s *CatalogService) GetPerformer(id int) (*models.Performer, error) {
+	performer, err := s.catalogRepo.GetPerformer(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return performer, err
+}
+
+func (s *CatalogService) CreatePerformer(req *models.PerformerRequest, actor *models.AuditActor) (*models.Performer, error) {
+	performer := performerFromRequest(req)
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		id, err := s.catalogRepo.CreatePerformer(tx, performer)
+		if err != nil {
+			return err
+		}
+		performer.ID = id
+		return s.audit.Record(tx, actor, AuditPerformerChanged, AuditEntityPerformer, id, nil, performer)
+	})
+	if isUniqueConstraintError(err) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return performer, nil
+}
+
+func (s *CatalogService) UpdatePerformer(id int, req *models.PerformerRequest, actor *models.AuditActor) (*models.Performer, error) {
+	before, err := s.GetPerformer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	performer := performerFromRequest(req)
+	performer.ID = id
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.catalogRepo.UpdatePerformer(tx, performer); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditPerformerChanged, AuditEntityPerformer, id, before, performer)
+	})
+	if isUniqueConstraintError(err) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return performer, nil
+}
+
+// DeletePerformer also removes the performer from every lineup
+func (s *CatalogService) DeletePerformer(id int, actor *models.AuditActor) error {
+	before, err := s.GetPerformer(id)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.catalogRepo.DeletePerformer(tx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditPerformerChanged, AuditEntityPerformer, id, before, nil)
+	})
+}
+
+// UpdateVenueTimeZone sets the IANA zone the venue's event times are shown in.
+// Stored times are UTC instants, so they keep their instant and move on the
+// wall clock.
+func (s *CatalogService) UpdateVenueTimeZone(venueID int, zone string, actor *models.AuditActor) (*models.VenueTimeZone, error) {
+	if !timezone.Valid(zone) {
+		return nil, ErrUnknownTimeZone
+	}
+
+	current, err := s.venueRepo.GetTimeZone(venueID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	before := &models.VenueTimeZone{VenueID: venueID, TimeZone: current}
+	after := &models.VenueTimeZone{VenueID: venueID, TimeZone: zone}
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.venueRepo.UpdateTimeZone(tx, venueID, zone); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditVenueTimeZoneChanged, AuditEntityVenue, venueID, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+func (s *CatalogService) GetEventClassification(eventID int) (*models.EventClassification, error) {
+	exists, err := s.catalogRepo.EventExists(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return s.catalogRepo.GetEventClassification(eventID)
+}
+
+// ClassifyEvent replaces the parts of the event's classification set in req.
+// Category and performer IDs must exist; tags must already be normalized.
+func (s *CatalogService) ClassifyEvent(eventID int, req *models.EventClassificationRequest, actor *models.AuditActor) (*models.EventClassification, error) {
+	before, err := s.GetEventClassification(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.CategoryIDs != nil {
+		count, err := s.catalogRepo.CountCategories(*req.CategoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		if count != len(*req.CategoryIDs) {
+			return nil, ErrUnknownCategory
+		}
+	}
+	if req.PerformerIDs != nil {
+		count, err := s.catalogRepo.CountPerformers(*req.PerformerIDs)
+		if err != nil {
+			return nil, err
+		}
+		if count != len(*req.PerformerIDs) {
+			return nil, ErrUnknownPerformer
+		}
+	}
+
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if req.CategoryIDs != nil {
+			if err := s.catalogRepo.SetEventCategories(tx, eventID, *req.CategoryIDs); err != nil {
+				return err
+			}
+		}
+		if req.Tags != nil {
+			if err := s.catalogRepo.SetEventTags(tx, eventID, *req.Tags); err != nil {
+				return err
+			}
+		}
+		if req.PerformerIDs != nil {
+			if err := s.catalogRepo.SetEventPerformers(tx, eventID, *req.PerformerIDs); err != nil {
+				return err
+			}
+		}
+		return s.audit.Record(tx, actor, AuditEventClassified, AuditEntityEvent, eventID, classificationAudit(before), req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.catalogRepo.GetEventClassification(eventID)
+}
+
+func (s *CatalogService) AddEventMedia(eventID int, req *models.EventMediaRequest, actor *models.AuditActor) (*models.EventMedia, error) {
+	exists, err := s.catalogRepo.EventExists(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	media := &models.EventMedia{
+		EventID:  eventID,
+		Kind:     req.Kind,
+		URL:      req.URL,
+		AltText:  req.AltText,
+		Position: req.Position,
+	}
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		id, err := s.catalogRepo.CreateEventMedia(tx, media, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		media.ID = id
+		return s.audit.Record(tx, actor, AuditEventMediaChanged, AuditEntityEvent, eventID, nil, media)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+func (s *CatalogService) DeleteEventMedia(eventID int, mediaID int, actor *models.AuditActor) error {
+	media, err := s.catalogRepo.GetEventMedia(eventID, mediaID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.catalogRepo.DeleteEventMedia(tx, mediaID); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditEventMediaChanged, AuditEntityEvent, eventID, media, nil)
+	})
+}
+
+func performerFromRequest(req *models.PerformerRequest) *models.Performer {
+	return &models.Performer{
+		Slug:        req.Slug,
+		Name:        req.Name,
+		Description: req.Description,
+		ImageURL:    req.ImageURL,
+	}
+}
+
+// classificationAudit is the audited shape of a classification, in the same
+// terms as EventClassificationRequest
+func classificationAudit(classification *models.EventClassification) map[string]interface{} {
+	categoryIDs := make([]int, 0, len(classification.Categories))
+	for _, category := range classification.Categories {
+		categoryIDs = append(categoryIDs, category.ID)
+	}
+	performerIDs := make([]int, 0, len(classification.Performers))
+	for _, performer := range classification.Performers {
+		performerIDs = append(performerIDs, performer.ID)
+	}
+	return map[string]interface{}{
+		"categoryIds":  categoryIDs,
+		"tags":         classification.Tags,
+		"performerIds": performerIDs,
+	}
+}
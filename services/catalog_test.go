@@ -0,0 +1,74 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"ticketbooth-backend/repositories"
+)
+
+func newTestCatalogService(t *testing.T) (*CatalogService, *stubSQL) {
+	t.Helper()
+
+	sqlStub, database := newStubSQL(t)
+	service := NewCatalogService(
+		database,
+		repositories.NewCatalogRepository(database),
+		repositories.NewVenueRepository(database),
+		NewAuditService(repositories.NewAuditRepository(database)),
+	)
+	return service, sqlStub
+}
+
+func TestUpdateVenueTimeZoneRejectsUnknownZones(t *testing.T) {
+	for _, zone := range []string{"", "Local", "Mars/Olympus_Mons", "America/Mexico City", "../etc/passwd"} {
+		service, sqlStub := newTestCatalogService(t)
+
+		if _, err := service.UpdateVenueTimeZone(5, zone, nil); !errors.Is(err, ErrUnknownTimeZone) {
+			t.Errorf("UpdateVenueTimeZone(%q): %v, want ErrUnknownTimeZone", zone, err)
+		}
+		if len(sqlStub.statements) != 0 {
+			t.Errorf("UpdateVenueTimeZone(%q) ran %v", zone, sqlStub.statements)
+		}
+	}
+}
+
+func TestUpdateVenueTimeZoneAuditsChange(t *testing.T) {
+	service, sqlStub := newTestCatalogService(t)
+	sqlStub.onQuery("SELECT time_zone FROM venue", []string{"time_zone"}, []driver.Value{"UTC"})
+	sqlStub.onExec("UPDATE venue SET time_zone", 0, 1)
+	sqlStub.onExec("INSERT INTO audit_log", 1, 1)
+
+	updated, err := service.UpdateVenueTimeZone(5, "America/Mexico_City", nil)
+	if err != nil {
+		t.Fatalf("UpdateVenueTimeZone: %v", err)
+	}
+	if updated.VenueID != 5 || updated.TimeZone != "America/Mexico_City" {
+		t.Errorf("updated %+v", updated)
+	}
+
+	if stored := sqlStub.ran("UPDATE venue SET time_zone"); len(stored) != 1 || stored[0].Args[0] != "America/Mexico_City" || stored[0].Args[1] != int64(5) {
+		t.Errorf("venue updates %v", stored)
+	}
+	// actor_user_id, action, entity_type, entity_id, before_data, after_data, ...
+	entries := sqlStub.ran("INSERT INTO audit_log")
+	if len(entries) != 1 || entries[0].Args[1] != AuditVenueTimeZoneChanged || entries[0].Args[2] != AuditEntityVenue || entries[0].Args[3] != "5" {
+		t.Fatalf("audit entries %v", entries)
+	}
+	if before := entries[0].Args[4]; before != `{"venueId":5,"timeZone":"UTC"}` {
+		t.Errorf("audit before %v", before)
+	}
+}
+
+func TestUpdateVenueTimeZoneUnknownVenue(t *testing.T) {
+	service, sqlStub := newTestCatalogService(t)
+	sqlStub.onQuery("SELECT time_zone FROM venue", []string{"time_zone"})
+
+	if _, err := service.UpdateVenueTimeZone(99, "Europe/Madrid", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateVenueTimeZone: %v, want ErrNotFound", err)
+	}
+	if len(sqlStub.ran("UPDATE venue")) != 0 {
+		t.Errorf("an unknown venue was updated")
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// Check-in outcomes, also stored as ticket_scan.result
+const (
+	CheckInAdmitted          = "ADMITTED"
+	CheckInAlreadyAdmitted   = "ALREADY_ADMITTED"
+	CheckInInvalidCredential = "INVALID_CREDENTIAL"
+	CheckInWrongEventDate    = "WRONG_EVENT_DATE"
+	CheckInTicketRefunded    = "TICKET_REFUNDED"
+	CheckInAlreadySynced     = "ALREADY_SYNCED"
+)
+
+// maxScanClockSkew bounds how far in the future a device's scan timestamp may be
+const maxScanClockSkew = 5 * time.Minute
+
+// CheckInResult describes what happened to a single scan
+type CheckInResult struct {
+	Status    string
+	Ticket    *models.Ticket
+	Admission *models.Admission
+	// Superseded is the admission replaced by an earlier offline scan
+	Superseded *models.Admission
+	// Conflict is set when two scans both let someone in on the same ticket
+	Conflict bool
+}
+
+// OfflineScan is a scan buffered by a device and uploaded after reconnecting
+type OfflineScan struct {
+	ClientScanID string
+	Credential   string
+	EventDateID  int
+	Gate         string
+	ScannedAt    time.Time
+}
+
+type CheckInService struct {
+	db          *db.DB
+	ticketRepo  *repositories.TicketRepository
+	checkInRepo *repositories.CheckInRepository
+	credentials *CredentialService
+	audit       *AuditService
+}
+
+func NewCheckInService(
+	db *db.DB,
+	ticketRepo *repositories.TicketRepository,
+	checkInRepo *repositories.CheckInRepository,
+	credentials *CredentialService,
+	audit *AuditService,
+) *CheckInService {
+	return &CheckInService{
+		db:          db,
+		ticketRepo:  ticketRepo,
+		checkInRepo: checkInRepo,
+		credentials: credentials,
+		audit:       audit,
+	}
+}
+
+// CheckIn verifies a live scan and admits the ticket. Second scans are rejected
+// with CheckInAlreadyAdmitted and the original admission.
+func (s *CheckInService) CheckIn(req *models.CheckInRequest, actor *models.AuditActor) (*CheckInResult, error) {
+	scan := &models.TicketScan{
+		EventDateID: req.EventDateID,
+		Gate:        req.Gate,
+		DeviceID:    req.DeviceID,
+		Source:      repositories.ScanSourceOnline,
+		ScannedAt:   time.Now().UTC(),
+	}
+
+	return s.process(scan, req.Credential, actor)
+}
+
+// SyncOfflineScans applies scans buffered by a device while it was offline.
+// Scans are applied oldest first and the earliest scan of a ticket becomes its
+// admission; any other scan of that ticket is flagged as a conflict, since an
+// offline device has already let its holder in.
+func (s *CheckInService) SyncOfflineScans(deviceID string, scans []*OfflineScan, actor *models.AuditActor) ([]*CheckInResult, error) {
+	order := make([]int, len(scans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scans[order[a]].ScannedAt.Before(scans[order[b]].ScannedAt)
+	})
+
+	results := make([]*CheckInResult, len(scans))
+	for _, i := range order {
+		req := scans[i]
+
+		existing, err := s.checkInRepo.GetScanByClientID(deviceID, req.ClientScanID)
+		if err == nil {
+			results[i] = &CheckInResult{Status: CheckInAlreadySynced, Conflict: existing.Conflict}
+			if existing.TicketID != nil {
+				results[i].Ticket = &models.Ticket{ID: *existing.TicketID}
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		scan := &models.TicketScan{
+			EventDateID:  req.EventDateID,
+			Gate:         req.Gate,
+			DeviceID:     deviceID,
+			ClientScanID: req.ClientScanID,
+			Source:       repositories.ScanSourceOffline,
+			ScannedAt:    clampScanTime(req.ScannedAt),
+		}
+
+		result, err := s.process(scan, req.Credential, actor)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+
+	return results, nil
+}
+
+func (s *CheckInService) process(scan *models.TicketScan, credential string, actor *models.AuditActor) (*CheckInResult, error) {
+	ticket, status, err := s.resolveTicket(scan, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckInResult{Status: status, Ticket: ticket}
+	if ticket != nil {
+		scan.TicketID = &ticket.ID
+	}
+
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if result.Status == CheckInAdmitted {
+			if err := s.admit(tx, scan, result); err != nil {
+				return err
+			}
+		}
+
+		// Only scans that set the ticket's admission change state; the rest are
+		// already kept in the scan log
+		if result.Status == CheckInAdmitted {
+			var before interface{}
+			if result.Superseded != nil {
+				before = result.Superseded
+			}
+			if err := s.audit.Record(tx, actor, AuditTicketAdmitted, AuditEntityTicket, result.Ticket.ID, before, result.Admission); err != nil {
+				return err
+			}
+		}
+
+		scan.Result = result.Status
+		scan.Conflict = result.Conflict
+		return s.checkInRepo.CreateScan(tx, scan)
+	})
+	if err != nil {
+		if isUniqueConstraintError(err) && scan.ClientScanID != "" {
+			// The same offline scan was uploaded concurrently
+			return &CheckInResult{Status: CheckInAlreadySynced, Ticket: ticket}, nil
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// resolveTicket verifies the credential and loads the ticket it was issued for
+func (s *CheckInService) resolveTicket(scan *models.TicketScan, credential string) (*models.Ticket, string, error) {
+	claims, key, err := s.credentials.Verify(credential)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredential) || errors.Is(err, ErrUnknownSigningKey) || errors.Is(err, ErrRevokedSigningKey) {
+			return nil, CheckInInvalidCredential, nil
+		}
+		return nil, "", err
+	}
+
+	ticket, err := s.ticketRepo.GetTicketByID(claims.TicketID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, CheckInInvalidCredential, nil
+		}
+		return nil, "", err
+	}
+
+	// A credential stays valid only while it matches the ticket it was issued for;
+	// reissuing the ticket replaces the nonce and invalidates earlier QR codes
+	if ticket.CredentialNonce == "" || ticket.CredentialNonce != claims.Nonce ||
+		ticket.EventDateID != claims.EventDateID || ticket.Event == nil || ticket.Event.ID != key.EventID {
+		return nil, CheckInInvalidCredential, nil
+	}
+
+	if ticket.RefundedAt != nil {
+		return ticket, CheckInTicketRefunded, nil
+	}
+
+	if claims.EventDateID != scan.EventDateID {
+		return ticket, CheckInWrongEventDate, nil
+	}
+
+	return ticket, CheckInAdmitted, nil
+}
+
+// admit records the admission, resolving it against any earlier one for the ticket
+func (s *CheckInService) admit(tx *sqlx.Tx, scan *models.TicketScan, result *CheckInResult) error {
+	ticketID := result.Ticket.ID
+	admission := &models.Admission{
+		TicketID:   ticketID,
+		AdmittedAt: scan.ScannedAt,
+		Gate:       scan.Gate,
+		DeviceID:   scan.DeviceID,
+	}
+
+	admitted, err := s.checkInRepo.AdmitTicket(tx, ticketID, admission.AdmittedAt, admission.Gate, admission.DeviceID)
+	if err != nil {
+		return err
+	}
+	if admitted {
+		result.Admission = admission
+		return nil
+	}
+
+	current, err := s.checkInRepo.GetAdmissionForUpdate(tx, ticketID)
+	if err != nil {
+		return err
+	}
+
+	if scan.Source == repositories.ScanSourceOffline {
+		// The offline device already let this holder in, so this is a duplicate entry either way
+		result.Conflict = true
+
+		if admission.AdmittedAt.Before(current.AdmittedAt) {
+			if err := s.checkInRepo.ReplaceAdmission(tx, admission); err != nil {
+				return err
+			}
+			result.Admission = admission
+			result.Superseded = current
+			return nil
+		}
+	}
+
+	result.Status = CheckInAlreadyAdmitted
+	result.Admission = current
+	return nil
+}
+
+// clampScanTime stops a device with a fast clock from claiming a future admission
+func clampScanTime(scannedAt time.Time) time.Time {
+	now := time.Now().UTC()
+	if scannedAt.After(now.Add(maxScanClockSkew)) {
+		return now
+	}
+	return scannedAt.UTC()
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// CredentialPrefix versions the credential envelope: TB1.<keyId>.<payload>.<signature>
+const CredentialPrefix = "TB1"
+
+var (
+	ErrInvalidCredential = errors.New("INVALID_CREDENTIAL")
+	ErrUnknownSigningKey = errors.New("UNKNOWN_SIGNING_KEY")
+	ErrRevokedSigningKey = errors.New("REVOKED_SIGNING_KEY")
+	ErrMissingNonce      = errors.New("MISSING_CREDENTIAL_NONCE")
+)
+
+// CredentialService signs and verifies ticket credentials with per-event Ed25519 keys.
+// Each key is generated from a random seed that is stored encrypted with a key
+// derived from the server secret. Scanners only need the public keys to verify
+// credentials offline.
+type CredentialService struct {
+	db      *db.DB
+	sealKey []byte
+	keyRepo *repositories.SigningKeyRepository
+	audit   *AuditService
+}
+
+func NewCredentialService(db *db.DB, secret string, keyRepo *repositories.SigningKeyRepository, audit *AuditService) *CredentialService {
+	return &CredentialService{
+		db:      db,
+		sealKey: sealingKey("ticket-signing-key", secret),
+		keyRepo: keyRepo,
+		audit:   audit,
+	}
+}
+
+// NewCredentialNonce returns a random nonce to store on a newly issued ticket
+func NewCredentialNonce() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ActiveKey returns the event's current signing key, creating the first one on
+// demand. An active key from before seeds were stored was derived from the server
+// secret; it is retired in favour of a random one, and keeps verifying.
+func (s *CredentialService) ActiveKey(eventID int) (*models.SigningKey, error) {
+	key, err := s.keyRepo.GetActiveKey(eventID)
+	if err == nil && key.SealedPrivateKey != "" {
+		return key, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	key, err = s.RotateKey(eventID, false, nil)
+	if err != nil && isUniqueConstraintError(err) {
+		// Another request created the first key concurrently
+		return s.keyRepo.GetActiveKey(eventID)
+	}
+	return key, err
+}
+
+// RotateKey creates a new active key for the event. Previous keys are retired, so
+// credentials they signed still verify, unless revokePrevious is set. Rotations
+// made by an actor are audited; the first key, created on demand, is not.
+func (s *CredentialService) RotateKey(eventID int, revokePrevious bool, actor *models.AuditActor) (*models.SigningKey, error) {
+	version, err := s.keyRepo.GetLatestVersion(eventID)
+	if err != nil {
+		return nil, err
+	}
+	version++
+
+	key, err := s.newKey(eventID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.keyRepo.RotateKey(tx, key, revokePrevious); err != nil {
+			return err
+		}
+		if actor == nil {
+			return nil
+		}
+		return s.audit.Record(tx, actor, AuditSigningKeyRotated, AuditEntityEvent, eventID, nil,
+			map[string]interface{}{"keyId": key.KeyID, "revokePrevious": revokePrevious},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.keyRepo.GetKeyByKeyID(key.KeyID)
+}
+
+// ListKeys returns every signing key for an event so scanners can cache them
+func (s *CredentialService) ListKeys(eventID int) ([]*models.SigningKey, error) {
+	return s.keyRepo.ListKeys(eventID)
+}
+
+// IssueForTicket builds and signs the credential for a loaded ticket
+func (s *CredentialService) IssueForTicket(ticket *models.Ticket) (string, error) {
+	if ticket.Event == nil {
+		return "", fmt.Errorf("ticket %d has no event loaded", ticket.ID)
+	}
+
+	key, err := s.ActiveKey(ticket.Event.ID)
+	if err != nil {
+		return "", err
+	}
+
+	return s.Issue(key, CredentialForTicket(ticket))
+}
+
+// Issue signs a credential payload with the given key
+func (s *CredentialService) Issue(key *models.SigningKey, credential *models.TicketCredential) (string, error) {
+	if credential.Nonce == "" {
+		return "", ErrMissingNonce
+	}
+
+	payload, err := json.Marshal(credential)
+	if err != nil {
+		return "", err
+	}
+
+	privateKey, err := s.privateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	signed := CredentialPrefix + "." + key.KeyID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(privateKey, []byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a credential against the stored public keys and returns its payload
+// together with the key that signed it
+func (s *CredentialService) Verify(credential string) (*models.TicketCredential, *models.SigningKey, error) {
+	keyID, err := CredentialKeyID(credential)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := s.keyRepo.GetKeyByKeyID(keyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrUnknownSigningKey
+		}
+		return nil, nil, err
+	}
+	if key.Status == repositories.SigningKeyRevoked {
+		return nil, nil, ErrRevokedSigningKey
+	}
+
+	publicKey, err := base64.RawURLEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := VerifyCredential(credential, ed25519.PublicKey(publicKey))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, key, nil
+}
+
+// CredentialForTicket builds the payload for a ticket loaded with its seat and event date
+func CredentialForTicket(ticket *models.Ticket) *models.TicketCredential {
+	credential := &models.TicketCredential{
+		TicketID:    ticket.ID,
+		EventDateID: ticket.EventDateID,
+		Nonce:       ticket.CredentialNonce,
+	}
+
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		credential.EventDate = ticket.EventDate.Date.Unix()
+	}
+
+	if ticket.Seat != nil {
+		credential.Seat = ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
+	}
+
+	return credential
+}
+
+// CredentialKeyID extracts the signing key ID from a credential without verifying it
+func CredentialKeyID(credential string) (string, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 4 || parts[0] != CredentialPrefix || parts[1] == "" {
+		return "", ErrInvalidCredential
+	}
+	return parts[1], nil
+}
+
+// VerifyCredential checks a credential's signature with an Ed25519 public key.
+// It needs no database access, so offline scanners can use it with cached keys.
+func VerifyCredential(credential string, publicKey ed25519.PublicKey) (*models.TicketCredential, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 4 || parts[0] != CredentialPrefix || len(publicKey) != ed25519.PublicKeySize {
+		return nil, ErrInvalidCredential
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	signed := strings.Join(parts[:3], ".")
+	if !ed25519.Verify(publicKey, []byte(signed), signature) {
+		return nil, ErrInvalidCredential
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	var decoded models.TicketCredential
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	return &decoded, nil
+}
+
+// newKey generates an active key for an event key version from a random seed,
+// sealing the seed for storage
+func (s *CredentialService) newKey(eventID int, version int) (*models.SigningKey, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	sealed, err := sealSecret(s.sealKey, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	return &models.SigningKey{
+		EventID:          eventID,
+		Version:          version,
+		KeyID:            fmt.Sprintf("e%dv%d", eventID, version),
+		PublicKey:        base64.RawURLEncoding.EncodeToString(publicKey),
+		SealedPrivateKey: sealed,
+		Status:           repositories.SigningKeyActive,
+	}, nil
+}
+
+// privateKey opens a key's stored seed
+func (s *CredentialService) privateKey(key *models.SigningKey) (ed25519.PrivateKey, error) {
+	if key.SealedPrivateKey == "" {
+		return nil, fmt.Errorf("signing key %s has no stored private key", key.KeyID)
+	}
+
+	seed, err := openSecret(s.sealKey, key.SealedPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", key.KeyID, err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key %s: stored seed has %d bytes", key.KeyID, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
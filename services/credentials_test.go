@@ -0,0 +1,89 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"database/sql/driver"
+	"encoding/base64"
+	"testing"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+var signingKeyColumns = []string{"id", "event_id", "version", "key_id", "public_key", "private_key", "status", "created_at", "retired_at"}
+
+func TestSigningKeysAreRandomAndSealed(t *testing.T) {
+	credentials := NewCredentialService(nil, "signing-secret", nil, nil)
+
+	first, err := credentials.newKey(7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := credentials.newKey(7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.PublicKey == second.PublicKey {
+		t.Fatal("two keys for the same event and version share a key pair")
+	}
+	if first.SealedPrivateKey == "" {
+		t.Fatal("key has no sealed seed")
+	}
+
+	credential := &models.TicketCredential{TicketID: 1010, EventDateID: 11, Nonce: "5f1c0a9e3b7d42c8a6e1f093"}
+	signed, err := credentials.Issue(first, credential)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	publicKey, err := base64.RawURLEncoding.DecodeString(first.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCredential(signed, ed25519.PublicKey(publicKey)); err != nil {
+		t.Fatalf("credential does not verify with the key's public key: %v", err)
+	}
+
+	// The secret alone no longer yields the key, and the seed needs the secret
+	if _, err := NewCredentialService(nil, "another-secret", nil, nil).Issue(first, credential); err == nil {
+		t.Error("a service with another secret signed with the sealed key")
+	}
+	legacy := *first
+	legacy.SealedPrivateKey = ""
+	if _, err := credentials.Issue(&legacy, credential); err == nil {
+		t.Error("a key without a stored seed signed a credential")
+	}
+}
+
+func TestActiveKeyRetiresLegacyDerivedKey(t *testing.T) {
+	sqlStub, database := newStubSQL(t)
+	credentials := NewCredentialService(database, "signing-secret", repositories.NewSigningKeyRepository(database), nil)
+
+	sqlStub.onQuery("WHERE event_id = ? AND status = ?", signingKeyColumns,
+		[]driver.Value{int64(1), int64(7), int64(1), "e7v1", "bGVnYWN5", "", repositories.SigningKeyActive, nil, nil})
+	sqlStub.onQuery("COALESCE(MAX(version), 0)", []string{"version"}, []driver.Value{int64(1)})
+	sqlStub.onExec("UPDATE event_signing_key SET status = ?, retired_at", 0, 1)
+	sqlStub.onExec("INSERT INTO event_signing_key", 2, 1)
+	sqlStub.onQuery("WHERE key_id = ?", signingKeyColumns,
+		[]driver.Value{int64(2), int64(7), int64(2), "e7v2", "bmV3", "c2VhbGVk", repositories.SigningKeyActive, nil, nil})
+
+	key, err := credentials.ActiveKey(7)
+	if err != nil {
+		t.Fatalf("ActiveKey: %v", err)
+	}
+	if key.KeyID != "e7v2" {
+		t.Errorf("active key %s, want the replacement e7v2", key.KeyID)
+	}
+
+	retired := sqlStub.ran("UPDATE event_signing_key SET status = ?, retired_at")
+	if len(retired) != 1 || retired[0].Args[0] != repositories.SigningKeyRetired {
+		t.Errorf("legacy key updates %v, want it retired, not revoked", retired)
+	}
+	inserted := sqlStub.ran("INSERT INTO event_signing_key")
+	// event_id, version, key_id, public_key, private_key, status
+	if len(inserted) != 1 || inserted[0].Args[2] != "e7v2" || inserted[0].Args[4] == "" {
+		t.Fatalf("inserted keys %v, want e7v2 with a sealed seed", inserted)
+	}
+	if _, err := credentials.privateKey(&models.SigningKey{KeyID: "e7v2", SealedPrivateKey: inserted[0].Args[4].(string)}); err != nil {
+		t.Errorf("stored seed does not open: %v", err)
+	}
+}
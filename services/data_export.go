@@ -0,0 +1,320 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	dataExportPollInterval = 10 * time.Second
+	// dataExportLease is how long a worker may spend on one export before
+	// another worker takes it over
+	dataExportLease       = 10 * time.Minute
+	dataExportMaxAttempts = 3
+	// dataExportTTL is how long a finished archive can be downloaded
+	dataExportTTL = 7 * 24 * time.Hour
+	// dataExportReuseWindow returns a recent finished export instead of building
+	// the same archive again
+	dataExportReuseWindow = 24 * time.Hour
+)
+
+var (
+	ErrExportNotReady = errors.New("EXPORT_NOT_READY")
+	ErrExportExpired  = errors.New("EXPORT_EXPIRED")
+)
+
+// DataExportService builds archives of everything held about a user: profile,
+// orders and tickets, sessions, check-ins and emails. Exports run in the
+// background; users poll the job and download the archive once it is ready.
+type DataExportService struct {
+	exportRepo     *repositories.DataExportRepository
+	userRepo       *repositories.UserRepository
+	roleRepo       *repositories.RoleRepository
+	mfaRepo        *repositories.MFARepository
+	identityRepo   *repositories.IdentityRepository
+	bookingRepo    *repositories.BookingRepository
+	sessionRepo    *repositories.SessionRepository
+	checkInRepo    *repositories.CheckInRepository
+	outboxRepo     *repositories.OutboxRepository
+	loginAuditRepo *repositories.LoginAuditRepository
+}
+
+func NewDataExportService(
+	exportRepo *repositories.DataExportRepository,
+	userRepo *repositories.UserRepository,
+	roleRepo *repositories.RoleRepository,
+	mfaRepo *repositories.MFARepository,
+	identityRepo *repositories.IdentityRepository,
+	bookingRepo *repositories.BookingRepository,
+	sessionRepo *repositories.SessionRepository,
+	checkInRepo *repositories.CheckInRepository,
+	outboxRepo *repositories.OutboxRepository,
+	loginAuditRepo *repositories.LoginAuditRepository,
+) *DataExportService {
+	return &DataExportService{
+		exportRepo:     exportRepo,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		mfaRepo:        mfaRepo,
+		identityRepo:   identityRepo,
+		bookingRepo:    bookingRepo,
+		sessionRepo:    sessionRepo,
+		checkInRepo:    checkInRepo,
+		outboxRepo:     outboxRepo,
+		loginAuditRepo: loginAuditRepo,
+	}
+}
+
+// Request queues an export for the user. An export already in progress, or one
+// finished within dataExportReuseWindow, is returned instead of a new one; the
+// bool reports whether a new job was created.
+func (s *DataExportService) Request(userID int, format string) (*models.DataExport, bool, error) {
+	latest, err := s.exportRepo.GetLatestExport(userID, format)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, false, err
+	}
+	if latest != nil {
+		if latest.Status != repositories.ExportReady {
+			return latest, false, nil
+		}
+		if latest.CompletedAt != nil && time.Since(*latest.CompletedAt) < dataExportReuseWindow {
+			return latest, false, nil
+		}
+	}
+
+	id, err := s.exportRepo.CreateExport(userID, format, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	export, err := s.exportRepo.GetExport(int(id))
+	if err != nil {
+		return nil, false, err
+	}
+	return export, true, nil
+}
+
+// Get returns one of the user's exports; other users' exports are not found
+func (s *DataExportService) Get(userID int, id int) (*models.DataExport, error) {
+	export, err := s.exportRepo.GetExport(id)
+	if err != nil {
+		return nil, err
+	}
+	if export.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return export, nil
+}
+
+// Download returns a finished export and its archive
+func (s *DataExportService) Download(userID int, id int) (*models.DataExport, []byte, error) {
+	export, err := s.Get(userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case export.Status == repositories.ExportExpired,
+		export.Status == repositories.ExportReady && export.ExpiresAt != nil && !time.Now().Before(*export.ExpiresAt):
+		return nil, nil, ErrExportExpired
+	case export.Status != repositories.ExportReady:
+		return nil, nil, ErrExportNotReady
+	}
+
+	data, err := s.exportRepo.GetExportData(export.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrExportExpired
+		}
+		return nil, nil, err
+	}
+	return export, data, nil
+}
+
+// Run builds queued exports until ctx is cancelled, and drops expired archives
+func (s *DataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(dataExportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := s.ProcessNext()
+			if err != nil {
+				log.Printf("data export: %v", err)
+			}
+			if err != nil || !processed {
+				break
+			}
+		}
+
+		if _, err := s.exportRepo.ExpireExports(time.Now()); err != nil {
+			log.Printf("data export: failed to expire archives: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessNext claims and builds one export, returning false when none was due
+func (s *DataExportService) ProcessNext() (bool, error) {
+	export, err := s.exportRepo.ClaimNext(dataExportLease)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	fileName, contentType, data, buildErr := s.build(export)
+	if buildErr == nil {
+		now := time.Now().UTC()
+		return true, s.exportRepo.CompleteExport(export.ID, fileName, contentType, data, now, now.Add(dataExportTTL))
+	}
+
+	log.Printf("data export %d attempt %d failed: %v", export.ID, export.Attempts, buildErr)
+	if export.Attempts >= dataExportMaxAttempts {
+		return true, s.exportRepo.FailExport(export.ID, buildErr.Error())
+	}
+	return true, s.exportRepo.RetryExport(export.ID, buildErr.Error())
+}
+
+// build collects the user's data and encodes it in the requested format
+func (s *DataExportService) build(export *models.DataExport) (string, string, []byte, error) {
+	archive, err := s.collect(export.UserID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	baseName := fmt.Sprintf("ticketbooth-export-%d-%s", export.UserID, time.Now().UTC().Format("20060102"))
+
+	if export.Format == repositories.ExportFormatZIP {
+		data, err := zipArchive(archive)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return baseName + ".zip", "application/zip", data, nil
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return "", "", nil, err
+	}
+	return baseName + ".json", "application/json", data, nil
+}
+
+func (s *DataExportService) collect(userID int) (*models.DataExportArchive, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &models.DataExportArchive{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Profile:     user,
+	}
+
+	if archive.Roles, err = s.roleRepo.GetUserRoles(userID); err != nil {
+		return nil, fmt.Errorf("roles: %w", err)
+	}
+
+	mfa, err := s.mfaRepo.GetMFA(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("mfa: %w", err)
+	}
+	archive.MFA = mfa
+
+	if archive.Identities, err = s.identityRepo.ListIdentities(userID); err != nil {
+		return nil, fmt.Errorf("linked accounts: %w", err)
+	}
+	if archive.Orders, err = s.bookingRepo.GetAllOrdersByUserID(strconv.Itoa(userID)); err != nil {
+		return nil, fmt.Errorf("orders: %w", err)
+	}
+	if archive.Sessions, err = s.sessionRepo.ListUserSessions(userID); err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+	if archive.CheckIns, err = s.checkInRepo.ListScansByUser(userID); err != nil {
+		return nil, fmt.Errorf("check-ins: %w", err)
+	}
+	if archive.Emails, err = s.outboxRepo.ListForUser(userID, user.Email); err != nil {
+		return nil, fmt.Errorf("emails: %w", err)
+	}
+	if archive.LoginLockouts, err = s.loginAuditRepo.ListUserLockouts(userID); err != nil {
+		return nil, fmt.Errorf("login lockouts: %w", err)
+	}
+
+	// Empty sections are written as [] rather than null
+	archive.Roles = nonNil(archive.Roles)
+	archive.Identities = nonNil(archive.Identities)
+	archive.Orders = nonNil(archive.Orders)
+	archive.Sessions = nonNil(archive.Sessions)
+	archive.CheckIns = nonNil(archive.CheckIns)
+	archive.Emails = nonNil(archive.Emails)
+	archive.LoginLockouts = nonNil(archive.LoginLockouts)
+
+	return archive, nil
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// zipArchive writes each section of the archive as its own JSON file
+func zipArchive(archive *models.DataExportArchive) ([]byte, error) {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", map[string]interface{}{
+			"generatedAt":    archive.GeneratedAt,
+			"profile":        archive.Profile,
+			"roles":          archive.Roles,
+			"mfa":            archive.MFA,
+			"linkedAccounts": archive.Identities,
+		}},
+		{"orders.json", archive.Orders},
+		{"sessions.json", archive.Sessions},
+		{"check-ins.json", archive.CheckIns},
+		{"emails.json", archive.Emails},
+		{"login-lockouts.json", archive.LoginLockouts},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
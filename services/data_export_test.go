@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+
+	"ticketbooth-backend/repositories"
+)
+
+func TestDataExportWorkerSkipsDeletedUsers(t *testing.T) {
+	sqlStub, database := newStubSQL(t)
+	service := NewDataExportService(
+		repositories.NewDataExportRepository(database),
+		repositories.NewUserRepository(database),
+		repositories.NewRoleRepository(database),
+		repositories.NewMFARepository(database),
+		repositories.NewIdentityRepository(database),
+		repositories.NewBookingRepository(database),
+		repositories.NewSessionRepository(database),
+		repositories.NewCheckInRepository(database),
+		repositories.NewOutboxRepository(database),
+		repositories.NewLoginAuditRepository(database),
+	)
+	// Only exports of users that are not deleted are claimable; none are left
+	sqlStub.onQuery("FROM data_export", []string{"id"})
+
+	processed, err := service.ProcessNext()
+	if err != nil {
+		t.Fatalf("ProcessNext: %v", err)
+	}
+	if processed {
+		t.Error("ProcessNext claimed an export")
+	}
+
+	claims := sqlStub.ran("FOR UPDATE SKIP LOCKED")
+	if len(claims) != 1 || !containsAll(claims[0].Query, "user_id IN (SELECT id FROM `user` WHERE deleted_at IS NULL)") {
+		t.Fatalf("claim queries %v do not exclude deleted users", claims)
+	}
+	if len(sqlStub.ran("FROM `user` WHERE id = ?")) != 0 {
+		t.Error("the worker collected user data without a claimed export")
+	}
+}
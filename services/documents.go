@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+	"ticketbooth-backend/models"
+)
+
+const (
+	documentDateFormat  = "Monday, January 2, 2006 at 3:04 PM"
+	documentQRSizePx    = 512
+	documentQRSizeMM    = 60.0
+	documentPageMargin  = 15.0
+	documentContentWide = 180.0
+)
+
+// DocumentService renders printable ticket and receipt PDFs
+type DocumentService struct {
+	credentials *CredentialService
+}
+
+func NewDocumentService(credentials *CredentialService) *DocumentService {
+	return &DocumentService{credentials: credentials}
+}
+
+// RenderOrderPDF renders an itemized receipt followed by one page per ticket
+func (s *DocumentService) RenderOrderPDF(order *models.Order) ([]byte, error) {
+	pdf := newDocument()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	addReceiptPage(pdf, tr, order)
+
+	for _, ticket := range order.Tickets {
+		// Refunded tickets stay on the receipt but get no printable page
+		if ticket.RefundedAt != nil {
+			continue
+		}
+		ticket.OrderID = order.ID
+		if err := s.addTicketPage(pdf, tr, ticket); err != nil {
+			return nil, err
+		}
+	}
+
+	return outputDocument(pdf)
+}
+
+// RenderTicketPDF renders a single printable ticket
+func (s *DocumentService) RenderTicketPDF(ticket *models.Ticket) ([]byte, error) {
+	pdf := newDocument()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	if err := s.addTicketPage(pdf, tr, ticket); err != nil {
+		return nil, err
+	}
+
+	return outputDocument(pdf)
+}
+
+func newDocument() *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(documentPageMargin, documentPageMargin, documentPageMargin)
+	pdf.SetAutoPageBreak(true, documentPageMargin)
+	pdf.SetCreator("Ticketbooth", true)
+	return pdf
+}
+
+func outputDocument(pdf *gofpdf.Fpdf) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func addReceiptPage(pdf *gofpdf.Fpdf, tr func(string) string, order *models.Order) {
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(0, 10, tr("Receipt"), "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 6, tr(fmt.Sprintf("Order #%d", order.ID)), "", 1, "L", false, 0, "")
+	if order.CreatedAt != nil {
+		pdf.CellFormat(0, 6, tr("Date: "+order.CreatedAt.Format(documentDateFormat)), "", 1, "L", false, 0, "")
+	}
+	if order.CustomerName != "" {
+		customer := order.CustomerName
+		if order.CustomerEmail != "" {
+			customer += " <" + order.CustomerEmail + ">"
+		}
+		pdf.CellFormat(0, 6, tr("Customer: "+customer), "", 1, "L", false, 0, "")
+	}
+	if order.PaymentSource != "" {
+		pdf.CellFormat(0, 6, tr("Payment: "+order.PaymentSource), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	columns := []struct {
+		title string
+		width float64
+		align string
+	}{
+		{"Ticket", 18, "L"},
+		{"Event", 62, "L"},
+		{"Type", 32, "L"},
+		{"Seat", 18, "L"},
+		{"Attendee", 30, "L"},
+		{"Price", 20, "R"},
+	}
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(235, 235, 235)
+	for _, column := range columns {
+		pdf.CellFormat(column.width, 8, tr(column.title), "B", 0, column.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 9)
+	lineTotal := 0.0
+	for _, ticket := range order.Tickets {
+		values := []string{
+			fmt.Sprintf("#%d", ticket.ID),
+			truncate(ticketEventLine(ticket), 42),
+			truncate(ticketTypeName(ticket), 20),
+			ticketSeatLabel(ticket),
+			truncate(ticket.ToName, 18),
+			fmt.Sprintf("%.2f", ticket.Price),
+		}
+		for i, column := range columns {
+			pdf.CellFormat(column.width, 7, tr(values[i]), "B", 0, column.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+		lineTotal += ticket.Price
+	}
+
+	total := lineTotal
+	if amount, err := strconv.ParseFloat(order.Amount, 64); err == nil {
+		total = amount
+	}
+
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(documentContentWide-20, 8, tr(fmt.Sprintf("Total (%d tickets)", len(order.Tickets))), "", 0, "R", false, 0, "")
+	pdf.CellFormat(20, 8, tr(fmt.Sprintf("%.2f", total)), "", 1, "R", false, 0, "")
+}
+
+func (s *DocumentService) addTicketPage(pdf *gofpdf.Fpdf, tr func(string) string, ticket *models.Ticket) error {
+	credential, err := s.credentials.IssueForTicket(ticket)
+	if err != nil {
+		return err
+	}
+
+	png, err := qrcode.Encode(credential, qrcode.Medium, documentQRSizePx)
+	if err != nil {
+		return err
+	}
+
+	pdf.AddPage()
+	top := pdf.GetY()
+
+	pdf.SetFont("Helvetica", "B", 22)
+	title := "Ticket"
+	if ticket.Event != nil {
+		title = ticket.Event.Title
+	}
+	pdf.MultiCell(documentContentWide-documentQRSizeMM-5, 10, tr(title), "", "L", false)
+	pdf.Ln(2)
+
+	details := [][2]string{}
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		details = append(details, [2]string{"Date", ticket.EventDate.Date.Format(documentDateFormat)})
+	}
+	if ticket.EventDate != nil && ticket.EventDate.Venue != nil {
+		details = append(details, [2]string{"Venue", ticket.EventDate.Venue.Name})
+	}
+	details = append(details, [2]string{"Ticket type", ticketTypeName(ticket)})
+	seat := ticketSeatLabel(ticket)
+	if seat == "" {
+		seat = "General admission"
+	}
+	details = append(details, [2]string{"Seat", seat})
+	if ticket.ToName != "" {
+		details = append(details, [2]string{"Attendee", ticket.ToName})
+	}
+	details = append(details, [2]string{"Ticket", fmt.Sprintf("#%d", ticket.ID)})
+	if ticket.OrderID != 0 {
+		details = append(details, [2]string{"Order", fmt.Sprintf("#%d", ticket.OrderID)})
+	}
+
+	for _, detail := range details {
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(30, 7, tr(detail[0]), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(documentContentWide-documentQRSizeMM-35, 7, tr(detail[1]), "", 1, "L", false, 0, "")
+	}
+
+	imageName := fmt.Sprintf("qr-%d", ticket.ID)
+	pdf.RegisterImageOptionsReader(imageName, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	pdf.ImageOptions(imageName, documentPageMargin+documentContentWide-documentQRSizeMM, top, documentQRSizeMM, documentQRSizeMM, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	pdf.SetY(top + documentQRSizeMM + 10)
+	pdf.SetFont("Helvetica", "I", 9)
+	pdf.MultiCell(documentContentWide, 5, tr("Present this QR code at the door. Each ticket admits one person once; copies of the code will be rejected after the first scan."), "T", "L", false)
+
+	return pdf.Error()
+}
+
+func ticketEventLine(ticket *models.Ticket) string {
+	line := ""
+	if ticket.Event != nil {
+		line = ticket.Event.Title
+	}
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		line += " - " + ticket.EventDate.Date.Format("Jan 2, 2006 3:04 PM")
+	}
+	return line
+}
+
+func ticketTypeName(ticket *models.Ticket) string {
+	if ticket.TicketType != nil {
+		return ticket.TicketType.Name
+	}
+	return ""
+}
+
+func ticketSeatLabel(ticket *models.Ticket) string {
+	if ticket.Seat != nil {
+		return ticket.Seat.Section + ticket.Seat.Row + ticket.Seat.Number
+	}
+	return ""
+}
+
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return string(runes[:max-3]) + "..."
+}
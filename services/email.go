@@ -0,0 +1,445 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+	"ticketbooth-backend/timezone"
+)
+
+// Email templates, stored as templates/email/<locale>/<name>.tmpl
+const (
+	EmailOrderConfirmation = "order_confirmation"
+	EmailOrderCancelled    = "order_cancelled"
+	EmailOrderRefunded     = "order_refunded"
+	EmailEventPostponed    = "event_postponed"
+	EmailTransferOffer     = "transfer_offer"
+	EmailPasswordReset     = "password_reset"
+	EmailVerification      = "email_verification"
+)
+
+// DefaultLocale is used when no template exists for the requested locale
+const DefaultLocale = "en"
+
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+// emailPayloads maps each template to the data type it renders, so queued
+// payloads decode back into the same struct the sender filled in
+var emailPayloads = map[string]func() interface{}{
+	EmailOrderConfirmation: func() interface{} { return &OrderConfirmationEmail{} },
+	EmailOrderCancelled:    func() interface{} { return &OrderCancelledEmail{} },
+	EmailOrderRefunded:     func() interface{} { return &OrderRefundedEmail{} },
+	EmailEventPostponed:    func() interface{} { return &EventPostponedEmail{} },
+	EmailTransferOffer:     func() interface{} { return &TransferOfferEmail{} },
+	EmailPasswordReset:     func() interface{} { return &PasswordResetEmail{} },
+	EmailVerification:      func() interface{} { return &EmailVerificationEmail{} },
+}
+
+type OrderConfirmationEmail struct {
+	OrderID      int           `json:"orderId"`
+	CustomerName string        `json:"customerName"`
+	EventTitle   string        `json:"eventTitle"`
+	EventDate    *time.Time    `json:"eventDate,omitempty"`
+	VenueName    string        `json:"venueName,omitempty"`
+	Tickets      []EmailTicket `json:"tickets"`
+	Total        float64       `json:"total"`
+}
+
+type EmailTicket struct {
+	ID       int     `json:"id"`
+	Type     string  `json:"type"`
+	Seat     string  `json:"seat,omitempty"`
+	Attendee string  `json:"attendee,omitempty"`
+	Price    float64 `json:"price"`
+}
+
+type OrderCancelledEmail struct {
+	OrderID      int        `json:"orderId"`
+	CustomerName string     `json:"customerName"`
+	EventTitle   string     `json:"eventTitle"`
+	EventDate    *time.Time `json:"eventDate,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	RefundAmount float64    `json:"refundAmount,omitempty"`
+}
+
+type OrderRefundedEmail struct {
+	OrderID      int     `json:"orderId"`
+	CustomerName string  `json:"customerName"`
+	EventTitle   string  `json:"eventTitle"`
+	Amount       float64 `json:"amount"`
+	TicketCount  int     `json:"ticketCount,omitempty"`
+	Reason       string  `json:"reason,omitempty"`
+}
+
+// EventPostponedEmail tells a purchaser their event date was postponed; the
+// tickets stay valid for the new date and can be refunded until
+// RefundDeadline. Times are on the venue's clock.
+type EventPostponedEmail struct {
+	OrderID        int        `json:"orderId"`
+	CustomerName   string     `json:"customerName"`
+	EventTitle     string     `json:"eventTitle"`
+	EventDate      *time.Time `json:"eventDate,omitempty"`
+	NewDate        *time.Time `json:"newDate,omitempty"`
+	RefundDeadline *time.Time `json:"refundDeadline,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+}
+
+type TransferOfferEmail struct {
+	SenderName    string     `json:"senderName"`
+	RecipientName string     `json:"recipientName"`
+	EventTitle    string     `json:"eventTitle"`
+	EventDate     *time.Time `json:"eventDate,omitempty"`
+	TicketCount   int        `json:"ticketCount"`
+	AcceptURL     string     `json:"acceptUrl"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+}
+
+type PasswordResetEmail struct {
+	Name      string     `json:"name"`
+	ResetURL  string     `json:"resetUrl"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type EmailVerificationEmail struct {
+	Name      string     `json:"name"`
+	VerifyURL string     `json:"verifyUrl"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Email is a message to queue; Data must be the payload type for Template
+type Email struct {
+	Template string
+	Locale   string
+	ToEmail  string
+	ToName   string
+	OrderID  int
+	Data     interface{}
+}
+
+// RenderedEmail is a template rendered for delivery
+type RenderedEmail struct {
+	Subject string
+	Body    string
+}
+
+// EmailTemplates holds the parsed templates for every locale
+type EmailTemplates struct {
+	locales map[string]map[string]*template.Template
+}
+
+// LoadEmailTemplates parses the embedded templates
+func LoadEmailTemplates() (*EmailTemplates, error) {
+	templates := &EmailTemplates{locales: make(map[string]map[string]*template.Template)}
+	funcs := template.FuncMap{
+		"money": func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	}
+
+	err := fs.WalkDir(emailTemplateFS, "templates/email", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path.Ext(file) != ".tmpl" {
+			return err
+		}
+
+		locale := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		tmpl, err := template.New(name).Funcs(funcs).ParseFS(emailTemplateFS, file)
+		if err != nil {
+			return err
+		}
+
+		if templates.locales[locale] == nil {
+			templates.locales[locale] = make(map[string]*template.Template)
+		}
+		templates.locales[locale][name] = tmpl
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range emailPayloads {
+		if templates.locales[DefaultLocale][name] == nil {
+			return nil, fmt.Errorf("missing %s template for default locale %s", name, DefaultLocale)
+		}
+	}
+
+	return templates, nil
+}
+
+// SupportedLocale returns the locale templates will use for a requested one,
+// matching "es-MX" to "es" and falling back to DefaultLocale
+func (t *EmailTemplates) SupportedLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if _, ok := t.locales[locale]; ok {
+		return locale
+	}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if _, ok := t.locales[locale[:i]]; ok {
+			return locale[:i]
+		}
+	}
+	return DefaultLocale
+}
+
+// Render renders a queued payload in the given locale
+func (t *EmailTemplates) Render(name string, locale string, payload []byte) (*RenderedEmail, error) {
+	newData, ok := emailPayloads[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	tmpl := t.locales[t.SupportedLocale(locale)][name]
+	if tmpl == nil {
+		tmpl = t.locales[DefaultLocale][name]
+	}
+
+	data := newData()
+	if err := json.Unmarshal(payload, data); err != nil {
+		return nil, err
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, err
+	}
+
+	return &RenderedEmail{
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimLeft(body.String(), "\n"),
+	}, nil
+}
+
+// NotificationService queues transactional emails in the outbox
+type NotificationService struct {
+	outboxRepo *repositories.OutboxRepository
+	userRepo   *repositories.UserRepository
+	templates  *EmailTemplates
+}
+
+func NewNotificationService(outboxRepo *repositories.OutboxRepository, userRepo *repositories.UserRepository, templates *EmailTemplates) *NotificationService {
+	return &NotificationService{
+		outboxRepo: outboxRepo,
+		userRepo:   userRepo,
+		templates:  templates,
+	}
+}
+
+// SupportedLocale resolves a requested locale to one with templates
+func (s *NotificationService) SupportedLocale(locale string) string {
+	return s.templates.SupportedLocale(locale)
+}
+
+// Queue adds an email to the outbox inside tx. Emails without a recipient are skipped.
+func (s *NotificationService) Queue(tx *sqlx.Tx, email *Email) error {
+	if email.ToEmail == "" {
+		return nil
+	}
+	if _, ok := emailPayloads[email.Template]; !ok {
+		return fmt.Errorf("unknown email template %q", email.Template)
+	}
+
+	payload, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	msg := &models.OutboxMessage{
+		Template: email.Template,
+		Locale:   s.templates.SupportedLocale(email.Locale),
+		ToEmail:  email.ToEmail,
+		ToName:   email.ToName,
+		Payload:  string(payload),
+	}
+	if email.OrderID != 0 {
+		msg.OrderID = &email.OrderID
+	}
+
+	return s.outboxRepo.Enqueue(tx, msg)
+}
+
+// QueueOrderConfirmation queues the confirmation for a booking made in tx. It goes
+// to the purchaser's email, or to the booking account when none was given.
+func (s *NotificationService) QueueOrderConfirmation(tx *sqlx.Tx, req *models.BookingRequest, eventDate *models.EventDate, booking *models.BookingResponse) error {
+	toEmail := req.CustomerEmail
+	if toEmail == "" {
+		user, err := s.userRepo.GetUserByID(req.UserID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if user != nil {
+			toEmail = user.Email
+		}
+	}
+
+	data := &OrderConfirmationEmail{
+		OrderID:      booking.OrderID,
+		CustomerName: req.CustomerName,
+		EventDate:    eventDate.Date,
+		Total:        booking.TotalAmount,
+		Tickets:      make([]EmailTicket, 0, len(booking.Tickets)),
+	}
+	if eventDate.Event != nil {
+		data.EventTitle = eventDate.Event.Title
+	}
+	if eventDate.Venue != nil {
+		data.VenueName = eventDate.Venue.Name
+	}
+
+	for _, ticket := range booking.Tickets {
+		emailTicket := EmailTicket{
+			ID:       ticket.ID,
+			Type:     ticket.TicketType,
+			Attendee: ticket.ToName,
+			Price:    ticket.Price,
+		}
+		if ticket.SeatLabel != nil {
+			emailTicket.Seat = *ticket.SeatLabel
+		}
+		data.Tickets = append(data.Tickets, emailTicket)
+	}
+
+	return s.Queue(tx, &Email{
+		Template: EmailOrderConfirmation,
+		Locale:   req.Locale,
+		ToEmail:  toEmail,
+		ToName:   req.CustomerName,
+		OrderID:  booking.OrderID,
+		Data:     data,
+	})
+}
+
+// QueueOrderRefund tells the purchaser about a refund issued in tx
+func (s *NotificationService) QueueOrderRefund(tx *sqlx.Tx, order *models.Order, eventTitle string, refund *models.OrderRefund) error {
+	toEmail, err := s.orderRecipient(order)
+	if err != nil {
+		return err
+	}
+
+	return s.Queue(tx, &Email{
+		Template: EmailOrderRefunded,
+		Locale:   order.Locale,
+		ToEmail:  toEmail,
+		ToName:   order.CustomerName,
+		OrderID:  order.ID,
+		Data: &OrderRefundedEmail{
+			OrderID:      order.ID,
+			CustomerName: order.CustomerName,
+			EventTitle:   eventTitle,
+			Amount:       refund.Amount,
+			TicketCount:  len(refund.TicketIDs),
+			Reason:       refund.Reason,
+		},
+	})
+}
+
+// QueueOrderCancelled tells the purchaser their event date was cancelled and
+// what the refund issued in tx pays back
+func (s *NotificationService) QueueOrderCancelled(tx *sqlx.Tx, order *models.Order, eventDate *models.EventDate, refund *models.OrderRefund) error {
+	toEmail, err := s.orderRecipient(order)
+	if err != nil {
+		return err
+	}
+
+	data := &OrderCancelledEmail{
+		OrderID:      order.ID,
+		CustomerName: order.CustomerName,
+		EventDate:    eventDate.Date,
+		Reason:       refund.Reason,
+		RefundAmount: refund.Amount,
+	}
+	if eventDate.Event != nil {
+		data.EventTitle = eventDate.Event.Title
+	}
+
+	return s.Queue(tx, &Email{
+		Template: EmailOrderCancelled,
+		Locale:   order.Locale,
+		ToEmail:  toEmail,
+		ToName:   order.CustomerName,
+		OrderID:  order.ID,
+		Data:     data,
+	})
+}
+
+// QueueEventPostponed tells the purchaser their event date was postponed by
+// change, when it moves to and how long they have to ask for a refund
+func (s *NotificationService) QueueEventPostponed(tx *sqlx.Tx, order *models.Order, eventDate *models.EventDate, change *models.EventDateChange) error {
+	toEmail, err := s.orderRecipient(order)
+	if err != nil {
+		return err
+	}
+
+	data := &EventPostponedEmail{
+		OrderID:        order.ID,
+		CustomerName:   order.CustomerName,
+		EventDate:      inZone(change.PreviousDate, eventDate.TimeZone),
+		NewDate:        inZone(change.NewDate, eventDate.TimeZone),
+		RefundDeadline: inZone(change.RefundDeadline, eventDate.TimeZone),
+		Reason:         change.Reason,
+	}
+	if eventDate.Event != nil {
+		data.EventTitle = eventDate.Event.Title
+	}
+
+	return s.Queue(tx, &Email{
+		Template: EmailEventPostponed,
+		Locale:   order.Locale,
+		ToEmail:  toEmail,
+		ToName:   order.CustomerName,
+		OrderID:  order.ID,
+		Data:     data,
+	})
+}
+
+// QueueTransferOffer emails the recipient of a ticket transfer a link to accept
+// it. Nothing calls it yet: there is no ticket transfer feature, which should
+// queue the offer in the transaction that creates it.
+func (s *NotificationService) QueueTransferOffer(tx *sqlx.Tx, toEmail string, locale string, offer *TransferOfferEmail) error {
+	return s.Queue(tx, &Email{
+		Template: EmailTransferOffer,
+		Locale:   locale,
+		ToEmail:  toEmail,
+		ToName:   offer.RecipientName,
+		Data:     offer,
+	})
+}
+
+// inZone converts t to the zone's clock; nil stays nil
+func inZone(t *time.Time, zone string) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := timezone.In(*t, zone)
+	return &local
+}
+
+// orderRecipient is the order's email, or the booking account's when none
+// was given
+func (s *NotificationService) orderRecipient(order *models.Order) (string, error) {
+	if order.CustomerEmail != "" {
+		return order.CustomerEmail, nil
+	}
+
+	user, err := s.userRepo.GetUserByID(order.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if user != nil {
+		return user.Email, nil
+	}
+	return "", nil
+}
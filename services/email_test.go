@@ -0,0 +1,59 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/repositories"
+)
+
+func TestQueueTransferOfferRendersInEachLocale(t *testing.T) {
+	templates, err := LoadEmailTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlStub, database := newStubSQL(t)
+	sqlStub.onExec("INSERT INTO email_outbox", 1, 1)
+	notifications := NewNotificationService(repositories.NewOutboxRepository(database), repositories.NewUserRepository(database), templates)
+
+	eventDate := time.Date(2026, 7, 15, 20, 0, 0, 0, time.UTC)
+	offer := &TransferOfferEmail{
+		SenderName:    "Alice",
+		RecipientName: "Carol",
+		EventTitle:    "Summer Concert",
+		EventDate:     &eventDate,
+		TicketCount:   2,
+		AcceptURL:     "https://tickets.test/transfers/accept?token=abc",
+	}
+
+	for _, locale := range []string{"en", "es-MX"} {
+		err := database.WithTx(func(tx *sqlx.Tx) error {
+			return notifications.QueueTransferOffer(tx, "carol@example.com", locale, offer)
+		})
+		if err != nil {
+			t.Fatalf("QueueTransferOffer(%s): %v", locale, err)
+		}
+	}
+
+	queued := sqlStub.ran("INSERT INTO email_outbox")
+	if len(queued) != 2 {
+		t.Fatalf("queued %d emails, want 2", len(queued))
+	}
+	for i, wantLocale := range []string{"en", "es"} {
+		// template, locale, to_email, to_name, order_id, payload, ...
+		args := queued[i].Args
+		if args[0] != EmailTransferOffer || args[1] != wantLocale || args[2] != "carol@example.com" || args[3] != "Carol" {
+			t.Errorf("queued %v", args[:4])
+		}
+
+		rendered, err := templates.Render(EmailTransferOffer, wantLocale, []byte(args[5].(string)))
+		if err != nil {
+			t.Fatalf("Render(%s): %v", wantLocale, err)
+		}
+		if !strings.Contains(rendered.Subject, "Alice") || !strings.Contains(rendered.Body, offer.AcceptURL) {
+			t.Errorf("%s transfer offer:\n%s\n%s", wantLocale, rendered.Subject, rendered.Body)
+		}
+	}
+}
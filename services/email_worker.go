@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	emailBatchSize    = 20
+	emailPollInterval = 5 * time.Second
+	// emailSendLease keeps a claimed message from being picked up again mid-send
+	emailSendLease   = 2 * time.Minute
+	emailMaxAttempts = 8
+	emailRetryBase   = 30 * time.Second
+	emailRetryMax    = 2 * time.Hour
+)
+
+// EmailAttachment is a file sent along with an email
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// EmailMessage is a fully rendered email ready for delivery
+type EmailMessage struct {
+	ToEmail     string
+	ToName      string
+	Subject     string
+	Body        string
+	Attachments []*EmailAttachment
+}
+
+// EmailSender delivers a rendered email
+type EmailSender interface {
+	Send(msg *EmailMessage) error
+}
+
+// SMTPSender delivers email through an SMTP server, upgrading to TLS when the
+// server offers STARTTLS
+type SMTPSender struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from mail.Address
+}
+
+func NewSMTPSender(host string, port string, username string, password string, from string) (*SMTPSender, error) {
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+
+	sender := &SMTPSender{
+		addr: net.JoinHostPort(host, port),
+		host: host,
+		from: *fromAddress,
+	}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return sender, nil
+}
+
+func (s *SMTPSender) Send(msg *EmailMessage) error {
+	to := mail.Address{Name: msg.ToName, Address: msg.ToEmail}
+	data, err := buildMIMEMessage(s.from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, data)
+}
+
+// outboxStore is the part of OutboxRepository the worker claims and settles
+// messages through
+type outboxStore interface {
+	ClaimDue(limit int, lease time.Duration) ([]*models.OutboxMessage, error)
+	MarkSent(id int, attempts int) error
+	MarkRetry(id int, attempts int, nextAttemptAt time.Time, lastError string) error
+	MarkFailed(id int, attempts int, lastError string) error
+}
+
+// EmailWorker delivers queued outbox messages, retrying failures with
+// exponential backoff until emailMaxAttempts is reached
+type EmailWorker struct {
+	outboxRepo  outboxStore
+	bookingRepo *repositories.BookingRepository
+	templates   *EmailTemplates
+	documents   *DocumentService
+	sender      EmailSender
+}
+
+func NewEmailWorker(
+	outboxRepo *repositories.OutboxRepository,
+	bookingRepo *repositories.BookingRepository,
+	templates *EmailTemplates,
+	documents *DocumentService,
+	sender EmailSender,
+) *EmailWorker {
+	return &EmailWorker{
+		outboxRepo:  outboxRepo,
+		bookingRepo: bookingRepo,
+		templates:   templates,
+		documents:   documents,
+		sender:      sender,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled
+func (w *EmailWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := w.ProcessBatch()
+			if err != nil {
+				log.Printf("email outbox: %v", err)
+			}
+			if err != nil || sent < emailBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch claims and delivers one batch of due messages, returning how many were claimed
+func (w *EmailWorker) ProcessBatch() (int, error) {
+	messages, err := w.outboxRepo.ClaimDue(emailBatchSize, emailSendLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		attempts := msg.Attempts + 1
+		sendErr := w.deliver(msg)
+
+		switch {
+		case sendErr == nil:
+			err = w.outboxRepo.MarkSent(msg.ID, attempts)
+		case attempts >= emailMaxAttempts:
+			log.Printf("email outbox: giving up on message %d after %d attempts: %v", msg.ID, attempts, sendErr)
+			err = w.outboxRepo.MarkFailed(msg.ID, attempts, sendErr.Error())
+		default:
+			err = w.outboxRepo.MarkRetry(msg.ID, attempts, time.Now().Add(emailRetryDelay(attempts)), sendErr.Error())
+		}
+		if err != nil {
+			return len(messages), err
+		}
+	}
+
+	return len(messages), nil
+}
+
+func (w *EmailWorker) deliver(msg *models.OutboxMessage) error {
+	rendered, err := w.templates.Render(msg.Template, msg.Locale, []byte(msg.Payload))
+	if err != nil {
+		return err
+	}
+
+	email := &EmailMessage{
+		ToEmail: msg.ToEmail,
+		ToName:  msg.ToName,
+		Subject: rendered.Subject,
+		Body:    rendered.Body,
+	}
+
+	// Confirmations carry the printable tickets, rendered at send time so the
+	// QR codes reflect the ticket's current credential
+	if msg.Template == EmailOrderConfirmation && msg.OrderID != nil {
+		order, err := w.bookingRepo.GetOrderByID(*msg.OrderID)
+		if err != nil {
+			return err
+		}
+		document, err := w.documents.RenderOrderPDF(order)
+		if err != nil {
+			return err
+		}
+		email.Attachments = append(email.Attachments, &EmailAttachment{
+			Filename:    fmt.Sprintf("order-%d.pdf", order.ID),
+			ContentType: "application/pdf",
+			Data:        document,
+		})
+	}
+
+	return w.sender.Send(email)
+}
+
+// emailRetryDelay doubles the wait after every failed attempt, up to emailRetryMax
+func emailRetryDelay(attempts int) time.Duration {
+	delay := emailRetryBase
+	for i := 1; i < attempts && delay < emailRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > emailRetryMax {
+		delay = emailRetryMax
+	}
+	return delay
+}
+
+// buildMIMEMessage encodes a plain-text email, as multipart/mixed when it has attachments
+func buildMIMEMessage(from mail.Address, to mail.Address, msg *EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	body := base64Lines([]byte(msg.Body))
+	if len(msg.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		buf.WriteString(body)
+		return buf.Bytes(), nil
+	}
+
+	boundaryBytes := make([]byte, 16)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, err
+	}
+	boundary := "tb-" + hex.EncodeToString(boundaryBytes)
+
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	buf.WriteString(body)
+
+	for _, attachment := range msg.Attachments {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", attachment.ContentType)
+		fmt.Fprintf(&buf, "Content-Disposition: %s\r\n", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		buf.WriteString(base64Lines(attachment.Data))
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+// base64Lines encodes data as base64 wrapped at 76 characters per RFC 2045
+func base64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var lines strings.Builder
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76])
+		lines.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	lines.WriteString(encoded)
+	lines.WriteString("\r\n")
+	return lines.String()
+}
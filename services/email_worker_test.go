@@ -0,0 +1,546 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// smtpSink is an in-process SMTP server that records every message it accepts
+type smtpSink struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []*sinkMessage
+	// reject answers RCPT with a temporary failure while set
+	reject bool
+	// hold, when set, keeps DATA from completing until it is closed;
+	// dataStarted is signalled when a message is waiting on it
+	hold        chan struct{}
+	dataStarted chan struct{}
+}
+
+type sinkMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &smtpSink{listener: listener, dataStarted: make(chan struct{}, 16)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+
+	return sink
+}
+
+func (s *smtpSink) sender(t *testing.T) *SMTPSender {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewSMTPSender(host, port, "", "", "Ticketbooth <no-reply@ticketbooth.test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+func (s *smtpSink) setReject(reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = reject
+}
+
+func (s *smtpSink) received() []*sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*sinkMessage(nil), s.messages...)
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) bool {
+		return text.PrintfLine(format, args...) == nil
+	}
+
+	if !reply("220 sink.ticketbooth.test ESMTP") {
+		return
+	}
+
+	msg := &sinkMessage{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 sink.ticketbooth.test")
+		case "MAIL":
+			msg = &sinkMessage{From: smtpPath(line)}
+			reply("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			reject := s.reject
+			s.mu.Unlock()
+			if reject {
+				reply("451 4.3.0 Mailbox temporarily unavailable")
+				continue
+			}
+			msg.To = append(msg.To, smtpPath(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = data
+
+			s.mu.Lock()
+			hold := s.hold
+			s.mu.Unlock()
+			if hold != nil {
+				s.dataStarted <- struct{}{}
+				<-hold
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK: queued")
+		case "RSET":
+			msg = &sinkMessage{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// smtpPath extracts the address from "MAIL FROM:<a@b>" or "RCPT TO:<a@b>"
+func smtpPath(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// memoryOutbox keeps outbox rows in memory with the same claim semantics as
+// OutboxRepository.ClaimDue: a claim takes due PENDING rows oldest first and
+// pushes their next attempt out by the lease, so no other claim sees them
+// until the lease runs out
+type memoryOutbox struct {
+	mu       sync.Mutex
+	messages map[int]*models.OutboxMessage
+	nextID   int
+}
+
+func newMemoryOutbox() *memoryOutbox {
+	return &memoryOutbox{messages: make(map[int]*models.OutboxMessage)}
+}
+
+func (o *memoryOutbox) enqueue(t *testing.T, template string, toEmail string, data interface{}) int {
+	t.Helper()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nextID++
+	o.messages[o.nextID] = &models.OutboxMessage{
+		ID:            o.nextID,
+		Template:      template,
+		Locale:        DefaultLocale,
+		ToEmail:       toEmail,
+		Payload:       string(payload),
+		Status:        repositories.OutboxPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	return o.nextID
+}
+
+func (o *memoryOutbox) get(id int) models.OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return *o.messages[id]
+}
+
+// makeDue moves a message's next attempt into the past, as if its backoff or
+// lease had run out
+func (o *memoryOutbox) makeDue(id int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages[id].NextAttemptAt = time.Now().UTC().Add(-time.Second)
+}
+
+func (o *memoryOutbox) setAttempts(id int, attempts int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages[id].Attempts = attempts
+}
+
+func (o *memoryOutbox) ClaimDue(limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now().UTC()
+	var due []*models.OutboxMessage
+	for _, msg := range o.messages {
+		if msg.Status == repositories.OutboxPending && !msg.NextAttemptAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*models.OutboxMessage, 0, len(due))
+	for _, msg := range due {
+		copied := *msg
+		claimed = append(claimed, &copied)
+		msg.NextAttemptAt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+func (o *memoryOutbox) MarkSent(id int, attempts int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg := o.messages[id]
+	now := time.Now().UTC()
+	msg.Status = repositories.OutboxSent
+	msg.Attempts = attempts
+	msg.SentAt = &now
+	msg.LastError = ""
+	return nil
+}
+
+func (o *memoryOutbox) MarkRetry(id int, attempts int, nextAttemptAt time.Time, lastError string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg := o.messages[id]
+	msg.Attempts = attempts
+	msg.NextAttemptAt = nextAttemptAt.UTC()
+	msg.LastError = lastError
+	return nil
+}
+
+func (o *memoryOutbox) MarkFailed(id int, attempts int, lastError string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg := o.messages[id]
+	msg.Status = repositories.OutboxFailed
+	msg.Attempts = attempts
+	msg.LastError = lastError
+	return nil
+}
+
+func newTestEmailWorker(t *testing.T, outbox *memoryOutbox, sink *smtpSink) *EmailWorker {
+	t.Helper()
+
+	templates, err := LoadEmailTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &EmailWorker{outboxRepo: outbox, templates: templates, sender: sink.sender(t)}
+}
+
+func passwordResetEmail(name string) *PasswordResetEmail {
+	return &PasswordResetEmail{Name: name, ResetURL: "https://tickets.test/reset?token=abc123"}
+}
+
+func TestEmailWorkerDeliversOverSMTP(t *testing.T) {
+	sink := newSMTPSink(t)
+	outbox := newMemoryOutbox()
+	worker := newTestEmailWorker(t, outbox, sink)
+	id := outbox.enqueue(t, EmailPasswordReset, "bob@example.com", passwordResetEmail("Bob"))
+
+	claimed, err := worker.ProcessBatch()
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	if claimed != 1 {
+		t.Fatalf("claimed %d messages, want 1", claimed)
+	}
+
+	received := sink.received()
+	if len(received) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(received))
+	}
+	if received[0].From != "no-reply@ticketbooth.test" || len(received[0].To) != 1 || received[0].To[0] != "bob@example.com" {
+		t.Errorf("unexpected envelope from %q to %v", received[0].From, received[0].To)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(received[0].Data)))
+	if err != nil {
+		t.Fatalf("sink received an invalid message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Reset your Ticketbooth password" {
+		t.Errorf("subject = %q (%v)", subject, err)
+	}
+	body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, parsed.Body))
+	if err != nil {
+		t.Fatalf("body is not base64: %v", err)
+	}
+	if !strings.Contains(string(body), "Hi Bob,") || !strings.Contains(string(body), "https://tickets.test/reset?token=abc123") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	msg := outbox.get(id)
+	if msg.Status != repositories.OutboxSent || msg.Attempts != 1 || msg.SentAt == nil {
+		t.Errorf("message after delivery: status %s, attempts %d, sentAt %v", msg.Status, msg.Attempts, msg.SentAt)
+	}
+}
+
+func TestEmailWorkerReschedulesFailedSendWithBackoff(t *testing.T) {
+	sink := newSMTPSink(t)
+	outbox := newMemoryOutbox()
+	worker := newTestEmailWorker(t, outbox, sink)
+	id := outbox.enqueue(t, EmailPasswordReset, "bob@example.com", passwordResetEmail("Bob"))
+
+	sink.setReject(true)
+	for attempt, wantDelay := range []time.Duration{30 * time.Second, time.Minute} {
+		before := time.Now()
+		if _, err := worker.ProcessBatch(); err != nil {
+			t.Fatalf("ProcessBatch: %v", err)
+		}
+		after := time.Now()
+
+		msg := outbox.get(id)
+		if msg.Status != repositories.OutboxPending || msg.Attempts != attempt+1 {
+			t.Fatalf("after failure %d: status %s, attempts %d", attempt+1, msg.Status, msg.Attempts)
+		}
+		if !strings.Contains(msg.LastError, "451") {
+			t.Errorf("last error %q does not carry the SMTP reply", msg.LastError)
+		}
+		if msg.NextAttemptAt.Before(before.Add(wantDelay)) || msg.NextAttemptAt.After(after.Add(wantDelay)) {
+			t.Errorf("after failure %d: next attempt in %s, want %s", attempt+1, msg.NextAttemptAt.Sub(after), wantDelay)
+		}
+
+		// Nothing is resent before the backoff runs out
+		claimed, err := worker.ProcessBatch()
+		if err != nil || claimed != 0 {
+			t.Fatalf("claimed %d messages during backoff (%v)", claimed, err)
+		}
+		outbox.makeDue(id)
+	}
+
+	sink.setReject(false)
+	if _, err := worker.ProcessBatch(); err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	msg := outbox.get(id)
+	if msg.Status != repositories.OutboxSent || msg.Attempts != 3 || msg.LastError != "" {
+		t.Errorf("after retry: status %s, attempts %d, last error %q", msg.Status, msg.Attempts, msg.LastError)
+	}
+	if received := sink.received(); len(received) != 1 {
+		t.Errorf("sink received %d messages, want 1", len(received))
+	}
+}
+
+func TestEmailWorkerGivesUpAfterMaxAttempts(t *testing.T) {
+	sink := newSMTPSink(t)
+	outbox := newMemoryOutbox()
+	worker := newTestEmailWorker(t, outbox, sink)
+	id := outbox.enqueue(t, EmailPasswordReset, "bob@example.com", passwordResetEmail("Bob"))
+	outbox.setAttempts(id, emailMaxAttempts-1)
+
+	sink.setReject(true)
+	if _, err := worker.ProcessBatch(); err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+
+	msg := outbox.get(id)
+	if msg.Status != repositories.OutboxFailed || msg.Attempts != emailMaxAttempts {
+		t.Errorf("status %s, attempts %d, want FAILED after %d", msg.Status, msg.Attempts, emailMaxAttempts)
+	}
+}
+
+func TestEmailRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{9, 2 * time.Hour},
+		{20, 2 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := emailRetryDelay(test.attempts); got != test.want {
+			t.Errorf("emailRetryDelay(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestEmailWorkerLeaseKeepsMessageFromSecondWorker(t *testing.T) {
+	sink := newSMTPSink(t)
+	outbox := newMemoryOutbox()
+	first := newTestEmailWorker(t, outbox, sink)
+	second := newTestEmailWorker(t, outbox, sink)
+	id := outbox.enqueue(t, EmailPasswordReset, "bob@example.com", passwordResetEmail("Bob"))
+
+	hold := make(chan struct{})
+	sink.mu.Lock()
+	sink.hold = hold
+	sink.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := first.ProcessBatch()
+		done <- err
+	}()
+
+	select {
+	case <-sink.dataStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first worker never started sending")
+	}
+
+	// The first worker is mid-send: its claim's lease hides the message
+	claimed, err := second.ProcessBatch()
+	if err != nil || claimed != 0 {
+		t.Fatalf("second worker claimed %d messages while the first was sending (%v)", claimed, err)
+	}
+
+	close(hold)
+	if err := <-done; err != nil {
+		t.Fatalf("first worker: %v", err)
+	}
+
+	if received := sink.received(); len(received) != 1 {
+		t.Errorf("sink received %d messages, want 1", len(received))
+	}
+	if msg := outbox.get(id); msg.Status != repositories.OutboxSent || msg.Attempts != 1 {
+		t.Errorf("status %s, attempts %d after one send", msg.Status, msg.Attempts)
+	}
+}
+
+func TestEmailWorkerResendsAfterLeaseExpires(t *testing.T) {
+	sink := newSMTPSink(t)
+	outbox := newMemoryOutbox()
+	worker := newTestEmailWorker(t, outbox, sink)
+	id := outbox.enqueue(t, EmailPasswordReset, "bob@example.com", passwordResetEmail("Bob"))
+
+	// A worker claims the message and dies before settling it
+	if _, err := outbox.ClaimDue(emailBatchSize, emailSendLease); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := worker.ProcessBatch(); err != nil || claimed != 0 {
+		t.Fatalf("claimed %d messages inside another worker's lease (%v)", claimed, err)
+	}
+
+	outbox.makeDue(id)
+	if claimed, err := worker.ProcessBatch(); err != nil || claimed != 1 {
+		t.Fatalf("claimed %d messages after the lease expired (%v)", claimed, err)
+	}
+	if received := sink.received(); len(received) != 1 {
+		t.Errorf("sink received %d messages, want 1", len(received))
+	}
+}
+
+func TestConcurrentEmailWorkersSendEachMessageOnce(t *testing.T) {
+	sink := newSMTPSink(t)
+	outbox := newMemoryOutbox()
+
+	const total = 2*emailBatchSize + 5
+	for i := 0; i < total; i++ {
+		outbox.enqueue(t, EmailPasswordReset, fmt.Sprintf("user%d@example.com", i), passwordResetEmail(fmt.Sprintf("User %d", i)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		worker := newTestEmailWorker(t, outbox, sink)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				claimed, err := worker.ProcessBatch()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if claimed == 0 {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, msg := range sink.received() {
+		for _, to := range msg.To {
+			counts[to]++
+		}
+	}
+	if len(counts) != total {
+		t.Errorf("sink received mail for %d recipients, want %d", len(counts), total)
+	}
+	for to, count := range counts {
+		if count != 1 {
+			t.Errorf("%s received %d copies", to, count)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	eventDateChangePollInterval = 10 * time.Second
+	// eventDateChangeLease is how long a worker may spend on one batch of
+	// orders before another worker takes the run over
+	eventDateChangeLease       = 5 * time.Minute
+	eventDateChangeBatchSize   = 100
+	eventDateChangeMaxAttempts = 3
+	// eventDateChangeRetryDelay spaces out the attempts at an order that failed
+	eventDateChangeRetryDelay = time.Minute
+	// defaultRefundWindow is how long holders of a postponed date may ask for a
+	// refund when the organizer does not say
+	defaultRefundWindow = 30 * 24 * time.Hour
+	// maxReportedFailures caps the failed orders listed in a progress report
+	maxReportedFailures = 100
+)
+
+var (
+	ErrNotOnSale               = errors.New("NOT_ON_SALE")
+	ErrSalesNotOpen            = errors.New("SALES_NOT_OPEN")
+	ErrSalesClosed             = errors.New("SALES_CLOSED")
+	ErrInvalidStatusTransition = errors.New("INVALID_STATUS_TRANSITION")
+	ErrEventDateClosed         = errors.New("EVENT_DATE_CLOSED")
+	ErrInvalidSchedule         = errors.New("INVALID_SCHEDULE")
+	ErrNothingToRetry          = errors.New("NOTHING_TO_RETRY")
+	ErrNoRefundWindow          = errors.New("NO_REFUND_WINDOW")
+
+	// errChangeOrderTaken rolls back work on an order another worker has
+	// already finished
+	errChangeOrderTaken = errors.New("order already processed")
+)
+
+// eventDateTransitions lists the states each state can move to. CANCELLED
+// and COMPLETED are final.
+var eventDateTransitions = map[string][]string{
+	repositories.EventDateDraft: {
+		repositories.EventDateOnSale, repositories.EventDateCancelled,
+	},
+	repositories.EventDateOnSale: {
+		repositories.EventDatePaused, repositories.EventDateSoldOut, repositories.EventDateCancelled,
+		repositories.EventDatePostponed, repositories.EventDateCompleted,
+	},
+	repositories.EventDatePaused: {
+		repositories.EventDateOnSale, repositories.EventDateSoldOut, repositories.EventDateCancelled,
+		repositories.EventDatePostponed, repositories.EventDateCompleted,
+	},
+	repositories.EventDateSoldOut: {
+		repositories.EventDateOnSale, repositories.EventDatePaused, repositories.EventDateCancelled,
+		repositories.EventDatePostponed, repositories.EventDateCompleted,
+	},
+	// Postponing again moves the date or announces the new one
+	repositories.EventDatePostponed: {
+		repositories.EventDateOnSale, repositories.EventDatePaused, repositories.EventDateSoldOut,
+		repositories.EventDateCancelled, repositories.EventDatePostponed, repositories.EventDateCompleted,
+	},
+}
+
+// CheckOnSale reports why eventDate cannot be booked at now, or nil when it
+// can. Sales close at the start time unless the date sets its own close.
+func CheckOnSale(eventDate *models.EventDate, now time.Time) error {
+	if eventDate.Status != repositories.EventDateOnSale {
+		return ErrNotOnSale
+	}
+	if eventDate.SalesOpenAt != nil && now.Before(*eventDate.SalesOpenAt) {
+		return ErrSalesNotOpen
+	}
+
+	closeAt := eventDate.SalesCloseAt
+	if closeAt == nil {
+		closeAt = eventDate.Date
+	}
+	if closeAt != nil && !now.Before(*closeAt) {
+		return ErrSalesClosed
+	}
+	return nil
+}
+
+// TimeUpdate changes one schedule field when Set: to Value, or to NULL when
+// Value is nil
+type TimeUpdate struct {
+	Set   bool
+	Value *time.Time
+}
+
+// EventDateSchedule is an update to an event date's times
+type EventDateSchedule struct {
+	Date         TimeUpdate
+	DoorsOpenAt  TimeUpdate
+	EndsAt       TimeUpdate
+	SalesOpenAt  TimeUpdate
+	SalesCloseAt TimeUpdate
+}
+
+// StatusChange moves an event date to Status
+type StatusChange struct {
+	Status string
+	Reason string
+	// NewDate moves a postponed date, with its doors and end
+	NewDate *time.Time
+	// RefundWindow is how long holders of a postponed date may ask for a
+	// refund; zero means defaultRefundWindow
+	RefundWindow time.Duration
+}
+
+// EventDateService runs the event date lifecycle for admins: scheduling,
+// status changes, and the cancellation and postponement runs that refund or
+// notify every order holding tickets for a date
+type EventDateService struct {
+	db            *db.DB
+	eventRepo     *repositories.EventRepository
+	changeRepo    *repositories.EventDateChangeRepository
+	refunds       *RefundService
+	notifications *NotificationService
+	audit         *AuditService
+}
+
+func NewEventDateService(
+	db *db.DB,
+	eventRepo *repositories.EventRepository,
+	changeRepo *repositories.EventDateChangeRepository,
+	refunds *RefundService,
+	notifications *NotificationService,
+	audit *AuditService,
+) *EventDateService {
+	return &EventDateService{
+		db:            db,
+		eventRepo:     eventRepo,
+		changeRepo:    changeRepo,
+		refunds:       refunds,
+		notifications: notifications,
+		audit:         audit,
+	}
+}
+
+// Schedule sets an event date's start, doors, end and sales window. The date
+// must keep a start time; cancelled and completed dates cannot change.
+func (s *EventDateService) Schedule(id int, schedule *EventDateSchedule, actor *models.AuditActor) error {
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		before, err := s.eventRepo.LockEventDate(tx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+		if before.Status == repositories.EventDateCancelled || before.Status == repositories.EventDateCompleted {
+			return ErrEventDateClosed
+		}
+
+		after := *before
+		after.Date = schedule.Date.apply(before.Date)
+		after.DoorsOpenAt = schedule.DoorsOpenAt.apply(before.DoorsOpenAt)
+		after.EndsAt = schedule.EndsAt.apply(before.EndsAt)
+		after.SalesOpenAt = schedule.SalesOpenAt.apply(before.SalesOpenAt)
+		after.SalesCloseAt = schedule.SalesCloseAt.apply(before.SalesCloseAt)
+		if !validSchedule(&after) {
+			return ErrInvalidSchedule
+		}
+
+		if err := s.eventRepo.UpdateEventDateSchedule(tx, &after); err != nil {
+			return err
+		}
+		return s.audit.Record(tx, actor, AuditEventDateScheduled, AuditEntityEventDate, id, scheduleAuditState(before), scheduleAuditState(&after))
+	})
+}
+
+// ChangeStatus moves an event date to req.Status on behalf of operatorID.
+// Cancelling or postponing also records a run over every order still holding
+// tickets for the date, in the same transaction, which Run then works through:
+// a cancellation refunds each order, a postponement tells each holder the new
+// date and how long they have to ask for a refund.
+func (s *EventDateService) ChangeStatus(id int, req *StatusChange, operatorID int, actor *models.AuditActor) (*models.EventDateStatusResponse, error) {
+	now := time.Now().UTC()
+	response := &models.EventDateStatusResponse{
+		ID:        id,
+		Status:    req.Status,
+		Reason:    req.Reason,
+		ChangedAt: now.Format(time.RFC3339),
+	}
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		before, err := s.eventRepo.LockEventDate(tx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+		if !canTransition(before.Status, req.Status) {
+			return ErrInvalidStatusTransition
+		}
+		response.PreviousStatus = before.Status
+
+		if req.NewDate != nil {
+			if err := s.moveDate(tx, before, *req.NewDate, now, actor); err != nil {
+				return err
+			}
+		}
+
+		if err := s.eventRepo.UpdateEventDateStatus(tx, id, req.Status, req.Reason, now); err != nil {
+			return err
+		}
+
+		after := map[string]interface{}{"status": req.Status, "reason": req.Reason}
+		if req.Status == repositories.EventDateCancelled || req.Status == repositories.EventDatePostponed {
+			change, err := s.startChange(tx, before, req, operatorID, now)
+			if err != nil {
+				return err
+			}
+			response.Change = change
+			after["changeId"] = change.ID
+		}
+
+		return s.audit.Record(tx, actor, AuditEventDateStatusChanged, AuditEntityEventDate, id,
+			map[string]interface{}{"status": before.Status, "reason": before.StatusReason},
+			after,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// moveDate reschedules a postponed date to newDate, moving doors and end by
+// the same amount
+func (s *EventDateService) moveDate(tx *sqlx.Tx, before *models.EventDate, newDate time.Time, now time.Time, actor *models.AuditActor) error {
+	if !newDate.After(now) {
+		return ErrInvalidSchedule
+	}
+
+	after := *before
+	after.Date = &newDate
+	if before.Date != nil {
+		shift := newDate.Sub(*before.Date)
+		after.DoorsOpenAt = shiftTime(before.DoorsOpenAt, shift)
+		after.EndsAt = shiftTime(before.EndsAt, shift)
+	}
+	if !validSchedule(&after) {
+		return ErrInvalidSchedule
+	}
+
+	if err := s.eventRepo.UpdateEventDateSchedule(tx, &after); err != nil {
+		return err
+	}
+	return s.audit.Record(tx, actor, AuditEventDateScheduled, AuditEntityEventDate, before.ID, scheduleAuditState(before), scheduleAuditState(&after))
+}
+
+// startChange records the run for a cancellation or postponement. Orders an
+// earlier postponement has not reached yet are dropped from it, so holders
+// only hear about the latest change.
+func (s *EventDateService) startChange(tx *sqlx.Tx, before *models.EventDate, req *StatusChange, operatorID int, now time.Time) (*models.EventDateChange, error) {
+	change := &models.EventDateChange{
+		EventDateID:    before.ID,
+		Kind:           repositories.ChangeCancel,
+		Reason:         req.Reason,
+		PreviousDate:   before.Date,
+		OperatorUserID: operatorID,
+		Status:         repositories.ChangePending,
+		CreatedAt:      now,
+	}
+
+	if req.Status == repositories.EventDatePostponed {
+		window := req.RefundWindow
+		if window <= 0 {
+			window = defaultRefundWindow
+		}
+		// There is no point asking for a refund once the new date has started
+		deadline := now.Add(window)
+		if req.NewDate != nil && deadline.After(*req.NewDate) {
+			deadline = *req.NewDate
+		}
+
+		change.Kind = repositories.ChangePostpone
+		change.NewDate = req.NewDate
+		change.RefundDeadline = &deadline
+	}
+
+	if err := s.changeRepo.SupersedePostponements(tx, before.ID); err != nil {
+		return nil, err
+	}
+
+	id, orders, err := s.changeRepo.CreateChange(tx, change)
+	if err != nil {
+		return nil, err
+	}
+	change.ID = id
+	change.Progress = &models.EventDateChangeProgress{Total: orders, Pending: orders}
+	return change, nil
+}
+
+// GetChange returns a run with its progress and the orders that failed
+func (s *EventDateService) GetChange(id int) (*models.EventDateChange, error) {
+	change, err := s.changeRepo.GetChange(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if change.Progress, err = s.changeRepo.GetProgress(id); err != nil {
+		return nil, err
+	}
+	if change.Progress.Failed > 0 {
+		if change.FailedOrders, err = s.changeRepo.ListFailedOrders(id, maxReportedFailures); err != nil {
+			return nil, err
+		}
+	}
+	return change, nil
+}
+
+// ListChanges returns an event date's runs with their progress, newest first
+func (s *EventDateService) ListChanges(eventDateID int) ([]*models.EventDateChange, error) {
+	if _, err := s.eventRepo.GetEventDateByID(eventDateID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	changes, err := s.changeRepo.ListChanges(eventDateID)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Progress, err = s.changeRepo.GetProgress(change.ID); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// RetryChange queues a run's failed orders again, returning the run as it
+// stands
+func (s *EventDateService) RetryChange(id int, actor *models.AuditActor) (*models.EventDateChange, error) {
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		change, err := s.changeRepo.LockChange(tx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		queued, err := s.changeRepo.RetryFailedOrders(tx, id)
+		if err != nil {
+			return err
+		}
+		if queued == 0 {
+			return ErrNothingToRetry
+		}
+
+		return s.audit.Record(tx, actor, AuditEventDateChangeRetried, AuditEntityEventDate, change.EventDateID,
+			nil, map[string]interface{}{"changeId": id, "orders": queued},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetChange(id)
+}
+
+// RefundPostponed refunds an order's tickets for a postponed date at the
+// holder's request, while the postponement's refund window is open. Other
+// users' orders are not found.
+func (s *EventDateService) RefundPostponed(orderID int, userID int, actor *models.AuditActor) (*models.OrderRefund, error) {
+	window, err := s.changeRepo.FindRefundWindow(orderID, time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoRefundWindow
+		}
+		return nil, err
+	}
+	if window.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	return s.refunds.RefundPostponedDate(orderID, window.EventDateID, userID, actor)
+}
+
+// Run works through cancellation and postponement runs until ctx is
+// cancelled
+func (s *EventDateService) Run(ctx context.Context) {
+	ticker := time.NewTicker(eventDateChangePollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := s.ProcessNext()
+			if err != nil {
+				log.Printf("event date change: %v", err)
+			}
+			if err != nil || !processed {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessNext claims one run and works through its pending orders, returning
+// false when none was due. Each order is marked done in the transaction that
+// refunds or notifies it, so a run cut short by a crash resumes where it
+// stopped once its lease lapses. An order that fails is tried again a minute
+// later, up to eventDateChangeMaxAttempts times, then left FAILED for an admin
+// to retry.
+func (s *EventDateService) ProcessNext() (bool, error) {
+	change, err := s.changeRepo.ClaimNext(eventDateChangeLease)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	eventDate, err := s.eventRepo.GetEventDateByID(change.EventDateID)
+	if err != nil {
+		return true, err
+	}
+	actor := &models.AuditActor{UserID: &change.OperatorUserID}
+
+	afterOrderID := 0
+	for {
+		items, err := s.changeRepo.ListPendingOrders(change.ID, afterOrderID, eventDateChangeBatchSize)
+		if err != nil {
+			return true, err
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			afterOrderID = item.OrderID
+			if err := s.processOrder(change, eventDate, item, actor); err != nil {
+				log.Printf("event date change %d: order %d: %v", change.ID, item.OrderID, err)
+				if err := s.changeRepo.FailOrderAttempt(change.ID, item.OrderID, err.Error(), eventDateChangeMaxAttempts); err != nil {
+					return true, err
+				}
+			}
+		}
+
+		if err := s.changeRepo.ExtendLease(change.ID, eventDateChangeLease); err != nil {
+			return true, err
+		}
+	}
+
+	completed, err := s.changeRepo.CompleteChange(change.ID, time.Now())
+	if err != nil || completed {
+		return true, err
+	}
+	return true, s.changeRepo.ReleaseChange(change.ID, time.Now().Add(eventDateChangeRetryDelay))
+}
+
+// processOrder refunds or notifies one order of a run
+func (s *EventDateService) processOrder(change *models.EventDateChange, eventDate *models.EventDate, item *models.EventDateChangeOrder, actor *models.AuditActor) error {
+	var err error
+	switch change.Kind {
+	case repositories.ChangeCancel:
+		_, err = s.refunds.RefundCancelledDate(item.OrderID, eventDate, change.Reason, change.OperatorUserID, actor,
+			func(tx *sqlx.Tx, refund *models.OrderRefund) error {
+				return s.finishOrder(tx, change.ID, item.OrderID, repositories.ChangeOrderDone, &refund.ID, &refund.Amount)
+			},
+		)
+		if err == ErrNothingToRefund {
+			// Refunded some other way since the run started
+			err = s.db.WithTx(func(tx *sqlx.Tx) error {
+				return s.finishOrder(tx, change.ID, item.OrderID, repositories.ChangeOrderSkipped, nil, nil)
+			})
+		}
+
+	case repositories.ChangePostpone:
+		err = s.db.WithTx(func(tx *sqlx.Tx) error {
+			if err := s.finishOrder(tx, change.ID, item.OrderID, repositories.ChangeOrderDone, nil, nil); err != nil {
+				return err
+			}
+			return s.notifications.QueueEventPostponed(tx, item.Order, eventDate, change)
+		})
+	}
+
+	if err == errChangeOrderTaken {
+		return nil
+	}
+	return err
+}
+
+func (s *EventDateService) finishOrder(tx *sqlx.Tx, changeID int, orderID int, status string, refundID *int, refundAmount *float64) error {
+	finished, err := s.changeRepo.FinishOrder(tx, changeID, orderID, status, refundID, refundAmount, time.Now())
+	if err != nil {
+		return err
+	}
+	if !finished {
+		return errChangeOrderTaken
+	}
+	return nil
+}
+
+func canTransition(from string, to string) bool {
+	for _, next := range eventDateTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func shiftTime(value *time.Time, by time.Duration) *time.Time {
+	if value == nil {
+		return nil
+	}
+	shifted := value.Add(by)
+	return &shifted
+}
+
+func (u TimeUpdate) apply(current *time.Time) *time.Time {
+	if u.Set {
+		return u.Value
+	}
+	return current
+}
+
+// validSchedule checks doors open no later than the start, the end follows
+// the start, and sales open before they close
+func validSchedule(eventDate *models.EventDate) bool {
+	if eventDate.Date == nil {
+		return false
+	}
+	if eventDate.DoorsOpenAt != nil && eventDate.DoorsOpenAt.After(*eventDate.Date) {
+		return false
+	}
+	if eventDate.EndsAt != nil && !eventDate.EndsAt.After(*eventDate.Date) {
+		return false
+	}
+	if eventDate.SalesOpenAt != nil && eventDate.SalesCloseAt != nil && !eventDate.SalesOpenAt.Before(*eventDate.SalesCloseAt) {
+		return false
+	}
+	return true
+}
+
+func scheduleAuditState(eventDate *models.EventDate) map[string]interface{} {
+	return map[string]interface{}{
+		"date":         eventDate.Date,
+		"doorsOpenAt":  eventDate.DoorsOpenAt,
+		"endsAt":       eventDate.EndsAt,
+		"salesOpenAt":  eventDate.SalesOpenAt,
+		"salesCloseAt": eventDate.SalesCloseAt,
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// LedgerService posts sales and refunds to the double-entry ledger. Posting
+// happens in the caller's transaction, so the ledger commits or rolls back
+// with the order or refund it describes.
+type LedgerService struct {
+	ledgerRepo *repositories.LedgerRepository
+	rates      ledger.Rates
+}
+
+func NewLedgerService(ledgerRepo *repositories.LedgerRepository, rates ledger.Rates) *LedgerService {
+	return &LedgerService{
+		ledgerRepo: ledgerRepo,
+		rates:      rates,
+	}
+}
+
+// RecordSale posts a new order, split at the current fee and tax rates. Free
+// orders move no money and are not posted.
+func (s *LedgerService) RecordSale(tx *sqlx.Tx, orderID int, eventID int, gross ledger.Amount) error {
+	if gross <= 0 {
+		return nil
+	}
+	return s.post(tx, ledger.Sale(orderID, eventID, s.rates.Split(gross), time.Now().UTC()))
+}
+
+// RecordRefund posts a refund of amount against an order, reversing the
+// matching share of the order's sale. order.RefundedAmount must be the total
+// refunded before this refund. An order placed before the ledger existed has
+// its sale posted first.
+func (s *LedgerService) RecordRefund(tx *sqlx.Tx, order *models.Order, refundID int, eventID int, amount ledger.Amount) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	sale, err := s.ledgerRepo.GetOrderSaleSplit(tx, order.ID)
+	if err == sql.ErrNoRows {
+		paid, err := ledger.ParseAmount(order.Amount)
+		if err != nil {
+			return fmt.Errorf("order %d amount: %w", order.ID, err)
+		}
+		sale = s.rates.Split(paid)
+
+		backfill := ledger.Sale(order.ID, eventID, sale, time.Now().UTC())
+		backfill.Memo = "Sale posted at first refund; order predates the ledger"
+		if err := s.post(tx, backfill); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	before := ledger.FromFloat(order.RefundedAmount)
+	share := sale.Share(before + amount).Minus(sale.Share(before))
+	return s.post(tx, ledger.Refund(order.ID, refundID, eventID, share, time.Now().UTC()))
+}
+
+// TrialBalance sums every account over transactions before asOf (all when
+// nil) and counts transactions that break the debits-equal-credits rule
+func (s *LedgerService) TrialBalance(asOf *time.Time) (*ledger.TrialBalance, int, error) {
+	balances, err := s.ledgerRepo.ListBalances(asOf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	unbalanced, err := s.ledgerRepo.CountUnbalancedTransactions(asOf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ledger.NewTrialBalance(balances), unbalanced, nil
+}
+
+// post enforces the balance invariant before anything is written
+func (s *LedgerService) post(tx *sqlx.Tx, t *ledger.Transaction) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("ledger %s for order %d: %w", t.Kind, t.OrderID, err)
+	}
+	_, err := s.ledgerRepo.CreateTransaction(tx, t)
+	return err
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+func TestRecordRefundBackfillsPreLedgerSale(t *testing.T) {
+	sqlStub, database := newStubSQL(t)
+	service := NewLedgerService(repositories.NewLedgerRepository(database), testRates)
+	// The order has no sale in the ledger
+	sqlStub.onQuery("FROM ledger_entry le", []string{"account", "net"})
+	sqlStub.onExec("INSERT INTO ledger_transaction", 21, 1)
+	sqlStub.onExec("INSERT INTO ledger_entry", 0, 1)
+
+	order := &models.Order{ID: 5, Amount: "100.00", RefundedAmount: 20}
+	err := database.WithTx(func(tx *sqlx.Tx) error {
+		return service.RecordRefund(tx, order, 11, 3, ledger.FromFloat(30))
+	})
+	if err != nil {
+		t.Fatalf("RecordRefund: %v", err)
+	}
+
+	transactions := postedTransactions(t, sqlStub)
+	if len(transactions) != 2 || transactions[0].Kind != ledger.KindSale || transactions[1].Kind != ledger.KindRefund {
+		t.Fatalf("posted %+v, want the backfilled sale, then the refund", transactions)
+	}
+	if transactions[0].Memo == "" {
+		t.Errorf("backfilled sale has no memo")
+	}
+
+	// The sale is the whole order at the current rates, not just what is left
+	var received ledger.Amount
+	for _, entry := range transactions[0].Entries {
+		if entry.Account == ledger.CustomerReceivable {
+			received = entry.Debit
+		}
+	}
+	if received != 10000 {
+		t.Errorf("backfilled sale received %s, want 100.00", received)
+	}
+
+	// Only the 20.00 to 50.00 slice of the sale is reversed
+	want := testRates.Split(10000).Share(5000).Minus(testRates.Split(10000).Share(2000))
+	for _, entry := range transactions[1].Entries {
+		switch entry.Account {
+		case ledger.Refunds:
+			if entry.Credit != 3000 {
+				t.Errorf("refunds credited %s, want 30.00", entry.Credit)
+			}
+		case ledger.OrganizerPayable:
+			if entry.Debit != want.Organizer {
+				t.Errorf("organizer debited %s, want %s", entry.Debit, want.Organizer)
+			}
+		case ledger.PlatformFees:
+			if entry.Debit != want.Fees {
+				t.Errorf("fees debited %s, want %s", entry.Debit, want.Fees)
+			}
+		case ledger.TaxPayable:
+			if entry.Debit != want.Tax {
+				t.Errorf("tax debited %s, want %s", entry.Debit, want.Tax)
+			}
+		}
+	}
+}
+
+func TestRecordRefundUsesRecordedSaleSplit(t *testing.T) {
+	sqlStub, database := newStubSQL(t)
+	// Rates changed since the sale; the refund follows the recorded split
+	service := NewLedgerService(repositories.NewLedgerRepository(database), ledger.Rates{PlatformFee: 1000})
+	sqlStub.onQuery("FROM ledger_entry le", []string{"account", "net"},
+		[]driver.Value{string(ledger.OrganizerPayable), "81.90"},
+		[]driver.Value{string(ledger.PlatformFees), "4.31"},
+		[]driver.Value{string(ledger.TaxPayable), "13.79"},
+	)
+	sqlStub.onExec("INSERT INTO ledger_transaction", 21, 1)
+	sqlStub.onExec("INSERT INTO ledger_entry", 0, 1)
+
+	order := &models.Order{ID: 5, Amount: "100.00"}
+	err := database.WithTx(func(tx *sqlx.Tx) error {
+		return service.RecordRefund(tx, order, 11, 3, ledger.FromFloat(100))
+	})
+	if err != nil {
+		t.Fatalf("RecordRefund: %v", err)
+	}
+
+	transactions := postedTransactions(t, sqlStub)
+	if len(transactions) != 1 || transactions[0].Kind != ledger.KindRefund {
+		t.Fatalf("posted %+v, want only the refund", transactions)
+	}
+	debits := map[ledger.Account]ledger.Amount{}
+	for _, entry := range transactions[0].Entries {
+		debits[entry.Account] = entry.Debit
+	}
+	if debits[ledger.OrganizerPayable] != 8190 || debits[ledger.PlatformFees] != 431 || debits[ledger.TaxPayable] != 1379 {
+		t.Errorf("full refund debited %v, want the recorded sale reversed exactly", debits)
+	}
+}
+
+func TestRecordSaleSkipsFreeOrders(t *testing.T) {
+	sqlStub, database := newStubSQL(t)
+	service := NewLedgerService(repositories.NewLedgerRepository(database), testRates)
+
+	err := database.WithTx(func(tx *sqlx.Tx) error {
+		return service.RecordSale(tx, 5, 3, 0)
+	})
+	if err != nil {
+		t.Fatalf("RecordSale: %v", err)
+	}
+	if len(sqlStub.ran("INSERT INTO ledger")) != 0 {
+		t.Errorf("a free order was posted to the ledger")
+	}
+}
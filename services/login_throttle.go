@@ -0,0 +1,297 @@
+package services
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// Lockout scopes, also stored as login_lockout.scope
+const (
+	LockoutScopeAccount = "ACCOUNT"
+	LockoutScopeIP      = "IP"
+)
+
+// AttemptStore keeps sliding-window failure counters and lockouts by key.
+// MemoryAttemptStore serves a single instance; a shared store (e.g. Redis)
+// can implement the same interface when the API runs on several nodes.
+type AttemptStore interface {
+	// RecordFailure adds a failure at now and returns the failures within window
+	RecordFailure(key string, now time.Time, window time.Duration) int
+	// Failures returns the failures within window and the time of the latest one
+	Failures(key string, now time.Time, window time.Duration) (int, time.Time)
+	// Reset forgets every failure recorded for key
+	Reset(key string)
+	// Lock blocks key until the given time
+	Lock(key string, until time.Time)
+	// LockedUntil returns when the lock on key expires, if it is locked at now
+	LockedUntil(key string, now time.Time) (time.Time, bool)
+}
+
+// LoginThrottlePolicy configures delays and lockouts for one scope
+type LoginThrottlePolicy struct {
+	Window time.Duration
+	// FreeAttempts failures are allowed before delays start
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// LockAfter failures within Window lock the key for LockFor
+	LockAfter int
+	LockFor   time.Duration
+}
+
+// Default policies: accounts lock quickly, while IPs tolerate more failures
+// since many users can share one address
+var (
+	DefaultAccountThrottle = LoginThrottlePolicy{
+		Window:       15 * time.Minute,
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockAfter:    10,
+		LockFor:      15 * time.Minute,
+	}
+	DefaultIPThrottle = LoginThrottlePolicy{
+		Window:       15 * time.Minute,
+		FreeAttempts: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockAfter:    50,
+		LockFor:      30 * time.Minute,
+	}
+)
+
+// LoginThrottle limits password attempts per account and per client IP with
+// progressive delays and temporary lockouts. Lockouts are recorded for audit.
+type LoginThrottle struct {
+	store     AttemptStore
+	auditRepo *repositories.LoginAuditRepository
+	account   LoginThrottlePolicy
+	ip        LoginThrottlePolicy
+}
+
+func NewLoginThrottle(store AttemptStore, auditRepo *repositories.LoginAuditRepository, account LoginThrottlePolicy, ip LoginThrottlePolicy) *LoginThrottle {
+	return &LoginThrottle{
+		store:     store,
+		auditRepo: auditRepo,
+		account:   account,
+		ip:        ip,
+	}
+}
+
+// ThrottleResult tells the caller whether an attempt may proceed
+type ThrottleResult struct {
+	Allowed    bool
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+// Check decides whether a login attempt may be tried now. identifier is the email
+// or username as submitted; user is the matching account, or nil if there is none.
+func (t *LoginThrottle) Check(identifier string, user *models.User, ip string) *ThrottleResult {
+	now := time.Now()
+	result := &ThrottleResult{Allowed: true}
+
+	for _, scope := range t.scopes(identifier, user, ip) {
+		if until, locked := t.store.LockedUntil(scope.key, now); locked {
+			result.restrict(until.Sub(now), true)
+			continue
+		}
+
+		failures, last := t.store.Failures(scope.key, now, scope.policy.Window)
+		if wait := last.Add(scope.policy.delay(failures)).Sub(now); wait > 0 {
+			result.restrict(wait, false)
+		}
+	}
+
+	return result
+}
+
+// RecordFailure counts a failed attempt and locks keys that reach their limit
+func (t *LoginThrottle) RecordFailure(identifier string, user *models.User, ip string) {
+	now := time.Now()
+
+	for _, scope := range t.scopes(identifier, user, ip) {
+		failures := t.store.RecordFailure(scope.key, now, scope.policy.Window)
+		if failures < scope.policy.LockAfter {
+			continue
+		}
+
+		until := now.Add(scope.policy.LockFor)
+		t.store.Lock(scope.key, until)
+		t.store.Reset(scope.key)
+
+		lockout := &models.LoginLockout{
+			Scope:       scope.name,
+			Subject:     scope.subject,
+			IPAddress:   ip,
+			Failures:    failures,
+			LockedUntil: until.UTC(),
+		}
+		if user != nil && scope.name == LockoutScopeAccount {
+			lockout.UserID = &user.ID
+		}
+		if err := t.auditRepo.CreateLockout(lockout); err != nil {
+			log.Printf("failed to record login lockout for %s %s: %v", scope.name, scope.subject, err)
+		}
+	}
+}
+
+// RecordSuccess clears the account's failures; the IP keeps its history so one
+// valid account cannot be used to reset a stuffing run
+func (t *LoginThrottle) RecordSuccess(user *models.User) {
+	t.store.Reset(accountThrottleKey("", user))
+}
+
+type throttleScope struct {
+	name    string
+	subject string
+	key     string
+	policy  LoginThrottlePolicy
+}
+
+func (t *LoginThrottle) scopes(identifier string, user *models.User, ip string) []throttleScope {
+	return []throttleScope{
+		{name: LockoutScopeAccount, subject: identifier, key: accountThrottleKey(identifier, user), policy: t.account},
+		{name: LockoutScopeIP, subject: ip, key: "ip:" + ip, policy: t.ip},
+	}
+}
+
+// accountThrottleKey keys existing accounts by ID, so logging in by email and by
+// username share one counter; unknown identifiers are counted as typed
+func accountThrottleKey(identifier string, user *models.User) string {
+	if user != nil {
+		return "user:" + strconv.Itoa(user.ID)
+	}
+	return "login:" + identifier
+}
+
+// delay doubles from BaseDelay for every failure past FreeAttempts, up to MaxDelay
+func (p LoginThrottlePolicy) delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func (r *ThrottleResult) restrict(wait time.Duration, locked bool) {
+	r.Allowed = false
+	r.Locked = r.Locked || locked
+	if wait > r.RetryAfter {
+		r.RetryAfter = wait
+	}
+}
+
+// MemoryAttemptStore is an in-process AttemptStore
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	failures  map[string][]time.Time
+	locks     map[string]time.Time
+	lastSweep time.Time
+}
+
+// memoryStoreSweepInterval bounds how often stale keys are dropped
+const memoryStoreSweepInterval = 5 * time.Minute
+
+// memoryStoreRetention is how long an idle key's failures are kept before sweeping
+const memoryStoreRetention = time.Hour
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		failures: make(map[string][]time.Time),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	attempts := append(prune(s.failures[key], now.Add(-window)), now)
+	s.failures[key] = attempts
+	return len(attempts)
+}
+
+func (s *MemoryAttemptStore) Failures(key string, now time.Time, window time.Duration) (int, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := prune(s.failures[key], now.Add(-window))
+	if len(attempts) == 0 {
+		delete(s.failures, key)
+		return 0, time.Time{}
+	}
+	s.failures[key] = attempts
+	return len(attempts), attempts[len(attempts)-1]
+}
+
+func (s *MemoryAttemptStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+}
+
+func (s *MemoryAttemptStore) Lock(key string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = until
+}
+
+func (s *MemoryAttemptStore) LockedUntil(key string, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !until.After(now) {
+		delete(s.locks, key)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// sweep drops expired locks and keys idle for longer than memoryStoreRetention,
+// so spraying many usernames cannot grow the maps without bound
+func (s *MemoryAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, attempts := range s.failures {
+		if len(attempts) == 0 || now.Sub(attempts[len(attempts)-1]) > memoryStoreRetention {
+			delete(s.failures, key)
+		}
+	}
+	for key, until := range s.locks {
+		if !until.After(now) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// prune drops attempts older than cutoff; attempts are stored oldest first
+func prune(attempts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(attempts) && !attempts[i].After(cutoff) {
+		i++
+	}
+	return attempts[i:]
+}
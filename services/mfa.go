@@ -0,0 +1,482 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	mfaChallengeTTL  = 5 * time.Minute
+	mfaEnrollTTL     = 15 * time.Minute
+	recoveryCodeSize = 10
+	recoveryCodeLen  = 10
+)
+
+var (
+	ErrInvalidMFAToken   = errors.New("INVALID_MFA_TOKEN")
+	ErrInvalidMFACode    = errors.New("INVALID_MFA_CODE")
+	ErrMFAAlreadyEnabled = errors.New("MFA_ALREADY_ENABLED")
+	ErrMFANotEnabled     = errors.New("MFA_NOT_ENABLED")
+	ErrMFANotStarted     = errors.New("MFA_ENROLLMENT_NOT_STARTED")
+	ErrMFARequired       = errors.New("MFA_REQUIRED")
+)
+
+// mfaRequiredRoles must use a second factor; they can change prices and refund orders
+var mfaRequiredRoles = []string{repositories.RoleAdmin, repositories.RoleOrganizer}
+
+// LoginResult holds either a new session or an MFA challenge to complete first
+type LoginResult struct {
+	Session   *TokenPair
+	Challenge *MFAChallenge
+}
+
+// MFAChallenge is the short-lived token that stands in for a session until the
+// second factor is verified, or enrolled when the account's role requires one
+type MFAChallenge struct {
+	Token              string
+	EnrollmentRequired bool
+	ExpiresIn          int
+}
+
+// TOTPEnrollment is shown once to the user to set up their authenticator app
+type TOTPEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// MFAService handles TOTP enrollment, recovery codes and the second login step.
+// TOTP secrets are encrypted with a key derived from the auth secret; recovery
+// codes and challenge tokens are stored as SHA-256 hashes.
+type MFAService struct {
+	db        *db.DB
+	userRepo  *repositories.UserRepository
+	roleRepo  *repositories.RoleRepository
+	mfaRepo   *repositories.MFARepository
+	tokenRepo *repositories.UserTokenRepository
+	auth      *AuthService
+	key       []byte
+	issuer    string
+}
+
+func NewMFAService(
+	db *db.DB,
+	userRepo *repositories.UserRepository,
+	roleRepo *repositories.RoleRepository,
+	mfaRepo *repositories.MFARepository,
+	tokenRepo *repositories.UserTokenRepository,
+	auth *AuthService,
+	authSecret string,
+	issuer string,
+) *MFAService {
+	return &MFAService{
+		db:        db,
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+		mfaRepo:   mfaRepo,
+		tokenRepo: tokenRepo,
+		auth:      auth,
+		key:       sealingKey("totp-secret", authSecret),
+		issuer:    issuer,
+	}
+}
+
+// StartLogin is called once the password is verified. Users with MFA get a
+// challenge; admins and organizers without it get an enrollment challenge;
+// everyone else gets a session straight away.
+func (s *MFAService) StartLogin(user *models.User, userAgent string, ipAddress string) (*LoginResult, error) {
+	enabled, err := s.enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return s.challenge(user.ID, repositories.TokenMFAChallenge, mfaChallengeTTL)
+	}
+
+	required, err := s.Required(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		return s.challenge(user.ID, repositories.TokenMFAEnroll, mfaEnrollTTL)
+	}
+
+	pair, err := s.auth.Login(user, userAgent, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Session: pair}, nil
+}
+
+// ChallengeUser returns the user an unexpired challenge token was issued to
+func (s *MFAService) ChallengeUser(purpose string, token string) (*models.User, error) {
+	challenge, err := s.tokenRepo.GetActiveToken(purpose, hashToken(token), time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	return s.userRepo.GetUserByID(challenge.UserID)
+}
+
+// CompleteLogin verifies a TOTP or recovery code against a challenge and starts the session
+func (s *MFAService) CompleteLogin(token string, code string, recoveryCode string, userAgent string, ipAddress string) (*TokenPair, error) {
+	var userID int
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		challenge, err := s.tokenRepo.GetActiveTokenForUpdate(tx, repositories.TokenMFAChallenge, hashToken(token), now)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidMFAToken
+			}
+			return err
+		}
+
+		var ok bool
+		if code != "" {
+			ok, err = s.verifyCode(tx, challenge.UserID, code, now)
+		} else {
+			ok, err = s.mfaRepo.UseRecoveryCode(tx, challenge.UserID, hashToken(normalizeRecoveryCode(recoveryCode)), now)
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		userID = challenge.UserID
+		return s.tokenRepo.MarkTokenUsed(tx, challenge.ID, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.Login(user, userAgent, ipAddress)
+}
+
+// BeginEnrollment generates a new pending TOTP secret, replacing any earlier
+// unconfirmed one. MFA stays off until ConfirmEnrollment sees a valid code.
+func (s *MFAService) BeginEnrollment(user *models.User) (*TOTPEnrollment, error) {
+	enabled, err := s.enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		return s.mfaRepo.SavePendingMFA(tx, user.ID, sealed)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment turns MFA on with the first valid code and returns a fresh
+// set of recovery codes, which are only ever shown here
+func (s *MFAService) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		var err error
+		codes, err = s.confirmEnrollment(tx, userID, code, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CompleteEnrollment confirms an enrollment started with a login enrollment
+// challenge, then starts the session the login was held back for
+func (s *MFAService) CompleteEnrollment(token string, code string, userAgent string, ipAddress string) (*TokenPair, []string, error) {
+	var userID int
+	var codes []string
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		challenge, err := s.tokenRepo.GetActiveTokenForUpdate(tx, repositories.TokenMFAEnroll, hashToken(token), now)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidMFAToken
+			}
+			return err
+		}
+
+		codes, err = s.confirmEnrollment(tx, challenge.UserID, code, now)
+		if err != nil {
+			return err
+		}
+
+		userID = challenge.UserID
+		return s.tokenRepo.MarkTokenUsed(tx, challenge.ID, now)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.auth.Login(user, userAgent, ipAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, codes, nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a TOTP code
+func (s *MFAService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		ok, err := s.verifyCode(tx, userID, code, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns MFA off after checking a TOTP code. Accounts whose role requires
+// MFA cannot turn it off.
+func (s *MFAService) Disable(userID int, code string) error {
+	required, err := s.Required(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		ok, err := s.verifyCode(tx, userID, code, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		return s.mfaRepo.DeleteMFA(tx, userID)
+	})
+}
+
+// Status reports whether MFA is on, whether the user's role requires it and how
+// many recovery codes are left
+func (s *MFAService) Status(userID int) (*models.MFAStatusResponse, error) {
+	enabled, err := s.enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.Required(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.MFAStatusResponse{Enabled: enabled, Required: required}
+	if enabled {
+		status.RecoveryCodesRemaining, err = s.mfaRepo.CountRecoveryCodes(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Required reports whether the user's role requires a second factor
+func (s *MFAService) Required(userID int) (bool, error) {
+	return s.roleRepo.HasAnyRole(userID, mfaRequiredRoles...)
+}
+
+func (s *MFAService) enabled(userID int) (bool, error) {
+	mfa, err := s.mfaRepo.GetMFA(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return mfa.ConfirmedAt != nil, nil
+}
+
+func (s *MFAService) challenge(userID int, purpose string, ttl time.Duration) (*LoginResult, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		if err := s.tokenRepo.InvalidateTokens(tx, userID, purpose, now); err != nil {
+			return err
+		}
+		return s.tokenRepo.CreateToken(tx, userID, purpose, hashToken(token), now.Add(ttl))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{Challenge: &MFAChallenge{
+		Token:              token,
+		EnrollmentRequired: purpose == repositories.TokenMFAEnroll,
+		ExpiresIn:          int(ttl / time.Second),
+	}}, nil
+}
+
+func (s *MFAService) confirmEnrollment(tx *sqlx.Tx, userID int, code string, now time.Time) ([]string, error) {
+	mfa, err := s.mfaRepo.GetMFAForUpdate(tx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMFANotStarted
+		}
+		return nil, err
+	}
+	if mfa.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := s.open(mfa.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, code, now, 0)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	if err := s.mfaRepo.ConfirmMFA(tx, userID, step, now); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(tx, userID)
+}
+
+// verifyCode checks a TOTP code against a confirmed enrollment and records its
+// step so the same code cannot be used again
+func (s *MFAService) verifyCode(tx *sqlx.Tx, userID int, code string, now time.Time) (bool, error) {
+	mfa, err := s.mfaRepo.GetMFAForUpdate(tx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrMFANotEnabled
+		}
+		return false, err
+	}
+	if mfa.ConfirmedAt == nil {
+		return false, ErrMFANotEnabled
+	}
+
+	secret, err := s.open(mfa.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := matchTOTP(secret, code, now, mfa.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	return true, s.mfaRepo.SetLastUsedStep(tx, userID, step)
+}
+
+func (s *MFAService) replaceRecoveryCodes(tx *sqlx.Tx, userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeSize)
+	hashes := make([]string, recoveryCodeSize)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// seal encrypts a TOTP secret with AES-256-GCM; the nonce is prepended
+func (s *MFAService) seal(plaintext string) (string, error) {
+	return sealSecret(s.key, []byte(plaintext))
+}
+
+func (s *MFAService) open(sealed string) (string, error) {
+	plaintext, err := openSecret(s.key, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// recoveryCodeAlphabet leaves out characters that are easily confused (0/o, 1/l/i)
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeLen; i++ {
+		if i == recoveryCodeLen/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes, so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
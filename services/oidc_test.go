@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	stubClientID    = "ticketbooth-web"
+	stubRedirectURL = "https://tickets.test/auth/callback"
+)
+
+// stubOIDCProvider is an httptest OpenID Connect provider. It serves discovery
+// and JWKS documents and a token endpoint that checks the PKCE verifier of
+// each authorization code before returning the code's ID token.
+type stubOIDCProvider struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu sync.Mutex
+	// jwks lists the kids published at the JWKS endpoint
+	jwks           map[string]crypto.PrivateKey
+	codes          map[string]stubAuthCode
+	discoveryHits  int
+	jwksHits       int
+	lastTokenForm  url.Values
+	discoveryIssue string
+}
+
+// stubAuthCode is an authorization code the provider has handed out
+type stubAuthCode struct {
+	challenge string
+	idToken   string
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &stubOIDCProvider{
+		rsaKey: rsaKey,
+		ecKey:  ecKey,
+		jwks:   map[string]crypto.PrivateKey{"rsa-1": rsaKey, "ec-1": ecKey},
+		codes:  make(map[string]stubAuthCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.serveDiscovery)
+	mux.HandleFunc("/jwks", stub.serveJWKS)
+	mux.HandleFunc("/token", stub.serveToken)
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+
+	return stub
+}
+
+func (p *stubOIDCProvider) issuer() string {
+	return p.server.URL
+}
+
+func (p *stubOIDCProvider) relyingParty() *OIDCProvider {
+	return NewOIDCProvider(OIDCProviderConfig{
+		Name:         "stub",
+		Issuer:       p.issuer() + "/",
+		ClientID:     stubClientID,
+		ClientSecret: "client-secret",
+		RedirectURL:  stubRedirectURL,
+	})
+}
+
+func (p *stubOIDCProvider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.discoveryHits++
+	issuer := p.discoveryIssue
+	p.mu.Unlock()
+	if issuer == "" {
+		issuer = p.issuer()
+	}
+
+	writeStubJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": p.issuer() + "/authorize",
+		"token_endpoint":         p.issuer() + "/token",
+		"jwks_uri":               p.issuer() + "/jwks",
+	})
+}
+
+func (p *stubOIDCProvider) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jwksHits++
+
+	keys := []map[string]string{}
+	for kid, key := range p.jwks {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case *ecdsa.PrivateKey:
+			keys = append(keys, map[string]string{
+				"kty": "EC", "kid": kid, "use": "sig", "alg": "ES256", "crv": "P-256",
+				"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	writeStubJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func (p *stubOIDCProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastTokenForm = r.PostForm
+
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("client_id") != stubClientID || r.PostForm.Get("redirect_uri") != stubRedirectURL {
+		writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	// RFC 7636: the S256 challenge is BASE64URL(SHA256(code_verifier))
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		writeStubJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeStubJSON(w, http.StatusOK, map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": code.idToken})
+}
+
+// authorize hands out a code for an authorization URL, as the provider does
+// after the user signs in, binding it to the URL's PKCE challenge
+func (p *stubOIDCProvider) authorize(t *testing.T, authURL string, idToken string) string {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL does not use S256: %s", authURL)
+	}
+
+	code, err := randomURLToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.codes[code] = stubAuthCode{challenge: parsed.Query().Get("code_challenge"), idToken: idToken}
+	p.mu.Unlock()
+	return code
+}
+
+// claims returns valid ID token claims for the relying party
+func (p *stubOIDCProvider) claims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            p.issuer(),
+		"sub":            "user-123",
+		"aud":            stubClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "Bob@Example.com",
+		"email_verified": true,
+		"name":           "Bob Example",
+	}
+}
+
+// sign encodes claims as a JWT signed by key under kid with alg
+func (p *stubOIDCProvider) sign(t *testing.T, alg string, kid string, key crypto.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case nil:
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeStubJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOIDCAuthCodeFlowWithPKCE(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	provider := stub.relyingParty()
+	ctx := context.Background()
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", pkceChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme+"://"+parsed.Host+parsed.Path != stub.issuer()+"/authorize" {
+		t.Errorf("authorization endpoint %s was not taken from discovery", authURL)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             stubClientID,
+		"redirect_uri":          stubRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        pkceChallenge(verifier),
+		"code_challenge_method": "S256",
+	}
+	for param, value := range want {
+		if got := parsed.Query().Get(param); got != value {
+			t.Errorf("%s = %q, want %q", param, got, value)
+		}
+	}
+
+	idToken := stub.sign(t, "RS256", "rsa-1", stub.rsaKey, stub.claims("nonce-1"))
+
+	// A code presented with the wrong verifier is refused by the provider
+	code := stub.authorize(t, authURL, idToken)
+	if _, err := provider.Exchange(ctx, code, "not-the-verifier", stubRedirectURL); !errors.Is(err, ErrOIDCExchangeFailed) {
+		t.Fatalf("Exchange with the wrong verifier: %v, want ErrOIDCExchangeFailed", err)
+	}
+
+	code = stub.authorize(t, authURL, idToken)
+	raw, err := provider.Exchange(ctx, code, verifier, stubRedirectURL)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if raw != idToken {
+		t.Errorf("Exchange returned %q, want the provider's ID token", raw)
+	}
+	stub.mu.Lock()
+	form := stub.lastTokenForm
+	stub.mu.Unlock()
+	if form.Get("code_verifier") != verifier || form.Get("client_secret") != "client-secret" {
+		t.Errorf("token request form %v", form)
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, raw, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "bob@example.com" || !claims.EmailVerified || claims.Name != "Bob Example" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.discoveryHits != 1 || stub.jwksHits != 1 {
+		t.Errorf("discovery fetched %d times and JWKS %d times, want both cached after one fetch", stub.discoveryHits, stub.jwksHits)
+	}
+}
+
+func TestOIDCDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	stub.discoveryIssue = "https://evil.test"
+
+	_, err := stub.relyingParty().AuthCodeURL(context.Background(), "state", "nonce", pkceChallenge("verifier"))
+	if err == nil {
+		t.Fatal("discovery with another issuer was accepted")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		claims := stub.claims("nonce-1")
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+				continue
+			}
+			claims[name] = value
+		}
+		return claims
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(nil)), true},
+		{"ES256", stub.sign(t, "ES256", "ec-1", stub.ecKey, with(nil)), true},
+		{"signed by another key", stub.sign(t, "RS256", "rsa-1", otherKey, with(nil)), false},
+		{"alg none", stub.sign(t, "none", "rsa-1", nil, with(nil)), false},
+		{"HS256 with the public key as secret", stub.sign(t, "HS256", "rsa-1", stub.rsaKey.N.Bytes(), with(nil)), false},
+		{"alg does not match key type", stub.sign(t, "ES256", "rsa-1", stub.ecKey, with(nil)), false},
+		{"unknown kid", stub.sign(t, "RS256", "rsa-9", stub.rsaKey, with(nil)), false},
+		{"tampered claims", tamperJWTClaims(t, stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(nil)), with(map[string]interface{}{"sub": "admin"})), false},
+		{"wrong issuer", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"iss": "https://evil.test"})), false},
+		{"issuer with trailing slash", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"iss": stub.issuer() + "/"})), true},
+		{"wrong audience", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"aud": "another-client"})), false},
+		{"audience list with this client only", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"aud": []string{stubClientID}})), true},
+		{"audience list without azp", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"aud": []string{stubClientID, "another-client"}})), false},
+		{"audience list with azp", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"aud": []string{stubClientID, "another-client"}, "azp": stubClientID})), true},
+		{"expired", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"exp": now.Add(-oidcClockSkew - time.Minute).Unix()})), false},
+		{"expired within clock skew", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})), true},
+		{"missing expiry", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"exp": nil})), false},
+		{"issued in the future", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"iat": now.Add(oidcClockSkew + time.Minute).Unix()})), false},
+		{"nonce mismatch", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"nonce": "nonce-2"})), false},
+		{"missing nonce", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"nonce": nil})), false},
+		{"missing subject", stub.sign(t, "RS256", "rsa-1", stub.rsaKey, with(map[string]interface{}{"sub": nil})), false},
+		{"malformed", "not-a-jwt", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := stub.relyingParty()
+			claims, err := provider.VerifyIDToken(context.Background(), test.token, "nonce-1")
+			if test.valid {
+				if err != nil {
+					t.Fatalf("VerifyIDToken: %v", err)
+				}
+				if claims.Subject != "user-123" {
+					t.Errorf("subject = %q", claims.Subject)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("VerifyIDToken error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenReadsStringEmailVerified(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+
+	for value, want := range map[interface{}]bool{"true": true, "false": false, true: true, false: false} {
+		claims := stub.claims("nonce-1")
+		claims["email_verified"] = value
+		token := stub.sign(t, "RS256", "rsa-1", stub.rsaKey, claims)
+
+		verified, err := stub.relyingParty().VerifyIDToken(context.Background(), token, "nonce-1")
+		if err != nil {
+			t.Fatalf("VerifyIDToken: %v", err)
+		}
+		if verified.EmailVerified != want {
+			t.Errorf("email_verified %#v read as %v", value, verified.EmailVerified)
+		}
+	}
+}
+
+func TestVerifyIDTokenRefetchesRotatedKeys(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	provider := stub.relyingParty()
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, stub.sign(t, "RS256", "rsa-1", stub.rsaKey, stub.claims("n")), "n"); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	stub.jwks["rsa-2"] = rotated
+	stub.mu.Unlock()
+	token := stub.sign(t, "RS256", "rsa-2", rotated, stub.claims("n"))
+
+	// Unknown kids do not refetch the key set more than once per interval
+	if _, err := provider.VerifyIDToken(ctx, token, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("token with a new kid right after a fetch: %v, want ErrInvalidIDToken", err)
+	}
+
+	provider.mu.Lock()
+	provider.keysFetched = time.Now().Add(-jwksRefreshInterval - time.Second)
+	provider.mu.Unlock()
+	if _, err := provider.VerifyIDToken(ctx, token, "n"); err != nil {
+		t.Fatalf("token signed with a rotated key: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.jwksHits != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", stub.jwksHits)
+	}
+}
+
+// tamperJWTClaims swaps a signed token's claims while keeping its signature
+func tamperJWTClaims(t *testing.T, token string, claims map[string]interface{}) string {
+	t.Helper()
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, signature := token[:strings.IndexByte(token, '.')], token[strings.LastIndexByte(token, '.')+1:]
+	return header + "." + base64.RawURLEncoding.EncodeToString(claimsJSON) + "." + signature
+}
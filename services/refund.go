@@ -0,0 +1,354 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+var (
+	ErrRefundExceedsBalance  = errors.New("REFUND_EXCEEDS_BALANCE")
+	ErrNothingToRefund       = errors.New("NOTHING_TO_REFUND")
+	ErrTicketNotInOrder      = errors.New("TICKET_NOT_IN_ORDER")
+	ErrTicketAlreadyRefunded = errors.New("TICKET_ALREADY_REFUNDED")
+)
+
+// RefundService issues full, per-ticket and partial-amount refunds. Each
+// refund locks its order first, so concurrent refunds on one order run one
+// after another and always see the current balance.
+type RefundService struct {
+	db            *db.DB
+	refundRepo    *repositories.RefundRepository
+	inventoryRepo *repositories.InventoryRepository
+	ledger        *LedgerService
+	notifications *NotificationService
+	audit         *AuditService
+}
+
+func NewRefundService(
+	db *db.DB,
+	refundRepo *repositories.RefundRepository,
+	inventoryRepo *repositories.InventoryRepository,
+	ledger *LedgerService,
+	notifications *NotificationService,
+	audit *AuditService,
+) *RefundService {
+	return &RefundService{
+		db:            db,
+		refundRepo:    refundRepo,
+		inventoryRepo: inventoryRepo,
+		ledger:        ledger,
+		notifications: notifications,
+		audit:         audit,
+	}
+}
+
+// Refund issues a refund against an order on behalf of operatorID. FULL
+// refunds the remaining balance and every ticket not yet refunded, TICKETS
+// refunds the listed tickets at the price paid, and AMOUNT refunds an
+// arbitrary sum without touching tickets. With restock, refunded tickets go
+// back on sale.
+func (s *RefundService) Refund(orderID int, req *models.RefundRequest, operatorID int, actor *models.AuditActor) (*models.OrderRefund, error) {
+	refund := &models.OrderRefund{
+		OrderID:        orderID,
+		Type:           req.Type,
+		Reason:         req.Reason,
+		OperatorUserID: operatorID,
+		Restocked:      req.Restock && req.Type != repositories.RefundAmount,
+		CreatedAt:      time.Now().UTC(),
+		TicketIDs:      []int{},
+	}
+
+	selectTickets := func(tickets []*models.Ticket, balance ledger.Amount) ([]*models.Ticket, ledger.Amount, error) {
+		return selectRefund(req, tickets, balance)
+	}
+	notify := func(tx *sqlx.Tx, order *models.Order, eventTitle string) error {
+		return s.notifications.QueueOrderRefund(tx, order, eventTitle, refund)
+	}
+
+	if err := s.issue(refund, selectTickets, notify, actor); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// RefundCancelledDate refunds an order's tickets for a cancelled event date
+// and sends the purchaser the cancellation notice. An order with nothing else
+// left gets a FULL refund of its balance; otherwise the date's tickets are
+// refunded at the price paid, capped at the balance. record, when set, runs in
+// the refund's transaction once the refund has its ID.
+func (s *RefundService) RefundCancelledDate(
+	orderID int,
+	eventDate *models.EventDate,
+	reason string,
+	operatorID int,
+	actor *models.AuditActor,
+	record func(tx *sqlx.Tx, refund *models.OrderRefund) error,
+) (*models.OrderRefund, error) {
+	refund := &models.OrderRefund{
+		OrderID:        orderID,
+		Reason:         reason,
+		OperatorUserID: operatorID,
+		CreatedAt:      time.Now().UTC(),
+		TicketIDs:      []int{},
+	}
+
+	notify := func(tx *sqlx.Tx, order *models.Order, eventTitle string) error {
+		if err := s.notifications.QueueOrderCancelled(tx, order, eventDate, refund); err != nil {
+			return err
+		}
+		if record == nil {
+			return nil
+		}
+		return record(tx, refund)
+	}
+
+	if err := s.issue(refund, selectEventDateRefund(refund, eventDate.ID), notify, actor); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// RefundPostponedDate refunds an order's tickets for a postponed event date
+// at the holder's request and puts them back on sale for the new date
+func (s *RefundService) RefundPostponedDate(orderID int, eventDateID int, userID int, actor *models.AuditActor) (*models.OrderRefund, error) {
+	refund := &models.OrderRefund{
+		OrderID:        orderID,
+		Reason:         "Event postponed",
+		OperatorUserID: userID,
+		Restocked:      true,
+		CreatedAt:      time.Now().UTC(),
+		TicketIDs:      []int{},
+	}
+
+	notify := func(tx *sqlx.Tx, order *models.Order, eventTitle string) error {
+		return s.notifications.QueueOrderRefund(tx, order, eventTitle, refund)
+	}
+
+	if err := s.issue(refund, selectEventDateRefund(refund, eventDateID), notify, actor); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// issue applies refund to its order in one transaction. selectTickets picks
+// the tickets and amount from the locked order; notify queues the email.
+func (s *RefundService) issue(
+	refund *models.OrderRefund,
+	selectTickets func(tickets []*models.Ticket, balance ledger.Amount) ([]*models.Ticket, ledger.Amount, error),
+	notify func(tx *sqlx.Tx, order *models.Order, eventTitle string) error,
+	actor *models.AuditActor,
+) error {
+	orderID := refund.OrderID
+
+	return s.db.WithTx(func(tx *sqlx.Tx) error {
+		order, err := s.refundRepo.LockOrder(tx, orderID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		tickets, err := s.refundRepo.GetOrderTicketsForUpdate(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		paid, err := ledger.ParseAmount(order.Amount)
+		if err != nil {
+			return fmt.Errorf("order %d amount: %w", orderID, err)
+		}
+		balance := paid - ledger.FromFloat(order.RefundedAmount)
+
+		selected, amount, err := selectTickets(tickets, balance)
+		if err != nil {
+			return err
+		}
+		if amount > balance {
+			return ErrRefundExceedsBalance
+		}
+		if amount == 0 && len(selected) == 0 {
+			return ErrNothingToRefund
+		}
+
+		// The order lock already serializes refunds; the guarded update keeps
+		// the balance from going negative even if a caller skips it
+		applied, err := s.refundRepo.AddRefundedAmount(tx, orderID, amount.String())
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return ErrRefundExceedsBalance
+		}
+
+		for _, ticket := range selected {
+			refund.TicketIDs = append(refund.TicketIDs, ticket.ID)
+		}
+		marked, err := s.refundRepo.MarkTicketsRefunded(tx, refund.TicketIDs, refund.Restocked, refund.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if marked != int64(len(selected)) {
+			return ErrTicketAlreadyRefunded
+		}
+		if refund.Restocked {
+			if err := s.releaseGAInventory(tx, selected); err != nil {
+				return err
+			}
+		}
+
+		refund.Amount = amount.Float()
+		refundID, err := s.refundRepo.CreateRefund(tx, refund)
+		if err != nil {
+			return err
+		}
+		refund.ID = int(refundID)
+
+		var eventID int
+		var eventTitle string
+		if len(tickets) > 0 && tickets[0].Event != nil {
+			eventID = tickets[0].Event.ID
+			eventTitle = tickets[0].Event.Title
+		}
+		if err := s.ledger.RecordRefund(tx, order, refund.ID, eventID, amount); err != nil {
+			return err
+		}
+
+		before := map[string]interface{}{"refundedAmount": order.RefundedAmount}
+		if err := s.audit.Record(tx, actor, AuditOrderRefunded, AuditEntityOrder, orderID, before, refund); err != nil {
+			return err
+		}
+
+		return notify(tx, order, eventTitle)
+	})
+}
+
+// List returns an order's refunds, oldest first
+func (s *RefundService) List(orderID int) ([]*models.OrderRefund, error) {
+	return s.refundRepo.ListRefunds(orderID)
+}
+
+// selectRefund works out which tickets a refund covers and how much it pays
+// out
+func selectRefund(req *models.RefundRequest, tickets []*models.Ticket, balance ledger.Amount) ([]*models.Ticket, ledger.Amount, error) {
+	switch req.Type {
+	case repositories.RefundFull:
+		var selected []*models.Ticket
+		for _, ticket := range tickets {
+			if ticket.RefundedAt == nil {
+				selected = append(selected, ticket)
+			}
+		}
+		if balance < 0 {
+			balance = 0
+		}
+		return selected, balance, nil
+
+	case repositories.RefundTickets:
+		byID := make(map[int]*models.Ticket, len(tickets))
+		for _, ticket := range tickets {
+			byID[ticket.ID] = ticket
+		}
+
+		var selected []*models.Ticket
+		var amount ledger.Amount
+		seen := make(map[int]bool, len(req.TicketIDs))
+		for _, id := range req.TicketIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			ticket, found := byID[id]
+			if !found {
+				return nil, 0, ErrTicketNotInOrder
+			}
+			if ticket.RefundedAt != nil {
+				return nil, 0, ErrTicketAlreadyRefunded
+			}
+			selected = append(selected, ticket)
+			amount += ledger.FromFloat(ticket.Price)
+		}
+		return selected, amount, nil
+
+	case repositories.RefundAmount:
+		if req.Amount == nil {
+			return nil, 0, ErrNothingToRefund
+		}
+		return nil, ledger.FromFloat(*req.Amount), nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown refund type %q", req.Type)
+}
+
+// selectEventDateRefund picks an order's unrefunded tickets for one event
+// date. An order with nothing else left is refunded in FULL; otherwise the
+// tickets are refunded at the price paid, capped at the balance.
+func selectEventDateRefund(refund *models.OrderRefund, eventDateID int) func(tickets []*models.Ticket, balance ledger.Amount) ([]*models.Ticket, ledger.Amount, error) {
+	return func(tickets []*models.Ticket, balance ledger.Amount) ([]*models.Ticket, ledger.Amount, error) {
+		var selected []*models.Ticket
+		var amount ledger.Amount
+		others := 0
+		for _, ticket := range tickets {
+			if ticket.RefundedAt != nil {
+				continue
+			}
+			if ticket.EventDateID != eventDateID {
+				others++
+				continue
+			}
+			selected = append(selected, ticket)
+			amount += ledger.FromFloat(ticket.Price)
+		}
+		if len(selected) == 0 {
+			return nil, 0, ErrNothingToRefund
+		}
+
+		if balance < 0 {
+			balance = 0
+		}
+		refund.Type = repositories.RefundTickets
+		if others == 0 {
+			refund.Type = repositories.RefundFull
+			amount = balance
+		}
+		if amount > balance {
+			amount = balance
+		}
+		return selected, amount, nil
+	}
+}
+
+// releaseGAInventory returns refunded general admission tickets to their
+// tier's remaining count. Seated tickets free their seat when marked refunded.
+func (s *RefundService) releaseGAInventory(tx *sqlx.Tx, tickets []*models.Ticket) error {
+	type tier struct{ eventDateID, ticketTypeID int }
+
+	counts := make(map[tier]int)
+	var order []tier
+	for _, ticket := range tickets {
+		if ticket.SeatID != 0 {
+			continue
+		}
+		key := tier{ticket.EventDateID, ticket.TicketTypeID}
+		if counts[key] == 0 {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+
+	for _, key := range order {
+		if err := s.inventoryRepo.ReleaseGATicketInventory(tx, key.eventDateID, key.ticketTypeID, counts[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+var (
+	refundOrderColumns  = []string{"id", "user_id", "amount", "customer_name", "customer_email", "locale", "refunded_amount"}
+	refundTicketColumns = []string{"id", "ticket_type_id", "event_date_id", "seat_id", "price", "refunded_at", "event_id", "title"}
+)
+
+// testRates are a 5% platform fee and 16% tax
+var testRates = ledger.Rates{PlatformFee: 500, Tax: 1600}
+
+func newTestRefundService(t *testing.T) (*RefundService, *stubSQL) {
+	t.Helper()
+
+	templates, err := LoadEmailTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlStub, database := newStubSQL(t)
+	service := NewRefundService(
+		database,
+		repositories.NewRefundRepository(database),
+		repositories.NewInventoryRepository(database),
+		NewLedgerService(repositories.NewLedgerRepository(database), testRates),
+		NewNotificationService(repositories.NewOutboxRepository(database), repositories.NewUserRepository(database), templates),
+		NewAuditService(repositories.NewAuditRepository(database)),
+	)
+	return service, sqlStub
+}
+
+// refundTicketRow is an unrefunded GA ticket of event 3 on event date 9
+func refundTicketRow(id int64, price float64) []driver.Value {
+	return []driver.Value{id, int64(2), int64(9), nil, price, nil, int64(3), "Summer Concert"}
+}
+
+// scriptRefund answers the statements of refunding order 5, which paid 100.00
+// and has had refunded returned so far, with a recorded sale split.
+// guardAffected is what the guarded refunded_amount update reports, and marked
+// how many tickets the refunded_at update changes.
+func scriptRefund(sqlStub *stubSQL, refunded float64, guardAffected int64, marked int64, tickets ...[]driver.Value) {
+	sqlStub.onQuery("FROM `order` WHERE id = ? FOR UPDATE", refundOrderColumns,
+		[]driver.Value{int64(5), int64(7), "100.00", "Bob Example", "bob@example.com", "en", refunded})
+	sqlStub.onQuery("FROM ticket t", refundTicketColumns, tickets...)
+	sqlStub.onExec("SET refunded_amount = refunded_amount + ?", 0, guardAffected)
+	sqlStub.onExec("SET refunded_at = ?", 0, marked)
+	sqlStub.onExec("UPDATE event_date_has_ticket_type", 0, 1)
+	sqlStub.onExec("INSERT INTO order_refund_ticket", 0, 1)
+	sqlStub.onExec("INSERT INTO order_refund (", 11, 1)
+
+	// 100.00 split at testRates: 13.79 tax, 4.31 fees, 81.90 organizer
+	sqlStub.onQuery("FROM ledger_entry le", []string{"account", "net"},
+		[]driver.Value{string(ledger.OrganizerPayable), "81.90"},
+		[]driver.Value{string(ledger.PlatformFees), "4.31"},
+		[]driver.Value{string(ledger.TaxPayable), "13.79"},
+	)
+	sqlStub.onExec("INSERT INTO ledger_transaction", 21, 1)
+	sqlStub.onExec("INSERT INTO ledger_entry", 0, 1)
+	sqlStub.onExec("INSERT INTO audit_log", 1, 1)
+	sqlStub.onExec("INSERT INTO email_outbox", 1, 1)
+}
+
+// refundedAmount is the amount passed to the guarded refunded_amount update
+func refundedAmount(t *testing.T, sqlStub *stubSQL) string {
+	t.Helper()
+
+	updates := sqlStub.ran("SET refunded_amount = refunded_amount + ?")
+	if len(updates) != 1 {
+		t.Fatalf("ran %d refunded_amount updates, want 1", len(updates))
+	}
+	// amount, order ID, amount again for the guard
+	args := updates[0].Args
+	if args[0] != args[2] || args[1] != int64(5) {
+		t.Errorf("guarded update args %v", args)
+	}
+	return args[0].(string)
+}
+
+func TestRefundFullRefundsBalanceAndRemainingTickets(t *testing.T) {
+	service, sqlStub := newTestRefundService(t)
+	refundedAt := []driver.Value{int64(1), int64(2), int64(9), nil, 20.0, time.Now(), int64(3), "Summer Concert"}
+	scriptRefund(sqlStub, 20, 1, 2, refundedAt, refundTicketRow(2, 40), refundTicketRow(3, 40))
+
+	refund, err := service.Refund(5, &models.RefundRequest{Type: repositories.RefundFull, Reason: "Customer request"}, 7, nil)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+
+	if amount := refundedAmount(t, sqlStub); amount != "80.00" {
+		t.Errorf("refunded %s, want the 80.00 balance", amount)
+	}
+	if refund.Type != repositories.RefundFull || refund.Amount != 80 || len(refund.TicketIDs) != 2 || refund.TicketIDs[0] != 2 || refund.TicketIDs[1] != 3 {
+		t.Errorf("refund %+v, want FULL 80 for tickets 2 and 3", refund)
+	}
+	if refund.ID != 11 || len(sqlStub.ran("COMMIT")) != 1 {
+		t.Errorf("refund %d was not stored and committed", refund.ID)
+	}
+}
+
+func TestRefundTicketsRefundsPricePaid(t *testing.T) {
+	service, sqlStub := newTestRefundService(t)
+	scriptRefund(sqlStub, 0, 1, 1, refundTicketRow(2, 40), refundTicketRow(3, 35.5))
+
+	req := &models.RefundRequest{Type: repositories.RefundTickets, TicketIDs: []int{3, 3}, Restock: true}
+	refund, err := service.Refund(5, req, 7, nil)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+
+	if amount := refundedAmount(t, sqlStub); amount != "35.50" {
+		t.Errorf("refunded %s, want ticket 3's price 35.50", amount)
+	}
+	if len(refund.TicketIDs) != 1 || refund.TicketIDs[0] != 3 || !refund.Restocked {
+		t.Errorf("refund %+v, want ticket 3 restocked once", refund)
+	}
+	// quantity, event date, ticket type
+	if released := sqlStub.ran("UPDATE event_date_has_ticket_type"); len(released) != 1 || released[0].Args[0] != int64(1) {
+		t.Errorf("inventory releases %v, want one ticket back on sale", released)
+	}
+}
+
+func TestRefundTicketsRejectsForeignAndRefundedTickets(t *testing.T) {
+	refunded := []driver.Value{int64(2), int64(2), int64(9), nil, 40.0, time.Now(), int64(3), "Summer Concert"}
+	for name, test := range map[string]struct {
+		ticketID int
+		want     error
+	}{
+		"not in order":     {ticketID: 99, want: ErrTicketNotInOrder},
+		"already refunded": {ticketID: 2, want: ErrTicketAlreadyRefunded},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service, sqlStub := newTestRefundService(t)
+			scriptRefund(sqlStub, 40, 1, 1, refunded, refundTicketRow(3, 40))
+
+			req := &models.RefundRequest{Type: repositories.RefundTickets, TicketIDs: []int{test.ticketID}}
+			if _, err := service.Refund(5, req, 7, nil); !errors.Is(err, test.want) {
+				t.Fatalf("Refund: %v, want %v", err, test.want)
+			}
+			if len(sqlStub.ran("SET refunded_amount")) != 0 || len(sqlStub.ran("ROLLBACK")) != 1 {
+				t.Errorf("a rejected refund changed the order")
+			}
+		})
+	}
+}
+
+func TestRefundAmountIsCappedAtBalance(t *testing.T) {
+	for name, test := range map[string]struct {
+		amount float64
+		want   error
+	}{
+		"within balance": {amount: 25.5},
+		"whole balance":  {amount: 60},
+		"over balance":   {amount: 60.01, want: ErrRefundExceedsBalance},
+		"zero":           {amount: 0, want: ErrNothingToRefund},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service, sqlStub := newTestRefundService(t)
+			scriptRefund(sqlStub, 40, 1, 0, refundTicketRow(2, 40))
+
+			amount := test.amount
+			refund, err := service.Refund(5, &models.RefundRequest{Type: repositories.RefundAmount, Amount: &amount, Restock: true}, 7, nil)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Refund: %v, want %v", err, test.want)
+			}
+			if test.want != nil {
+				if len(sqlStub.ran("SET refunded_amount")) != 0 {
+					t.Errorf("a rejected refund changed the order")
+				}
+				return
+			}
+
+			if got := refundedAmount(t, sqlStub); got != ledger.FromFloat(test.amount).String() {
+				t.Errorf("refunded %s, want %.2f", got, test.amount)
+			}
+			// An amount refund leaves tickets and inventory alone
+			if len(refund.TicketIDs) != 0 || refund.Restocked || len(sqlStub.ran("SET refunded_at")) != 0 || len(sqlStub.ran("event_date_has_ticket_type")) != 0 {
+				t.Errorf("amount refund %+v touched tickets", refund)
+			}
+		})
+	}
+}
+
+func TestRefundRollsBackWhenGuardedUpdateRejects(t *testing.T) {
+	service, sqlStub := newTestRefundService(t)
+	// Another refund raced past the balance read; the update guard catches it
+	scriptRefund(sqlStub, 0, 0, 0, refundTicketRow(2, 40))
+
+	amount := 30.0
+	if _, err := service.Refund(5, &models.RefundRequest{Type: repositories.RefundAmount, Amount: &amount}, 7, nil); !errors.Is(err, ErrRefundExceedsBalance) {
+		t.Fatalf("Refund: %v, want ErrRefundExceedsBalance", err)
+	}
+	if len(sqlStub.ran("INSERT INTO order_refund")) != 0 || len(sqlStub.ran("INSERT INTO ledger")) != 0 {
+		t.Errorf("a refund past the guard was recorded")
+	}
+	if len(sqlStub.ran("ROLLBACK")) != 1 || len(sqlStub.ran("COMMIT")) != 0 {
+		t.Errorf("the refund transaction was not rolled back")
+	}
+}
+
+func TestRefundPostsBalancedLedgerReversal(t *testing.T) {
+	service, sqlStub := newTestRefundService(t)
+	scriptRefund(sqlStub, 0, 1, 1, refundTicketRow(2, 50), refundTicketRow(3, 50))
+
+	if _, err := service.Refund(5, &models.RefundRequest{Type: repositories.RefundTickets, TicketIDs: []int{2}}, 7, nil); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+
+	transactions := postedTransactions(t, sqlStub)
+	if len(transactions) != 1 || transactions[0].Kind != ledger.KindRefund {
+		t.Fatalf("posted %+v, want one refund", transactions)
+	}
+	// Half the sale is reversed, rounded half away from zero: 6.90 tax, 2.16
+	// fees and the rest, 40.94, from the organizer
+	want := map[ledger.Account]ledger.Amount{ledger.OrganizerPayable: 4094, ledger.PlatformFees: 216, ledger.TaxPayable: 690}
+	for _, entry := range transactions[0].Entries {
+		if entry.Account == ledger.Refunds {
+			if entry.Credit != 5000 {
+				t.Errorf("refunds credited %s, want 50.00", entry.Credit)
+			}
+			continue
+		}
+		if entry.Debit != want[entry.Account] {
+			t.Errorf("%s debited %s, want %s", entry.Account, entry.Debit, want[entry.Account])
+		}
+	}
+}
+
+func TestSelectEventDateRefund(t *testing.T) {
+	refundedAt := time.Now()
+	ticket := func(id, eventDateID int, price float64) *models.Ticket {
+		return &models.Ticket{ID: id, EventDateID: eventDateID, Price: price}
+	}
+
+	for name, test := range map[string]struct {
+		tickets     []*models.Ticket
+		balance     ledger.Amount
+		wantType    string
+		wantAmount  ledger.Amount
+		wantTickets int
+		wantErr     error
+	}{
+		"only the date's tickets": {
+			tickets:     []*models.Ticket{ticket(1, 9, 40), ticket(2, 9, 40)},
+			balance:     9000,
+			wantType:    repositories.RefundFull,
+			wantAmount:  9000,
+			wantTickets: 2,
+		},
+		"other dates left": {
+			tickets:     []*models.Ticket{ticket(1, 9, 40), ticket(2, 10, 40)},
+			balance:     8000,
+			wantType:    repositories.RefundTickets,
+			wantAmount:  4000,
+			wantTickets: 1,
+		},
+		"capped at balance": {
+			tickets:     []*models.Ticket{ticket(1, 9, 40), ticket(2, 9, 40), ticket(3, 10, 40)},
+			balance:     5000,
+			wantType:    repositories.RefundTickets,
+			wantAmount:  5000,
+			wantTickets: 2,
+		},
+		"refunded tickets skipped": {
+			tickets:     []*models.Ticket{{ID: 1, EventDateID: 9, Price: 40, RefundedAt: &refundedAt}, ticket(2, 9, 40)},
+			balance:     -100,
+			wantType:    repositories.RefundFull,
+			wantAmount:  0,
+			wantTickets: 1,
+		},
+		"nothing on the date": {
+			tickets: []*models.Ticket{ticket(1, 10, 40)},
+			balance: 4000,
+			wantErr: ErrNothingToRefund,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			refund := &models.OrderRefund{}
+			selected, amount, err := selectEventDateRefund(refund, 9)(test.tickets, test.balance)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("selectEventDateRefund: %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if refund.Type != test.wantType || amount != test.wantAmount || len(selected) != test.wantTickets {
+				t.Errorf("got %s %s for %d tickets, want %s %s for %d", refund.Type, amount, len(selected), test.wantType, test.wantAmount, test.wantTickets)
+			}
+		})
+	}
+}
+
+// postedTransactions rebuilds the ledger transactions written to the stub, in
+// order, and fails the test if any of them does not balance
+func postedTransactions(t *testing.T, sqlStub *stubSQL) []*ledger.Transaction {
+	t.Helper()
+
+	var transactions []*ledger.Transaction
+	for _, statement := range sqlStub.statements {
+		switch {
+		case containsAll(statement.Query, "INSERT INTO ledger_transaction"):
+			// kind, order_id, refund_id, event_id, memo, created_at
+			memo, _ := statement.Args[4].(string)
+			transactions = append(transactions, &ledger.Transaction{Kind: statement.Args[0].(string), Memo: memo})
+		case containsAll(statement.Query, "INSERT INTO ledger_entry"):
+			if len(transactions) == 0 {
+				t.Fatalf("ledger entry written before its transaction")
+			}
+			// transaction_id, account, debit, credit
+			debit, err := ledger.ParseAmount(statement.Args[2].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			credit, err := ledger.ParseAmount(statement.Args[3].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			current := transactions[len(transactions)-1]
+			current.Entries = append(current.Entries, ledger.Entry{Account: ledger.Account(statement.Args[1].(string)), Debit: debit, Credit: credit})
+		}
+	}
+
+	for _, transaction := range transactions {
+		if err := transaction.Validate(); err != nil {
+			t.Errorf("posted %s transaction: %v", transaction.Kind, err)
+		}
+	}
+	return transactions
+}
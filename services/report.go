@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+// Sales report CSV tables
+const (
+	ReportTableTiers    = "tiers"
+	ReportTableDates    = "dates"
+	ReportTableVelocity = "velocity"
+	ReportTableSections = "sections"
+)
+
+// ReportService builds sales reports for admins
+type ReportService struct {
+	reportRepo *repositories.ReportRepository
+}
+
+func NewReportService(reportRepo *repositories.ReportRepository) *ReportService {
+	return &ReportService{
+		reportRepo: reportRepo,
+	}
+}
+
+// SalesReport reports on every date of scope.EventID, or on the single date
+// scope.EventDateID. Velocity is bucketed by interval (hour or day) and at
+// most topSections sections are listed.
+func (s *ReportService) SalesReport(scope *repositories.SalesScope, interval string, topSections int) (*models.SalesReport, error) {
+	report := &models.SalesReport{
+		From:        scope.From,
+		To:          scope.To,
+		Interval:    interval,
+		Dates:       []*models.DateSales{},
+		Tiers:       []*models.TierSales{},
+		Velocity:    []*models.SalesVelocityPoint{},
+		TopSections: []*models.SectionSales{},
+	}
+
+	dates, err := s.reportRepo.ListDates(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if scope.EventDateID != 0 {
+		if len(dates) == 0 {
+			return nil, ErrNotFound
+		}
+		scope.EventID = dates[0].EventID
+		report.EventDateID = &scope.EventDateID
+		report.EventTitle = dates[0].EventTitle
+	} else {
+		report.EventTitle, err = s.reportRepo.GetEventTitle(scope.EventID)
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	report.EventID = scope.EventID
+
+	byDate := make(map[int]*models.DateSales, len(dates))
+	for _, date := range dates {
+		sales := &models.DateSales{
+			EventDateID: date.EventDateID,
+			Date:        date.Date,
+			SeatingMode: date.SeatingMode,
+			Capacity:    date.TotalTickets,
+		}
+		byDate[date.EventDateID] = sales
+		report.Dates = append(report.Dates, sales)
+	}
+
+	if err := s.addTiers(scope, report, byDate); err != nil {
+		return nil, err
+	}
+
+	var revenue ledger.Amount
+	var capacity *int
+	for _, date := range report.Dates {
+		report.TicketsSold += date.TicketsSold
+		report.TicketsRefunded += date.TicketsRefunded
+		revenue += ledger.FromFloat(date.GrossRevenue)
+		capacity = addCapacity(capacity, date.Capacity)
+		date.SellThroughPercent = sellThrough(date.TicketsSold, date.Capacity)
+	}
+	report.GrossRevenue = revenue.Float()
+	report.Capacity = capacity
+	report.SellThroughPercent = sellThrough(report.TicketsSold, capacity)
+
+	velocity, err := s.reportRepo.SalesVelocity(scope, interval)
+	if err != nil {
+		return nil, err
+	}
+	if velocity != nil {
+		report.Velocity = velocity
+	}
+
+	sections, err := s.reportRepo.SalesBySection(scope)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if sections[i].TicketsSold != sections[j].TicketsSold {
+			return sections[i].TicketsSold > sections[j].TicketsSold
+		}
+		if sections[i].GrossRevenue != sections[j].GrossRevenue {
+			return sections[i].GrossRevenue > sections[j].GrossRevenue
+		}
+		return sections[i].Section < sections[j].Section
+	})
+	if len(sections) > topSections {
+		sections = sections[:topSections]
+	}
+	for _, section := range sections {
+		seats := section.Seats
+		section.SellThroughPercent = sellThrough(section.TicketsSold, &seats)
+		report.TopSections = append(report.TopSections, section)
+	}
+
+	return report, nil
+}
+
+// addTiers fills in per-tier sales and capacities and rolls them up into the
+// dates. A tier's capacity on a date is its max_quantity, or its seat count
+// when max_quantity is not set; a date without tota_tickets takes the sum of
+// its tiers.
+func (s *ReportService) addTiers(scope *repositories.SalesScope, report *models.SalesReport, byDate map[int]*models.DateSales) error {
+	sales, err := s.reportRepo.SalesByTier(scope)
+	if err != nil {
+		return err
+	}
+	capacities, err := s.reportRepo.TierCapacities(scope)
+	if err != nil {
+		return err
+	}
+
+	byTier := make(map[int]*models.TierSales)
+	tier := func(ticketTypeID int, name string) *models.TierSales {
+		if existing, found := byTier[ticketTypeID]; found {
+			return existing
+		}
+		created := &models.TierSales{TicketTypeID: ticketTypeID, Name: name}
+		byTier[ticketTypeID] = created
+		report.Tiers = append(report.Tiers, created)
+		return created
+	}
+
+	dateTierCapacity := make(map[int]*int)
+	for _, row := range capacities {
+		capacity := row.MaxQuantity
+		if capacity == nil && row.Seats > 0 {
+			seats := row.Seats
+			capacity = &seats
+		}
+
+		t := tier(row.TicketTypeID, row.Name)
+		t.Capacity = addCapacity(t.Capacity, capacity)
+		dateTierCapacity[row.EventDateID] = addCapacity(dateTierCapacity[row.EventDateID], capacity)
+	}
+
+	tierRevenue := make(map[int]ledger.Amount)
+	dateRevenue := make(map[int]ledger.Amount)
+	for _, row := range sales {
+		t := tier(row.TicketTypeID, row.Name)
+		t.TicketsSold += row.Sold
+		t.TicketsRefunded += row.Refunded
+		tierRevenue[row.TicketTypeID] += ledger.FromFloat(row.Revenue)
+
+		if date, found := byDate[row.EventDateID]; found {
+			date.TicketsSold += row.Sold
+			date.TicketsRefunded += row.Refunded
+			dateRevenue[row.EventDateID] += ledger.FromFloat(row.Revenue)
+		}
+	}
+
+	for _, t := range report.Tiers {
+		t.GrossRevenue = tierRevenue[t.TicketTypeID].Float()
+		t.SellThroughPercent = sellThrough(t.TicketsSold, t.Capacity)
+	}
+	sort.Slice(report.Tiers, func(i, j int) bool {
+		return report.Tiers[i].TicketTypeID < report.Tiers[j].TicketTypeID
+	})
+
+	for id, date := range byDate {
+		date.GrossRevenue = dateRevenue[id].Float()
+		if date.Capacity == nil {
+			date.Capacity = dateTierCapacity[id]
+		}
+	}
+
+	return nil
+}
+
+// SalesReportCSV renders one table of a report (tiers, dates, velocity or
+// sections) as CSV
+func (s *ReportService) SalesReportCSV(report *models.SalesReport, table string) ([]byte, error) {
+	var records [][]string
+
+	switch table {
+	case ReportTableTiers:
+		records = append(records, []string{"ticket_type_id", "name", "tickets_sold", "tickets_refunded", "gross_revenue", "capacity", "sell_through_percent"})
+		for _, t := range report.Tiers {
+			records = append(records, []string{
+				strconv.Itoa(t.TicketTypeID), t.Name, strconv.Itoa(t.TicketsSold), strconv.Itoa(t.TicketsRefunded),
+				ledger.FromFloat(t.GrossRevenue).String(), csvInt(t.Capacity), csvPercent(t.SellThroughPercent),
+			})
+		}
+
+	case ReportTableDates:
+		records = append(records, []string{"event_date_id", "date", "seating_mode", "tickets_sold", "tickets_refunded", "gross_revenue", "capacity", "sell_through_percent"})
+		for _, d := range report.Dates {
+			date := ""
+			if d.Date != nil {
+				date = d.Date.UTC().Format(time.RFC3339)
+			}
+			records = append(records, []string{
+				strconv.Itoa(d.EventDateID), date, d.SeatingMode, strconv.Itoa(d.TicketsSold), strconv.Itoa(d.TicketsRefunded),
+				ledger.FromFloat(d.GrossRevenue).String(), csvInt(d.Capacity), csvPercent(d.SellThroughPercent),
+			})
+		}
+
+	case ReportTableVelocity:
+		records = append(records, []string{"period", "tickets_sold", "gross_revenue"})
+		for _, p := range report.Velocity {
+			records = append(records, []string{
+				p.Period.UTC().Format(time.RFC3339), strconv.Itoa(p.TicketsSold), ledger.FromFloat(p.GrossRevenue).String(),
+			})
+		}
+
+	case ReportTableSections:
+		records = append(records, []string{"section", "tickets_sold", "gross_revenue", "seats", "sell_through_percent"})
+		for _, section := range report.TopSections {
+			records = append(records, []string{
+				section.Section, strconv.Itoa(section.TicketsSold), ledger.FromFloat(section.GrossRevenue).String(),
+				strconv.Itoa(section.Seats), csvPercent(section.SellThroughPercent),
+			})
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown report table %q", table)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addCapacity sums capacities, treating nil as unknown rather than zero
+func addCapacity(total *int, capacity *int) *int {
+	if capacity == nil {
+		return total
+	}
+	sum := *capacity
+	if total != nil {
+		sum += *total
+	}
+	return &sum
+}
+
+// sellThrough is sold as a percentage of capacity, rounded to two decimals
+func sellThrough(sold int, capacity *int) *float64 {
+	if capacity == nil || *capacity <= 0 {
+		return nil
+	}
+	percent := math.Round(float64(sold)*10000/float64(*capacity)) / 100
+	return &percent
+}
+
+func csvInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+func csvPercent(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', 2, 64)
+}
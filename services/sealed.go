@@ -0,0 +1,61 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var errSealedTooShort = errors.New("sealed value too short")
+
+// sealingKey derives an AES-256 key for one purpose from a server secret, so
+// each kind of stored secret is wrapped with its own key
+func sealingKey(purpose string, secret string) []byte {
+	key := sha256.Sum256([]byte(purpose + ":" + secret))
+	return key[:]
+}
+
+// sealSecret encrypts plaintext with AES-GCM under key, returning base64 of
+// the nonce followed by the ciphertext
+func sealSecret(key []byte, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a value produced by sealSecret with the same key
+func openSecret(key []byte, sealed string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errSealedTooShort
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/ledger"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+var ErrSettlementPeriodOpen = errors.New("SETTLEMENT_PERIOD_OPEN")
+
+// errNothingToSettle rolls back a statement that claimed no orders or refunds
+var errNothingToSettle = errors.New("nothing to settle")
+
+const (
+	settlementDefaultLimit = 50
+	settlementMaxLimit     = 200
+)
+
+// SettlementService produces organizer payout statements from the ledger. Each
+// statement claims the orders placed in its period and any refunds issued
+// since the organizer's last statement, so every sale and refund is paid out
+// exactly once; a refund of an order settled earlier is deducted from the next
+// statement.
+type SettlementService struct {
+	db             *db.DB
+	settlementRepo *repositories.SettlementRepository
+	audit          *AuditService
+}
+
+func NewSettlementService(
+	db *db.DB,
+	settlementRepo *repositories.SettlementRepository,
+	audit *AuditService,
+) *SettlementService {
+	return &SettlementService{
+		db:             db,
+		settlementRepo: settlementRepo,
+		audit:          audit,
+	}
+}
+
+// Run settles [start, end) for one organizer, or for every organizer with
+// something to settle when organizerID is 0. It returns the statements created
+// and how many orders were skipped because their event has no organizer.
+func (s *SettlementService) Run(start time.Time, end time.Time, organizerID int, createdBy int, actor *models.AuditActor) ([]*models.Settlement, int, error) {
+	if end.After(time.Now()) {
+		return nil, 0, ErrSettlementPeriodOpen
+	}
+
+	organizerIDs := []int{organizerID}
+	if organizerID == 0 {
+		var err error
+		if organizerIDs, err = s.settlementRepo.ListUnsettledOrganizers(start, end); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	settlements := []*models.Settlement{}
+	for _, id := range organizerIDs {
+		settlement, err := s.settle(start, end, id, createdBy, actor)
+		if err == errNothingToSettle {
+			continue
+		}
+		if err != nil {
+			return settlements, 0, fmt.Errorf("settle organizer %d: %w", id, err)
+		}
+		settlements = append(settlements, settlement)
+	}
+
+	unassigned, err := s.settlementRepo.CountUnassignedOrders(start, end)
+	if err != nil {
+		return settlements, 0, err
+	}
+
+	return settlements, unassigned, nil
+}
+
+// settle builds one organizer's statement in its own transaction. Claiming
+// only rows whose settlement_id is still NULL is what stops two runs from
+// settling the same order: the second run waits on the first one's row locks
+// and then finds nothing left to claim.
+func (s *SettlementService) settle(start time.Time, end time.Time, organizerID int, createdBy int, actor *models.AuditActor) (*models.Settlement, error) {
+	settlement := &models.Settlement{
+		OrganizerID: organizerID,
+		PeriodStart: start.UTC(),
+		PeriodEnd:   end.UTC(),
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		id, err := s.settlementRepo.CreateSettlement(tx, settlement)
+		if err != nil {
+			return err
+		}
+		settlement.ID = int(id)
+		settlement.Reference = fmt.Sprintf("STL-%s-%06d", settlement.PeriodEnd.Format("20060102"), settlement.ID)
+
+		orders, err := s.settlementRepo.ClaimOrders(tx, settlement.ID, organizerID, start, end)
+		if err != nil {
+			return err
+		}
+		refunds, err := s.settlementRepo.ClaimRefunds(tx, settlement.ID, organizerID, end)
+		if err != nil {
+			return err
+		}
+		if orders == 0 && refunds == 0 {
+			return errNothingToSettle
+		}
+		settlement.OrderCount = int(orders)
+		settlement.RefundCount = int(refunds)
+
+		lines, err := s.settlementRepo.SumClaimed(tx, settlement.ID)
+		if err != nil {
+			return err
+		}
+
+		var gross, refunded, fees, tax, net ledger.Amount
+		for _, line := range lines {
+			if err := s.settlementRepo.CreateLine(tx, line); err != nil {
+				return err
+			}
+			gross += ledger.FromFloat(line.GrossSales)
+			refunded += ledger.FromFloat(line.Refunds)
+			fees += ledger.FromFloat(line.PlatformFees)
+			tax += ledger.FromFloat(line.Tax)
+			net += ledger.FromFloat(line.NetPayout)
+		}
+		settlement.GrossSales = gross.Float()
+		settlement.Refunds = refunded.Float()
+		settlement.PlatformFees = fees.Float()
+		settlement.Tax = tax.Float()
+		settlement.NetPayout = net.Float()
+		settlement.Lines = lines
+
+		if err := s.settlementRepo.FinalizeSettlement(tx, settlement); err != nil {
+			return err
+		}
+
+		return s.audit.Record(tx, actor, AuditSettlementCreated, AuditEntitySettlement, settlement.ID, nil, settlement)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return settlement, nil
+}
+
+// Get returns a settlement with its per-event lines
+func (s *SettlementService) Get(id int) (*models.Settlement, error) {
+	return s.settlementRepo.GetSettlement(id)
+}
+
+// List returns matching settlements, newest first, clamping the page size
+func (s *SettlementService) List(filter *repositories.SettlementFilter) ([]*models.Settlement, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = settlementDefaultLimit
+	}
+	if filter.Limit > settlementMaxLimit {
+		filter.Limit = settlementMaxLimit
+	}
+	return s.settlementRepo.ListSettlements(filter)
+}
+
+// StatementCSV renders a settlement as a payout statement: one row per event
+// followed by a TOTAL row
+func (s *SettlementService) StatementCSV(settlement *models.Settlement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := []string{
+		"settlement_reference", "organizer_id", "organizer_name", "period_start", "period_end",
+		"event_id", "event_title", "orders", "refunds_issued",
+		"gross_sales", "refunds", "platform_fees", "tax", "net_payout",
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	row := func(eventID string, eventTitle string, orders int, refundsIssued int, gross, refunds, fees, tax, net float64) []string {
+		return []string{
+			settlement.Reference,
+			strconv.Itoa(settlement.OrganizerID),
+			settlement.OrganizerName,
+			settlement.PeriodStart.UTC().Format(time.RFC3339),
+			settlement.PeriodEnd.UTC().Format(time.RFC3339),
+			eventID,
+			eventTitle,
+			strconv.Itoa(orders),
+			strconv.Itoa(refundsIssued),
+			ledger.FromFloat(gross).String(),
+			ledger.FromFloat(refunds).String(),
+			ledger.FromFloat(fees).String(),
+			ledger.FromFloat(tax).String(),
+			ledger.FromFloat(net).String(),
+		}
+	}
+
+	for _, line := range settlement.Lines {
+		record := row(strconv.Itoa(line.EventID), line.EventTitle, line.OrderCount, line.RefundCount,
+			line.GrossSales, line.Refunds, line.PlatformFees, line.Tax, line.NetPayout)
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	total := row("", "TOTAL", settlement.OrderCount, settlement.RefundCount,
+		settlement.GrossSales, settlement.Refunds, settlement.PlatformFees, settlement.Tax, settlement.NetPayout)
+	if err := w.Write(total); err != nil {
+		return nil, err
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
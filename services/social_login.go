@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+const (
+	oidcAuthRequestTTL = 10 * time.Minute
+	usernameMaxLength  = 45
+)
+
+var (
+	ErrInvalidOIDCState     = errors.New("INVALID_OIDC_STATE")
+	ErrOIDCEmailNotVerified = errors.New("OIDC_EMAIL_NOT_VERIFIED")
+)
+
+// SocialLoginService signs users in through external OpenID Connect providers.
+// An external identity is linked to the user with the same verified email, or
+// a new user is created on first login.
+type SocialLoginService struct {
+	db           *db.DB
+	providers    map[string]*OIDCProvider
+	userRepo     *repositories.UserRepository
+	identityRepo *repositories.IdentityRepository
+	sessionRepo  *repositories.SessionRepository
+	mfa          *MFAService
+}
+
+func NewSocialLoginService(
+	db *db.DB,
+	providers []*OIDCProvider,
+	userRepo *repositories.UserRepository,
+	identityRepo *repositories.IdentityRepository,
+	sessionRepo *repositories.SessionRepository,
+	mfa *MFAService,
+) *SocialLoginService {
+	byName := make(map[string]*OIDCProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &SocialLoginService{
+		db:           db,
+		providers:    byName,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		sessionRepo:  sessionRepo,
+		mfa:          mfa,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *SocialLoginService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Authorize starts a login: it stores a PKCE verifier and nonce under a random
+// state and returns the provider URL to send the browser to
+func (s *SocialLoginService) Authorize(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrOIDCProviderNotFound
+	}
+
+	state, err := randomURLToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLToken()
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	if err := s.identityRepo.DeleteExpiredAuthRequests(now); err != nil {
+		log.Printf("failed to delete expired oidc auth requests: %v", err)
+	}
+	err = s.identityRepo.CreateAuthRequest(&models.OIDCAuthRequest{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		RedirectURI:  provider.config.RedirectURL,
+		ExpiresAt:    now.Add(oidcAuthRequestTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// Callback finishes a login with the code and state the provider redirected
+// back with. The result is a session, or an MFA challenge for accounts that use
+// or require a second factor.
+func (s *SocialLoginService) Callback(ctx context.Context, providerName string, code string, state string, userAgent string, ipAddress string) (*LoginResult, *models.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrOIDCProviderNotFound
+	}
+
+	var request *models.OIDCAuthRequest
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		var err error
+		request, err = s.identityRepo.ConsumeAuthRequest(tx, hashToken(state), time.Now().UTC())
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidOIDCState
+			}
+			return err
+		}
+		if request.Provider != providerName {
+			return ErrInvalidOIDCState
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, request.CodeVerifier, request.RedirectURI)
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, request.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.resolveUser(providerName, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.mfa.StartLogin(user, userAgent, ipAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, user, nil
+}
+
+// resolveUser finds the user linked to the external identity, links it to the
+// user with the same verified email, or creates a new user
+func (s *SocialLoginService) resolveUser(providerName string, claims *IDTokenClaims) (*models.User, error) {
+	now := time.Now().UTC()
+
+	identity, err := s.identityRepo.GetIdentity(providerName, claims.Subject)
+	if err == nil {
+		if err := s.identityRepo.TouchIdentity(identity.ID, claims.Email, now); err != nil {
+			return nil, err
+		}
+		return s.userRepo.GetUserByID(identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	existing, err := s.userRepo.GetUserByEmail(claims.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var userID int
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		if existing != nil {
+			userID = existing.ID
+			if existing.EmailVerifiedAt == nil {
+				// Whoever registered this address never proved they own it, while the
+				// provider has. Take the account away from them: verify the email,
+				// drop the unproven password and end their sessions.
+				if err := s.userRepo.MarkEmailVerified(tx, userID, now); err != nil {
+					return err
+				}
+				if err := s.userRepo.UpdatePassword(tx, userID, unusablePassword()); err != nil {
+					return err
+				}
+				if _, err := s.sessionRepo.RevokeAllSessions(tx, userID, repositories.SessionRevokedAccountLinked, now); err != nil {
+					return err
+				}
+			}
+		} else {
+			username, err := s.generateUsername(claims.Email)
+			if err != nil {
+				return err
+			}
+			firstName, lastName := namesFromClaims(claims)
+
+			id, err := s.userRepo.CreateVerifiedUser(tx, &models.User{
+				Username:       username,
+				FirstName:      firstName,
+				LastName:       lastName,
+				Email:          claims.Email,
+				HashedPassword: unusablePassword(),
+			}, now)
+			if err != nil {
+				return err
+			}
+			userID = int(id)
+		}
+
+		return s.identityRepo.CreateIdentity(tx, &models.UserIdentity{
+			UserID:      userID,
+			Provider:    providerName,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: &now,
+		})
+	})
+	if err != nil {
+		// A concurrent first login with the same identity or email won the race
+		if isUniqueConstraintError(err) {
+			if identity, err := s.identityRepo.GetIdentity(providerName, claims.Subject); err == nil {
+				return s.userRepo.GetUserByID(identity.UserID)
+			}
+		}
+		return nil, err
+	}
+
+	return s.userRepo.GetUserByID(userID)
+}
+
+// generateUsername derives a username from the email's local part, adding a
+// random suffix until it is not taken
+func (s *SocialLoginService) generateUsername(email string) (string, error) {
+	local := email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		local = email[:at]
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(local) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	base := strings.Trim(b.String(), "._")
+	if base == "" {
+		base = "user"
+	}
+	base = clipRunes(base, usernameMaxLength-4)
+
+	candidate := base
+	for attempt := 0; attempt < 10; attempt++ {
+		taken, err := s.userRepo.UsernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, suffix.Int64())
+	}
+
+	return "", fmt.Errorf("could not generate a free username for %q", base)
+}
+
+// namesFromClaims splits the provider's name claims into the required first
+// and last name columns
+func namesFromClaims(claims *IDTokenClaims) (string, string) {
+	first := strings.TrimSpace(claims.GivenName)
+	last := strings.TrimSpace(claims.FamilyName)
+
+	if first == "" && last == "" && strings.TrimSpace(claims.Name) != "" {
+		parts := strings.Fields(claims.Name)
+		first = parts[0]
+		last = strings.Join(parts[1:], " ")
+	}
+	if first == "" {
+		first = claims.Email
+		if at := strings.Index(first, "@"); at >= 0 {
+			first = first[:at]
+		}
+	}
+
+	return clipRunes(first, 45), clipRunes(last, 45)
+}
+
+// clipRunes shortens value to at most max runes, without an ellipsis
+func clipRunes(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return string(runes[:max])
+}
+
+// unusablePassword returns a value no password hashes to; users created through
+// a provider can set a password later with the password reset flow
+func unusablePassword() string {
+	return "!" + rand.Text()
+}
+
+// hasUsablePassword is false for users created through a provider, and for
+// deleted users
+func hasUsablePassword(user *models.User) bool {
+	return !strings.HasPrefix(user.HashedPassword, "!")
+}
+
+func randomURLToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
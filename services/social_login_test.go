@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ticketbooth-backend/models"
+	"ticketbooth-backend/repositories"
+)
+
+var (
+	identityColumns = []string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}
+	userColumns     = []string{"id", "username", "name", "last_name", "email", "hashed_password", "email_verified_at", "date_created", "date_updated"}
+)
+
+func newTestSocialLogin(t *testing.T, stub *stubOIDCProvider) (*SocialLoginService, *stubSQL) {
+	t.Helper()
+
+	sqlStub, database := newStubSQL(t)
+	var providers []*OIDCProvider
+	if stub != nil {
+		providers = append(providers, stub.relyingParty())
+	}
+	service := NewSocialLoginService(
+		database,
+		providers,
+		repositories.NewUserRepository(database),
+		repositories.NewIdentityRepository(database),
+		repositories.NewSessionRepository(database),
+		nil,
+	)
+	return service, sqlStub
+}
+
+func userRow(id int64, email string, verifiedAt interface{}) []driver.Value {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []driver.Value{id, "bob", "Bob", "Example", email, "$2a$10$existing", verifiedAt, created, created}
+}
+
+func verifiedClaims() *IDTokenClaims {
+	return &IDTokenClaims{Subject: "user-123", Email: "bob@example.com", EmailVerified: true, Name: "Bob Example"}
+}
+
+func TestSocialLoginAuthorizeStoresPKCEVerifier(t *testing.T) {
+	stub := newStubOIDCProvider(t)
+	service, sqlStub := newTestSocialLogin(t, stub)
+	sqlStub.onExec("DELETE FROM oidc_auth_request", 0, 0)
+	sqlStub.onExec("INSERT INTO oidc_auth_request", 1, 1)
+
+	authURL, state, err := service.Authorize(context.Background(), "stub")
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	stored := sqlStub.ran("INSERT INTO oidc_auth_request")
+	if len(stored) != 1 {
+		t.Fatalf("stored %d auth requests, want 1", len(stored))
+	}
+	// state_hash, provider, code_verifier, nonce, redirect_uri, expires_at
+	args := stored[0].Args
+	verifier, nonce := args[2].(string), args[3].(string)
+	if args[0] != hashToken(state) {
+		t.Errorf("stored state hash %v, want the hash of the returned state", args[0])
+	}
+	if args[4] != stubRedirectURL {
+		t.Errorf("stored redirect URI %v", args[4])
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Query().Get("state") != state || parsed.Query().Get("nonce") != nonce {
+		t.Errorf("authorization URL %s does not carry the stored state and nonce", authURL)
+	}
+	if parsed.Query().Get("code_challenge") != pkceChallenge(verifier) {
+		t.Errorf("code_challenge is not derived from the stored verifier")
+	}
+
+	// Only the stored verifier redeems the code
+	idToken := stub.sign(t, "RS256", "rsa-1", stub.rsaKey, stub.claims(nonce))
+	provider := service.providers["stub"]
+	code := stub.authorize(t, authURL, idToken)
+	if _, err := provider.Exchange(context.Background(), code, verifier+"x", stubRedirectURL); !errors.Is(err, ErrOIDCExchangeFailed) {
+		t.Fatalf("Exchange with another verifier: %v, want ErrOIDCExchangeFailed", err)
+	}
+	code = stub.authorize(t, authURL, idToken)
+	raw, err := provider.Exchange(context.Background(), code, verifier, stubRedirectURL)
+	if err != nil {
+		t.Fatalf("Exchange with the stored verifier: %v", err)
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), raw, nonce); err != nil {
+		t.Fatalf("VerifyIDToken with the stored nonce: %v", err)
+	}
+}
+
+func TestResolveUserRefusesUnverifiedEmail(t *testing.T) {
+	for name, claims := range map[string]*IDTokenClaims{
+		"unverified": {Subject: "user-123", Email: "bob@example.com", EmailVerified: false},
+		"no email":   {Subject: "user-123", EmailVerified: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service, sqlStub := newTestSocialLogin(t, nil)
+			sqlStub.onQuery("FROM user_identity", identityColumns)
+			sqlStub.onQuery("FROM `user` WHERE email = ?", userColumns, userRow(7, "bob@example.com", time.Now()))
+
+			if _, err := service.resolveUser("stub", claims); !errors.Is(err, ErrOIDCEmailNotVerified) {
+				t.Fatalf("resolveUser: %v, want ErrOIDCEmailNotVerified", err)
+			}
+			if len(sqlStub.ran("WHERE email = ?")) != 0 || len(sqlStub.ran("BEGIN")) != 0 {
+				t.Errorf("an unverified email was matched against existing accounts")
+			}
+		})
+	}
+}
+
+func TestResolveUserLinksVerifiedEmailToVerifiedAccount(t *testing.T) {
+	service, sqlStub := newTestSocialLogin(t, nil)
+	sqlStub.onQuery("FROM user_identity", identityColumns)
+	sqlStub.onQuery("FROM `user` WHERE email = ?", userColumns, userRow(7, "bob@example.com", time.Now()))
+	sqlStub.onExec("INSERT INTO user_identity", 3, 1)
+	sqlStub.onQuery("FROM `user` WHERE id = ?", userColumns, userRow(7, "bob@example.com", time.Now()))
+
+	user, err := service.resolveUser("stub", verifiedClaims())
+	if err != nil {
+		t.Fatalf("resolveUser: %v", err)
+	}
+	if user.ID != 7 {
+		t.Errorf("resolved user %d, want the existing account 7", user.ID)
+	}
+
+	linked := sqlStub.ran("INSERT INTO user_identity")
+	if len(linked) != 1 || linked[0].Args[0] != int64(7) || linked[0].Args[1] != "stub" || linked[0].Args[2] != "user-123" {
+		t.Fatalf("identity inserts %v, want one linking user 7 to stub/user-123", linked)
+	}
+	if len(sqlStub.ran("SET hashed_password")) != 0 || len(sqlStub.ran("UPDATE user_session")) != 0 {
+		t.Errorf("linking a verified account changed its password or sessions")
+	}
+	if len(sqlStub.ran("COMMIT")) != 1 {
+		t.Errorf("link was not committed")
+	}
+}
+
+func TestResolveUserTakesOverUnverifiedAccount(t *testing.T) {
+	service, sqlStub := newTestSocialLogin(t, nil)
+	sqlStub.onQuery("FROM user_identity", identityColumns)
+	sqlStub.onQuery("FROM `user` WHERE email = ?", userColumns, userRow(7, "bob@example.com", nil))
+	sqlStub.onExec("SET email_verified_at", 0, 1)
+	sqlStub.onExec("SET hashed_password", 0, 1)
+	sqlStub.onExec("UPDATE user_session SET revoked_at", 0, 2)
+	sqlStub.onExec("INSERT INTO user_identity", 3, 1)
+	sqlStub.onQuery("FROM `user` WHERE id = ?", userColumns, userRow(7, "bob@example.com", time.Now()))
+
+	if _, err := service.resolveUser("stub", verifiedClaims()); err != nil {
+		t.Fatalf("resolveUser: %v", err)
+	}
+
+	steps := []string{"BEGIN", "SET email_verified_at", "SET hashed_password", "UPDATE user_session", "INSERT INTO user_identity", "COMMIT"}
+	var order []string
+	for _, statement := range sqlStub.statements {
+		for _, step := range steps {
+			if strings.Contains(statement.Query, step) {
+				order = append(order, step)
+			}
+		}
+	}
+	if strings.Join(order, ", ") != strings.Join(steps, ", ") {
+		t.Fatalf("statements ran in order %v, want %v", order, steps)
+	}
+
+	password := sqlStub.ran("SET hashed_password")[0].Args[0].(string)
+	if hasUsablePassword(&models.User{HashedPassword: password}) {
+		t.Errorf("unproven password was replaced with usable %q", password)
+	}
+	if reason := sqlStub.ran("UPDATE user_session")[0].Args[1]; reason != repositories.SessionRevokedAccountLinked {
+		t.Errorf("sessions revoked with reason %v", reason)
+	}
+}
+
+func TestResolveUserTouchesKnownIdentity(t *testing.T) {
+	service, sqlStub := newTestSocialLogin(t, nil)
+	sqlStub.onQuery("FROM user_identity", identityColumns,
+		[]driver.Value{int64(3), int64(7), "stub", "user-123", "old@example.com", time.Now(), nil})
+	sqlStub.onExec("UPDATE user_identity SET email", 0, 1)
+	sqlStub.onQuery("FROM `user` WHERE id = ?", userColumns, userRow(7, "bob@example.com", time.Now()))
+
+	// The provider's email is not trusted for lookups once the identity is known
+	claims := verifiedClaims()
+	claims.EmailVerified = false
+	user, err := service.resolveUser("stub", claims)
+	if err != nil {
+		t.Fatalf("resolveUser: %v", err)
+	}
+	if user.ID != 7 {
+		t.Errorf("resolved user %d, want 7", user.ID)
+	}
+	if touched := sqlStub.ran("UPDATE user_identity SET email"); len(touched) != 1 || touched[0].Args[0] != "bob@example.com" {
+		t.Errorf("identity updates %v", touched)
+	}
+	if len(sqlStub.ran("WHERE email = ?")) != 0 || len(sqlStub.ran("INSERT")) != 0 {
+		t.Errorf("a known identity was linked again")
+	}
+}
+
+func TestResolveUserCreatesAccountForNewEmail(t *testing.T) {
+	service, sqlStub := newTestSocialLogin(t, nil)
+	sqlStub.onQuery("FROM user_identity", identityColumns)
+	sqlStub.onQuery("FROM `user` WHERE email = ?", userColumns)
+	sqlStub.onQuery("SELECT COUNT(*) FROM `user` WHERE username", []string{"count"}, []driver.Value{int64(0)})
+	sqlStub.onExec("INSERT INTO `user`", 42, 1)
+	sqlStub.onExec("INSERT INTO user_identity", 3, 1)
+	sqlStub.onQuery("FROM `user` WHERE id = ?", userColumns, userRow(42, "bob@example.com", time.Now()))
+
+	user, err := service.resolveUser("stub", verifiedClaims())
+	if err != nil {
+		t.Fatalf("resolveUser: %v", err)
+	}
+	if user.ID != 42 {
+		t.Errorf("resolved user %d, want the new account 42", user.ID)
+	}
+
+	created := sqlStub.ran("INSERT INTO `user`")
+	if len(created) != 1 {
+		t.Fatalf("created %d users, want 1", len(created))
+	}
+	// username, name, last_name, email, hashed_password, email_verified_at
+	if created[0].Args[0] != "bob" || created[0].Args[1] != "Bob" || created[0].Args[2] != "Example" || created[0].Args[3] != "bob@example.com" {
+		t.Errorf("created user with %v", created[0].Args)
+	}
+	if linked := sqlStub.ran("INSERT INTO user_identity"); len(linked) != 1 || linked[0].Args[0] != int64(42) {
+		t.Errorf("identity inserts %v, want one for user 42", linked)
+	}
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"ticketbooth-backend/db"
+)
+
+// stubSQL is a database/sql driver for tests that need no real database. Each
+// statement is answered by the first scripted reply whose fragment it
+// contains, and every statement is recorded so tests can assert what ran.
+// Statements with no scripted reply fail the call.
+type stubSQL struct {
+	mu         sync.Mutex
+	replies    []*stubReply
+	statements []stubStatement
+}
+
+type stubReply struct {
+	fragment     string
+	columns      []string
+	rows         [][]driver.Value
+	lastInsertID int64
+	rowsAffected int64
+	err          error
+}
+
+// stubStatement is one statement run against the stub; BEGIN, COMMIT and
+// ROLLBACK are recorded as statements too
+type stubStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+var (
+	stubSQLMu        sync.Mutex
+	stubSQLDatabases = make(map[string]*stubSQL)
+)
+
+func init() {
+	sql.Register("stubsql", stubSQLDriver{})
+}
+
+// newStubSQL returns a stub and a *db.DB whose statements it answers
+func newStubSQL(t *testing.T) (*stubSQL, *db.DB) {
+	t.Helper()
+
+	stub := &stubSQL{}
+	name := t.Name()
+	stubSQLMu.Lock()
+	stubSQLDatabases[name] = stub
+	stubSQLMu.Unlock()
+
+	conn, err := sql.Open("stubsql", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		stubSQLMu.Lock()
+		delete(stubSQLDatabases, name)
+		stubSQLMu.Unlock()
+	})
+
+	return stub, db.New(sqlx.NewDb(conn, "mysql"))
+}
+
+// onQuery answers queries containing fragment with rows; no rows makes
+// QueryRow return sql.ErrNoRows
+func (s *stubSQL) onQuery(fragment string, columns []string, rows ...[]driver.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, &stubReply{fragment: fragment, columns: columns, rows: rows})
+}
+
+// onExec answers statements containing fragment with a result
+func (s *stubSQL) onExec(fragment string, lastInsertID int64, rowsAffected int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, &stubReply{fragment: fragment, lastInsertID: lastInsertID, rowsAffected: rowsAffected})
+}
+
+// ran returns the statements containing fragment, in the order they ran
+func (s *stubSQL) ran(fragment string) []stubStatement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []stubStatement
+	for _, statement := range s.statements {
+		if strings.Contains(statement.Query, fragment) {
+			matched = append(matched, statement)
+		}
+	}
+	return matched
+}
+
+func (s *stubSQL) record(query string, args []driver.Value) *stubReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statements = append(s.statements, stubStatement{Query: query, Args: args})
+	for _, reply := range s.replies {
+		if strings.Contains(query, reply.fragment) {
+			return reply
+		}
+	}
+	return &stubReply{err: fmt.Errorf("stubsql: unexpected statement %q", strings.Join(strings.Fields(query), " "))}
+}
+
+type stubSQLDriver struct{}
+
+func (stubSQLDriver) Open(name string) (driver.Conn, error) {
+	stubSQLMu.Lock()
+	defer stubSQLMu.Unlock()
+
+	stub, ok := stubSQLDatabases[name]
+	if !ok {
+		return nil, fmt.Errorf("stubsql: unknown database %q", name)
+	}
+	return &stubSQLConn{stub: stub}, nil
+}
+
+type stubSQLConn struct {
+	stub *stubSQL
+}
+
+func (c *stubSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubSQLStmt{stub: c.stub, query: query}, nil
+}
+
+func (c *stubSQLConn) Close() error {
+	return nil
+}
+
+func (c *stubSQLConn) Begin() (driver.Tx, error) {
+	c.stub.mu.Lock()
+	defer c.stub.mu.Unlock()
+	c.stub.statements = append(c.stub.statements, stubStatement{Query: "BEGIN"})
+	return &stubSQLTx{stub: c.stub}, nil
+}
+
+type stubSQLTx struct {
+	stub *stubSQL
+}
+
+func (t *stubSQLTx) Commit() error {
+	t.stub.mu.Lock()
+	defer t.stub.mu.Unlock()
+	t.stub.statements = append(t.stub.statements, stubStatement{Query: "COMMIT"})
+	return nil
+}
+
+func (t *stubSQLTx) Rollback() error {
+	t.stub.mu.Lock()
+	defer t.stub.mu.Unlock()
+	t.stub.statements = append(t.stub.statements, stubStatement{Query: "ROLLBACK"})
+	return nil
+}
+
+type stubSQLStmt struct {
+	stub  *stubSQL
+	query string
+}
+
+func (s *stubSQLStmt) Close() error {
+	return nil
+}
+
+func (s *stubSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *stubSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	reply := s.stub.record(s.query, args)
+	if reply.err != nil {
+		return nil, reply.err
+	}
+	return stubSQLResult{lastInsertID: reply.lastInsertID, rowsAffected: reply.rowsAffected}, nil
+}
+
+func (s *stubSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	reply := s.stub.record(s.query, args)
+	if reply.err != nil {
+		return nil, reply.err
+	}
+	return &stubSQLRows{columns: reply.columns, rows: reply.rows}, nil
+}
+
+type stubSQLResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r stubSQLResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r stubSQLResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type stubSQLRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *stubSQLRows) Columns() []string {
+	return r.columns
+}
+
+func (r *stubSQLRows) Close() error {
+	return nil
+}
+
+func (r *stubSQLRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"ticketbooth-backend/models"
+)
+
+var ErrWalletNotConfigured = errors.New("WALLET_NOT_CONFIGURED")
+
+// googleWalletSaveURL is the prefix for "Add to Google Wallet" links
+const googleWalletSaveURL = "https://pay.google.com/gp/v/save/"
+
+// AppleWalletConfig holds the Pass Type ID certificate used to sign .pkpass bundles
+type AppleWalletConfig struct {
+	PassTypeID       string
+	TeamID           string
+	OrganizationName string
+	Certificate      *x509.Certificate
+	PrivateKey       crypto.PrivateKey
+	// WWDR is Apple's intermediate certificate, embedded in every signature
+	WWDR *x509.Certificate
+}
+
+// GoogleWalletConfig holds the issuer and service account used to sign save links
+type GoogleWalletConfig struct {
+	IssuerID         string
+	ServiceAccount   string
+	PrivateKey       *rsa.PrivateKey
+	OrganizationName string
+}
+
+// WalletPass is a rendered pass ready to be sent to the client
+type WalletPass struct {
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// GoogleWalletPass is a signed Google Wallet save link and the object it creates
+type GoogleWalletPass struct {
+	SaveURL string          `json:"saveUrl"`
+	JWT     string          `json:"jwt"`
+	Object  json.RawMessage `json:"object"`
+}
+
+// ticketCredentialIssuer signs the credential carried by a pass's barcode
+type ticketCredentialIssuer interface {
+	IssueForTicket(ticket *models.Ticket) (string, error)
+}
+
+// WalletService exports tickets as Apple Wallet and Google Wallet passes.
+// Either platform may be left unconfigured; its export then fails with
+// ErrWalletNotConfigured.
+type WalletService struct {
+	credentials ticketCredentialIssuer
+	apple       *AppleWalletConfig
+	google      *GoogleWalletConfig
+}
+
+func NewWalletService(credentials *CredentialService, apple *AppleWalletConfig, google *GoogleWalletConfig) *WalletService {
+	return &WalletService{
+		credentials: credentials,
+		apple:       apple,
+		google:      google,
+	}
+}
+
+// LoadAppleWalletConfig reads the signing certificate, key and WWDR certificate from PEM files
+func LoadAppleWalletConfig(passTypeID, teamID, organizationName, certPath, keyPath, wwdrPath string) (*AppleWalletConfig, error) {
+	cert, err := readCertificate(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("apple pass certificate: %w", err)
+	}
+	wwdr, err := readCertificate(wwdrPath)
+	if err != nil {
+		return nil, fmt.Errorf("apple WWDR certificate: %w", err)
+	}
+	key, err := readPrivateKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("apple pass key: %w", err)
+	}
+
+	return &AppleWalletConfig{
+		PassTypeID:       passTypeID,
+		TeamID:           teamID,
+		OrganizationName: organizationName,
+		Certificate:      cert,
+		PrivateKey:       key,
+		WWDR:             wwdr,
+	}, nil
+}
+
+// LoadGoogleWalletConfig reads a Google Cloud service account key file
+func LoadGoogleWalletConfig(issuerID, organizationName, serviceAccountPath string) (*GoogleWalletConfig, error) {
+	data, err := os.ReadFile(serviceAccountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("google service account: %w", err)
+	}
+
+	key, err := parsePrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("google service account: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("google service account: private key is not RSA")
+	}
+
+	return &GoogleWalletConfig{
+		IssuerID:         issuerID,
+		ServiceAccount:   account.ClientEmail,
+		PrivateKey:       rsaKey,
+		OrganizationName: organizationName,
+	}, nil
+}
+
+// ApplePass builds a signed .pkpass bundle for a loaded ticket
+func (s *WalletService) ApplePass(ticket *models.Ticket) (*WalletPass, error) {
+	if s.apple == nil {
+		return nil, ErrWalletNotConfigured
+	}
+
+	credential, err := s.credentials.IssueForTicket(ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	passJSON, err := json.Marshal(s.applePassFields(ticket, credential))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{"pass.json": passJSON}
+	for name, size := range map[string]int{"icon.png": 29, "icon@2x.png": 58, "icon@3x.png": 87} {
+		icon, err := renderPassIcon(size)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = icon
+	}
+
+	manifest := make(map[string]string, len(files))
+	for name, data := range files {
+		sum := sha1.Sum(data)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.signManifest(manifestJSON)
+	if err != nil {
+		return nil, err
+	}
+	files["manifest.json"] = manifestJSON
+	files["signature"] = signature
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range []string{"pass.json", "icon.png", "icon@2x.png", "icon@3x.png", "manifest.json", "signature"} {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return &WalletPass{
+		ContentType: "application/vnd.apple.pkpass",
+		Filename:    fmt.Sprintf("ticket-%d.pkpass", ticket.ID),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+func (s *WalletService) applePassFields(ticket *models.Ticket, credential string) map[string]interface{} {
+	title := "Ticket"
+	if ticket.Event != nil {
+		title = ticket.Event.Title
+	}
+
+	primary := []map[string]string{{"key": "event", "label": "EVENT", "value": title}}
+	secondary := []map[string]string{}
+	auxiliary := []map[string]string{}
+
+	if ticket.EventDate != nil && ticket.EventDate.Venue != nil {
+		secondary = append(secondary, map[string]string{"key": "venue", "label": "VENUE", "value": ticket.EventDate.Venue.Name})
+	}
+	seat := ticketSeatLabel(ticket)
+	if seat == "" {
+		seat = "General admission"
+	}
+	secondary = append(secondary, map[string]string{"key": "seat", "label": "SEAT", "value": seat})
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		auxiliary = append(auxiliary, map[string]string{
+			"key":       "date",
+			"label":     "DATE",
+			"value":     ticket.EventDate.Date.Format(time.RFC3339),
+			"dateStyle": "PKDateStyleMedium",
+			"timeStyle": "PKDateStyleShort",
+		})
+	}
+	if name := ticketTypeName(ticket); name != "" {
+		auxiliary = append(auxiliary, map[string]string{"key": "type", "label": "TYPE", "value": name})
+	}
+	if ticket.ToName != "" {
+		auxiliary = append(auxiliary, map[string]string{"key": "attendee", "label": "ATTENDEE", "value": ticket.ToName})
+	}
+
+	barcode := map[string]string{
+		"format":          "PKBarcodeFormatQR",
+		"message":         credential,
+		"messageEncoding": "iso-8859-1",
+	}
+
+	pass := map[string]interface{}{
+		"formatVersion":      1,
+		"passTypeIdentifier": s.apple.PassTypeID,
+		"teamIdentifier":     s.apple.TeamID,
+		"organizationName":   s.apple.OrganizationName,
+		"serialNumber":       strconv.Itoa(ticket.ID),
+		"description":        title,
+		"barcodes":           []map[string]string{barcode},
+		"eventTicket": map[string]interface{}{
+			"primaryFields":   primary,
+			"secondaryFields": secondary,
+			"auxiliaryFields": auxiliary,
+			"backFields": []map[string]string{
+				{"key": "ticket", "label": "Ticket", "value": fmt.Sprintf("#%d", ticket.ID)},
+			},
+		},
+	}
+
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		pass["relevantDate"] = ticket.EventDate.Date.Format(time.RFC3339)
+	}
+
+	return pass
+}
+
+// signManifest produces the detached PKCS#7 signature Apple Wallet expects
+func (s *WalletService) signManifest(manifest []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(manifest)
+	if err != nil {
+		return nil, err
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	if err := signedData.AddSignerChain(s.apple.Certificate, s.apple.PrivateKey, []*x509.Certificate{s.apple.WWDR}, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	signedData.Detach()
+
+	return signedData.Finish()
+}
+
+// GooglePass builds a signed "Add to Google Wallet" link for a loaded ticket
+func (s *WalletService) GooglePass(ticket *models.Ticket) (*GoogleWalletPass, error) {
+	if s.google == nil {
+		return nil, ErrWalletNotConfigured
+	}
+	if ticket.Event == nil {
+		return nil, fmt.Errorf("ticket %d has no event loaded", ticket.ID)
+	}
+
+	credential, err := s.credentials.IssueForTicket(ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	classID := fmt.Sprintf("%s.event-%d", s.google.IssuerID, ticket.Event.ID)
+	eventClass := map[string]interface{}{
+		"id":           classID,
+		"issuerName":   s.google.OrganizationName,
+		"eventName":    localizedString(ticket.Event.Title),
+		"reviewStatus": "UNDER_REVIEW",
+	}
+	if ticket.EventDate != nil && ticket.EventDate.Venue != nil {
+		eventClass["venue"] = map[string]interface{}{
+			"name":    localizedString(ticket.EventDate.Venue.Name),
+			"address": localizedString(ticket.EventDate.Venue.Name),
+		}
+	}
+	if ticket.EventDate != nil && ticket.EventDate.Date != nil {
+		eventClass["dateTime"] = map[string]string{"start": ticket.EventDate.Date.Format(time.RFC3339)}
+	}
+
+	object := map[string]interface{}{
+		"id":      fmt.Sprintf("%s.ticket-%d", s.google.IssuerID, ticket.ID),
+		"classId": classID,
+		"state":   "ACTIVE",
+		"barcode": map[string]string{"type": "QR_CODE", "value": credential},
+	}
+	if ticket.ToName != "" {
+		object["ticketHolderName"] = ticket.ToName
+	}
+	if name := ticketTypeName(ticket); name != "" {
+		object["ticketType"] = localizedString(name)
+	}
+	if ticket.Seat != nil {
+		object["seatInfo"] = map[string]interface{}{
+			"section": localizedString(ticket.Seat.Section),
+			"row":     localizedString(ticket.Seat.Row),
+			"seat":    localizedString(ticket.Seat.Number),
+		}
+	}
+
+	objectJSON, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := signRS256(s.google.PrivateKey, map[string]interface{}{
+		"iss": s.google.ServiceAccount,
+		"aud": "google",
+		"typ": "savetowallet",
+		"iat": time.Now().Unix(),
+		"payload": map[string]interface{}{
+			"eventTicketClasses": []interface{}{eventClass},
+			"eventTicketObjects": []interface{}{object},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GoogleWalletPass{
+		SaveURL: googleWalletSaveURL + token,
+		JWT:     token,
+		Object:  objectJSON,
+	}, nil
+}
+
+func localizedString(value string) map[string]interface{} {
+	return map[string]interface{}{
+		"defaultValue": map[string]string{"language": "en-US", "value": value},
+	}
+}
+
+// signRS256 encodes claims as a compact JWT signed with RSASSA-PKCS1-v1_5 SHA-256
+func signRS256(key *rsa.PrivateKey, claims interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// renderPassIcon draws the plain square icon every pass bundle must contain
+func renderPassIcon(size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	fill := color.RGBA{R: 0x1f, G: 0x2a, B: 0x44, A: 0xff}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate found", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func readPrivateKey(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKey(data)
+}
+
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"ticketbooth-backend/models"
+)
+
+// fixedKeyIssuer signs credentials with one signing key, standing in for the
+// database-backed key lookup in CredentialService.IssueForTicket
+type fixedKeyIssuer struct {
+	credentials *CredentialService
+	key         *models.SigningKey
+}
+
+func (f *fixedKeyIssuer) IssueForTicket(ticket *models.Ticket) (string, error) {
+	return f.credentials.Issue(f.key, CredentialForTicket(ticket))
+}
+
+func newFixedKeyIssuer(t *testing.T, eventID int) (*fixedKeyIssuer, ed25519.PublicKey) {
+	t.Helper()
+
+	credentials := NewCredentialService(nil, "wallet-test-secret", nil, nil)
+	key, err := credentials.newKey(eventID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := base64.RawURLEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixedKeyIssuer{credentials: credentials, key: key}, ed25519.PublicKey(publicKey)
+}
+
+// testCertificateChain returns a throwaway root standing in for Apple's WWDR
+// certificate and a pass certificate and key it issued
+func testCertificateChain(t *testing.T) (root *x509.Certificate, cert *x509.Certificate, key *rsa.PrivateKey) {
+	t.Helper()
+
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test WWDR"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Pass Type ID: pass.test.ticketbooth"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root, cert, key
+}
+
+func testWalletTicket() *models.Ticket {
+	date := time.Date(2025, 7, 16, 20, 0, 0, 0, time.UTC)
+	return &models.Ticket{
+		ID:              1010,
+		EventDateID:     11,
+		ToName:          "Bob Example",
+		CredentialNonce: "5f1c0a9e3b7d42c8a6e1f093",
+		TicketType:      &models.TicketType{Name: "VIP"},
+		Seat:            &models.Seat{Section: "A", Row: "1", Number: "4"},
+		Event:           &models.Event{ID: 7, Title: "Rock Festival 2025"},
+		EventDate: &models.EventDate{
+			ID:    11,
+			Date:  &date,
+			Venue: &models.Venue{Name: "Arena"},
+		},
+	}
+}
+
+func TestApplePassIsSignedBundle(t *testing.T) {
+	root, cert, key := testCertificateChain(t)
+	issuer, publicKey := newFixedKeyIssuer(t, 7)
+	wallet := &WalletService{
+		credentials: issuer,
+		apple: &AppleWalletConfig{
+			PassTypeID:       "pass.test.ticketbooth",
+			TeamID:           "TEAM123456",
+			OrganizationName: "Ticketbooth",
+			Certificate:      cert,
+			PrivateKey:       key,
+			WWDR:             root,
+		},
+	}
+
+	pass, err := wallet.ApplePass(testWalletTicket())
+	if err != nil {
+		t.Fatalf("ApplePass: %v", err)
+	}
+	if pass.ContentType != "application/vnd.apple.pkpass" || pass.Filename != "ticket-1010.pkpass" {
+		t.Fatalf("unexpected pass metadata %q %q", pass.ContentType, pass.Filename)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(pass.Data), int64(len(pass.Data)))
+	if err != nil {
+		t.Fatalf("pass is not a zip archive: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, entry := range archive.File {
+		reader, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name] = data
+	}
+
+	var manifest map[string]string
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("manifest.json: %v", err)
+	}
+	for _, name := range []string{"pass.json", "icon.png", "icon@2x.png", "icon@3x.png"} {
+		data, found := files[name]
+		if !found {
+			t.Fatalf("bundle is missing %s", name)
+		}
+		sum := sha1.Sum(data)
+		if manifest[name] != hex.EncodeToString(sum[:]) {
+			t.Errorf("manifest hash for %s is %q, want %x", name, manifest[name], sum)
+		}
+	}
+	if len(manifest) != 4 {
+		t.Errorf("manifest lists %d files, want 4", len(manifest))
+	}
+
+	signature, err := pkcs7.Parse(files["signature"])
+	if err != nil {
+		t.Fatalf("signature is not PKCS#7: %v", err)
+	}
+	signature.Content = files["manifest.json"]
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	if err := signature.VerifyWithChain(roots); err != nil {
+		t.Fatalf("signature does not verify against the WWDR chain: %v", err)
+	}
+	if signer := signature.GetOnlySigner(); signer == nil || !signer.Equal(cert) {
+		t.Error("signature is not made by the pass certificate")
+	}
+
+	signature.Content = append([]byte(nil), files["manifest.json"]...)
+	signature.Content[len(signature.Content)-2] ^= 0xff
+	if err := signature.Verify(); err == nil {
+		t.Error("signature verified a tampered manifest")
+	}
+
+	var fields struct {
+		PassTypeIdentifier string `json:"passTypeIdentifier"`
+		TeamIdentifier     string `json:"teamIdentifier"`
+		SerialNumber       string `json:"serialNumber"`
+		Barcodes           []struct {
+			Format  string `json:"format"`
+			Message string `json:"message"`
+		} `json:"barcodes"`
+	}
+	if err := json.Unmarshal(files["pass.json"], &fields); err != nil {
+		t.Fatalf("pass.json: %v", err)
+	}
+	if fields.PassTypeIdentifier != "pass.test.ticketbooth" || fields.TeamIdentifier != "TEAM123456" || fields.SerialNumber != "1010" {
+		t.Errorf("unexpected pass identifiers %+v", fields)
+	}
+	if len(fields.Barcodes) != 1 || fields.Barcodes[0].Format != "PKBarcodeFormatQR" {
+		t.Fatalf("unexpected barcodes %+v", fields.Barcodes)
+	}
+	assertTicketCredential(t, fields.Barcodes[0].Message, publicKey)
+}
+
+func TestGooglePassIsSignedJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, publicKey := newFixedKeyIssuer(t, 7)
+	wallet := &WalletService{
+		credentials: issuer,
+		google: &GoogleWalletConfig{
+			IssuerID:         "3388000000012345678",
+			ServiceAccount:   "wallet@ticketbooth-test.iam.gserviceaccount.com",
+			PrivateKey:       key,
+			OrganizationName: "Ticketbooth",
+		},
+	}
+
+	before := time.Now().Unix()
+	pass, err := wallet.GooglePass(testWalletTicket())
+	if err != nil {
+		t.Fatalf("GooglePass: %v", err)
+	}
+	if pass.SaveURL != googleWalletSaveURL+pass.JWT {
+		t.Errorf("save URL %q does not carry the JWT", pass.SaveURL)
+	}
+
+	parts := strings.Split(pass.JWT, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT has %d parts", len(parts))
+	}
+
+	var header map[string]string
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		t.Fatalf("JWT header: %v", err)
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Errorf("unexpected JWT header %v", header)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("JWT signature does not verify: %v", err)
+	}
+
+	var claims struct {
+		Iss     string `json:"iss"`
+		Aud     string `json:"aud"`
+		Typ     string `json:"typ"`
+		Iat     int64  `json:"iat"`
+		Payload struct {
+			EventTicketClasses []struct {
+				ID string `json:"id"`
+			} `json:"eventTicketClasses"`
+			EventTicketObjects []struct {
+				ID      string `json:"id"`
+				ClassID string `json:"classId"`
+				State   string `json:"state"`
+				Barcode struct {
+					Type  string `json:"type"`
+					Value string `json:"value"`
+				} `json:"barcode"`
+				TicketHolderName string `json:"ticketHolderName"`
+			} `json:"eventTicketObjects"`
+		} `json:"payload"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		t.Fatalf("JWT claims: %v", err)
+	}
+
+	if claims.Iss != "wallet@ticketbooth-test.iam.gserviceaccount.com" || claims.Aud != "google" || claims.Typ != "savetowallet" {
+		t.Errorf("unexpected claims iss=%q aud=%q typ=%q", claims.Iss, claims.Aud, claims.Typ)
+	}
+	if claims.Iat < before || claims.Iat > time.Now().Unix() {
+		t.Errorf("iat %d is not the signing time", claims.Iat)
+	}
+	if len(claims.Payload.EventTicketClasses) != 1 || claims.Payload.EventTicketClasses[0].ID != "3388000000012345678.event-7" {
+		t.Fatalf("unexpected classes %+v", claims.Payload.EventTicketClasses)
+	}
+	if len(claims.Payload.EventTicketObjects) != 1 {
+		t.Fatalf("unexpected objects %+v", claims.Payload.EventTicketObjects)
+	}
+	object := claims.Payload.EventTicketObjects[0]
+	if object.ID != "3388000000012345678.ticket-1010" || object.ClassID != "3388000000012345678.event-7" || object.State != "ACTIVE" {
+		t.Errorf("unexpected object %+v", object)
+	}
+	if object.TicketHolderName != "Bob Example" || object.Barcode.Type != "QR_CODE" {
+		t.Errorf("unexpected object holder or barcode %+v", object)
+	}
+	assertTicketCredential(t, object.Barcode.Value, publicKey)
+
+	var returned struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(pass.Object, &returned); err != nil || returned.ID != object.ID {
+		t.Errorf("returned object %s does not match the signed one", pass.Object)
+	}
+}
+
+func TestWalletPassesNeedConfiguration(t *testing.T) {
+	issuer, _ := newFixedKeyIssuer(t, 7)
+	wallet := &WalletService{credentials: issuer}
+
+	if _, err := wallet.ApplePass(testWalletTicket()); !errors.Is(err, ErrWalletNotConfigured) {
+		t.Errorf("ApplePass error = %v, want ErrWalletNotConfigured", err)
+	}
+	if _, err := wallet.GooglePass(testWalletTicket()); !errors.Is(err, ErrWalletNotConfigured) {
+		t.Errorf("GooglePass error = %v, want ErrWalletNotConfigured", err)
+	}
+}
+
+// assertTicketCredential checks a pass's barcode is the ticket's signed credential
+func assertTicketCredential(t *testing.T, credential string, publicKey ed25519.PublicKey) {
+	t.Helper()
+
+	payload, err := VerifyCredential(credential, publicKey)
+	if err != nil {
+		t.Fatalf("barcode credential does not verify: %v", err)
+	}
+	if payload.TicketID != 1010 || payload.EventDateID != 11 || payload.Seat != "A14" || payload.Nonce != "5f1c0a9e3b7d42c8a6e1f093" {
+		t.Errorf("unexpected credential payload %+v", payload)
+	}
+}
@@ -0,0 +1,53 @@
+// Package timezone resolves venue time zones. Event times are stored as UTC
+// instants and shown in the IANA zone of the venue they take place at, so a
+// showtime reads the same as on the venue's own clock.
+package timezone
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	// Embedded so zones resolve on hosts without a system zoneinfo database
+	_ "time/tzdata"
+)
+
+// Default is the zone of venues that have none set
+const Default = "UTC"
+
+var locations sync.Map
+
+// Valid reports whether name is an IANA zone that Location resolves, such as
+// America/Mexico_City. Venue zones are checked with it before they are stored.
+func Valid(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// Location returns the named IANA zone. An empty or unknown name resolves to
+// UTC rather than failing, so a bad venue setting cannot break responses; the
+// fallback is logged once per name.
+func Location(name string) *time.Location {
+	if name == "" || name == Default {
+		return time.UTC
+	}
+	if cached, found := locations.Load(name); found {
+		return cached.(*time.Location)
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("timezone: unknown zone %q, showing times in UTC: %v", name, err)
+		location = time.UTC
+	}
+	locations.Store(name, location)
+	return location
+}
+
+// In returns t on the wall clock of the named zone
+func In(t time.Time, name string) time.Time {
+	return t.In(Location(name))
+}